@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 运维/GM用的内部http接口，只应该监听内网地址
+
+type AdminConf struct {
+	ListenAddr string `xml:"listen_addr" json:"listen_addr"`
+}
+
+// Validate 检查配置，把所有问题一起返回
+func (conf *AdminConf) Validate() (errs []error) {
+	if conf.ListenAddr == "" {
+		errs = append(errs, fmt.Errorf("listen_addr is required"))
+	} else if _, port, err := net.SplitHostPort(conf.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listen_addr %q: %s", conf.ListenAddr, err.Error()))
+	} else if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		errs = append(errs, fmt.Errorf("listen_addr %q: port out of range 1-65535", conf.ListenAddr))
+	}
+	return
+}
+
+type Server struct {
+	mux   *http.ServeMux
+	srv   *http.Server
+	probe probe
+}
+
+func NewServer() *Server {
+	return &Server{
+		mux: http.NewServeMux(),
+	}
+}
+
+var inst = NewServer()
+
+func GetInst() *Server {
+	return inst
+}
+
+// Handle Start前后都可以注册
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+func (s *Server) HandleFunc(pattern string, f func(http.ResponseWriter, *http.Request)) {
+	s.mux.HandleFunc(pattern, f)
+}
+
+func (s *Server) Start(conf *AdminConf) error {
+	l, err := net.Listen("tcp", conf.ListenAddr)
+	if err != nil {
+		return err
+	}
+	s.srv = &http.Server{Handler: s.mux}
+	go func() {
+		if err := s.srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Printf("admin server stopped: %s", err.Error())
+		}
+	}()
+	log.Printf("admin server listening on %s", conf.ListenAddr)
+	return nil
+}
+
+func (s *Server) Stop() {
+	if s.srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	s.srv.Shutdown(ctx)
+}
+
+// WriteJSON handler里返回json用
+func WriteJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("admin write json error: %s", err.Error())
+	}
+}
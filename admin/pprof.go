@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	rpprof "runtime/pprof"
+	"strconv"
+	"sync/atomic"
+	"test/wg"
+	"time"
+)
+
+const defaultCaptureSeconds = 30
+
+// EnablePprof 挂上net/http/pprof，另外加一个/debug/capture：
+// 后台录一段cpu profile再拍一张heap快照，存到dir下，文件名带时间戳，线上出性能问题时用
+func (s *Server) EnablePprof(dir string) {
+	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	s.mux.HandleFunc("/debug/capture", func(w http.ResponseWriter, r *http.Request) {
+		sec := defaultCaptureSeconds
+		if v := r.URL.Query().Get("seconds"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > 300 {
+				http.Error(w, "seconds must be 1-300", http.StatusBadRequest)
+				return
+			}
+			sec = n
+		}
+		files, err := s.startCapture(dir, time.Duration(sec)*time.Second)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		WriteJSON(w, files)
+	})
+}
+
+var capturing atomic.Bool
+
+// startCapture 立即返回要写的文件名，实际录制在后台进行，同一时间只允许一个
+func (s *Server) startCapture(dir string, d time.Duration) ([]string, error) {
+	if !capturing.CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("capture already running")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		capturing.Store(false)
+		return nil, err
+	}
+	tag := time.Now().Format("20060102_150405")
+	cpuPath := filepath.Join(dir, "cpu_"+tag+".pprof")
+	heapPath := filepath.Join(dir, "heap_"+tag+".pprof")
+	cpuFile, err := os.Create(cpuPath)
+	if err != nil {
+		capturing.Store(false)
+		return nil, err
+	}
+	if err = rpprof.StartCPUProfile(cpuFile); err != nil {
+		// /debug/pprof/profile正在录的话也会到这里
+		cpuFile.Close()
+		os.Remove(cpuPath)
+		capturing.Store(false)
+		return nil, err
+	}
+	go func() {
+		defer capturing.Store(false)
+		// 停服时提前结束，录到的部分照样写出来
+		wg.SleepCtx(wg.ShutdownCtx(), d)
+		rpprof.StopCPUProfile()
+		cpuFile.Close()
+		if err := writeHeap(heapPath); err != nil {
+			log.Printf("capture heap profile failed: %s", err.Error())
+			return
+		}
+		log.Printf("profile captured: %s %s", cpuPath, heapPath)
+	}()
+	return []string{cpuPath, heapPath}, nil
+}
+
+func writeHeap(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return rpprof.Lookup("heap").WriteTo(f, 0)
+}
@@ -0,0 +1,150 @@
+package admin
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 启动就绪状态机，给k8s之类的编排用：
+// /healthz 存活探针，进程活着且（开始服务以后）主循环还在转就返回200
+// /readyz  就绪探针，按顺序走完所有启动阶段、并且所有就绪检查都通过才返回200，停服开始后立刻变503
+
+// Stage 启动阶段，只能按顺序一步一步往前走（Stopping除外，任何时候都能进）
+type Stage int32
+
+const (
+	StageStarting      Stage = iota
+	StageConfigLoaded        // 配置读完并校验通过
+	StageDbConnected         // mysql连上了
+	StageCachesWarmed        // 开关、封禁表之类启动要加载的数据都加载完了
+	StageListenersOpen       // 对外端口开了，可以接流量
+	StageStopping            // 收到退出信号，正在停服
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StageStarting:
+		return "starting"
+	case StageConfigLoaded:
+		return "config_loaded"
+	case StageDbConnected:
+		return "db_connected"
+	case StageCachesWarmed:
+		return "caches_warmed"
+	case StageListenersOpen:
+		return "listeners_open"
+	case StageStopping:
+		return "stopping"
+	}
+	return fmt.Sprintf("stage(%d)", int32(s))
+}
+
+type StageRecord struct {
+	Stage string `json:"stage"`
+	At    string `json:"at"`
+}
+
+type probe struct {
+	m           sync.RWMutex
+	stage       Stage
+	history     []StageRecord
+	live        func() error
+	readyChecks map[string]func() error
+}
+
+// SetStage 推进启动阶段，跳步或者倒退会被拒绝（返回false），保证前面的依赖一定已经就绪
+func (s *Server) SetStage(stage Stage) bool {
+	s.probe.m.Lock()
+	defer s.probe.m.Unlock()
+	cur := s.probe.stage
+	if stage != StageStopping && stage != cur+1 || cur == StageStopping {
+		log.Printf("admin readiness: refuse stage %s -> %s", cur, stage)
+		return false
+	}
+	s.probe.stage = stage
+	s.probe.history = append(s.probe.history, StageRecord{Stage: stage.String(), At: time.Now().Format("2006-01-02 15:04:05.000")})
+	log.Printf("admin readiness: stage %s -> %s", cur, stage)
+	return true
+}
+
+func (s *Server) Stage() Stage {
+	s.probe.m.RLock()
+	defer s.probe.m.RUnlock()
+	return s.probe.stage
+}
+
+// SetLiveCheck /healthz在开始服务以后额外调用的检查，一般是看主循环有没有卡死
+func (s *Server) SetLiveCheck(f func() error) {
+	s.probe.m.Lock()
+	defer s.probe.m.Unlock()
+	s.probe.live = f
+}
+
+// AddReadyCheck 服务中也可能暂时不该接流量的条件（比如db熔断了），任何一个返回error /readyz就是503
+func (s *Server) AddReadyCheck(name string, f func() error) {
+	s.probe.m.Lock()
+	defer s.probe.m.Unlock()
+	if s.probe.readyChecks == nil {
+		s.probe.readyChecks = map[string]func() error{}
+	}
+	s.probe.readyChecks[name] = f
+}
+
+type probeResult struct {
+	Stage   string            `json:"stage"`
+	OK      bool              `json:"ok"`
+	Failed  map[string]string `json:"failed,omitempty"`
+	History []StageRecord     `json:"history"`
+}
+
+func (s *Server) probeSnapshot() (Stage, probeResult, func() error, map[string]func() error) {
+	s.probe.m.RLock()
+	defer s.probe.m.RUnlock()
+	checks := make(map[string]func() error, len(s.probe.readyChecks))
+	for k, v := range s.probe.readyChecks {
+		checks[k] = v
+	}
+	res := probeResult{Stage: s.probe.stage.String(), History: append([]StageRecord(nil), s.probe.history...)}
+	return s.probe.stage, res, s.probe.live, checks
+}
+
+func writeProbe(w http.ResponseWriter, res probeResult) {
+	if !res.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	WriteJSON(w, res)
+}
+
+// EnableProbes 注册/healthz和/readyz
+func (s *Server) EnableProbes() {
+	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		stage, res, live, _ := s.probeSnapshot()
+		res.OK = true
+		if stage >= StageListenersOpen && live != nil {
+			if err := live(); err != nil {
+				res.OK = false
+				res.Failed = map[string]string{"live": err.Error()}
+			}
+		}
+		writeProbe(w, res)
+	})
+	s.mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		stage, res, _, checks := s.probeSnapshot()
+		res.OK = stage == StageListenersOpen
+		if res.OK {
+			for name, f := range checks {
+				if err := f(); err != nil {
+					if res.Failed == nil {
+						res.Failed = map[string]string{}
+					}
+					res.Failed[name] = err.Error()
+					res.OK = false
+				}
+			}
+		}
+		writeProbe(w, res)
+	})
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"test/admin"
+	"test/audit"
+	"test/backup"
+	"test/db"
+	"test/discovery"
+	"test/flags"
+	"test/gateway"
+	"test/metrics"
+	"test/rank"
+	"test/timer"
+	"test/tool_gen_code/result"
+	"time"
+)
+
+func registerAdminHandlers() {
+	admin.GetInst().Handle("/flags", flags.GetInst().HTTPHandler())
+	admin.GetInst().EnablePprof("profiles")
+	admin.GetInst().HandleFunc("/timer/pending", func(w http.ResponseWriter, r *http.Request) {
+		var list []timer.PendingTrigger
+		if err := runOnLoop(func() { list = timer.GetInst().Dump() }, 3*time.Second); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		admin.WriteJSON(w, list)
+	})
+	// 最近触发过的触发器，新的在前。?name=daily_reset只看这个名字，?limit=20限制条数
+	admin.GetInst().HandleFunc("/timer/history", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		var list []timer.FiredEntry
+		if err := runOnLoop(func() { list = timer.GetInst().History(q.Get("name"), limit) }, 3*time.Second); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		admin.WriteJSON(w, list)
+	})
+	// 崩溃循环检测的状态和最近的运行记录；POST /safe-mode/clear清掉异常退出记录，下次重启按正常模式
+	admin.GetInst().HandleFunc("/safe-mode", func(w http.ResponseWriter, r *http.Request) {
+		var ret map[string]any
+		err := runOnLoop(func() {
+			ret = map[string]any{"safe_mode": inSafeMode(), "db_read_only": db.GetDbPool().ReadOnly()}
+			if runTracker != nil {
+				ret["why"] = runTracker.why
+				ret["runs"] = runTracker.state.Runs
+			}
+		}, 3*time.Second)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		admin.WriteJSON(w, ret)
+	})
+	admin.GetInst().HandleFunc("/safe-mode/clear", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		if runTracker == nil {
+			http.Error(w, "crash-loop tracking is off", http.StatusBadRequest)
+			return
+		}
+		err := runOnLoop(runTracker.clear, 3*time.Second)
+		audit.RecordRequest(r, "server.safe_mode_clear", "", nil, nil, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		admin.WriteJSON(w, map[string]string{"result": "cleared, restart to leave safe mode"})
+	})
+	admin.GetInst().HandleFunc("/timer/shards", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, timer.GetKeyed().Stats())
+	})
+	// GET看当前支持的客户端版本范围，POST ?min=1.2.0&max=1.4.0 热更新（参数为空表示不限制）
+	admin.GetInst().HandleFunc("/gateway/versions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			q := r.URL.Query()
+			min, max := gateway.GetInst().VersionRange()
+			err := gateway.GetInst().SetVersionRange(q.Get("min"), q.Get("max"))
+			audit.RecordRequest(r, "gateway.versions", "", map[string]string{"min": min, "max": max}, map[string]string{"min": q.Get("min"), "max": q.Get("max")}, err)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		min, max := gateway.GetInst().VersionRange()
+		admin.WriteJSON(w, map[string]string{"min_version": min, "max_version": max})
+	})
+	// GET看排队人数，POST ?max=2000 热更新在线上限（0不限制）
+	admin.GetInst().HandleFunc("/gateway/queue", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			max, err := strconv.Atoi(r.URL.Query().Get("max"))
+			if err == nil && max < 0 {
+				err = fmt.Errorf("max %d must not be negative", max)
+			}
+			audit.RecordRequest(r, "gateway.max_sessions", "", nil, r.URL.Query().Get("max"), err)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			gateway.GetInst().SetMaxSessions(max)
+		}
+		waiting, admitted := gateway.GetInst().QueueLen()
+		admin.WriteJSON(w, map[string]int{"waiting": waiting, "admitted": admitted})
+	})
+	// 当前二进制编进去的配置表版本（-gen-stamp生成后重新编译才会变）
+	admin.GetInst().HandleFunc("/conf/version", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, result.ConfVersion())
+	})
+	// 主循环耗时预算：最近超预算的tick和当前tick到目前为止的耗时排行
+	admin.GetInst().HandleFunc("/loop/budget", func(w http.ResponseWriter, r *http.Request) {
+		slow, total := metrics.GetTickBudget().SlowTicks()
+		admin.WriteJSON(w, map[string]any{"slow_ticks": total, "recent": slow, "current": metrics.GetTickBudget().Current()})
+	})
+	admin.GetInst().HandleFunc("/db/timings", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, db.GetDbPool().QueryTimings())
+	})
+	// 故障注入：GET看当前配置，POST一个ChaosConf的json打开（空body关掉），只给测试环境用
+	admin.GetInst().HandleFunc("/db/chaos", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var conf *db.ChaosConf
+			if r.ContentLength != 0 {
+				conf = &db.ChaosConf{}
+				if err := json.NewDecoder(r.Body).Decode(conf); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if errs := conf.Validate(); len(errs) > 0 {
+					http.Error(w, errs[0].Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			audit.RecordRequest(r, "db.chaos", "", db.GetDbPool().Chaos(), conf, nil)
+			db.GetDbPool().SetChaos(conf)
+		}
+		admin.WriteJSON(w, db.GetDbPool().Chaos())
+	})
+	// 按表的访问量，POST清零
+	admin.GetInst().HandleFunc("/db/tables", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			db.GetDbPool().ResetStats()
+		}
+		admin.WriteJSON(w, db.GetDbPool().Stats())
+	})
+	// 服务发现里当前活着的节点，?role=game只看某个角色
+	admin.GetInst().HandleFunc("/discovery/nodes", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, discovery.GetInst().Nodes(r.URL.Query().Get("role")))
+	})
+	admin.GetInst().HandleFunc("/backup/list", func(w http.ResponseWriter, r *http.Request) {
+		names, err := backup.GetInst().List()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		last, lastErr := backup.GetInst().Last()
+		ret := map[string]any{"backups": names, "last": last}
+		if lastErr != nil {
+			ret["last_error"] = lastErr.Error()
+		}
+		admin.WriteJSON(w, ret)
+	})
+	// POST立即备份一次，只等内存数据序列化完，打包上传在后台做，结果看/backup/list的last
+	admin.GetInst().HandleFunc("/backup/run", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		var err error
+		if loopErr := runOnLoop(func() { err = backup.GetInst().Run() }, 5*time.Second); loopErr != nil {
+			err = loopErr
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		admin.WriteJSON(w, map[string]string{"status": "started"})
+	})
+	// 临时榜手动结算（活动提前结束），POST ?id=活动id
+	admin.GetInst().HandleFunc("/rank/temp/settle", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var before []rank.TempBoardInfo
+		if loopErr := runOnLoop(func() {
+			before = rank.GetManager().List()
+			err = rank.GetManager().Settle(id)
+		}, 5*time.Second); loopErr != nil {
+			err = loopErr
+		}
+		var info any
+		for _, b := range before {
+			if b.ActivityId == id {
+				info = b
+			}
+		}
+		audit.RecordRequest(r, "rank.settle", strconv.FormatInt(id, 10), info, nil, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		admin.WriteJSON(w, map[string]string{"result": "settled"})
+	})
+	// 最近的审计日志（内存里的，更早的查audit_log表或者文件），?actor=&action=过滤
+	admin.GetInst().HandleFunc("/audit", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		admin.WriteJSON(w, audit.GetInst().Recent(q.Get("actor"), q.Get("action")))
+	})
+	admin.GetInst().EnableProbes()
+	// 主循环2秒内没响应就认为卡死了
+	admin.GetInst().SetLiveCheck(func() error {
+		return runOnLoop(func() {}, 2*time.Second)
+	})
+	admin.GetInst().AddReadyCheck("db_breaker", func() error {
+		if st := db.GetDbPool().BreakerState(); st == db.BreakerOpen {
+			return fmt.Errorf("mysql circuit breaker %s", st)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,186 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"test/db"
+	"test/metrics"
+	"time"
+)
+
+// 审计日志：GM命令、配置热更、封禁增删、手动结算这类特权操作，谁（Actor）、从哪（Source）、对什么（Target）做了什么（Action），改之前和改之后的值，成功还是失败。
+// 先同步追加写本地文件（jsonl，只追加不改，文件是准的），再异步插一行到audit_log表方便后台查；写库失败只打日志。
+// 最近的recentSize条留在内存里，admin的/audit直接看
+//
+// 建表语句：
+// CREATE TABLE audit_log (
+//   id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//   event_time BIGINT NOT NULL,
+//   actor VARCHAR(64) NOT NULL,
+//   source VARCHAR(64) NOT NULL,
+//   action VARCHAR(64) NOT NULL,
+//   target VARCHAR(255) NOT NULL,
+//   before_value TEXT,
+//   after_value TEXT,
+//   result VARCHAR(255) NOT NULL,
+//   KEY (event_time),
+//   KEY (actor)
+// );
+
+const (
+	recentSize = 200
+	// ActorHeader 内部运营后台/网关转发admin请求时带上操作人
+	ActorHeader = "X-Admin-User"
+	// ActorSystem 定时任务、文件监听这种没有人操作的
+	ActorSystem = "system"
+)
+
+type Entry struct {
+	Time   int64           `json:"time"` // 毫秒
+	Actor  string          `json:"actor"`
+	Source string          `json:"source,omitempty"` // admin请求的来源地址
+	Action string          `json:"action"`           // flags.reload、gateway.ban、rank.settle……
+	Target string          `json:"target,omitempty"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+	Result string          `json:"result"` // ok或者错误信息
+}
+
+type Log struct {
+	m      sync.Mutex
+	file   *os.File
+	pool   db.Pool
+	recent []Entry
+	next   int
+}
+
+var inst = &Log{}
+
+func GetInst() *Log {
+	return inst
+}
+
+// Open path为空不写文件，pool为nil不写库。没Open时Record只进内存和普通日志
+func (l *Log) Open(path string, pool db.Pool) error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		l.file = f
+	}
+	l.pool = pool
+	return nil
+}
+
+func (l *Log) Close() {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// Record 记一条，任何goroutine都可以调。before/after是任意能json序列化的值，nil表示没有
+func (l *Log) Record(actor, source, action, target string, before, after any, err error) {
+	e := Entry{Time: time.Now().UnixMilli(), Actor: actor, Source: source, Action: action, Target: target, Before: toJSON(before), After: toJSON(after), Result: "ok"}
+	if e.Actor == "" {
+		e.Actor = "unknown"
+	}
+	if err != nil {
+		e.Result = err.Error()
+	}
+	b, _ := json.Marshal(&e)
+	log.Printf("AUDIT %s", b)
+	metrics.GetCounter("audit." + action).Inc()
+
+	l.m.Lock()
+	if l.recent == nil {
+		l.recent = make([]Entry, 0, recentSize)
+	}
+	if len(l.recent) < recentSize {
+		l.recent = append(l.recent, e)
+	} else {
+		l.recent[l.next] = e
+		l.next = (l.next + 1) % recentSize
+	}
+	if l.file != nil {
+		if _, werr := l.file.Write(append(b, '\n')); werr != nil {
+			metrics.GetCounter("audit.file_error").Inc()
+			log.Printf("audit file write failed: %s", werr.Error())
+		}
+	}
+	pool := l.pool
+	l.m.Unlock()
+
+	if pool == nil {
+		return
+	}
+	qerr := pool.AddQuery(&db.SqlQuery{
+		Stmt:     "insert into audit_log (event_time, actor, source, action, target, before_value, after_value, result) values (?, ?, ?, ?, ?, ?, ?, ?);",
+		Args:     []any{e.Time / 1000, e.Actor, e.Source, e.Action, e.Target, nullable(e.Before), nullable(e.After), e.Result},
+		Priority: db.PriorityHigh,
+		CbFunc: func(_ []*db.DBData, err error) {
+			if err != nil {
+				metrics.GetCounter("audit.db_error").Inc()
+				log.Printf("audit db insert failed, only in file: %s", err.Error())
+			}
+		},
+	})
+	if qerr != nil {
+		metrics.GetCounter("audit.db_error").Inc()
+		log.Printf("audit db insert failed, only in file: %s", qerr.Error())
+	}
+}
+
+func toJSON(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(err.Error())
+	}
+	if string(b) == "null" {
+		// 类型化的nil指针
+		return nil
+	}
+	return b
+}
+
+func nullable(b json.RawMessage) any {
+	if b == nil {
+		return nil
+	}
+	return string(b)
+}
+
+// Recent 内存里最近的记录，新的在前。actor、action不为空时只看匹配的
+func (l *Log) Recent(actor, action string) []Entry {
+	l.m.Lock()
+	defer l.m.Unlock()
+	ret := make([]Entry, 0, len(l.recent))
+	for i := len(l.recent) - 1; i >= 0; i-- {
+		e := l.recent[(l.next+i)%len(l.recent)]
+		if (actor == "" || e.Actor == actor) && (action == "" || e.Action == action) {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// Record 用默认实例记一条
+func Record(actor, source, action, target string, before, after any, err error) {
+	inst.Record(actor, source, action, target, before, after, err)
+}
+
+// RecordRequest admin handler里用，操作人从请求头ActorHeader取，来源是请求的远端地址
+func RecordRequest(r *http.Request, action, target string, before, after any, err error) {
+	inst.Record(r.Header.Get(ActorHeader), r.RemoteAddr, action, target, before, after, err)
+}
@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"test/db"
+	"testing"
+)
+
+type ban struct {
+	Ip     string `json:"ip"`
+	Reason string `json:"reason"`
+}
+
+func TestAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	pool := db.NewFakePool()
+	l := &Log{}
+	if err := l.Open(path, pool); err != nil {
+		t.Fatal(err)
+	}
+	var none *ban
+	r := httptest.NewRequest("POST", "/gateway/bans?ip=1.2.3.4", nil)
+	r.Header.Set(ActorHeader, "alice")
+	l.Record(r.Header.Get(ActorHeader), r.RemoteAddr, "gateway.ban", "1.2.3.4", none, &ban{Ip: "1.2.3.4", Reason: "spam"}, nil)
+	l.Record(ActorSystem, "", "flags.reload", "flags.xml", map[string]bool{"a": false}, map[string]bool{"a": true}, errors.New("bad xml"))
+	l.Close()
+
+	f, _ := os.Open(path)
+	defer f.Close()
+	var lines []Entry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, e)
+	}
+	if len(lines) != 2 || lines[0].Actor != "alice" || lines[0].Before != nil || string(lines[0].After) != `{"ip":"1.2.3.4","reason":"spam"}` {
+		t.Fatalf("file %+v", lines)
+	}
+	if lines[1].Result != "bad xml" || string(lines[1].After) != `{"a":true}` {
+		t.Fatalf("file %+v", lines[1])
+	}
+	rows := pool.Table("audit_log")
+	if len(rows) != 2 || rows[0].String("actor") != "alice" || rows[0].String("after_value") != `{"ip":"1.2.3.4","reason":"spam"}` {
+		t.Fatalf("db rows %v", rows)
+	}
+	if rec := l.Recent("", ""); len(rec) != 2 || rec[0].Action != "flags.reload" {
+		t.Fatalf("recent %+v", rec)
+	}
+	if rec := l.Recent("alice", ""); len(rec) != 1 || rec[0].Action != "gateway.ban" {
+		t.Fatalf("recent by actor %+v", rec)
+	}
+	for i := 0; i < recentSize+3; i++ {
+		l.Record("bob", "", "gm.add_item", "", nil, i, nil)
+	}
+	if rec := l.Recent("", ""); len(rec) != recentSize || string(rec[0].After) != "202" || len(l.Recent("alice", "")) != 0 {
+		t.Fatalf("ring %d %s", len(rec), rec[0].After)
+	}
+}
@@ -0,0 +1,384 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"test/db"
+	"test/gtime"
+	"test/metrics"
+	"test/timer"
+	"time"
+)
+
+// 定时全量备份：把关键的内存状态（排行榜、持久化触发器、还没落库的脏数据……）和指定的mysql表打成一个tar.gz，
+// 存到本地目录或者S3兼容的对象存储，按份数/时间清理旧备份，出事时用Restore（或者启动参数-backup-restore）恢复。
+//
+// 各模块用Register登记自己的数据源。内存数据源在主循环里序列化（保证一致），之后打包、导mysql、上传、清理都在后台goroutine里做，不卡主循环
+
+const (
+	namePrefix   = "backup_"
+	nameSuffix   = ".tar.gz"
+	nameLayout   = "20060102_150405"
+	manifestName = "manifest.json"
+)
+
+var ErrRunning = errors.New("backup already running")
+
+type BackupConf struct {
+	Dir         string  `xml:"dir" json:"dir"`                     // 本地备份目录，配了s3时不用
+	IntervalMin int     `xml:"interval_min" json:"interval_min"`   // 多少分钟备份一次，0不自动备份（只能手动Run）
+	Keep        int     `xml:"keep" json:"keep"`                   // 最多保留几份，0不按份数删
+	MaxAgeHours int     `xml:"max_age_hours" json:"max_age_hours"` // 超过多少小时的删掉，0不按时间删
+	MysqlTables string  `xml:"mysql_tables" json:"mysql_tables"`   // 逗号分隔，备份时用db.DumpTable逻辑导出
+	S3          *S3Conf `xml:"s3" json:"s3"`
+}
+
+// Validate 检查配置，把所有问题一起返回
+func (conf *BackupConf) Validate() (errs []error) {
+	if conf.S3 == nil && conf.Dir == "" {
+		errs = append(errs, fmt.Errorf("dir or s3 is required"))
+	}
+	if conf.S3 != nil {
+		if conf.S3.Endpoint == "" || conf.S3.Bucket == "" {
+			errs = append(errs, fmt.Errorf("s3 endpoint and bucket are required"))
+		}
+		if conf.S3.AccessKey == "" || conf.S3.SecretKey == "" {
+			errs = append(errs, fmt.Errorf("s3 access_key and secret_key are required"))
+		}
+	}
+	if conf.IntervalMin < 0 {
+		errs = append(errs, fmt.Errorf("interval_min %d must not be negative", conf.IntervalMin))
+	}
+	if conf.Keep < 0 {
+		errs = append(errs, fmt.Errorf("keep %d must not be negative", conf.Keep))
+	}
+	if conf.MaxAgeHours < 0 {
+		errs = append(errs, fmt.Errorf("max_age_hours %d must not be negative", conf.MaxAgeHours))
+	}
+	return
+}
+
+func (conf *BackupConf) tables() []string {
+	var ret []string
+	for _, t := range strings.Split(conf.MysqlTables, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// Source 一个备份数据源，Name就是它在压缩包里的文件名（比如"rank/arena.jsonl"）。
+// Async为false的Save在主循环里调；为true的在后台goroutine里调（mysql导出这种本身线程安全又慢的）。Restore为nil表示只备份不恢复（排查用）
+type Source struct {
+	Name    string
+	Async   bool
+	Save    func(w io.Writer) error
+	Restore func(r io.Reader) error
+}
+
+// Manifest 压缩包里的manifest.json
+type Manifest struct {
+	Time    string            `json:"time"`
+	Entries map[string]int    `json:"entries"`          // 文件名->字节数
+	Errors  map[string]string `json:"errors,omitempty"` // 备份失败的数据源，其他数据源照常备份
+}
+
+type Backup struct {
+	conf    *BackupConf
+	store   Store
+	sources []Source
+	running atomic.Bool
+	m       sync.Mutex
+	last    *Manifest
+	lastErr error
+}
+
+var inst = &Backup{}
+
+func GetInst() *Backup {
+	return inst
+}
+
+// Register 在Start之前登记，重名的后登记的覆盖
+func (b *Backup) Register(src Source) {
+	for i, s := range b.sources {
+		if s.Name == src.Name {
+			b.sources[i] = src
+			return
+		}
+	}
+	b.sources = append(b.sources, src)
+}
+
+// Open 按配置打开存储，不开始定时备份（-backup-list、-backup-restore只需要这个）
+func (b *Backup) Open(conf *BackupConf) error {
+	b.conf = conf
+	if conf.S3 != nil {
+		b.store = newS3Store(*conf.S3)
+		return nil
+	}
+	s, err := newDirStore(conf.Dir)
+	if err != nil {
+		return err
+	}
+	b.store = s
+	return nil
+}
+
+// Start Open之后按interval_min定时备份，在主循环里调
+func (b *Backup) Start() {
+	if b.store == nil || b.conf.IntervalMin <= 0 {
+		return
+	}
+	interval := time.Duration(b.conf.IntervalMin) * time.Minute
+	timer.Every(interval, "backup", func() {
+		if err := b.Run(); err != nil {
+			log.Printf("scheduled backup failed: %s", err.Error())
+		}
+	})
+}
+
+type entry struct {
+	name string
+	data []byte
+}
+
+// Run 立即备份一次，必须在主循环里调。内存数据源同步序列化完就返回，剩下的在后台做，结果看Last()
+func (b *Backup) Run() error {
+	if b.store == nil {
+		return fmt.Errorf("backup not opened")
+	}
+	if !b.running.CompareAndSwap(false, true) {
+		return ErrRunning
+	}
+	now := time.Now()
+	man := &Manifest{Time: gtime.FormatStandard(now), Entries: map[string]int{}, Errors: map[string]string{}}
+	var entries []entry
+	var async []Source
+	for _, src := range b.sources {
+		if src.Async {
+			async = append(async, src)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := src.Save(&buf); err != nil {
+			man.Errors[src.Name] = err.Error()
+			continue
+		}
+		entries = append(entries, entry{name: src.Name, data: buf.Bytes()})
+	}
+	go func() {
+		defer b.running.Store(false)
+		start := time.Now()
+		for _, src := range async {
+			var buf bytes.Buffer
+			if err := src.Save(&buf); err != nil {
+				man.Errors[src.Name] = err.Error()
+				continue
+			}
+			entries = append(entries, entry{name: src.Name, data: buf.Bytes()})
+		}
+		name := namePrefix + now.Format(nameLayout) + nameSuffix
+		err := b.finish(name, man, entries)
+		b.m.Lock()
+		b.last, b.lastErr = man, err
+		b.m.Unlock()
+		metrics.GetHistogram("backup.duration").Observe(time.Since(start))
+		if err != nil {
+			metrics.GetCounter("backup.failed").Inc()
+			log.Printf("backup %s failed: %s", name, err.Error())
+			return
+		}
+		log.Printf("backup %s done, %d entries, %d errors, cost %v", name, len(man.Entries), len(man.Errors), time.Since(start))
+	}()
+	return nil
+}
+
+func (b *Backup) finish(name string, man *Manifest, entries []entry) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	write := func(n string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: n, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	for _, e := range entries {
+		man.Entries[e.name] = len(e.data)
+	}
+	mb, _ := json.MarshalIndent(man, "", "  ")
+	if err := write(manifestName, mb); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := write(e.name, e.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := b.store.Put(name, buf.Bytes()); err != nil {
+		return err
+	}
+	return b.prune(time.Now())
+}
+
+// prune 按份数和时间删旧备份
+func (b *Backup) prune(now time.Time) error {
+	names, err := b.List()
+	if err != nil {
+		return err
+	}
+	var drop []string
+	if b.conf.Keep > 0 && len(names) > b.conf.Keep {
+		drop = append(drop, names[:len(names)-b.conf.Keep]...)
+		names = names[len(names)-b.conf.Keep:]
+	}
+	if b.conf.MaxAgeHours > 0 {
+		deadline := now.Add(-time.Duration(b.conf.MaxAgeHours) * time.Hour)
+		for _, n := range names {
+			if t, ok := backupTime(n); ok && t.Before(deadline) {
+				drop = append(drop, n)
+			}
+		}
+	}
+	for _, n := range drop {
+		if err = b.store.Delete(n); err != nil {
+			return err
+		}
+		log.Printf("backup %s pruned", n)
+	}
+	return nil
+}
+
+func backupTime(name string) (time.Time, bool) {
+	s := strings.TrimSuffix(strings.TrimPrefix(name, namePrefix), nameSuffix)
+	t, err := time.ParseInLocation(nameLayout, s, time.Local)
+	return t, err == nil
+}
+
+// List 所有备份，旧的在前
+func (b *Backup) List() ([]string, error) {
+	if b.store == nil {
+		return nil, fmt.Errorf("backup not opened")
+	}
+	all, err := b.store.List(namePrefix)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, n := range all {
+		if strings.HasSuffix(n, nameSuffix) {
+			ret = append(ret, n)
+		}
+	}
+	return ret, nil
+}
+
+// Last 最近一次备份的结果，还没备份过返回nil
+func (b *Backup) Last() (*Manifest, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.last, b.lastErr
+}
+
+// Restore 从名为name的备份恢复，only为空时恢复所有登记过且有Restore的数据源，否则只恢复only里列的。
+// 在主循环里调（一般是启动时，开放端口之前）。name传"latest"取最新的一份。返回恢复了哪些数据源
+func (b *Backup) Restore(name string, only ...string) ([]string, error) {
+	if b.store == nil {
+		return nil, fmt.Errorf("backup not opened")
+	}
+	if name == "latest" {
+		names, err := b.List()
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no backup found")
+		}
+		name = names[len(names)-1]
+	}
+	data, err := b.store.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	want := map[string]bool{}
+	for _, n := range only {
+		want[n] = true
+	}
+	var restored []string
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return restored, err
+		}
+		if h.Name == manifestName || len(want) > 0 && !want[h.Name] {
+			continue
+		}
+		src, ok := b.source(h.Name)
+		if !ok || src.Restore == nil {
+			continue
+		}
+		if err = src.Restore(tr); err != nil {
+			return restored, fmt.Errorf("restore %s from %s: %w", h.Name, name, err)
+		}
+		restored = append(restored, h.Name)
+		log.Printf("restored %s from %s", h.Name, name)
+	}
+	return restored, nil
+}
+
+func (b *Backup) source(name string) (Source, bool) {
+	for _, s := range b.sources {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Source{}, false
+}
+
+// RegisterMysql 把配置里mysql_tables列的表登记成数据源（文件名mysql/<表名>.jsonl），Open之后调
+func (b *Backup) RegisterMysql(pool *db.MysqlPool) {
+	if b.conf == nil {
+		return
+	}
+	for _, t := range b.conf.tables() {
+		table := t
+		b.Register(Source{
+			Name:  "mysql/" + table + ".jsonl",
+			Async: true,
+			Save: func(w io.Writer) error {
+				_, err := pool.DumpTable(table, w)
+				return err
+			},
+			Restore: func(r io.Reader) error {
+				_, err := pool.LoadTable(table, r)
+				return err
+			},
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitDone(t *testing.T, b *Backup) {
+	deadline := time.Now().Add(5 * time.Second)
+	for b.running.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("backup not finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	b := &Backup{}
+	if err := b.Open(&BackupConf{Dir: t.TempDir(), Keep: 2}); err != nil {
+		t.Fatal(err)
+	}
+	state := "v1"
+	var restored string
+	b.Register(Source{
+		Name: "state.txt",
+		Save: func(w io.Writer) error {
+			_, err := io.WriteString(w, state)
+			return err
+		},
+		Restore: func(r io.Reader) error {
+			data, err := io.ReadAll(r)
+			restored = string(data)
+			return err
+		},
+	})
+	b.Register(Source{Name: "async.txt", Async: true, Save: func(w io.Writer) error {
+		_, err := io.WriteString(w, "async")
+		return err
+	}})
+	if err := b.Run(); err != nil {
+		t.Fatal(err)
+	}
+	waitDone(t, b)
+	man, err := b.Last()
+	if err != nil || man.Entries["state.txt"] != 2 || man.Entries["async.txt"] != 5 {
+		t.Fatalf("last manifest %+v, err %v", man, err)
+	}
+	names, _ := b.List()
+	if len(names) != 1 {
+		t.Fatalf("list %v", names)
+	}
+	got, err := b.Restore("latest")
+	if err != nil || restored != "v1" || len(got) != 1 || got[0] != "state.txt" {
+		t.Fatalf("restore %v %q %v", got, restored, err)
+	}
+	if _, err = b.Restore("latest", "other.txt"); err != nil || restored != "v1" {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupPrune(t *testing.T) {
+	b := &Backup{}
+	if err := b.Open(&BackupConf{Dir: t.TempDir(), Keep: 3, MaxAgeHours: 24}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, ago := range []time.Duration{48, 10, 5, 3, 1} {
+		name := namePrefix + now.Add(-ago*time.Hour).Format(nameLayout) + nameSuffix
+		if err := b.store.Put(name, []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.prune(now); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := b.List()
+	if len(names) != 3 || names[0] != namePrefix+now.Add(-5*time.Hour).Format(nameLayout)+nameSuffix {
+		t.Fatalf("after prune %v", names)
+	}
+}
+
+// 最简单的内存版S3，只认path-style和签名头存在
+func TestS3Store(t *testing.T) {
+	var m sync.Mutex
+	objs := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		m.Lock()
+		defer m.Unlock()
+		key := strings.TrimPrefix(r.URL.Path, "/bkt/")
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			objs[key] = data
+		case http.MethodGet:
+			if r.URL.Query().Get("list-type") == "2" {
+				var buf bytes.Buffer
+				buf.WriteString("<ListBucketResult>")
+				for k := range objs {
+					if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+						buf.WriteString("<Contents><Key>" + k + "</Key></Contents>")
+					}
+				}
+				buf.WriteString("<IsTruncated>false</IsTruncated></ListBucketResult>")
+				w.Write(buf.Bytes())
+				return
+			}
+			data, ok := objs[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case http.MethodDelete:
+			delete(objs, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	s := newS3Store(S3Conf{Endpoint: srv.URL, Bucket: "bkt", Region: "us-east-1", AccessKey: "ak", SecretKey: "sk", Prefix: "game1/"})
+	if err := s.Put("a.tar.gz", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := s.Get("a.tar.gz"); err != nil || string(data) != "hello" {
+		t.Fatalf("get %q %v", data, err)
+	}
+	if _, ok := objs["game1/a.tar.gz"]; !ok {
+		t.Fatalf("prefix not applied: %v", objs)
+	}
+	if names, err := s.List("a"); err != nil || len(names) != 1 || names[0] != "a.tar.gz" {
+		t.Fatalf("list %v %v", names, err)
+	}
+	if err := s.Delete("a.tar.gz"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := s.List(""); len(names) != 0 {
+		t.Fatalf("list after delete %v", names)
+	}
+}
@@ -0,0 +1,151 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3兼容存储（AWS S3、MinIO、各家云的对象存储），只用到PutObject/GetObject/ListObjectsV2/DeleteObject，
+// 自己做SigV4签名，不引SDK。用path-style地址：endpoint/bucket/key
+
+type S3Conf struct {
+	Endpoint  string `xml:"endpoint" json:"endpoint"` // 比如https://s3.ap-northeast-1.amazonaws.com、http://127.0.0.1:9000
+	Bucket    string `xml:"bucket" json:"bucket"`
+	Region    string `xml:"region" json:"region"` // MinIO随便填，默认us-east-1
+	AccessKey string `xml:"access_key" json:"access_key"`
+	SecretKey string `xml:"secret_key" json:"secret_key"`
+	Prefix    string `xml:"prefix" json:"prefix"` // 对象名前缀，多个服共用一个bucket时区分，比如"s1/"
+}
+
+type s3Store struct {
+	conf   S3Conf
+	client *http.Client
+}
+
+func newS3Store(conf S3Conf) *s3Store {
+	if conf.Region == "" {
+		conf.Region = "us-east-1"
+	}
+	conf.Endpoint = strings.TrimSuffix(conf.Endpoint, "/")
+	return &s3Store{conf: conf, client: &http.Client{Timeout: 5 * time.Minute}}
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// do 发一个签好名的请求，非2xx当错误返回（带上响应体，S3的错误信息在里面）
+func (s *s3Store) do(method string, key string, query url.Values, body []byte) ([]byte, error) {
+	u, err := url.Parse(s.conf.Endpoint + "/" + s.conf.Bucket + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	// S3要求空格编码成%20而不是+
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		u.RawQuery,
+		"host:" + u.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.conf.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+	signingKey := hmacSHA256(hmacSHA256(hmacSHA256(hmacSHA256([]byte("AWS4"+s.conf.SecretKey), date), s.conf.Region), "s3"), "aws4_request")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.conf.AccessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(signingKey, toSign))))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("s3 %s %s: %s %s", method, key, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return b, nil
+}
+
+func (s *s3Store) Put(name string, data []byte) error {
+	_, err := s.do(http.MethodPut, s.conf.Prefix+name, url.Values{}, data)
+	return err
+}
+
+func (s *s3Store) Get(name string) ([]byte, error) {
+	return s.do(http.MethodGet, s.conf.Prefix+name, url.Values{}, nil)
+}
+
+func (s *s3Store) Delete(name string) error {
+	_, err := s.do(http.MethodDelete, s.conf.Prefix+name, url.Values{}, nil)
+	return err
+}
+
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *s3Store) List(prefix string) ([]string, error) {
+	var ret []string
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {s.conf.Prefix + prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		b, err := s.do(http.MethodGet, "", q, nil)
+		if err != nil {
+			return nil, err
+		}
+		res := &listResult{}
+		if err = xml.Unmarshal(b, res); err != nil {
+			return nil, err
+		}
+		for _, c := range res.Contents {
+			ret = append(ret, strings.TrimPrefix(c.Key, s.conf.Prefix))
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
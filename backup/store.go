@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Store 备份文件存哪：本地目录或者S3兼容的对象存储
+type Store interface {
+	Put(name string, data []byte) error
+	Get(name string) ([]byte, error)
+	List(prefix string) ([]string, error) // 返回的名字按字典序排好
+	Delete(name string) error
+}
+
+type dirStore struct {
+	dir string
+}
+
+func newDirStore(dir string) (*dirStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &dirStore{dir: dir}, nil
+}
+
+// Put 先写临时文件再改名，进程中途挂掉不会留下半个备份
+func (s *dirStore) Put(name string, data []byte) error {
+	path := filepath.Join(s.dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *dirStore) Get(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.dir, filepath.Base(name)))
+}
+
+func (s *dirStore) List(prefix string) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), prefix) && !strings.HasSuffix(e.Name(), ".tmp") {
+			ret = append(ret, e.Name())
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (s *dirStore) Delete(name string) error {
+	return os.Remove(filepath.Join(s.dir, filepath.Base(name)))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"test/backup"
+	"test/db"
+	"test/timer"
+)
+
+// registerBackupSources 登记全服级别的备份数据源。业务模块自己的数据（排行榜之类）在模块初始化时自己Register
+func registerBackupSources() {
+	b := backup.GetInst()
+	b.Register(backup.Source{
+		Name: "timer.json",
+		Save: func(w io.Writer) error {
+			blob, err := timer.GetInst().Save()
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(blob)
+			return err
+		},
+		Restore: func(r io.Reader) error {
+			blob, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			_, err = timer.GetInst().Restore(blob)
+			return err
+		},
+	})
+	// 所有待触发的触发器（包括没法持久化的闭包），只用来排查，不恢复
+	b.Register(backup.Source{
+		Name: "timer_pending.json",
+		Save: func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(timer.GetInst().Dump())
+		},
+	})
+	b.Register(backup.Source{
+		Name: "dirty.gob",
+		Save: func(w io.Writer) error {
+			_, err := db.WriteDirtySnapshot(w)
+			return err
+		},
+		Restore: func(r io.Reader) error {
+			_, err := db.RestoreDirtySnapshot(db.GetDbPool(), r)
+			return err
+		},
+	})
+	b.RegisterMysql(db.GetDbPool())
+}
@@ -0,0 +1,186 @@
+package calendar
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"test/gtime"
+	"test/timer"
+	"test/tool_gen_code/result"
+	"time"
+)
+
+// 活动日历：开关时间配在表格的activity结构里（result.Activity），启动时和配置热更后调Reload，
+// 按当前时间对账：该开着还没开的立刻开、该关了还开着的立刻关、没到时间的注册开启触发器，开着的注册关闭触发器。
+// 玩法模块按活动类型Register处理函数，不用自己管触发器
+
+const (
+	timeLayout = gtime.Layout
+	timerTag   = "calendar"
+)
+
+// Handler 同一个活动OnOpen和OnClose成对调用。resumed为true表示不是准点开的（停服期间到了开启时间、或者热更改了开启时间），
+// 这时不要再发开服公告之类的东西；进程重启后开着的活动也会再OnOpen(resumed=true)一次，处理函数要能重入
+type Handler struct {
+	OnOpen  func(a *result.Activity, resumed bool)
+	OnClose func(a *result.Activity)
+}
+
+type Calendar struct {
+	t        *timer.Timer
+	clock    func() time.Time
+	handlers map[string]Handler
+	open     map[int]*result.Activity // 当前开着的活动
+}
+
+// New clock传nil用time.Now，单测里传Simulator.Now
+func New(t *timer.Timer, clock func() time.Time) *Calendar {
+	if clock == nil {
+		clock = time.Now
+	}
+	return &Calendar{
+		t:        t,
+		clock:    clock,
+		handlers: make(map[string]Handler),
+		open:     make(map[int]*result.Activity),
+	}
+}
+
+var inst = New(timer.GetInst(), nil)
+
+func GetInst() *Calendar {
+	return inst
+}
+
+// Register 一种活动类型一个处理函数，要在Reload之前注册
+func (c *Calendar) Register(typ string, h Handler) {
+	c.handlers[typ] = h
+}
+
+// IsOpen 活动当前是否开着
+func (c *Calendar) IsOpen(id int) bool {
+	_, ok := c.open[id]
+	return ok
+}
+
+// OpenList 当前开着的活动，按id排序
+func (c *Calendar) OpenList() []*result.Activity {
+	ret := make([]*result.Activity, 0, len(c.open))
+	for _, a := range c.open {
+		ret = append(ret, a)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Id < ret[j].Id })
+	return ret
+}
+
+func window(a *result.Activity) (open time.Time, close time.Time, err error) {
+	if open, err = gtime.Parse(a.OpenTime); err != nil {
+		return
+	}
+	if close, err = gtime.Parse(a.CloseTime); err != nil {
+		return
+	}
+	if !close.After(open) {
+		err = fmt.Errorf("close_time %s not after open_time %s", a.CloseTime, a.OpenTime)
+	}
+	return
+}
+
+// Reload 启动时（result.LoadActivity之后）和每次配置热更后调，在主循环里调。
+// 先清掉自己注册的所有触发器，再按当前配置和当前时间重新对账；配置有问题的活动跳过并返回错误，不影响其他活动
+func (c *Calendar) Reload() error {
+	c.t.CancelWhere(func(tags timer.Tags) bool { return tags.Has(timerTag) })
+	now := c.clock()
+	ids := make([]int, 0, len(result.ActivityById))
+	for id := range result.ActivityById {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	var bad []string
+	for _, id := range ids {
+		a := result.ActivityById[id]
+		openAt, closeAt, err := window(a)
+		if err != nil {
+			bad = append(bad, fmt.Sprintf("activity %d: %s", id, err.Error()))
+			continue
+		}
+		shouldOpen := !now.Before(openAt) && now.Before(closeAt)
+		switch {
+		case shouldOpen && c.IsOpen(id):
+			c.open[id] = a // 配置可能改了名字之类的，换成新的
+			c.push(closeAt, "calendar_close", id)
+		case shouldOpen:
+			c.doOpen(a, true)
+			c.push(closeAt, "calendar_close", id)
+		case c.IsOpen(id):
+			c.doClose(id)
+		case now.Before(openAt):
+			c.push(openAt, "calendar_open", id)
+		}
+	}
+	// 配置里删掉的活动直接关
+	for id := range c.open {
+		if _, ok := result.ActivityById[id]; !ok {
+			c.doClose(id)
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("%d bad activities: %v", len(bad), bad)
+	}
+	return nil
+}
+
+func (c *Calendar) push(at time.Time, name string, id int) {
+	err := c.t.PushAt(at, timer.Trigger{
+		Fun:   c.onTrigger,
+		Param: id,
+		Name:  name,
+		Tags:  timer.Tags{timerTag},
+	})
+	if err != nil {
+		// 没注册上的话这个活动到点不会开关，下次Reload会重新注册
+		log.Printf("calendar activity %d %s trigger at %s not pushed: %s", id, name, gtime.FormatStandard(at), err.Error())
+	}
+}
+
+func (c *Calendar) onTrigger(now int64, param interface{}) {
+	id := param.(int)
+	a := result.ActivityById[id]
+	if a == nil {
+		c.doClose(id)
+		return
+	}
+	openAt, closeAt, err := window(a)
+	if err != nil {
+		return
+	}
+	t := time.Unix(now, 0)
+	if !t.Before(openAt) && t.Before(closeAt) {
+		if !c.IsOpen(id) {
+			c.doOpen(a, false)
+			c.push(closeAt, "calendar_close", id)
+		}
+		return
+	}
+	c.doClose(id)
+}
+
+func (c *Calendar) doOpen(a *result.Activity, resumed bool) {
+	c.open[a.Id] = a
+	log.Printf("calendar: activity %d (%s) open, resumed = %v", a.Id, a.Name, resumed)
+	if h, ok := c.handlers[a.Type]; ok && h.OnOpen != nil {
+		h.OnOpen(a, resumed)
+	}
+}
+
+func (c *Calendar) doClose(id int) {
+	a, ok := c.open[id]
+	if !ok {
+		return
+	}
+	delete(c.open, id)
+	log.Printf("calendar: activity %d (%s) close", a.Id, a.Name)
+	if h, ok := c.handlers[a.Type]; ok && h.OnClose != nil {
+		h.OnClose(a)
+	}
+}
@@ -0,0 +1,70 @@
+package calendar
+
+import (
+	"test/timer"
+	"test/tool_gen_code/result"
+	"testing"
+	"time"
+)
+
+func TestCalendar(t *testing.T) {
+	start := time.Date(2024, 2, 10, 12, 0, 0, 0, time.Local)
+	s := timer.NewSimulator(start)
+	c := New(s.Timer, s.Now)
+	var got []string
+	c.Register("double_exp", Handler{
+		OnOpen: func(a *result.Activity, resumed bool) {
+			if resumed {
+				got = append(got, "resume "+a.Name)
+			} else {
+				got = append(got, "open "+a.Name)
+			}
+		},
+		OnClose: func(a *result.Activity) { got = append(got, "close "+a.Name) },
+	})
+	f := func(t time.Time) string { return t.Format(timeLayout) }
+	err := result.LoadActivity([]*result.Activity{
+		{Id: 1, Type: "double_exp", Name: "running", OpenTime: f(start.Add(-time.Hour)), CloseTime: f(start.Add(time.Hour))},
+		{Id: 2, Type: "double_exp", Name: "later", OpenTime: f(start.Add(10 * time.Minute)), CloseTime: f(start.Add(20 * time.Minute))},
+		{Id: 3, Type: "double_exp", Name: "over", OpenTime: f(start.Add(-2 * time.Hour)), CloseTime: f(start.Add(-time.Hour))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsOpen(1) || c.IsOpen(2) || c.IsOpen(3) {
+		t.Fatalf("unexpected open state: %v", c.OpenList())
+	}
+	s.Advance(15 * time.Minute)
+	if !c.IsOpen(2) {
+		t.Fatalf("activity 2 should be open")
+	}
+
+	// 热更：1提前结束，2延后到30分，新加4
+	err = result.LoadActivity([]*result.Activity{
+		{Id: 1, Type: "double_exp", Name: "running", OpenTime: f(start.Add(-time.Hour)), CloseTime: f(start.Add(10 * time.Minute))},
+		{Id: 2, Type: "double_exp", Name: "later", OpenTime: f(start.Add(10 * time.Minute)), CloseTime: f(start.Add(30 * time.Minute))},
+		{Id: 4, Type: "double_exp", Name: "new", OpenTime: f(start.Add(40 * time.Minute)), CloseTime: f(start.Add(50 * time.Minute))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	s.Advance(time.Hour)
+	want := []string{"resume running", "open later", "close running", "close later", "open new", "close new"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if s.Pending() != 0 {
+		t.Fatalf("stale triggers left: %d", s.Pending())
+	}
+}
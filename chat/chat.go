@@ -0,0 +1,277 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"test/gateway"
+	"time"
+	"unicode/utf8"
+)
+
+// 聊天：世界/公会/私聊三种频道，走网关收发，消息体先用json（还没有protobuf定义）。
+// 所有方法都在主循环里调（网关handler本来就在主循环里执行），不加锁
+
+const (
+	MsgIdChatSend  uint16 = 1001 // 客户端->服务器 SendReq
+	MsgIdChatPush  uint16 = 1002 // 服务器->客户端 Msg
+	MsgIdChatError uint16 = 1003 // 服务器->客户端 发送失败的原因
+)
+
+type ChannelKind int32
+
+const (
+	ChannelWorld   ChannelKind = 1
+	ChannelGuild   ChannelKind = 2
+	ChannelPrivate ChannelKind = 3
+)
+
+var (
+	ErrRateLimited = errors.New("chat rate limited")
+	ErrNotMember   = errors.New("not a member of this channel")
+	ErrBlocked     = errors.New("message blocked by filter")
+	ErrTooLong     = errors.New("message too long")
+	ErrEmpty       = errors.New("message is empty")
+	ErrOffline     = errors.New("sender not online")
+)
+
+const maxTextLen = 200 // 按字符数
+
+type SendReq struct {
+	Kind   ChannelKind `json:"kind"`
+	Target int64       `json:"target"` // 公会频道填公会id，私聊填对方玩家id，世界频道不填
+	Text   string      `json:"text"`
+}
+
+type Msg struct {
+	Kind   ChannelKind `json:"kind"`
+	Target int64       `json:"target"`
+	From   int64       `json:"from"`
+	Text   string      `json:"text"`
+	Time   int64       `json:"time"`
+}
+
+// Filter 屏蔽词钩子，返回替换后的文本；ok=false表示整条拦截
+type Filter func(from int64, text string) (string, bool)
+
+type channelKey struct {
+	kind ChannelKind
+	a, b int64 // 公会频道a=公会id；私聊a<b是双方玩家id
+}
+
+type rateState struct {
+	windowStart time.Time
+	count       int
+}
+
+type Chat struct {
+	online     map[int64]*gateway.Session
+	sessPlayer map[uint64]int64
+	guilds     map[int64]map[int64]struct{} // 公会id -> 成员
+	guildOf    map[int64]int64              // 玩家 -> 公会id
+	history    map[channelKey][]*Msg
+	historyLen int
+	filter     Filter
+	rateLimit  int           // 每个窗口内最多发多少条
+	ratePer    time.Duration // 窗口长度
+	rates      map[int64]*rateState
+	now        func() time.Time
+}
+
+// New historyLen每个频道保留多少条历史，rateLimit/ratePer每人每ratePer最多发rateLimit条（rateLimit<=0不限）
+func New(historyLen int, rateLimit int, ratePer time.Duration) *Chat {
+	return &Chat{
+		online:     make(map[int64]*gateway.Session),
+		sessPlayer: make(map[uint64]int64),
+		guilds:     make(map[int64]map[int64]struct{}),
+		guildOf:    make(map[int64]int64),
+		history:    make(map[channelKey][]*Msg),
+		historyLen: historyLen,
+		rateLimit:  rateLimit,
+		ratePer:    ratePer,
+		rates:      make(map[int64]*rateState),
+		now:        time.Now,
+	}
+}
+
+// Register 把发送消息的handler挂到网关上，在网关Start之前调
+func (c *Chat) Register(g *gateway.Gateway) {
+	g.RegisterHandler(MsgIdChatSend, c.onSend)
+}
+
+func (c *Chat) SetFilter(f Filter) {
+	c.filter = f
+}
+
+// Online 玩家登录后绑定连接
+func (c *Chat) Online(playerId int64, sess *gateway.Session) {
+	c.online[playerId] = sess
+	c.sessPlayer[sess.Id] = playerId
+}
+
+func (c *Chat) Offline(playerId int64) {
+	if sess, ok := c.online[playerId]; ok {
+		delete(c.sessPlayer, sess.Id)
+	}
+	delete(c.online, playerId)
+	delete(c.rates, playerId)
+}
+
+func (c *Chat) JoinGuild(guildId int64, playerId int64) {
+	c.LeaveGuild(playerId)
+	members, ok := c.guilds[guildId]
+	if !ok {
+		members = make(map[int64]struct{})
+		c.guilds[guildId] = members
+	}
+	members[playerId] = struct{}{}
+	c.guildOf[playerId] = guildId
+}
+
+func (c *Chat) LeaveGuild(playerId int64) {
+	guildId, ok := c.guildOf[playerId]
+	if !ok {
+		return
+	}
+	delete(c.guildOf, playerId)
+	delete(c.guilds[guildId], playerId)
+	if len(c.guilds[guildId]) == 0 {
+		delete(c.guilds, guildId)
+	}
+}
+
+func (c *Chat) onSend(sess *gateway.Session, body []byte) {
+	from, ok := c.sessPlayer[sess.Id]
+	if !ok {
+		return
+	}
+	req := &SendReq{}
+	if err := json.Unmarshal(body, req); err != nil {
+		log.Printf("chat: bad request from player %d: %s", from, err.Error())
+		return
+	}
+	if err := c.Send(from, req); err != nil {
+		sess.Send(&gateway.Packet{MsgId: MsgIdChatError, Body: []byte(err.Error())})
+	}
+}
+
+// Send 服务器自己也可以调（系统公告走世界频道之类）
+func (c *Chat) Send(from int64, req *SendReq) error {
+	text := req.Text
+	if text == "" {
+		return ErrEmpty
+	}
+	if utf8.RuneCountInString(text) > maxTextLen {
+		return ErrTooLong
+	}
+	key, receivers, err := c.route(from, req)
+	if err != nil {
+		return err
+	}
+	if !c.allow(from) {
+		return ErrRateLimited
+	}
+	if c.filter != nil {
+		var pass bool
+		if text, pass = c.filter(from, text); !pass {
+			return ErrBlocked
+		}
+	}
+	msg := &Msg{Kind: req.Kind, Target: req.Target, From: from, Text: text, Time: c.now().Unix()}
+	c.appendHistory(key, msg)
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	p := &gateway.Packet{MsgId: MsgIdChatPush, Body: b}
+	for _, sess := range receivers {
+		if err := sess.Send(p); err != nil {
+			log.Printf("chat: push to session %d failed: %s", sess.Id, err.Error())
+		}
+	}
+	return nil
+}
+
+// route 检查发送权限，返回频道和在线的接收者
+func (c *Chat) route(from int64, req *SendReq) (channelKey, []*gateway.Session, error) {
+	var receivers []*gateway.Session
+	switch req.Kind {
+	case ChannelWorld:
+		for _, sess := range c.online {
+			receivers = append(receivers, sess)
+		}
+		return channelKey{kind: ChannelWorld}, receivers, nil
+	case ChannelGuild:
+		members, ok := c.guilds[req.Target]
+		if _, in := members[from]; !ok || !in {
+			return channelKey{}, nil, ErrNotMember
+		}
+		for id := range members {
+			if sess, ok := c.online[id]; ok {
+				receivers = append(receivers, sess)
+			}
+		}
+		return channelKey{kind: ChannelGuild, a: req.Target}, receivers, nil
+	case ChannelPrivate:
+		if sess, ok := c.online[from]; ok {
+			receivers = append(receivers, sess)
+		}
+		if sess, ok := c.online[req.Target]; ok && req.Target != from {
+			receivers = append(receivers, sess)
+		}
+		return privateKey(from, req.Target), receivers, nil
+	}
+	return channelKey{}, nil, ErrNotMember
+}
+
+func privateKey(x, y int64) channelKey {
+	if x > y {
+		x, y = y, x
+	}
+	return channelKey{kind: ChannelPrivate, a: x, b: y}
+}
+
+// allow 固定窗口计数
+func (c *Chat) allow(playerId int64) bool {
+	if c.rateLimit <= 0 {
+		return true
+	}
+	now := c.now()
+	st, ok := c.rates[playerId]
+	if !ok || now.Sub(st.windowStart) >= c.ratePer {
+		c.rates[playerId] = &rateState{windowStart: now, count: 1}
+		return true
+	}
+	if st.count >= c.rateLimit {
+		return false
+	}
+	st.count++
+	return true
+}
+
+func (c *Chat) appendHistory(key channelKey, msg *Msg) {
+	if c.historyLen <= 0 {
+		return
+	}
+	h := append(c.history[key], msg)
+	if len(h) > c.historyLen {
+		h = append([]*Msg(nil), h[len(h)-c.historyLen:]...)
+	}
+	c.history[key] = h
+}
+
+// History 频道最近的消息，从旧到新。viewer用来检查公会/私聊的查看权限
+func (c *Chat) History(viewer int64, kind ChannelKind, target int64) ([]*Msg, error) {
+	switch kind {
+	case ChannelWorld:
+		return c.history[channelKey{kind: ChannelWorld}], nil
+	case ChannelGuild:
+		if _, in := c.guilds[target][viewer]; !in {
+			return nil, ErrNotMember
+		}
+		return c.history[channelKey{kind: ChannelGuild, a: target}], nil
+	case ChannelPrivate:
+		return c.history[privateKey(viewer, target)], nil
+	}
+	return nil, ErrNotMember
+}
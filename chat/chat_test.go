@@ -0,0 +1,144 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+	"test/gateway"
+	"testing"
+	"time"
+)
+
+func newTestChat(historyLen int, rateLimit int) (*Chat, *time.Time) {
+	c := New(historyLen, rateLimit, time.Minute)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	c.now = func() time.Time { return now }
+	// 推送走discard连接，这里只看权限和历史
+	g := gateway.NewGateway()
+	for id := int64(1); id <= 3; id++ {
+		c.Online(id, g.ReplaySession(uint64(id)))
+	}
+	return c, &now
+}
+
+func texts(msgs []*Msg) string {
+	var s []string
+	for _, m := range msgs {
+		s = append(s, m.Text)
+	}
+	return strings.Join(s, ",")
+}
+
+func TestRateLimit(t *testing.T) {
+	c, now := newTestChat(10, 2)
+	world := func(from int64, text string) error {
+		return c.Send(from, &SendReq{Kind: ChannelWorld, Text: text})
+	}
+	if err := world(1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	world(1, "b")
+	if err := world(1, "c"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("third message err = %v", err)
+	}
+	// 按人计数，别人不受影响
+	if err := world(2, "x"); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(time.Minute)
+	if err := world(1, "d"); err != nil {
+		t.Fatalf("next window err = %v", err)
+	}
+	// 被拦的消息不进历史；空消息和超长消息不占次数
+	if err := world(2, ""); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("empty err = %v", err)
+	}
+	if err := world(2, strings.Repeat("字", maxTextLen+1)); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("too long err = %v", err)
+	}
+	if err := world(2, "y"); err != nil {
+		t.Fatal(err)
+	}
+	h, _ := c.History(3, ChannelWorld, 0)
+	if texts(h) != "a,b,x,d,y" {
+		t.Fatalf("history %s", texts(h))
+	}
+}
+
+func TestHistoryTrim(t *testing.T) {
+	c, _ := newTestChat(3, 0)
+	for _, s := range []string{"1", "2", "3", "4", "5"} {
+		if err := c.Send(1, &SendReq{Kind: ChannelWorld, Text: s}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, _ := c.History(1, ChannelWorld, 0)
+	if texts(h) != "3,4,5" || cap(h) > 4 {
+		t.Fatalf("history %s, cap %d", texts(h), cap(h))
+	}
+}
+
+func TestFilter(t *testing.T) {
+	c, _ := newTestChat(10, 1)
+	c.SetFilter(func(from int64, text string) (string, bool) {
+		if strings.Contains(text, "spam") {
+			return "", false
+		}
+		return strings.ReplaceAll(text, "bad", "***"), true
+	})
+	if err := c.Send(1, &SendReq{Kind: ChannelWorld, Text: "buy spam"}); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("blocked err = %v", err)
+	}
+	if err := c.Send(2, &SendReq{Kind: ChannelWorld, Text: "bad day"}); err != nil {
+		t.Fatal(err)
+	}
+	h, _ := c.History(1, ChannelWorld, 0)
+	if texts(h) != "*** day" {
+		t.Fatalf("history %s", texts(h))
+	}
+}
+
+func TestMembership(t *testing.T) {
+	c, _ := newTestChat(10, 0)
+	c.JoinGuild(100, 1)
+	c.JoinGuild(100, 2)
+	guild := func(from int64, guildId int64, text string) error {
+		return c.Send(from, &SendReq{Kind: ChannelGuild, Target: guildId, Text: text})
+	}
+	if err := guild(1, 100, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if err := guild(3, 100, "let me in"); !errors.Is(err, ErrNotMember) {
+		t.Fatalf("outsider send err = %v", err)
+	}
+	if _, err := c.History(3, ChannelGuild, 100); !errors.Is(err, ErrNotMember) {
+		t.Fatalf("outsider history err = %v", err)
+	}
+	if h, err := c.History(2, ChannelGuild, 100); err != nil || texts(h) != "hi" {
+		t.Fatalf("member history %s, %v", texts(h), err)
+	}
+	// 换公会之后原来的频道发不了也看不了
+	c.JoinGuild(200, 2)
+	if err := guild(2, 100, "bye"); !errors.Is(err, ErrNotMember) {
+		t.Fatalf("left guild send err = %v", err)
+	}
+	if _, err := c.History(2, ChannelGuild, 100); !errors.Is(err, ErrNotMember) {
+		t.Fatalf("left guild history err = %v", err)
+	}
+	c.LeaveGuild(1)
+	if _, ok := c.guilds[100]; ok {
+		t.Fatal("empty guild kept")
+	}
+
+	// 私聊双方看到同一份历史，第三个人看不到
+	c.Send(1, &SendReq{Kind: ChannelPrivate, Target: 2, Text: "p1"})
+	c.Send(2, &SendReq{Kind: ChannelPrivate, Target: 1, Text: "p2"})
+	h1, _ := c.History(1, ChannelPrivate, 2)
+	h2, _ := c.History(2, ChannelPrivate, 1)
+	h3, _ := c.History(3, ChannelPrivate, 1)
+	if texts(h1) != "p1,p2" || texts(h2) != "p1,p2" || len(h3) != 0 {
+		t.Fatalf("private history %s / %s / %s", texts(h1), texts(h2), texts(h3))
+	}
+	if err := c.Send(1, &SendReq{Kind: 9, Text: "?"}); !errors.Is(err, ErrNotMember) {
+		t.Fatalf("unknown channel err = %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"test/admin"
+	"test/backup"
+	"test/db"
+	"test/discovery"
+	"test/gateway"
+	"test/timer"
+	"time"
+)
+
+type ServerConf struct {
+	MysqlConf   *db.MysqlConf        `xml:"mysql" json:"mysql"`
+	GatewayConf *gateway.GatewayConf `xml:"gateway" json:"gateway"`
+	AdminConf   *admin.AdminConf     `xml:"admin" json:"admin"` // 可选，不配不开admin接口
+	FlagsFile   string               `xml:"flags_file" json:"flags_file"`
+	BackupConf  *backup.BackupConf   `xml:"backup" json:"backup"` // 可选，不配不备份
+
+	DiscoveryConf   *discovery.DiscoveryConf `xml:"discovery" json:"discovery"`                   // 可选，不配不注册，多进程部署时见role.go
+	TimerMaxJumpSec int                      `xml:"timer_max_jump_sec" json:"timer_max_jump_sec"` // 系统时间往前跳时每次打点最多补多少秒的触发器，0不限制，见timer/clock.go
+	TickBudgetMs    int                      `xml:"tick_budget_ms" json:"tick_budget_ms"`         // 主循环一个tick的耗时超过这个值打出最耗时的几项，0用默认200ms，见metrics/budget.go
+	Timezone        string                   `xml:"timezone" json:"timezone"`                     // 服务器时区（IANA名），不填或Local用机器本地时区，见gtime
+	CrashLoop       *CrashLoopConf           `xml:"crash_loop" json:"crash_loop"`                 // 可选，不配不检测崩溃循环，见crashloop.go
+	AuditFile       string                   `xml:"audit_file" json:"audit_file"`                 // 审计日志文件（只追加），不填只写库，见audit
+	TimerLimit      *timer.LimitConf         `xml:"timer_limit" json:"timer_limit"`               // 可选，不配不限制待触发数，见timer/limit.go
+}
+
+// 启动时必须存在的文件
+var requiredPaths = []string{
+	"./tool_gen_code/code_template.tpl",
+	"./tool_gen_code/test_template.tpl",
+	"./tool_gen_code/cs_template.tpl",
+	"./tool_gen_code/ts_template.tpl",
+	"./tool_gen_code/chart.xlsx",
+}
+
+// loadConf 读配置并检查，所有问题收集起来一起返回，不会遇到第一个就停
+func loadConf(path string) (*ServerConf, []string) {
+	var problems []string
+	for _, p := range requiredPaths {
+		if _, err := os.Stat(p); err != nil {
+			problems = append(problems, fmt.Sprintf("required file %s: %s", p, err.Error()))
+		}
+	}
+	confFile, err := os.ReadFile(path)
+	if err != nil {
+		return nil, append(problems, fmt.Sprintf("read %s: %s", path, err.Error()))
+	}
+	conf := &ServerConf{}
+	if err = xml.Unmarshal(confFile, conf); err != nil {
+		return nil, append(problems, fmt.Sprintf("%s unmarshal: %s", path, err.Error()))
+	}
+	if conf.MysqlConf == nil {
+		problems = append(problems, "<mysql> section is missing")
+	} else {
+		for _, e := range conf.MysqlConf.Validate() {
+			problems = append(problems, "<mysql> "+e.Error())
+		}
+	}
+	if conf.GatewayConf == nil {
+		problems = append(problems, "<gateway> section is missing")
+	} else {
+		for _, e := range conf.GatewayConf.Validate() {
+			problems = append(problems, "<gateway> "+e.Error())
+		}
+	}
+	if conf.AdminConf != nil {
+		for _, e := range conf.AdminConf.Validate() {
+			problems = append(problems, "<admin> "+e.Error())
+		}
+	}
+	if conf.BackupConf != nil {
+		for _, e := range conf.BackupConf.Validate() {
+			problems = append(problems, "<backup> "+e.Error())
+		}
+	}
+	if conf.DiscoveryConf != nil {
+		for _, e := range conf.DiscoveryConf.Validate() {
+			problems = append(problems, "<discovery> "+e.Error())
+		}
+	}
+	if conf.CrashLoop != nil {
+		for _, e := range conf.CrashLoop.Validate() {
+			problems = append(problems, "<crash_loop> "+e.Error())
+		}
+	}
+	if conf.TimerLimit != nil {
+		for _, e := range conf.TimerLimit.Validate() {
+			problems = append(problems, "<timer_limit> "+e.Error())
+		}
+	}
+	if conf.TimerMaxJumpSec < 0 {
+		problems = append(problems, fmt.Sprintf("<timer_max_jump_sec> %d must not be negative", conf.TimerMaxJumpSec))
+	}
+	if conf.Timezone != "" {
+		if _, err := time.LoadLocation(conf.Timezone); err != nil {
+			problems = append(problems, fmt.Sprintf("<timezone> %s", err.Error()))
+		}
+	}
+	if conf.TickBudgetMs < 0 {
+		problems = append(problems, fmt.Sprintf("<tick_budget_ms> %d must not be negative", conf.TickBudgetMs))
+	}
+	if conf.FlagsFile != "" {
+		if _, err := os.Stat(conf.FlagsFile); err != nil {
+			problems = append(problems, fmt.Sprintf("<flags_file> %s", err.Error()))
+		}
+	}
+	return conf, problems
+}
+
+// mustLoadConf 有任何问题都一次性打印出来然后退出，role是-role参数，角色需要的配置也在这里检查
+func mustLoadConf(path string, role string) *ServerConf {
+	conf, problems := loadConf(path)
+	if conf != nil {
+		problems = append(problems, checkRole(role, conf)...)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "Server start failed, %d config problem(s) in %s:\n  - %s\n", len(problems), path, strings.Join(problems, "\n  - "))
+		os.Exit(1)
+	}
+	return conf
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"test/db"
+	"time"
+)
+
+// 主goroutine panic时的最后一搏：先把脏数据和db队列里的写入尽量落库（有时间上限），再写一份崩溃报告，然后照常panic退出。
+// 只管得到主goroutine（主循环、handler、timer回调都在这里），其他goroutine的panic recover不到
+
+const (
+	crashFlushTimeout = 5 * time.Second
+	crashReportDir    = "crash_reports"
+)
+
+type flushOutcome struct {
+	Rounds      int
+	Queued      int // 丢进db队列的脏数据条数（多轮累计）
+	DirtyLeft   int // 超时时还没落库的脏数据
+	PendingLeft int // 超时时db队列里还没执行的
+	Elapsed     time.Duration
+}
+
+// handleCrash 在main里defer，要排在ReleaseMysqlPool的defer之后注册（先于它执行）
+func handleCrash() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := debug.Stack()
+	log.Printf("PANIC: %v, emergency flush start", r)
+	outcome := emergencyFlush(crashFlushTimeout)
+	log.Printf("emergency flush done: %+v", outcome)
+	if path, err := writeCrashReport(r, stack, outcome); err != nil {
+		log.Printf("write crash report failed: %s", err.Error())
+	} else {
+		log.Printf("crash report written to %s", path)
+	}
+	runTracker.endRun(false, fmt.Sprintf("panic: %v", r))
+	panic(r)
+}
+
+// emergencyFlush db队列只有几十个位置，脏数据一轮丢不完，所以是 Flush->等队列清空 循环到全部落库或者超时
+func emergencyFlush(timeout time.Duration) (o flushOutcome) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	pool := db.GetDbPool()
+	defer func() {
+		o.Elapsed = time.Since(start)
+		if r := recover(); r != nil {
+			// 内存数据可能已经是坏的，序列化的时候再panic就不管了
+			log.Printf("emergency flush panicked: %v", r)
+			o.DirtyLeft = db.DirtyCount()
+			o.PendingLeft = pool.Pending()
+		}
+	}()
+	if !pool.Inited {
+		o.DirtyLeft = db.DirtyCount()
+		return
+	}
+	for time.Now().Before(deadline) {
+		o.Rounds++
+		o.Queued += db.FlushAllDirty()
+		o.PendingLeft = pool.Drain(deadline)
+		o.DirtyLeft = db.DirtyCount()
+		if o.DirtyLeft == 0 && o.PendingLeft == 0 {
+			break
+		}
+	}
+	return
+}
+
+func writeCrashReport(r any, stack []byte, o flushOutcome) (string, error) {
+	if err := os.MkdirAll(crashReportDir, 0755); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	path := fmt.Sprintf("%s/crash_%s_%d.txt", crashReportDir, now.Format("20060102_150405"), os.Getpid())
+	content := fmt.Sprintf("time: %s\npanic: %v\n\nflush: rounds=%d queued=%d dirty_left=%d pending_left=%d elapsed=%v\n\n%s",
+		now.Format("2006-01-02 15:04:05.000"), r, o.Rounds, o.Queued, o.DirtyLeft, o.PendingLeft, o.Elapsed, stack)
+	return path, os.WriteFile(path, []byte(content), 0644)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"test/admin"
+	"test/gtime"
+	"time"
+)
+
+// 崩溃循环检测：每次启动往状态文件里记一条运行记录，正常停服时标记clean，panic时记下原因。
+// 启动时上一条没有标记clean的（panic、被kill -9、机器掉电）都算一次异常退出，最近window_min分钟内异常退出达到max_crashes次就进安全模式：
+// 不开网关和服务发现（不接玩家流量）、db只读、主循环不跑timer，只有admin接口能用，等运维上去看日志、改配置、修数据。
+// 处理完了POST /safe-mode/clear清掉异常记录，再重启就是正常模式。-safe-mode参数可以直接以安全模式启动
+
+const maxRunRecords = 20
+
+type CrashLoopConf struct {
+	MaxCrashes int `xml:"max_crashes" json:"max_crashes"` // 窗口内异常退出多少次进安全模式
+	WindowMin  int `xml:"window_min" json:"window_min"`   // 窗口长度（分钟）
+}
+
+func (c *CrashLoopConf) Validate() (errs []error) {
+	if c.MaxCrashes <= 0 {
+		errs = append(errs, fmt.Errorf("max_crashes %d must be positive", c.MaxCrashes))
+	}
+	if c.WindowMin <= 0 {
+		errs = append(errs, fmt.Errorf("window_min %d must be positive", c.WindowMin))
+	}
+	return
+}
+
+type runRecord struct {
+	Pid    int       `json:"pid"`
+	Start  time.Time `json:"start"`
+	Exit   time.Time `json:"exit"` // 零值表示没有正常走到退出流程（当前进程，或者被kill -9）
+	Clean  bool      `json:"clean"`
+	Reason string    `json:"reason,omitempty"` // 异常退出的原因，被kill -9的没有
+}
+
+type crashState struct {
+	Runs []*runRecord `json:"runs"` // 从旧到新，最后一条是当前进程
+}
+
+type crashTracker struct {
+	path     string
+	state    crashState
+	cur      *runRecord
+	safeMode bool
+	why      string
+}
+
+var runTracker *crashTracker
+
+func loadCrashState(path string) crashState {
+	var st crashState
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("read crash state %s failed, start fresh: %s", path, err.Error())
+		}
+		return st
+	}
+	if err = json.Unmarshal(b, &st); err != nil {
+		log.Printf("bad crash state %s, start fresh: %s", path, err.Error())
+		return crashState{}
+	}
+	return st
+}
+
+// abnormalSince now之前window内的异常退出
+func (st *crashState) abnormalSince(since time.Time) (n int) {
+	for _, r := range st.Runs {
+		if !r.Clean && !r.Start.Before(since) {
+			n++
+		}
+	}
+	return
+}
+
+// beginRun 启动时调，记下这次运行并判断要不要进安全模式。conf为nil时只在force时进
+func beginRun(path string, conf *CrashLoopConf, force bool, now time.Time) *crashTracker {
+	t := &crashTracker{path: path, state: loadCrashState(path)}
+	if force {
+		t.safeMode, t.why = true, "-safe-mode flag"
+	} else if conf != nil {
+		since := now.Add(-time.Duration(conf.WindowMin) * time.Minute)
+		if n := t.state.abnormalSince(since); n >= conf.MaxCrashes {
+			t.safeMode = true
+			t.why = fmt.Sprintf("%d abnormal exits since %s", n, gtime.FormatStandard(since))
+		}
+	}
+	t.cur = &runRecord{Pid: os.Getpid(), Start: now}
+	t.state.Runs = append(t.state.Runs, t.cur)
+	if len(t.state.Runs) > maxRunRecords {
+		t.state.Runs = t.state.Runs[len(t.state.Runs)-maxRunRecords:]
+	}
+	t.save()
+	if t.safeMode {
+		log.Printf("WARNING: starting in SAFE MODE (%s): gateway closed, db read only, admin api only", t.why)
+	}
+	return t
+}
+
+func (t *crashTracker) save() {
+	b, _ := json.MarshalIndent(&t.state, "", "  ")
+	if err := os.WriteFile(t.path, b, 0644); err != nil {
+		log.Printf("write crash state %s failed: %s", t.path, err.Error())
+	}
+}
+
+// endRun 退出时调。clean=false的reason写panic内容之类
+func (t *crashTracker) endRun(clean bool, reason string) {
+	if t == nil {
+		return
+	}
+	t.cur.Exit = time.Now()
+	t.cur.Clean = clean
+	t.cur.Reason = reason
+	t.save()
+}
+
+// clear 清掉之前的异常退出记录，下次启动按正常模式
+func (t *crashTracker) clear() {
+	for _, r := range t.state.Runs {
+		if r != t.cur && !r.Clean {
+			r.Clean = true
+			r.Reason += " (cleared)"
+		}
+	}
+	t.save()
+	log.Printf("crash history cleared, next start will be in normal mode")
+}
+
+func inSafeMode() bool {
+	return runTracker != nil && runTracker.safeMode
+}
+
+// serveSafeMode 安全模式下只开着admin跑主循环（处理admin的runOnLoop和退出信号），/readyz一直是503
+func serveSafeMode(hasAdmin bool) {
+	if !hasAdmin {
+		log.Printf("WARNING: safe mode without <admin> configured, only signals can stop the server")
+	}
+	admin.GetInst().AddReadyCheck("safe_mode", func() error {
+		return fmt.Errorf("server is in safe mode: %s", runTracker.why)
+	})
+	Loop()
+	runTracker.endRun(true, "")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 守护进程模式：
+//   ./test -daemon            后台启动，写pid文件，stdout/stderr都重定向到logs/server.log（按天/按大小切分）
+//   ./test -stop              给pid文件里记的进程发SIGTERM并等它退出，代替手动ps+kill
+// -pid和-log-dir可以改pid文件和日志目录，-stop时-pid要和启动时一致
+
+const (
+	daemonChildEnv   = "SERVER_DAEMON_CHILD" // 子进程的标记，有这个环境变量说明已经是后台进程了
+	stopWaitTimeout  = 30 * time.Second
+	logFileName      = "server.log"
+	logMaxSize       = 512 << 20 // 单个日志文件超过这个大小也切
+	logKeepBackups   = 14
+	logCheckInterval = time.Minute
+)
+
+var errNotRunning = errors.New("server is not running")
+
+func isDaemonChild() bool {
+	return os.Getenv(daemonChildEnv) == "1"
+}
+
+// readPid 读pid文件，进程已经不在了也返回errNotRunning
+func readPid(pidFile string) (int, error) {
+	b, err := os.ReadFile(pidFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, errNotRunning
+	}
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("bad pid file %s: %w", pidFile, err)
+	}
+	if !processAlive(pid) {
+		return pid, errNotRunning
+	}
+	return pid, nil
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	return err == nil && p.Signal(syscall.Signal(0)) == nil
+}
+
+// writePidFile 已经有一个活着的进程占着pid文件时拒绝启动，残留的（上次被kill -9）直接覆盖
+func writePidFile(pidFile string) error {
+	if pid, err := readPid(pidFile); err == nil && pid != os.Getpid() {
+		return fmt.Errorf("server already running with pid %d (%s)", pid, pidFile)
+	}
+	return os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644)
+}
+
+// removePidFile 只删自己写的，防止把新起的进程的pid文件删掉
+func removePidFile(pidFile string) {
+	if pid, _ := readPid(pidFile); pid == os.Getpid() {
+		os.Remove(pidFile)
+	}
+}
+
+// stopDaemon -stop用，返回进程退出码
+func stopDaemon(pidFile string) int {
+	pid, err := readPid(pidFile)
+	if errors.Is(err, errNotRunning) {
+		fmt.Fprintf(os.Stderr, "%s (pid file %s)\n", err.Error(), pidFile)
+		os.Remove(pidFile)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	p, err := os.FindProcess(pid)
+	if err == nil {
+		err = p.Signal(syscall.SIGTERM)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "send SIGTERM to %d failed: %s\n", pid, err.Error())
+		return 1
+	}
+	fmt.Printf("SIGTERM sent to %d, waiting for exit...\n", pid)
+	deadline := time.Now().Add(stopWaitTimeout)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			fmt.Printf("server %d stopped\n", pid)
+			return 0
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	fmt.Fprintf(os.Stderr, "server %d still running after %v, check %s\n", pid, stopWaitTimeout, logFileName)
+	return 1
+}
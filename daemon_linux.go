@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// startDaemon 用同样的参数再起一个脱离终端的自己（新session），父进程打印子进程pid后退出。
+// 子进程的fd 1/2直接指向日志文件，fmt.Printf、log和runtime的panic堆栈都会进日志
+func startDaemon(pidFile, logDir string) error {
+	if pid, err := readPid(pidFile); err == nil {
+		return fmt.Errorf("server already running with pid %d (%s)", pid, pidFile)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(logDir, 0755); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(filepath.Join(logDir, logFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+	wd, _ := os.Getwd()
+	p, err := os.StartProcess(exe, os.Args, &os.ProcAttr{
+		Dir:   wd,
+		Env:   append(os.Environ(), daemonChildEnv+"=1"),
+		Files: []*os.File{devNull, logFile, logFile},
+		Sys:   &syscall.SysProcAttr{Setsid: true},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("server started in background, pid %d, log %s\n", p.Pid, logFile.Name())
+	return p.Release()
+}
+
+// startLogRotate 子进程里跑，跨天或者超过logMaxSize时把server.log改名成server.log.日期[.序号]，
+// 重新打开一个server.log再dup到fd 1/2上。旧文件只留logKeepBackups个
+func startLogRotate(logDir string) {
+	path := filepath.Join(logDir, logFileName)
+	day := time.Now().Format("20060102")
+	go func() {
+		tk := time.NewTicker(logCheckInterval)
+		defer tk.Stop()
+		for now := range tk.C {
+			st, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			today := now.Format("20060102")
+			if today == day && st.Size() < logMaxSize {
+				continue
+			}
+			if err = rotateLog(path, day); err != nil {
+				fmt.Fprintf(os.Stderr, "rotate log failed: %s\n", err.Error())
+				continue
+			}
+			day = today
+			trimLogBackups(path)
+		}
+	}()
+}
+
+func rotateLog(path, day string) error {
+	backup := path + "." + day
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			break
+		}
+		backup = fmt.Sprintf("%s.%s.%d", path, day, i)
+	}
+	if err := os.Rename(path, backup); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, fd := range []int{1, 2} {
+		if err = syscall.Dup3(int(f.Fd()), fd, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func trimLogBackups(path string) {
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) <= logKeepBackups {
+		return
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		si, _ := os.Stat(backups[i])
+		sj, _ := os.Stat(backups[j])
+		return si != nil && sj != nil && si.ModTime().Before(sj.ModTime())
+	})
+	for _, b := range backups[:len(backups)-logKeepBackups] {
+		os.Remove(b)
+	}
+}
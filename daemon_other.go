@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+var errDaemonUnsupported = errors.New("daemon mode is only supported on linux")
+
+func startDaemon(pidFile, logDir string) error {
+	return errDaemonUnsupported
+}
+
+func startLogRotate(logDir string) {}
@@ -0,0 +1,321 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"test/metrics"
+	"time"
+)
+
+// 运营统计日志（登录、消费、产出、关卡……）：玩法里Track一下就返回，不进玩法的查询队列。
+// 后台goroutine攒批，按表拼成一条多行insert写进日志表；写库失败（库挂了、熔断了）就追加到spool目录下的jsonl文件，
+// 等库恢复之后下一次写成功时把文件补写回去。channel满了直接丢，不会卡主循环，丢了多少看db.analytics.dropped
+//
+// 日志表第一列固定是event_time（BIGINT，秒），后面是RegisterAnalytics时给的列，建表语句例：
+// CREATE TABLE log_login (
+//   id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//   event_time BIGINT NOT NULL,
+//   player_id BIGINT NOT NULL,
+//   ip VARCHAR(64) NOT NULL,
+//   KEY (event_time)
+// );
+
+var ErrAnalyticsTable = errors.New("analytics table not registered")
+
+type AnalyticsOptions struct {
+	BufferSize    int           // channel长度，默认10000
+	BatchSize     int           // 一张表攒够多少条写一次，默认200
+	FlushInterval time.Duration // 没攒够也最多隔多久写一次，默认1秒
+	SpoolDir      string        // 写库失败时落文件的目录，空串表示直接丢
+}
+
+type analyticsRow struct {
+	Table  string `json:"table"`
+	Time   int64  `json:"time"`
+	Values []any  `json:"values"`
+}
+
+type Analytics struct {
+	pool    Pool
+	opts    AnalyticsOptions
+	m       sync.RWMutex
+	columns map[string][]string
+	ch      chan *analyticsRow
+	stop    chan struct{}
+	done    chan struct{}
+	spooled bool // spool目录里可能有没补写的文件，只在后台goroutine里读写
+
+	rotation *LogRotation // 不为nil时按月分的表按event_time写到对应月份，见log_rotate.go
+}
+
+func NewAnalytics() *Analytics {
+	return &Analytics{columns: make(map[string][]string)}
+}
+
+var analytics = NewAnalytics()
+
+func GetAnalytics() *Analytics {
+	return analytics
+}
+
+// RegisterAnalytics 登记一张日志表和它的列（不含event_time），Track时values按这个顺序给
+func (a *Analytics) RegisterAnalytics(table string, columns ...string) error {
+	if err := checkIdent(table); err != nil {
+		return err
+	}
+	for _, c := range columns {
+		if err := checkIdent(c); err != nil {
+			return err
+		}
+	}
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.columns[table] = columns
+	return nil
+}
+
+// Start 开后台goroutine，之前Track的都会丢掉
+func (a *Analytics) Start(pool Pool, opts AnalyticsOptions) {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 10000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 200
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	a.pool = pool
+	a.opts = opts
+	a.ch = make(chan *analyticsRow, opts.BufferSize)
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	a.spooled = opts.SpoolDir != ""
+	go a.loop()
+}
+
+// Stop 把channel里剩下的写完（写不进库就落文件）再返回，停服时调
+func (a *Analytics) Stop() {
+	if a.stop == nil {
+		return
+	}
+	close(a.stop)
+	<-a.done
+}
+
+// SetRotation Start之前调，登记在rotation里的表写到按月分的表
+func (a *Analytics) SetRotation(r *LogRotation) {
+	a.rotation = r
+}
+
+// Track 任何goroutine都能调，不阻塞。values个数要和登记的列数一致
+func (a *Analytics) Track(table string, values ...any) error {
+	a.m.RLock()
+	cols, ok := a.columns[table]
+	a.m.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAnalyticsTable, table)
+	}
+	if len(values) != len(cols) {
+		return fmt.Errorf("analytics %s wants %d values, got %d", table, len(cols), len(values))
+	}
+	if a.ch == nil {
+		metrics.GetCounter("db.analytics.dropped").Inc()
+		return nil
+	}
+	select {
+	case a.ch <- &analyticsRow{Table: table, Time: time.Now().Unix(), Values: values}:
+	default:
+		metrics.GetCounter("db.analytics.dropped").Inc()
+	}
+	return nil
+}
+
+func (a *Analytics) loop() {
+	defer close(a.done)
+	tk := time.NewTicker(a.opts.FlushInterval)
+	defer tk.Stop()
+	batches := make(map[string][]*analyticsRow)
+	for {
+		select {
+		case r := <-a.ch:
+			batches[r.Table] = append(batches[r.Table], r)
+			if len(batches[r.Table]) >= a.opts.BatchSize {
+				a.write(r.Table, batches[r.Table])
+				delete(batches, r.Table)
+			}
+		case <-tk.C:
+			for table, rows := range batches {
+				a.write(table, rows)
+				delete(batches, table)
+			}
+			metrics.GetGauge("db.analytics.queue").Set(int64(len(a.ch)))
+		case <-a.stop:
+			for len(a.ch) > 0 {
+				r := <-a.ch
+				batches[r.Table] = append(batches[r.Table], r)
+			}
+			for table, rows := range batches {
+				a.write(table, rows)
+			}
+			return
+		}
+	}
+}
+
+// write 写库，失败落文件；写成功并且之前落过文件的话顺便补写
+func (a *Analytics) write(table string, rows []*analyticsRow) {
+	if err := a.insert(table, rows); err != nil {
+		metrics.GetCounter("db.analytics.failed").Add(int64(len(rows)))
+		if a.opts.SpoolDir == "" {
+			log.Printf("analytics insert %s failed, %d rows dropped: %s", table, len(rows), err.Error())
+			return
+		}
+		if err2 := a.spool(table, rows); err2 != nil {
+			log.Printf("analytics insert %s failed and spool failed, %d rows dropped: %s / %s", table, len(rows), err.Error(), err2.Error())
+			return
+		}
+		a.spooled = true
+		return
+	}
+	metrics.GetCounter("db.analytics.written").Add(int64(len(rows)))
+	if a.spooled {
+		a.replay()
+	}
+}
+
+// insert 按月分表的拆成每个月一条insert
+func (a *Analytics) insert(table string, rows []*analyticsRow) error {
+	if a.rotation == nil || !a.rotation.Rotated(table) {
+		return a.insertInto(table, table, rows)
+	}
+	var months []string
+	buckets := make(map[string][]*analyticsRow)
+	for _, r := range rows {
+		name := a.rotation.TableFor(table, time.Unix(r.Time, 0))
+		if _, ok := buckets[name]; !ok {
+			months = append(months, name)
+		}
+		buckets[name] = append(buckets[name], r)
+	}
+	for _, name := range months {
+		if err := a.insertInto(table, name, buckets[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Analytics) insertInto(table string, target string, rows []*analyticsRow) error {
+	a.m.RLock()
+	cols := a.columns[table]
+	a.m.RUnlock()
+	one := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(cols)+1), ", ") + ")"
+	var sb strings.Builder
+	sb.WriteString("insert into " + target + " (event_time")
+	for _, c := range cols {
+		sb.WriteString(", " + c)
+	}
+	sb.WriteString(") values ")
+	args := make([]any, 0, len(rows)*(len(cols)+1))
+	for i, r := range rows {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(one)
+		args = append(args, r.Time)
+		args = append(args, r.Values...)
+	}
+	sb.WriteString(";")
+	return a.pool.Exec(sb.String(), args...)
+}
+
+func spoolFile(dir string, table string, t time.Time) string {
+	return filepath.Join(dir, table+"_"+t.Format("20060102")+".jsonl")
+}
+
+func (a *Analytics) spool(table string, rows []*analyticsRow) error {
+	if err := os.MkdirAll(a.opts.SpoolDir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(spoolFile(a.opts.SpoolDir, table, time.Now()), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range rows {
+		if err = enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replay 把spool目录下的文件按时间顺序补写回库，写完一个删一个，中途失败留着下次再补（同一个文件里已经写进去的批次会重复，统计日志能接受）
+func (a *Analytics) replay() {
+	files, err := filepath.Glob(filepath.Join(a.opts.SpoolDir, "*.jsonl"))
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	for _, path := range files {
+		if err = a.replayFile(path); err != nil {
+			log.Printf("analytics replay %s failed, retry later: %s", path, err.Error())
+			return
+		}
+		os.Remove(path)
+		log.Printf("analytics spool %s replayed", path)
+	}
+	a.spooled = false
+}
+
+func (a *Analytics) replayFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	batches := make(map[string][]*analyticsRow)
+	dec := json.NewDecoder(f)
+	dec.UseNumber() // 不然整数会变成float64，大的id丢精度
+	for dec.More() {
+		r := &analyticsRow{}
+		if err = dec.Decode(r); err != nil {
+			return err
+		}
+		a.m.RLock()
+		cols, ok := a.columns[r.Table]
+		a.m.RUnlock()
+		if !ok || len(cols) != len(r.Values) {
+			log.Printf("analytics replay %s: table %s not registered or columns changed, row dropped", path, r.Table)
+			continue
+		}
+		batches[r.Table] = append(batches[r.Table], r)
+		if len(batches[r.Table]) >= a.opts.BatchSize {
+			if err = a.insert(r.Table, batches[r.Table]); err != nil {
+				return err
+			}
+			delete(batches, r.Table)
+		}
+	}
+	for table, rows := range batches {
+		if err = a.insert(table, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
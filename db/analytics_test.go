@@ -0,0 +1,80 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// analyticsPool 只记Exec，down为true时全部失败
+type analyticsPool struct {
+	FakePool
+	mu    sync.Mutex
+	down  bool
+	stmts []string
+	rows  int
+}
+
+func (p *analyticsPool) Exec(sql string, args ...any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("db down")
+	}
+	p.stmts = append(p.stmts, sql)
+	p.rows += len(args) / 3
+	return nil
+}
+
+func TestAnalytics(t *testing.T) {
+	dir := t.TempDir()
+	pool := &analyticsPool{}
+	a := NewAnalytics()
+	if err := a.RegisterAnalytics("log_login", "player_id", "ip"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.RegisterAnalytics("log;drop", "x"); err == nil {
+		t.Fatal("illegal table name should fail")
+	}
+	a.Start(pool, AnalyticsOptions{BatchSize: 2, FlushInterval: 20 * time.Millisecond, SpoolDir: dir})
+	if err := a.Track("log_other", 1); !errors.Is(err, ErrAnalyticsTable) {
+		t.Fatal(err)
+	}
+	if err := a.Track("log_login", 1); err == nil {
+		t.Fatal("wrong value count should fail")
+	}
+	a.Track("log_login", int64(1), "1.1.1.1")
+	a.Track("log_login", int64(2), "2.2.2.2")
+	time.Sleep(100 * time.Millisecond)
+	pool.mu.Lock()
+	if len(pool.stmts) != 1 || pool.rows != 2 || !strings.HasPrefix(pool.stmts[0], "insert into log_login (event_time, player_id, ip) values (?, ?, ?), (?, ?, ?)") {
+		t.Fatalf("stmts %v rows %d", pool.stmts, pool.rows)
+	}
+	pool.down = true
+	pool.mu.Unlock()
+
+	// 库挂了落文件
+	a.Track("log_login", int64(3), "3.3.3.3")
+	time.Sleep(100 * time.Millisecond)
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("spool files %v", files)
+	}
+
+	// 恢复之后下一次写成功时补写
+	pool.mu.Lock()
+	pool.down = false
+	pool.mu.Unlock()
+	a.Track("log_login", int64(4), "4.4.4.4")
+	a.Stop()
+	if _, err := os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Fatalf("spool file should be removed: %v", err)
+	}
+	if pool.rows != 4 {
+		t.Fatalf("rows %d", pool.rows)
+	}
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+// 大的玩家存档（protobuf序列化后的blob）压缩后再存库。
+// 压缩后的数据带11字节头：2字节magic + 1字节格式 + 4字节原始长度 + 4字节原始数据的crc32（都是大端），读的时候按头自动识别；
+// 头校验不过的（magic对不上、格式不认识、长度或crc对不上）都按未压缩的老数据原样返回，所以开压缩不用洗库，
+// 老数据碰巧以magic开头也不会被误当成压缩数据
+//
+// 存档表约定两列：
+// CREATE TABLE player_save (
+//   id BIGINT NOT NULL PRIMARY KEY,
+//   data MEDIUMBLOB
+// );
+
+type BlobFormat byte
+
+const (
+	BlobRaw    BlobFormat = 0
+	BlobGzip   BlobFormat = 1
+	BlobSnappy BlobFormat = 2
+)
+
+var blobMagic = [2]byte{0xB1, 0x0B}
+
+const (
+	blobHeadLen = 11
+	// 小于这个长度的不压缩（压完可能更大），只加个头
+	blobMinCompress = 256
+)
+
+func ParseBlobFormat(s string) (BlobFormat, error) {
+	switch s {
+	case "", "none":
+		return BlobRaw, nil
+	case "gzip":
+		return BlobGzip, nil
+	case "snappy":
+		return BlobSnappy, nil
+	}
+	return BlobRaw, fmt.Errorf("unknown blob compress %q, must be none/gzip/snappy", s)
+}
+
+// CompressBlob 按format压缩并加头，BlobRaw时原样返回（不加头，和老数据一样）
+func CompressBlob(data []byte, format BlobFormat) ([]byte, error) {
+	if format == BlobRaw {
+		return data, nil
+	}
+	if len(data) < blobMinCompress {
+		format = BlobRaw
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, blobHeadLen+len(data)/2))
+	buf.Write(blobMagic[:])
+	buf.WriteByte(byte(format))
+	var sum [8]byte
+	binary.BigEndian.PutUint32(sum[:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(sum[4:], crc32.ChecksumIEEE(data))
+	buf.Write(sum[:])
+	switch format {
+	case BlobRaw:
+		buf.Write(data)
+	case BlobGzip:
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case BlobSnappy:
+		buf.Write(snappy.Encode(nil, data))
+	default:
+		return nil, fmt.Errorf("CompressBlob error: unknown format %d", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecompressBlob 按头识别格式解压，头校验不过的按老数据原样返回。
+// 真正压缩过的数据坏了也会走到原样返回，由后面的proto.Unmarshal报错
+func DecompressBlob(b []byte) ([]byte, error) {
+	if len(b) < blobHeadLen || b[0] != blobMagic[0] || b[1] != blobMagic[1] {
+		return b, nil
+	}
+	rawLen := binary.BigEndian.Uint32(b[3:7])
+	sum := binary.BigEndian.Uint32(b[7:11])
+	raw, err := decodeBlobBody(BlobFormat(b[2]), b[blobHeadLen:], rawLen)
+	if err != nil || uint32(len(raw)) != rawLen || crc32.ChecksumIEEE(raw) != sum {
+		return b, nil
+	}
+	return raw, nil
+}
+
+// decodeBlobBody 解压头后面的部分，解出来超过rawLen就不再读，避免老数据被当成gzip时解出一大坨
+func decodeBlobBody(format BlobFormat, body []byte, rawLen uint32) ([]byte, error) {
+	switch format {
+	case BlobRaw:
+		return body, nil
+	case BlobGzip:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(io.LimitReader(r, int64(rawLen)+1))
+	case BlobSnappy:
+		if n, err := snappy.DecodedLen(body); err != nil || uint32(n) != rawLen {
+			return nil, errors.New("snappy length mismatch")
+		}
+		return snappy.Decode(nil, body)
+	}
+	return nil, fmt.Errorf("unknown format %d", format)
+}
+
+// SaveBlob 序列化+压缩后写进table的data列，格式用配置里的blob_compress
+func (mysql *MysqlPool) SaveBlob(table string, key any, pb proto.Message) error {
+	b, err := mysql.encodeBlob(table, pb)
+	if err != nil {
+		return err
+	}
+	return mysql.Exec("replace into "+table+" (id, data) values (?, ?);", key, b)
+}
+
+// LoadBlob 读出来解压后Unmarshal进pb，没有这一行返回ErrNoRows
+func (mysql *MysqlPool) LoadBlob(table string, key any, pb proto.Message) error {
+	if !identReg.MatchString(table) {
+		return fmt.Errorf("LoadBlob error: illegal table name %q", table)
+	}
+	rows, err := mysql.Query("select data from "+table+" where id = ?;", key)
+	if err != nil {
+		return err
+	}
+	return decodeBlob(rows[0].Data["data"], pb)
+}
+
+// AddSaveBlob 异步版本。pb在调用方的goroutine里就序列化好，之后改pb不影响这次存的内容
+func (mysql *MysqlPool) AddSaveBlob(table string, key any, pb proto.Message, cb func(error)) error {
+	b, err := mysql.encodeBlob(table, pb)
+	if err != nil {
+		return err
+	}
+	return mysql.AddQuery(&SqlQuery{
+		Stmt:     "replace into " + table + " (id, data) values (?, ?);",
+		Args:     []any{key, b},
+		Priority: PriorityHigh,
+		CbFunc: func(_ []*DBData, err error) {
+			cb(err)
+		},
+	})
+}
+
+// AddLoadBlob 异步版本，cb在db的Loop goroutine里执行，cb之前不要碰pb
+func (mysql *MysqlPool) AddLoadBlob(table string, key any, pb proto.Message, cb func(error)) error {
+	if !identReg.MatchString(table) {
+		return fmt.Errorf("AddLoadBlob error: illegal table name %q", table)
+	}
+	return mysql.AddQuery(&SqlQuery{
+		Stmt: "select data from " + table + " where id = ?;",
+		Args: []any{key},
+		CbFunc: func(rows []*DBData, err error) {
+			if err != nil {
+				cb(err)
+				return
+			}
+			cb(decodeBlob(rows[0].Data["data"], pb))
+		},
+	})
+}
+
+func (mysql *MysqlPool) encodeBlob(table string, pb proto.Message) ([]byte, error) {
+	if !identReg.MatchString(table) {
+		return nil, fmt.Errorf("SaveBlob error: illegal table name %q", table)
+	}
+	b, err := proto.Marshal(pb)
+	if err != nil {
+		return nil, err
+	}
+	return CompressBlob(b, mysql.blobFormat)
+}
+
+func decodeBlob(b []byte, pb proto.Message) error {
+	if b == nil {
+		return errors.New("blob is null")
+	}
+	raw, err := DecompressBlob(b)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(raw, pb)
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBlobRoundTrip(t *testing.T) {
+	big := bytes.Repeat([]byte("player save data "), 100)
+	small := []byte("tiny")
+	for _, format := range []BlobFormat{BlobRaw, BlobGzip, BlobSnappy} {
+		for _, data := range [][]byte{big, small} {
+			b, err := CompressBlob(data, format)
+			if err != nil {
+				t.Fatalf("format %d compress error: %s", format, err.Error())
+			}
+			if format != BlobRaw && len(data) >= blobMinCompress && len(b) >= len(data) {
+				t.Errorf("format %d not compressed: %d -> %d", format, len(data), len(b))
+			}
+			raw, err := DecompressBlob(b)
+			if err != nil {
+				t.Fatalf("format %d decompress error: %s", format, err.Error())
+			}
+			if !bytes.Equal(raw, data) {
+				t.Errorf("format %d round trip mismatch", format)
+			}
+		}
+	}
+	// 没有头的老数据原样返回
+	if raw, _ := DecompressBlob(small); !bytes.Equal(raw, small) {
+		t.Errorf("legacy data changed")
+	}
+	// 老数据碰巧以magic开头，格式字节也认识，长度/crc对不上就原样返回
+	for _, legacy := range [][]byte{
+		append([]byte{0xB1, 0x0B, byte(BlobRaw)}, big...),
+		append([]byte{0xB1, 0x0B, byte(BlobGzip)}, big...),
+		append([]byte{0xB1, 0x0B, byte(BlobSnappy)}, big...),
+		{0xB1, 0x0B, byte(BlobRaw), 0, 0, 0, 0, 0, 0, 0, 1},
+		{0xB1, 0x0B, 9},
+	} {
+		raw, err := DecompressBlob(legacy)
+		if err != nil || !bytes.Equal(raw, legacy) {
+			t.Errorf("legacy blob % x... changed, err %v", legacy[:3], err)
+		}
+	}
+	// 压缩数据坏了crc对不上，也不会把半截数据当成正确结果
+	b, _ := CompressBlob(big, BlobSnappy)
+	b[len(b)-1] ^= 0xFF
+	if raw, _ := DecompressBlob(b); !bytes.Equal(raw, b) {
+		t.Errorf("corrupted blob decoded")
+	}
+}
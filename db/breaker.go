@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"test/metrics"
+	"time"
+)
+
+// 熔断：连续失败breaker_failures次后打开，打开期间所有查询直接返回ErrCircuitOpen，
+// 不再去连一个已经挂掉的库，也就不会把主循环的回调全堵在db队列后面。
+// 冷却时间过了进入半开，放一条查询过去探测，成功就关闭，失败继续打开
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	}
+	return "closed"
+}
+
+const defaultBreakerCooldown = 5 * time.Second
+
+type circuitBreaker struct {
+	m         sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     BreakerState
+	openedAt  time.Time
+	probing   bool // 半开时已经放出去一条探测
+}
+
+// newBreaker threshold<=0时返回nil，表示不开熔断，nil上的方法都能调
+func newBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *circuitBreaker) report(err error) {
+	if b == nil {
+		return
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	if !isBreakerFailure(err) {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.probing = false
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.probing = false
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// setState 调用方需持有b.m
+func (b *circuitBreaker) setState(s BreakerState) {
+	if b.state == s {
+		return
+	}
+	log.Printf("mysql circuit breaker %s -> %s", b.state, s)
+	b.state = s
+	metrics.GetGauge("db.breaker.state").Set(int64(s))
+}
+
+func (b *circuitBreaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.state
+}
+
+// isBreakerFailure 只有库连不上/超时才算失败，sql写错、查不到数据这种不算
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrConnLost) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// BreakerState 当前熔断状态，没开熔断时总是closed
+func (mysql *MysqlPool) BreakerState() BreakerState {
+	return mysql.breaker.State()
+}
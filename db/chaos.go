@@ -0,0 +1,111 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"test/metrics"
+	"time"
+)
+
+// 故障注入（只给测试环境用）：配置<chaos>后每条Query/Exec真正执行前按概率注入延迟、随机错误、断线，
+// 用来端到端验证重试、熔断（断线算熔断失败，随机错误不算）、队列落盘这些逻辑。注入点在熔断检查之后，熔断打开时不会再注入。
+// 正式环境千万别配，启动时会打一行很显眼的日志
+
+var ErrChaos = errors.New("mysql chaos injected error")
+
+type ChaosConf struct {
+	LatencyMs   int     `xml:"latency_ms" json:"latency_ms"`     // 注入的延迟上限，实际在[0, latency_ms]里随机
+	LatencyRate float64 `xml:"latency_rate" json:"latency_rate"` // 注入延迟的概率，0-1
+	ErrorRate   float64 `xml:"error_rate" json:"error_rate"`     // 返回ErrChaos的概率
+	DropRate    float64 `xml:"drop_rate" json:"drop_rate"`       // 返回ErrConnLost（模拟断线）的概率
+	Seed        int64   `xml:"seed" json:"seed"`                 // 随机种子，0用当前时间，想复现同一串故障就填固定值
+}
+
+func (c *ChaosConf) Validate() (errs []error) {
+	rates := []struct {
+		name string
+		v    float64
+	}{{"latency_rate", c.LatencyRate}, {"error_rate", c.ErrorRate}, {"drop_rate", c.DropRate}}
+	for _, r := range rates {
+		if r.v < 0 || r.v > 1 {
+			errs = append(errs, fmt.Errorf("chaos %s %v out of range 0-1", r.name, r.v))
+		}
+	}
+	if c.LatencyMs < 0 {
+		errs = append(errs, fmt.Errorf("chaos latency_ms %d must not be negative", c.LatencyMs))
+	}
+	return
+}
+
+type chaos struct {
+	conf ChaosConf
+	m    sync.Mutex
+	rnd  *rand.Rand
+}
+
+func newChaos(conf *ChaosConf) *chaos {
+	if conf == nil {
+		return nil
+	}
+	seed := conf.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &chaos{conf: *conf, rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (c *chaos) roll(rate float64) bool {
+	return rate > 0 && c.rnd.Float64() < rate
+}
+
+// inject nil上也能调。先注入延迟，再按概率断线或报错
+func (c *chaos) inject() error {
+	if c == nil {
+		return nil
+	}
+	c.m.Lock()
+	var delay time.Duration
+	if c.conf.LatencyMs > 0 && c.roll(c.conf.LatencyRate) {
+		delay = time.Duration(c.rnd.Int63n(int64(c.conf.LatencyMs)+1)) * time.Millisecond
+	}
+	drop := c.roll(c.conf.DropRate)
+	fail := !drop && c.roll(c.conf.ErrorRate)
+	c.m.Unlock()
+	if delay > 0 {
+		metrics.GetCounter("db.chaos.latency").Inc()
+		time.Sleep(delay)
+	}
+	if drop {
+		metrics.GetCounter("db.chaos.drop").Inc()
+		return wrapErr(driver.ErrBadConn)
+	}
+	if fail {
+		metrics.GetCounter("db.chaos.error").Inc()
+		return ErrChaos
+	}
+	return nil
+}
+
+// SetChaos 运行中开关故障注入，传nil关掉
+func (mysql *MysqlPool) SetChaos(conf *ChaosConf) {
+	if conf != nil {
+		log.Printf("WARNING: mysql chaos enabled, latency %dms@%v, error %v, drop %v", conf.LatencyMs, conf.LatencyRate, conf.ErrorRate, conf.DropRate)
+	} else if mysql.chaos.Load() != nil {
+		log.Printf("mysql chaos disabled")
+	}
+	mysql.chaos.Store(newChaos(conf))
+}
+
+// Chaos 当前的故障注入配置，没开返回nil
+func (mysql *MysqlPool) Chaos() *ChaosConf {
+	c := mysql.chaos.Load()
+	if c == nil {
+		return nil
+	}
+	conf := c.conf
+	return &conf
+}
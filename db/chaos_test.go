@@ -0,0 +1,52 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChaos(t *testing.T) {
+	var off *chaos
+	if err := off.inject(); err != nil {
+		t.Fatalf("nil chaos injected %v", err)
+	}
+	if err := newChaos(&ChaosConf{ErrorRate: 1}).inject(); !errors.Is(err, ErrChaos) || isBreakerFailure(err) {
+		t.Fatalf("error_rate 1: %v", err)
+	}
+	if err := newChaos(&ChaosConf{DropRate: 1, ErrorRate: 1}).inject(); !errors.Is(err, ErrConnLost) || !isBreakerFailure(err) {
+		t.Fatalf("drop_rate 1: %v", err)
+	}
+	// 同一个种子注入的故障序列一样
+	seq := func() (ret []bool) {
+		c := newChaos(&ChaosConf{ErrorRate: 0.5, Seed: 42})
+		for i := 0; i < 20; i++ {
+			ret = append(ret, c.inject() != nil)
+		}
+		return
+	}
+	a, b := seq(), seq()
+	hits := 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatal("same seed gave different faults")
+		}
+		if a[i] {
+			hits++
+		}
+	}
+	if hits == 0 || hits == len(a) {
+		t.Fatalf("error_rate 0.5 hit %d/%d", hits, len(a))
+	}
+	if errs := (&ChaosConf{LatencyRate: 2, DropRate: -1, LatencyMs: -1}).Validate(); len(errs) != 3 {
+		t.Fatalf("validate = %v", errs)
+	}
+	mysql := NewMysqlPool()
+	mysql.SetChaos(&ChaosConf{ErrorRate: 0.1})
+	if c := mysql.Chaos(); c == nil || c.ErrorRate != 0.1 {
+		t.Fatalf("Chaos() = %+v", c)
+	}
+	mysql.SetChaos(nil)
+	if mysql.Chaos() != nil {
+		t.Fatal("chaos not disabled")
+	}
+}
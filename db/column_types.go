@@ -0,0 +1,152 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 按驱动给的列类型把[]byte转成go的原生类型，放进DBData.Values，调用方不用自己再strconv一遍
+// 列类型按语句缓存，同一条sql只调一次rows.ColumnTypes()
+
+type valueKind int
+
+const (
+	kindBytes valueKind = iota // blob/binary等，保持[]byte
+	kindInt
+	kindUint
+	kindFloat
+	kindTime
+	kindString
+)
+
+type columnMeta struct {
+	name string
+	kind valueKind
+}
+
+const maxColumnCacheSize = 1024 // 拼接出来的sql太多时不至于无限涨
+
+func kindOf(dbType string) valueKind {
+	t := strings.ToUpper(dbType)
+	switch {
+	case t == "UNSIGNED BIGINT":
+		return kindUint
+	case strings.HasSuffix(t, "INT") || t == "YEAR":
+		return kindInt
+	case t == "FLOAT" || t == "DOUBLE" || t == "DECIMAL":
+		return kindFloat
+	case t == "DATETIME" || t == "TIMESTAMP" || t == "DATE":
+		return kindTime
+	case strings.HasSuffix(t, "CHAR") || strings.HasSuffix(t, "TEXT") || t == "ENUM" || t == "SET" || t == "JSON":
+		return kindString
+	}
+	return kindBytes
+}
+
+// columnMetas 调用方需持有mysql.m
+func (mysql *MysqlPool) columnMetas(stmt string, rows *sql.Rows) []columnMeta {
+	if metas, ok := mysql.columnCache[stmt]; ok {
+		return metas
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil
+	}
+	metas := make([]columnMeta, len(types))
+	for i, ct := range types {
+		metas[i] = columnMeta{name: ct.Name(), kind: kindOf(ct.DatabaseTypeName())}
+	}
+	if mysql.columnCache == nil || len(mysql.columnCache) >= maxColumnCacheSize {
+		mysql.columnCache = make(map[string][]columnMeta)
+	}
+	mysql.columnCache[stmt] = metas
+	return metas
+}
+
+// convertValue 转换失败就保留原始[]byte，不让一列的脏数据弄丢整行
+func convertValue(kind valueKind, raw []byte) any {
+	if raw == nil {
+		return nil
+	}
+	s := string(raw)
+	switch kind {
+	case kindInt:
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return v
+		}
+	case kindUint:
+		if v, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return v
+		}
+	case kindFloat:
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v
+		}
+	case kindTime:
+		if v, ok := parseMysqlTime(s); ok {
+			return v
+		}
+	case kindString:
+		return s
+	}
+	return raw
+}
+
+func parseMysqlTime(s string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999", "2006-01-02"} {
+		if v, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return v, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// 下面的取值函数优先用Values里转换好的值，没有（比如FakePool造的数据）就从Data现转
+
+func (d *DBData) Int64(col string) int64 {
+	switch v := d.Values[col].(type) {
+	case int64:
+		return v
+	case uint64:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	v, _ := strconv.ParseInt(string(d.Data[col]), 10, 64)
+	return v
+}
+
+func (d *DBData) Float64(col string) float64 {
+	switch v := d.Values[col].(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	v, _ := strconv.ParseFloat(string(d.Data[col]), 64)
+	return v
+}
+
+func (d *DBData) String(col string) string {
+	if v, ok := d.Values[col].(string); ok {
+		return v
+	}
+	return string(d.Data[col])
+}
+
+func (d *DBData) Time(col string) time.Time {
+	if v, ok := d.Values[col].(time.Time); ok {
+		return v
+	}
+	v, _ := parseMysqlTime(string(d.Data[col]))
+	return v
+}
+
+// IsNull 列不存在也算null
+func (d *DBData) IsNull(col string) bool {
+	return d.Data[col] == nil
+}
@@ -0,0 +1,57 @@
+package db
+
+import "fmt"
+
+// Validate 检查配置，把所有问题一起返回（不是遇到第一个就返回），启动时统一打印
+func (conf *MysqlConf) Validate() (errs []error) {
+	if conf.Username == "" {
+		errs = append(errs, fmt.Errorf("user_name is required"))
+	}
+	// 顺便把环境变量、文件权限、解密都试一遍，启动时一起报
+	if _, err := conf.ResolvePassword(); err != nil {
+		errs = append(errs, err)
+	}
+	if conf.RemoteIp == "" {
+		errs = append(errs, fmt.Errorf("remote_ip is required"))
+	}
+	if conf.RemotePort <= 0 || conf.RemotePort > 65535 {
+		errs = append(errs, fmt.Errorf("remote_port %d out of range 1-65535", conf.RemotePort))
+	}
+	if conf.DbName == "" {
+		errs = append(errs, fmt.Errorf("db_name is required"))
+	}
+	if conf.SlowQueryMs < 0 {
+		errs = append(errs, fmt.Errorf("slow_query_ms %d must not be negative", conf.SlowQueryMs))
+	}
+	if conf.BreakerFailures < 0 {
+		errs = append(errs, fmt.Errorf("breaker_failures %d must not be negative", conf.BreakerFailures))
+	}
+	if conf.BreakerCooldownSec < 0 {
+		errs = append(errs, fmt.Errorf("breaker_cooldown_sec %d must not be negative", conf.BreakerCooldownSec))
+	}
+	if conf.TablePrefix != "" && !identReg.MatchString(conf.TablePrefix) {
+		errs = append(errs, fmt.Errorf("table_prefix %q may only contain letters, digits and underscore", conf.TablePrefix))
+	}
+	if _, err := ParseBlobFormat(conf.BlobCompress); err != nil {
+		errs = append(errs, err)
+	}
+	if conf.MaxResultRows < 0 {
+		errs = append(errs, fmt.Errorf("max_result_rows %d must not be negative", conf.MaxResultRows))
+	}
+	if conf.MaxResultBytes < 0 {
+		errs = append(errs, fmt.Errorf("max_result_bytes %d must not be negative", conf.MaxResultBytes))
+	}
+	if _, err := ParseResultLimitPolicy(conf.ResultLimitPolicy); err != nil {
+		errs = append(errs, err)
+	}
+	if conf.SpillQueueLen < 0 || conf.SpillQueueLen > queryQueueSize {
+		errs = append(errs, fmt.Errorf("spill_queue_len %d out of range 0-%d", conf.SpillQueueLen, queryQueueSize))
+	}
+	if conf.Chaos != nil {
+		errs = append(errs, conf.Chaos.Validate()...)
+	}
+	if conf.SpillMaxMB < 0 {
+		errs = append(errs, fmt.Errorf("spill_max_mb %d must not be negative", conf.SpillMaxMB))
+	}
+	return
+}
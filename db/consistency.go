@@ -0,0 +1,197 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"test/metrics"
+	"test/timer"
+	"time"
+)
+
+// 一致性巡检：定时把内存里的数据（排行榜dict、背包之类）和库里的行逐条对比，差异打日志+记指标，按配置的策略修复。
+//
+// 时序问题：内存快照是在主循环里拍的，查库要排队，中间内存可能又改过并落库了。所以：
+// 1. 拍快照时还在DirtySet里的key不比（本来就还没落库）
+// 2. 查库语句用PriorityLow，之前Flush丢进队列的写（PriorityHigh）一定先执行
+// 3. 一次发现的差异先记成可疑，下一轮还不一致才算真的不一致（再报告、再修），避开两轮之间正好改过的key
+
+type RepairPolicy int
+
+const (
+	RepairNone       RepairPolicy = iota // 只报告
+	RepairFromMemory                     // 以内存为准改库
+	RepairFromDB                         // 以库为准改内存
+)
+
+func ParseRepairPolicy(s string) (RepairPolicy, error) {
+	switch s {
+	case "", "none":
+		return RepairNone, nil
+	case "memory":
+		return RepairFromMemory, nil
+	case "db":
+		return RepairFromDB, nil
+	}
+	return RepairNone, fmt.Errorf("unknown repair policy %q, must be none/memory/db", s)
+}
+
+type DivergenceKind int
+
+const (
+	MissingInDB     DivergenceKind = iota // 内存有库里没有
+	MissingInMemory                       // 库里有内存没有
+	ValueMismatch
+)
+
+func (k DivergenceKind) String() string {
+	switch k {
+	case MissingInDB:
+		return "missing_in_db"
+	case MissingInMemory:
+		return "missing_in_memory"
+	}
+	return "mismatch"
+}
+
+type Divergence[K comparable] struct {
+	Key    K
+	Kind   DivergenceKind
+	Memory string
+	DB     string
+}
+
+// ConsistencyCheck 值统一转成string比较，转的时候注意两边格式一致（比如都用strconv.FormatInt）
+type ConsistencyCheck[K comparable] struct {
+	Name     string
+	Query    string               // 查出库里全部数据的select（表大的话自己加条件分批，这里不管）
+	RowKey   func(*DBData) K      // 从一行里取key
+	RowValue func(*DBData) string // 从一行里取要比较的值
+	Memory   func() map[K]string  // 内存快照，在主循环里调
+	Dirty    *DirtySet[K]         // 可选，快照时还没落库的key不比
+	Policy   RepairPolicy
+	RepairDB func(d Divergence[K]) *SqlQuery // RepairFromMemory时用，返回把库改成内存值的语句，nil表示不修这一条
+	// RepairMem RepairFromDB时用，在db的Loop goroutine里调，要碰主循环数据的话自己转一下
+	RepairMem func(d Divergence[K])
+
+	suspects map[K]struct{} // 上一轮发现的差异，只在db goroutine里读写
+}
+
+func (c *ConsistencyCheck[K]) metricName(s string) string {
+	return "db.consistency." + c.Name + "." + s
+}
+
+// Run 在主循环里调，拍快照后把查询丢进db队列。cb（可以为nil）在db goroutine里拿到确认过的差异
+func (c *ConsistencyCheck[K]) Run(pool Pool, cb func([]Divergence[K])) error {
+	mem := c.Memory()
+	var skip map[K]struct{}
+	if c.Dirty != nil {
+		skip = c.Dirty.keys()
+	}
+	return pool.AddQuery(&SqlQuery{
+		Stmt:      c.Query,
+		Priority:  PriorityLow,
+		Unlimited: true, // 少查了行会被当成MissingInDB，RepairFromMemory还会去"修"
+		CbFunc: func(rows []*DBData, err error) {
+			if err != nil && !errors.Is(err, ErrNoRows) {
+				log.Printf("consistency check %s query failed: %s", c.Name, err.Error())
+				return
+			}
+			found := c.compare(mem, rows, skip)
+			confirmed := c.confirm(found)
+			metrics.GetGauge(c.metricName("divergence")).Set(int64(len(confirmed)))
+			for _, d := range confirmed {
+				log.Printf("consistency check %s: key %v %s, memory %q db %q", c.Name, d.Key, d.Kind, d.Memory, d.DB)
+			}
+			c.repair(pool, confirmed)
+			if cb != nil {
+				cb(confirmed)
+			}
+		},
+	})
+}
+
+func (c *ConsistencyCheck[K]) compare(mem map[K]string, rows []*DBData, skip map[K]struct{}) (ret []Divergence[K]) {
+	seen := make(map[K]struct{}, len(rows))
+	for _, row := range rows {
+		k := c.RowKey(row)
+		seen[k] = struct{}{}
+		if _, ok := skip[k]; ok {
+			continue
+		}
+		v := c.RowValue(row)
+		m, ok := mem[k]
+		if !ok {
+			ret = append(ret, Divergence[K]{Key: k, Kind: MissingInMemory, DB: v})
+		} else if m != v {
+			ret = append(ret, Divergence[K]{Key: k, Kind: ValueMismatch, Memory: m, DB: v})
+		}
+	}
+	for k, m := range mem {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		if _, ok := skip[k]; ok {
+			continue
+		}
+		ret = append(ret, Divergence[K]{Key: k, Kind: MissingInDB, Memory: m})
+	}
+	return
+}
+
+// confirm 只留下连续两轮都不一致的
+func (c *ConsistencyCheck[K]) confirm(found []Divergence[K]) []Divergence[K] {
+	var confirmed []Divergence[K]
+	next := make(map[K]struct{}, len(found))
+	for _, d := range found {
+		if _, ok := c.suspects[d.Key]; ok {
+			confirmed = append(confirmed, d)
+		} else {
+			next[d.Key] = struct{}{}
+		}
+	}
+	c.suspects = next
+	return confirmed
+}
+
+func (c *ConsistencyCheck[K]) repair(pool Pool, list []Divergence[K]) {
+	repaired := metrics.GetCounter(c.metricName("repaired"))
+	for _, d := range list {
+		switch c.Policy {
+		case RepairFromMemory:
+			if c.RepairDB == nil {
+				continue
+			}
+			q := c.RepairDB(d)
+			if q == nil {
+				continue
+			}
+			key := d.Key
+			q.CbFunc = func(_ []*DBData, err error) {
+				if err != nil {
+					log.Printf("consistency check %s repair %v failed: %s", c.Name, key, err.Error())
+				}
+			}
+			if err := pool.AddQuery(q); err != nil {
+				log.Printf("consistency check %s repair %v not queued: %s", c.Name, key, err.Error())
+				continue
+			}
+			repaired.Inc()
+		case RepairFromDB:
+			if c.RepairMem == nil {
+				continue
+			}
+			c.RepairMem(d)
+			repaired.Inc()
+		}
+	}
+}
+
+// Schedule 用timer每interval巡检一次
+func (c *ConsistencyCheck[K]) Schedule(pool Pool, interval time.Duration) {
+	timer.Every(interval, "consistency_"+c.Name, func() {
+		if err := c.Run(pool, nil); err != nil {
+			log.Printf("consistency check %s not queued: %s", c.Name, err.Error())
+		}
+	})
+}
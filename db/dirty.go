@@ -0,0 +1,137 @@
+package db
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"test/timer"
+	"time"
+)
+
+// DirtySet 脏数据集合：业务改了内存数据之后Mark一下，定时批量落库，而不是每改一次写一次库。
+// 同一个key在两次落库之间改多少次都只写一次（写的是落库那一刻的内存数据）
+type DirtySet[K comparable] struct {
+	pool  Pool
+	name  string
+	save  func(K) *SqlQuery // 生成落库语句（不用填CbFunc），返回nil表示这个key不用写了
+	m     sync.Mutex        // 落库失败的回调在db goroutine里重新Mark
+	dirty map[K]struct{}
+}
+
+var (
+	dirtySetsM sync.Mutex
+	dirtySets  []dirtyFlusher
+)
+
+type dirtyFlusher interface {
+	Flush() int
+	Len() int
+	snapshot() []DirtyRecord
+}
+
+// NewDirtySet name用于日志和timer统计，save在调用Flush的goroutine（主循环）里执行
+func NewDirtySet[K comparable](pool Pool, name string, save func(K) *SqlQuery) *DirtySet[K] {
+	d := &DirtySet[K]{
+		pool:  pool,
+		name:  name,
+		save:  save,
+		dirty: make(map[K]struct{}),
+	}
+	dirtySetsM.Lock()
+	dirtySets = append(dirtySets, d)
+	dirtySetsM.Unlock()
+	return d
+}
+
+func (d *DirtySet[K]) Mark(k K) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.dirty[k] = struct{}{}
+}
+
+func (d *DirtySet[K]) Len() int {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return len(d.dirty)
+}
+
+// keys 当前脏key的拷贝
+func (d *DirtySet[K]) keys() map[K]struct{} {
+	d.m.Lock()
+	defer d.m.Unlock()
+	ret := make(map[K]struct{}, len(d.dirty))
+	for k := range d.dirty {
+		ret[k] = struct{}{}
+	}
+	return ret
+}
+
+// Flush 把当前所有脏数据按PriorityHigh丢进db队列，返回丢进去的条数。
+// 队列满了的留着下次再写；写库失败的会重新标脏
+func (d *DirtySet[K]) Flush() int {
+	d.m.Lock()
+	keys := make([]K, 0, len(d.dirty))
+	for k := range d.dirty {
+		keys = append(keys, k)
+	}
+	d.dirty = make(map[K]struct{})
+	d.m.Unlock()
+
+	n := 0
+	for i, k := range keys {
+		q := d.save(k)
+		if q == nil {
+			continue
+		}
+		key := k
+		q.Priority = PriorityHigh
+		q.CbFunc = func(_ []*DBData, err error) {
+			if err != nil {
+				log.Printf("dirty set %s flush %v failed, retry next round: %s", d.name, key, err.Error())
+				d.Mark(key)
+			}
+		}
+		if err := d.pool.AddQuery(q); err != nil {
+			if !errors.Is(err, ErrQueueFull) {
+				log.Printf("dirty set %s flush %v failed: %s", d.name, key, err.Error())
+			}
+			for _, left := range keys[i:] {
+				d.Mark(left)
+			}
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// StartFlush 用timer每interval落库一次
+func (d *DirtySet[K]) StartFlush(interval time.Duration) {
+	timer.Every(interval, "dirty_flush_"+d.name, func() {
+		d.Flush()
+	})
+}
+
+// FlushAllDirty 所有DirtySet都Flush一次，停服前调
+func FlushAllDirty() int {
+	dirtySetsM.Lock()
+	sets := append([]dirtyFlusher(nil), dirtySets...)
+	dirtySetsM.Unlock()
+	n := 0
+	for _, d := range sets {
+		n += d.Flush()
+	}
+	return n
+}
+
+// DirtyCount 所有DirtySet里还没落库的条数
+func DirtyCount() int {
+	dirtySetsM.Lock()
+	sets := append([]dirtyFlusher(nil), dirtySets...)
+	dirtySetsM.Unlock()
+	n := 0
+	for _, d := range sets {
+		n += d.Len()
+	}
+	return n
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// 脏数据快照（备份用）：把所有DirtySet里还没落库的数据按落库语句导出来，恢复时直接执行这些语句。
+// 和Flush一样要在主循环里调（save函数读的是内存数据）
+
+// DirtyRecord 一条待落库的数据
+type DirtyRecord struct {
+	Set  string // DirtySet的名字
+	Stmt string
+	Args []any
+}
+
+func (d *DirtySet[K]) snapshot() []DirtyRecord {
+	var ret []DirtyRecord
+	for k := range d.keys() {
+		q := d.save(k)
+		if q == nil {
+			continue
+		}
+		ret = append(ret, DirtyRecord{Set: d.name, Stmt: q.Stmt, Args: q.Args})
+	}
+	return ret
+}
+
+// WriteDirtySnapshot 用gob编码（Args里的[]byte、int64这些类型能原样还原），返回导出的条数
+func WriteDirtySnapshot(w io.Writer) (int, error) {
+	dirtySetsM.Lock()
+	sets := append([]dirtyFlusher(nil), dirtySets...)
+	dirtySetsM.Unlock()
+	var all []DirtyRecord
+	for _, d := range sets {
+		all = append(all, d.snapshot()...)
+	}
+	return len(all), gob.NewEncoder(w).Encode(all)
+}
+
+// RestoreDirtySnapshot 按顺序同步执行快照里的语句，遇到错误停下，返回已执行的条数
+func RestoreDirtySnapshot(pool Pool, r io.Reader) (int, error) {
+	var all []DirtyRecord
+	if err := gob.NewDecoder(r).Decode(&all); err != nil {
+		return 0, err
+	}
+	for i, rec := range all {
+		if err := pool.Exec(rec.Stmt, rec.Args...); err != nil {
+			return i, fmt.Errorf("restore dirty %s record %d: %w", rec.Set, i, err)
+		}
+	}
+	return len(all), nil
+}
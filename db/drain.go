@@ -0,0 +1,27 @@
+package db
+
+import "time"
+
+// Pending 队列里还没执行的加上正在执行的查询数
+func (mysql *MysqlPool) Pending() int {
+	if !mysql.Inited {
+		return 0
+	}
+	n := int(mysql.inflight.Load())
+	for _, l := range mysql.queryLists {
+		n += len(l)
+	}
+	return n
+}
+
+// Drain 阻塞等Loop把队列里的查询都执行完，到deadline还没执行完的返回剩余条数。
+// 停服/崩溃前落库用，调用方不能是db的Loop goroutine自己
+func (mysql *MysqlPool) Drain(deadline time.Time) int {
+	for {
+		n := mysql.Pending()
+		if n == 0 || !time.Now().Before(deadline) {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 导出格式：一行一条json（JSONL），跨环境迁移、GM排查都用这个
+// {"table":"player","row":{"id":"1","name":"aaa","deleted_at":null},"bin":{"save_data":"base64..."}}
+// row里是mysql返回的文本值（NULL为null），不是合法utf8的列（protobuf存档之类）放到bin里base64编码
+type DumpLine struct {
+	Table string             `json:"table"`
+	Row   map[string]*string `json:"row"`
+	Bin   map[string]string  `json:"bin,omitempty"`
+}
+
+var identReg = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func checkIdent(name string) error {
+	if !identReg.MatchString(name) {
+		return fmt.Errorf("illegal table or column name: %s", name)
+	}
+	return nil
+}
+
+// DumpTable 导出整张表
+func (mysql *MysqlPool) DumpTable(table string, w io.Writer) (int, error) {
+	return mysql.DumpTableWhere(table, w, "")
+}
+
+// DumpTableWhere 按条件导出，比如导某个玩家的数据：DumpTableWhere("player_item", w, "player_id = ?", pid)
+// where由调用方（admin接口）拼，不要直接拼外部输入，值一律走args。不受结果集大小限制，导出（备份）不能少行
+func (mysql *MysqlPool) DumpTableWhere(table string, w io.Writer, where string, args ...any) (int, error) {
+	if err := checkIdent(table); err != nil {
+		return 0, err
+	}
+	stmt := "SELECT * FROM `" + table + "`"
+	if where != "" {
+		stmt += " WHERE " + where
+	}
+	rows, err := mysql.QueryAll(stmt, args...)
+	if errors.Is(err, ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, row := range rows {
+		line := &DumpLine{Table: table, Row: make(map[string]*string, len(row.Data))}
+		for col, v := range row.Data {
+			switch {
+			case v == nil:
+				line.Row[col] = nil
+			case utf8.Valid(v):
+				s := string(v)
+				line.Row[col] = &s
+			default:
+				if line.Bin == nil {
+					line.Bin = make(map[string]string)
+				}
+				line.Bin[col] = base64.StdEncoding.EncodeToString(v)
+			}
+		}
+		if err = enc.Encode(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(rows), bw.Flush()
+}
+
+// LoadTable 把DumpTable导出的数据导进table（用REPLACE INTO，主键相同的行会被覆盖）。
+// table可以和导出时不同（比如导进临时表核对），文件里table字段只做提示
+func (mysql *MysqlPool) LoadTable(table string, r io.Reader) (int, error) {
+	if err := checkIdent(table); err != nil {
+		return 0, err
+	}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	n := 0
+	for dec.More() {
+		line := &DumpLine{}
+		if err := dec.Decode(line); err != nil {
+			return n, fmt.Errorf("LoadTable decode error at line %d: %w", n+1, err)
+		}
+		var cols []string
+		for col := range line.Row {
+			cols = append(cols, col)
+		}
+		for col := range line.Bin {
+			cols = append(cols, col)
+		}
+		sort.Strings(cols)
+		args := make([]any, 0, len(cols))
+		for _, col := range cols {
+			if err := checkIdent(col); err != nil {
+				return n, err
+			}
+			if b64, ok := line.Bin[col]; ok {
+				v, err := base64.StdEncoding.DecodeString(b64)
+				if err != nil {
+					return n, fmt.Errorf("LoadTable decode bin column %s at line %d: %w", col, n+1, err)
+				}
+				args = append(args, v)
+			} else if v := line.Row[col]; v != nil {
+				args = append(args, *v)
+			} else {
+				args = append(args, nil)
+			}
+		}
+		stmt := "REPLACE INTO `" + table + "` (`" + strings.Join(cols, "`, `") + "`) VALUES (" +
+			strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ") + ")"
+		if err := mysql.Exec(stmt, args...); err != nil {
+			return n, fmt.Errorf("LoadTable exec error at line %d: %w", n+1, err)
+		}
+		n++
+	}
+	return n, nil
+}
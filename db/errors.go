@@ -0,0 +1,40 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// 对外暴露的错误类型，回调里用errors.Is(err, db.ErrNoRows)这种写法判断，不要去比较错误字符串
+var (
+	ErrNotInited   = errors.New("mysql pool not inited")
+	ErrNoRows      = errors.New("mysql query returned no rows")
+	ErrQueueFull   = errors.New("mysql query queue is full")
+	ErrConnLost    = errors.New("mysql connection lost")
+	ErrCircuitOpen = errors.New("mysql circuit breaker is open")
+
+	ErrResultTooLarge = errors.New("mysql query result exceeds size limit")
+	ErrSpillFull      = errors.New("mysql spill file is full")
+	ErrDuplicateKey   = errors.New("mysql duplicate key")
+	ErrReadOnly       = errors.New("mysql pool is read only")
+)
+
+const mysqlErrDupEntry = 1062
+
+// wrapErr 把驱动层的断线类错误统一包成ErrConnLost、主键/唯一键冲突包成ErrDuplicateKey，原始错误信息保留在文本里方便查日志
+func wrapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return fmt.Errorf("%w: %s", ErrConnLost, err.Error())
+	}
+	var me *mysql.MySQLError
+	if errors.As(err, &me) && me.Number == mysqlErrDupEntry {
+		return fmt.Errorf("%w: %s", ErrDuplicateKey, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// FakePool 单测用的内存假库。
+// 两种用法：
+// 1. SetResult预设某条语句的返回（语句原文匹配，忽略大小写和多余空格），优先级最高
+// 2. SetTable放一张内存表，支持最简单的 select * from t [where a = ? and b = ?] / insert into t (a, b) values (?, ?) / delete from t [where ...] / update t set a = ? [where ...]
+// 复杂语句（join、子查询、order by之类）请用SetResult
+type FakePool struct {
+	m       sync.Mutex
+	tables  map[string][]*DBData
+	results map[string]fakeResult
+	Execs   []string // 执行过的所有语句（包括Query），方便断言
+}
+
+type fakeResult struct {
+	rows []*DBData
+	err  error
+}
+
+func NewFakePool() *FakePool {
+	return &FakePool{
+		tables:  make(map[string][]*DBData),
+		results: make(map[string]fakeResult),
+	}
+}
+
+func normalizeStmt(stmt string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.TrimSuffix(strings.TrimSpace(stmt), ";")), " "))
+}
+
+// SetResult 预设语句的返回值，rows为空且err为nil时Query返回ErrNoRows（与真库行为一致）
+func (f *FakePool) SetResult(stmt string, rows []*DBData, err error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.results[normalizeStmt(stmt)] = fakeResult{rows: rows, err: err}
+}
+
+// SetTable 整张表覆盖
+func (f *FakePool) SetTable(table string, rows []*DBData) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.tables[strings.ToLower(table)] = rows
+}
+
+// Table 取内存表当前内容，用来断言insert/update/delete的效果
+func (f *FakePool) Table(table string) []*DBData {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.tables[strings.ToLower(table)]
+}
+
+var (
+	fakeSelectReg = regexp.MustCompile(`^select \* from (\w+)(?: where (.+))?$`)
+	fakeInsertReg = regexp.MustCompile(`^(?:insert|replace) into (\w+) \((.+)\) values \((.+)\)$`)
+	fakeDeleteReg = regexp.MustCompile(`^delete from (\w+)(?: where (.+))?$`)
+	fakeUpdateReg = regexp.MustCompile(`^update (\w+) set (.+?)(?: where (.+))?$`)
+)
+
+func (f *FakePool) Query(sql string, args ...any) ([]*DBData, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	stmt := normalizeStmt(sql)
+	f.Execs = append(f.Execs, stmt)
+	if r, ok := f.results[stmt]; ok {
+		if r.err == nil && len(r.rows) == 0 {
+			return nil, ErrNoRows
+		}
+		return r.rows, r.err
+	}
+	sub := fakeSelectReg.FindStringSubmatch(stmt)
+	if sub == nil {
+		return nil, fmt.Errorf("FakePool::Query unsupported stmt: %s", stmt)
+	}
+	cond, err := parseFakeCond(sub[2], args)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*DBData
+	for _, row := range f.tables[sub[1]] {
+		if cond.match(row) {
+			ret = append(ret, row)
+		}
+	}
+	if len(ret) == 0 {
+		return nil, ErrNoRows
+	}
+	return ret, nil
+}
+
+// Exec 成功后和真库一样触发写钩子（见hooks.go）
+func (f *FakePool) Exec(sql string, args ...any) error {
+	if err := f.exec(sql, args...); err != nil {
+		return err
+	}
+	fireWriteHooks(sql, args)
+	return nil
+}
+
+func (f *FakePool) exec(sql string, args ...any) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	stmt := normalizeStmt(sql)
+	f.Execs = append(f.Execs, stmt)
+	if r, ok := f.results[stmt]; ok {
+		return r.err
+	}
+	if sub := fakeInsertReg.FindStringSubmatch(stmt); sub != nil {
+		cols := splitFakeList(sub[2])
+		if len(cols) != len(args) {
+			return fmt.Errorf("FakePool::Exec column count %d != args count %d", len(cols), len(args))
+		}
+		row := &DBData{Data: make(map[string][]byte)}
+		for i, c := range cols {
+			row.Data[c] = fakeBytes(args[i])
+		}
+		f.tables[sub[1]] = append(f.tables[sub[1]], row)
+		return nil
+	}
+	if sub := fakeDeleteReg.FindStringSubmatch(stmt); sub != nil {
+		cond, err := parseFakeCond(sub[2], args)
+		if err != nil {
+			return err
+		}
+		var left []*DBData
+		for _, row := range f.tables[sub[1]] {
+			if !cond.match(row) {
+				left = append(left, row)
+			}
+		}
+		f.tables[sub[1]] = left
+		return nil
+	}
+	if sub := fakeUpdateReg.FindStringSubmatch(stmt); sub != nil {
+		sets := splitFakeList(sub[2])
+		if len(sets) > len(args) {
+			return fmt.Errorf("FakePool::Exec not enough args for update")
+		}
+		cond, err := parseFakeCond(sub[3], args[len(sets):])
+		if err != nil {
+			return err
+		}
+		for _, row := range f.tables[sub[1]] {
+			if !cond.match(row) {
+				continue
+			}
+			for i, s := range sets {
+				row.Data[strings.TrimSpace(strings.TrimSuffix(s, "= ?"))] = fakeBytes(args[i])
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("FakePool::Exec unsupported stmt: %s", stmt)
+}
+
+// AddQuery 同步执行并立刻回调，单测里不用等Loop
+func (f *FakePool) AddQuery(q *SqlQuery) error {
+	if q == nil {
+		return nil
+	}
+	if strings.HasPrefix(normalizeStmt(q.Stmt), "select") {
+		rows, err := f.Query(q.Stmt, q.Args...)
+		q.CbFunc(rows, err)
+		return nil
+	}
+	q.CbFunc(nil, f.Exec(q.Stmt, q.Args...))
+	return nil
+}
+
+type fakeCond map[string][]byte
+
+func (c fakeCond) match(row *DBData) bool {
+	for k, v := range c {
+		if string(row.Data[k]) != string(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseFakeCond 只支持 a = ? and b = ? 这种形式
+func parseFakeCond(where string, args []any) (fakeCond, error) {
+	cond := fakeCond{}
+	if where == "" {
+		return cond, nil
+	}
+	parts := strings.Split(where, " and ")
+	if len(parts) > len(args) {
+		return nil, fmt.Errorf("FakePool where clause needs %d args, got %d", len(parts), len(args))
+	}
+	for i, p := range parts {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[1]) != "?" {
+			return nil, fmt.Errorf("FakePool unsupported where clause: %s", where)
+		}
+		cond[strings.TrimSpace(kv[0])] = fakeBytes(args[i])
+	}
+	return cond, nil
+}
+
+func splitFakeList(s string) []string {
+	var ret []string
+	for _, v := range strings.Split(s, ",") {
+		ret = append(ret, strings.Trim(strings.TrimSpace(v), "`"))
+	}
+	return ret
+}
+
+// fakeBytes 跟mysql驱动一样，所有值都按文本形式存成[]byte
+func fakeBytes(v any) []byte {
+	switch vv := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return vv
+	case string:
+		return []byte(vv)
+	default:
+		return []byte(fmt.Sprint(vv))
+	}
+}
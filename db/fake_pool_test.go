@@ -0,0 +1,74 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFakePool(t *testing.T) {
+	var p Pool = NewFakePool()
+	if err := p.Exec("insert into test_table (id, name) values (?, ?);", 1, "aaa"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Exec("insert into test_table (id, name) values (?, ?);", 2, "bbb"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := p.Query("select * from test_table where id = ?;", 2)
+	if err != nil || len(rows) != 1 || string(rows[0].Data["name"]) != "bbb" {
+		t.Fatalf("select by id failed: %v, %v", rows, err)
+	}
+	if err = p.Exec("update test_table set name = ? where id = ?", "ccc", 2); err != nil {
+		t.Fatal(err)
+	}
+	rows, _ = p.Query("select * from test_table where id = ?", 2)
+	if string(rows[0].Data["name"]) != "ccc" {
+		t.Fatalf("update failed: %s", rows[0].Data["name"])
+	}
+	if err = p.Exec("delete from test_table where id = ?", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Query("select * from test_table where id = ?", 1); !errors.Is(err, ErrNoRows) {
+		t.Fatalf("expect ErrNoRows, got %v", err)
+	}
+
+	fp := p.(*FakePool)
+	fp.SetResult("select count(*) as c from test_table", []*DBData{{Data: map[string][]byte{"c": []byte("1")}}}, nil)
+	p.AddQuery(&SqlQuery{
+		Stmt: "SELECT count(*) AS c FROM test_table;",
+		CbFunc: func(data []*DBData, err error) {
+			if err != nil || string(data[0].Data["c"]) != "1" {
+				t.Fatalf("canned result failed: %v, %v", data, err)
+			}
+		},
+	})
+	fp.SetResult("delete from test_table", nil, ErrConnLost)
+	if err = p.Exec("delete from test_table"); !errors.Is(err, ErrConnLost) {
+		t.Fatalf("expect ErrConnLost, got %v", err)
+	}
+}
+
+func TestTableHooks(t *testing.T) {
+	p := NewFakePool()
+	var got []TableEvent
+	id := OnTableWrite("hook_table", func(ev TableEvent) { got = append(got, ev) })
+	defer RemoveTableHook(OnTableWrite("other_table", func(ev TableEvent) { t.Fatalf("wrong table hook fired: %v", ev) }))
+	p.Exec("insert into hook_table (id, name) values (?, ?)", 1, "a")
+	p.Exec("update HOOK_TABLE set name = ? where id = ?", "b", 1)
+	if err := p.Exec("update hook_table set"); err == nil {
+		t.Fatalf("bad stmt should fail")
+	}
+	if len(got) != 2 || got[0].Op != "insert" || got[1].Op != "update" || got[1].Args[1] != 1 {
+		t.Fatalf("unexpected events: %v", got)
+	}
+	RemoveTableHook(id)
+	p.Exec("delete from hook_table where id = ?", 1)
+	if len(got) != 2 {
+		t.Fatalf("removed hook still fired")
+	}
+	if op, tables := stmtTables("insert into a (id) select id from b on duplicate key update id = 1"); op != "insert" || len(tables) != 1 || tables[0] != "a" {
+		t.Fatalf("stmtTables = %s %v", op, tables)
+	}
+	if _, tables := stmtTables("select * from a join b on a.id = b.id for update"); len(tables) != 2 {
+		t.Fatalf("select tables = %v", tables)
+	}
+}
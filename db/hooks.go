@@ -0,0 +1,140 @@
+package db
+
+import (
+	"log"
+	"strings"
+	"sync"
+)
+
+// 表级读写钩子：按表名注册，写入成功后回调（带语句和参数），查询结果缓存、内存里的玩家缓存用来精确失效。
+// 注意：
+// 1. 钩子在执行这条语句的goroutine里同步调用（异步查询就是db的Loop），而且这时还持有连接池的锁，钩子里只能做删缓存这种轻操作，
+//    不能再同步Query/Exec（会死锁），要动主循环的数据请自己丢回主循环
+// 2. 表名按业务代码里写的原名（不带table_prefix）匹配，不区分大小写
+// 3. 写钩子只看目标表（insert into/replace into/update/delete from后面那张），insert ... select里的来源表不算写；
+//    事务里的写入在提交成功后才回调，回滚的（包括RollbackTo撤掉的那一段）不回调
+// 4. CALL存储过程不知道动了哪些表，不触发钩子
+
+// TableEvent 一次成功的读或写
+type TableEvent struct {
+	Table string
+	Op    string // select/insert/update/delete/replace
+	Stmt  string
+	Args  []any
+}
+
+type TableHook func(ev TableEvent)
+
+type hookEntry struct {
+	id int
+	f  TableHook
+}
+
+var (
+	hooksM     sync.RWMutex
+	writeHooks = map[string][]hookEntry{}
+	readHooks  = map[string][]hookEntry{}
+	hookSeq    int
+)
+
+func addHook(hooks map[string][]hookEntry, table string, f TableHook) int {
+	hooksM.Lock()
+	defer hooksM.Unlock()
+	hookSeq++
+	table = strings.ToLower(table)
+	hooks[table] = append(hooks[table], hookEntry{id: hookSeq, f: f})
+	return hookSeq
+}
+
+// OnTableWrite 注册写钩子，返回的id给RemoveTableHook用
+func OnTableWrite(table string, f TableHook) int {
+	return addHook(writeHooks, table, f)
+}
+
+// OnTableRead 注册读钩子（select成功后回调，查到0行不算成功），统计热点表之类用
+func OnTableRead(table string, f TableHook) int {
+	return addHook(readHooks, table, f)
+}
+
+func RemoveTableHook(id int) {
+	hooksM.Lock()
+	defer hooksM.Unlock()
+	for _, hooks := range []map[string][]hookEntry{writeHooks, readHooks} {
+		for table, list := range hooks {
+			for i, h := range list {
+				if h.id == id {
+					hooks[table] = append(list[:i:i], list[i+1:]...)
+					if len(hooks[table]) == 0 {
+						delete(hooks, table)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// stmtTables 语句的操作类型和涉及的表，写语句只返回目标表
+func stmtTables(stmt string) (op string, tables []string) {
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	op = strings.ToLower(fields[0])
+	matches := tableRefReg.FindAllStringSubmatch(stmt, -1)
+	seen := map[string]bool{}
+	for _, m := range matches {
+		if strings.ToLower(m[1]) == "update" && op != "update" {
+			continue // on duplicate key update / for update
+		}
+		t := strings.ToLower(m[2])
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		tables = append(tables, t)
+		if op != "select" {
+			break
+		}
+	}
+	return
+}
+
+func fireHooks(hooks map[string][]hookEntry, ev TableEvent) {
+	hooksM.RLock()
+	list := append([]hookEntry(nil), hooks[ev.Table]...)
+	hooksM.RUnlock()
+	for _, h := range list {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("table hook panic, table = %s, stmt = %s: %v", ev.Table, ev.Stmt, r)
+				}
+			}()
+			h.f(ev)
+		}()
+	}
+}
+
+// fireWriteHooks stmt要传加前缀之前的原语句
+func fireWriteHooks(stmt string, args []any) {
+	op, tables := stmtTables(stmt)
+	switch op {
+	case "insert", "update", "delete", "replace":
+	default:
+		return
+	}
+	for _, t := range tables {
+		fireHooks(writeHooks, TableEvent{Table: t, Op: op, Stmt: stmt, Args: args})
+	}
+}
+
+func fireReadHooks(stmt string, args []any) {
+	op, tables := stmtTables(stmt)
+	if op != "select" {
+		return
+	}
+	for _, t := range tables {
+		fireHooks(readHooks, TableEvent{Table: t, Op: op, Stmt: stmt, Args: args})
+	}
+}
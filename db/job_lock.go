@@ -0,0 +1,54 @@
+package db
+
+import (
+	"errors"
+	"time"
+)
+
+// 集群单例任务的锁（timer.Locker的mysql实现）：每个(任务名, 计划触发时间)往job_lock表插一行，主键冲突说明别的进程已经抢到了。
+// 不是租约锁，不用续期也不用释放，进程抢到之后挂了这一次就算漏跑（宁可漏也不重复），要补跑请GM手动触发。
+//
+// 建表语句：
+// CREATE TABLE job_lock (
+//   name VARCHAR(128) NOT NULL,
+//   fire_at BIGINT NOT NULL,
+//   owner VARCHAR(128) NOT NULL,
+//   locked_at BIGINT NOT NULL,
+//   PRIMARY KEY (name, fire_at)
+// );
+
+type JobLock struct {
+	pool  Pool
+	owner string
+}
+
+// NewJobLock owner是本进程的标识（一般用服务发现的node_id），只是记下来方便查是谁跑的
+func NewJobLock(pool Pool, owner string) *JobLock {
+	return &JobLock{pool: pool, owner: owner}
+}
+
+// TryLock 同步执行一条insert，主键冲突返回false
+func (l *JobLock) TryLock(name string, at int64) (bool, error) {
+	err := l.pool.Exec("insert into job_lock (name, fire_at, owner, locked_at) values (?, ?, ?, ?)", name, at, l.owner, time.Now().Unix())
+	if errors.Is(err, ErrDuplicateKey) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Owner 查某次任务是哪个进程跑的，没人抢到返回ErrNoRows
+func (l *JobLock) Owner(name string, at int64) (string, error) {
+	rows, err := l.pool.Query("select * from job_lock where name = ? and fire_at = ?", name, at)
+	if err != nil {
+		return "", err
+	}
+	return string(rows[0].Data["owner"]), nil
+}
+
+// Prune 删掉before之前的记录，启动时调一次，表不会一直涨
+func (l *JobLock) Prune(before time.Time) error {
+	return l.pool.Exec("delete from job_lock where fire_at < ?", before.Unix())
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// lockPool 按(name, fire_at)模拟主键冲突
+type lockPool struct {
+	*FakePool
+	keys map[[2]any]bool
+}
+
+func (p *lockPool) Exec(sql string, args ...any) error {
+	if normalizeStmt(sql)[:6] == "insert" {
+		k := [2]any{args[0], args[1]}
+		if p.keys[k] {
+			return wrapErr(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+		}
+		p.keys[k] = true
+	}
+	return p.FakePool.Exec(sql, args...)
+}
+
+func TestJobLock(t *testing.T) {
+	if err := wrapErr(&mysql.MySQLError{Number: 1062}); !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("1062 not wrapped: %v", err)
+	}
+	pool := &lockPool{FakePool: NewFakePool(), keys: map[[2]any]bool{}}
+	a, b := NewJobLock(pool, "game-1"), NewJobLock(pool, "game-2")
+	if ok, err := a.TryLock("daily_settle", 100); !ok || err != nil {
+		t.Fatalf("first lock = %v, %v", ok, err)
+	}
+	if ok, err := b.TryLock("daily_settle", 100); ok || err != nil {
+		t.Fatalf("second lock = %v, %v", ok, err)
+	}
+	if ok, _ := b.TryLock("daily_settle", 200); !ok {
+		t.Fatal("next day should be lockable")
+	}
+	if owner, err := a.Owner("daily_settle", 100); owner != "game-1" || err != nil {
+		t.Fatalf("owner = %s, %v", owner, err)
+	}
+	pool.SetResult("insert into job_lock (name, fire_at, owner, locked_at) values (?, ?, ?, ?)", nil, ErrConnLost)
+	if ok, err := a.TryLock("weekly", 300); ok || !errors.Is(err, ErrConnLost) {
+		t.Fatalf("lock on broken db = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 一条join语句查出父子两层数据（比如玩家+背包物品），按声明的key列把平铺的结果行归到各自的父结构下，
+// 不用先查父表再按父id一条条查子表（N+1次查询在单连接上排队很慢）。
+// 列名重复时（两张表都有id）select里要起别名，比如`select p.id as pid, p.name, i.id as item_id, i.count from player p left join item i on i.owner = p.id where ...`
+
+// Join P、C是业务自己的结构，ParentKey/ChildKey是结果里的列名
+type Join[P any, C any] struct {
+	Stmt      string
+	ParentKey string // 同一个值的行合并成一个父结构，按第一次出现的顺序返回
+	// ChildKey LEFT JOIN没有子行时这一列是NULL，这时只有父没有子；
+	// 同一个父下重复出现的子（再join第三张表会出现）只取第一次。不填时每一行都是一个子
+	ChildKey string
+	Parent   func(row *DBData) P // 同一个父只用第一次出现的那一行调一次
+	Child    func(row *DBData) C
+}
+
+type Nested[P any, C any] struct {
+	Parent   P
+	Children []C
+}
+
+// Group 把查出来的行分组，rows为空返回空结果
+func (j *Join[P, C]) Group(rows []*DBData) ([]*Nested[P, C], error) {
+	var ret []*Nested[P, C]
+	index := make(map[string]int)
+	seen := make(map[[2]string]struct{})
+	for _, row := range rows {
+		pk, ok := row.Data[j.ParentKey]
+		if !ok {
+			return nil, fmt.Errorf("join error: parent key column %s not in result", j.ParentKey)
+		}
+		i, ok := index[string(pk)]
+		if !ok {
+			i = len(ret)
+			index[string(pk)] = i
+			ret = append(ret, &Nested[P, C]{Parent: j.Parent(row)})
+		}
+		if j.ChildKey != "" {
+			if row.IsNull(j.ChildKey) {
+				continue
+			}
+			k := [2]string{string(pk), string(row.Data[j.ChildKey])}
+			if _, dup := seen[k]; dup {
+				continue
+			}
+			seen[k] = struct{}{}
+		}
+		ret[i].Children = append(ret[i].Children, j.Child(row))
+	}
+	return ret, nil
+}
+
+// Query 同步执行，一行都没有时返回空结果而不是ErrNoRows
+func (j *Join[P, C]) Query(pool Pool, args ...any) ([]*Nested[P, C], error) {
+	rows, err := pool.Query(j.Stmt, args...)
+	if err != nil && !errors.Is(err, ErrNoRows) {
+		return nil, err
+	}
+	return j.Group(rows)
+}
+
+// AddQuery 异步版本，分组在db goroutine里做，cb也在db goroutine里调
+func (j *Join[P, C]) AddQuery(pool Pool, args []any, priority QueryPriority, cb func([]*Nested[P, C], error)) error {
+	return pool.AddQuery(&SqlQuery{
+		Stmt:     j.Stmt,
+		Args:     args,
+		Priority: priority,
+		CbFunc: func(rows []*DBData, err error) {
+			if err != nil && !errors.Is(err, ErrNoRows) {
+				cb(nil, err)
+				return
+			}
+			cb(j.Group(rows))
+		},
+	})
+}
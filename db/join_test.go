@@ -0,0 +1,66 @@
+package db
+
+import (
+	"testing"
+)
+
+type joinPlayer struct {
+	Id   int64
+	Name string
+}
+
+type joinItem struct {
+	Id    int64
+	Count int64
+}
+
+func TestJoin(t *testing.T) {
+	row := func(pid, name, itemId, count string) *DBData {
+		d := &DBData{Data: map[string][]byte{"pid": []byte(pid), "name": []byte(name), "item_id": nil, "count": nil}}
+		if itemId != "" {
+			d.Data["item_id"], d.Data["count"] = []byte(itemId), []byte(count)
+		}
+		return d
+	}
+	stmt := "select p.id as pid, p.name, i.id as item_id, i.count from player p left join item i on i.owner = p.id where p.id in (?, ?, ?)"
+	pool := NewFakePool()
+	pool.SetResult(stmt, []*DBData{
+		row("1", "a", "10", "5"),
+		row("2", "b", "", ""),
+		row("1", "a", "11", "1"),
+		row("1", "a", "10", "5"),
+		row("3", "c", "12", "7"),
+	}, nil)
+	j := &Join[joinPlayer, joinItem]{
+		Stmt:      stmt,
+		ParentKey: "pid",
+		ChildKey:  "item_id",
+		Parent:    func(r *DBData) joinPlayer { return joinPlayer{r.Int64("pid"), r.String("name")} },
+		Child:     func(r *DBData) joinItem { return joinItem{r.Int64("item_id"), r.Int64("count")} },
+	}
+	list, err := j.Query(pool, 1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Parent.Name != "a" || list[1].Parent.Id != 2 || list[2].Parent.Id != 3 {
+		t.Fatalf("parents = %+v", list)
+	}
+	if c := list[0].Children; len(c) != 2 || c[0] != (joinItem{10, 5}) || c[1] != (joinItem{11, 1}) {
+		t.Fatalf("children of 1 = %+v", c)
+	}
+	if len(list[1].Children) != 0 || len(list[2].Children) != 1 {
+		t.Fatalf("children = %+v %+v", list[1].Children, list[2].Children)
+	}
+
+	// 没有行不算错
+	pool.SetResult(stmt, nil, nil)
+	var got []*Nested[joinPlayer, joinItem]
+	if err = j.AddQuery(pool, []any{4, 5, 6}, PriorityNormal, func(l []*Nested[joinPlayer, joinItem], e error) { got, err = l, e }); err != nil || len(got) != 0 {
+		t.Fatalf("empty = %+v %v", got, err)
+	}
+
+	j.ParentKey = "player_id"
+	if _, err = j.Group([]*DBData{row("1", "a", "", "")}); err == nil {
+		t.Fatal("missing parent key column should fail")
+	}
+}
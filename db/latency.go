@@ -0,0 +1,70 @@
+package db
+
+import (
+	"log"
+	"sync"
+	"test/metrics"
+	"time"
+)
+
+// 排队耗时 vs 执行耗时：只有一个连接、一个Loop，查询慢了分不清是前面排了一长串还是mysql自己慢。
+// AddQuery时记入队时间，Loop取出时算排队耗时，执行完（含回调，回调也是在Loop里跑的）算执行耗时。
+// 指标：db.query.wait、db.query.wait.<priority>、db.query.exec
+// 总耗时超过slow_query_ms的会打一行日志并留在QueryTimings()里
+
+const maxQueryTimings = 100
+
+// QueryTiming 一条查询从入队到执行完的耗时拆分
+type QueryTiming struct {
+	Stmt     string
+	Priority string
+	Wait     time.Duration // 在队列里等了多久
+	Exec     time.Duration // Loop里执行+回调用了多久
+	At       time.Time     // 执行完的时间
+}
+
+// Bottleneck 排队比执行久说明是单连接吞吐不够，反之是mysql（或者回调）自己慢
+func (t QueryTiming) Bottleneck() string {
+	if t.Wait > t.Exec {
+		return "queue"
+	}
+	return "mysql"
+}
+
+type timingRing struct {
+	m    sync.Mutex
+	list []QueryTiming
+}
+
+func (r *timingRing) add(t QueryTiming) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.list = append(r.list, t)
+	if len(r.list) > maxQueryTimings {
+		r.list = r.list[len(r.list)-maxQueryTimings:]
+	}
+}
+
+// QueryTimings 最近总耗时超过慢查询阈值的查询（旧的在前）
+func (mysql *MysqlPool) QueryTimings() []QueryTiming {
+	mysql.timings.m.Lock()
+	defer mysql.timings.m.Unlock()
+	return append([]QueryTiming(nil), mysql.timings.list...)
+}
+
+// observeLatency Loop里每条查询执行完调用
+func (mysql *MysqlPool) observeLatency(q *SqlQuery, dequeueAt time.Time, exec time.Duration) {
+	if q.enqueueAt.IsZero() {
+		return
+	}
+	wait := dequeueAt.Sub(q.enqueueAt)
+	metrics.GetHistogram("db.query.wait").Observe(wait)
+	metrics.GetHistogram("db.query.wait." + q.Priority.String()).Observe(wait)
+	metrics.GetHistogram("db.query.exec").Observe(exec)
+	if mysql.slowThreshold <= 0 || wait+exec < mysql.slowThreshold {
+		return
+	}
+	t := QueryTiming{Stmt: q.Stmt, Priority: q.Priority.String(), Wait: wait, Exec: exec, At: time.Now()}
+	log.Printf("slow query latency: wait = %v, exec = %v, bottleneck = %s, priority = %s, stmt = %s", wait, exec, t.Bottleneck(), t.Priority, q.Stmt)
+	mysql.timings.add(t)
+}
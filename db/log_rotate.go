@@ -0,0 +1,183 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"test/gtime"
+	"test/metrics"
+	"test/timer"
+	"time"
+)
+
+// 日志表按月分表：只追加的日志表（登录、消费流水……）一张表越写越大，按月建log_login_202501这样的表，写入落到当月的表，
+// 超过保留月数的整张drop掉，比delete from ... where event_time < ?快得多也不会锁表。月份按服务器时区（gtime）算。
+// 定时任务每次检查一遍：当月和下个月的表不存在就建（月初切换时不会写到不存在的表），过期的删掉。
+// 建表语句登记时给，表名的位置写%s，例：
+// CREATE TABLE %s (
+//   id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//   event_time BIGINT NOT NULL,
+//   player_id BIGINT NOT NULL,
+//   KEY (event_time)
+// );
+// 配合Analytics用时SetRotation挂上去，Track照常写基础表名，按每行的event_time落到对应月份的表
+
+const bucketLayout = "200601"
+
+type rotatedTable struct {
+	create    string
+	retention int // 保留几个月（含当月）
+}
+
+type LogRotation struct {
+	pool   Pool
+	m      sync.RWMutex
+	tables map[string]*rotatedTable
+}
+
+func NewLogRotation(pool Pool) *LogRotation {
+	return &LogRotation{pool: pool, tables: make(map[string]*rotatedTable)}
+}
+
+// Register 登记一张按月分的表，retention是保留的月数（含当月，至少1）
+func (r *LogRotation) Register(base string, create string, retention int) error {
+	if err := checkIdent(base); err != nil {
+		return err
+	}
+	if !strings.Contains(create, "%s") {
+		return fmt.Errorf("log rotation %s: create statement has no %%s for table name", base)
+	}
+	if retention < 1 {
+		return fmt.Errorf("log rotation %s: retention %d must be positive", base, retention)
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.tables[base] = &rotatedTable{create: create, retention: retention}
+	return nil
+}
+
+// Rotated base是不是登记过的分表
+func (r *LogRotation) Rotated(base string) bool {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	_, ok := r.tables[base]
+	return ok
+}
+
+// TableFor t所在月份的表名，没登记过的表原样返回
+func (r *LogRotation) TableFor(base string, t time.Time) string {
+	if !r.Rotated(base) {
+		return base
+	}
+	return base + "_" + t.In(gtime.Location()).Format(bucketLayout)
+}
+
+// Current 当月的表名，insert用这个
+func (r *LogRotation) Current(base string) string {
+	return r.TableFor(base, gtime.Now())
+}
+
+// Tables 库里已有的分表，从旧到新
+func (r *LogRotation) Tables(base string) ([]string, error) {
+	// 配了表名前缀时库里的名字带前缀，这里查的时候加上，返回的时候去掉
+	full := base
+	if p, ok := r.pool.(interface{ Table(string) string }); ok {
+		full = p.Table(base)
+	}
+	rows, err := r.pool.Query("select table_name as name from information_schema.tables where table_schema = database() and table_name like ?", strings.ReplaceAll(full, "_", "\\_")+"\\_%")
+	if err != nil && !errors.Is(err, ErrNoRows) {
+		return nil, err
+	}
+	var ret []string
+	for _, row := range rows {
+		name := row.String("name")
+		if !strings.HasPrefix(name, full) {
+			continue
+		}
+		suffix := name[len(full):]
+		if len(suffix) != len(bucketLayout)+1 {
+			continue
+		}
+		if _, err := time.Parse(bucketLayout, suffix[1:]); err != nil {
+			continue
+		}
+		ret = append(ret, base+suffix)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Rotate 同步执行一次：建当月和下个月的表，删超过保留期的。会阻塞，主循环里用Schedule。
+// 一张表出错不影响其他表，返回第一个错误
+func (r *LogRotation) Rotate(now time.Time) (first error) {
+	r.m.RLock()
+	bases := make([]string, 0, len(r.tables))
+	for base := range r.tables {
+		bases = append(bases, base)
+	}
+	r.m.RUnlock()
+	sort.Strings(bases)
+	for _, base := range bases {
+		if err := r.rotate(base, now); err != nil {
+			metrics.GetCounter("db.log_rotate.error").Inc()
+			log.Printf("log rotation %s failed: %s", base, err.Error())
+			if first == nil {
+				first = fmt.Errorf("log rotation %s: %w", base, err)
+			}
+		}
+	}
+	return
+}
+
+func (r *LogRotation) rotate(base string, now time.Time) error {
+	r.m.RLock()
+	conf := r.tables[base]
+	r.m.RUnlock()
+	existing, err := r.Tables(base)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool, len(existing))
+	for _, t := range existing {
+		have[t] = true
+	}
+	local := now.In(gtime.Location())
+	month := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, gtime.Location())
+	for _, m := range []time.Time{month, month.AddDate(0, 1, 0)} {
+		name := r.TableFor(base, m)
+		if have[name] {
+			continue
+		}
+		if err = r.pool.Exec(fmt.Sprintf(conf.create, name)); err != nil {
+			return err
+		}
+		metrics.GetCounter("db.log_rotate.created").Inc()
+		log.Printf("log table %s created", name)
+	}
+	oldest := r.TableFor(base, month.AddDate(0, 1-conf.retention, 0))
+	for _, name := range existing {
+		if name >= oldest {
+			break
+		}
+		if err = r.pool.Exec("drop table " + name); err != nil {
+			return err
+		}
+		metrics.GetCounter("db.log_rotate.dropped").Inc()
+		log.Printf("log table %s dropped, retention %d months", name, conf.retention)
+	}
+	return nil
+}
+
+// Schedule 马上检查一次，之后每interval一次。在主循环里调，建表删表在单独的goroutine里做
+func (r *LogRotation) Schedule(interval time.Duration) {
+	run := func() {
+		go func() {
+			r.Rotate(time.Now())
+		}()
+	}
+	run()
+	timer.Every(interval, "log_rotate", run)
+}
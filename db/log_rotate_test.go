@@ -0,0 +1,59 @@
+package db
+
+import (
+	"strings"
+	"test/gtime"
+	"testing"
+	"time"
+)
+
+func TestLogRotation(t *testing.T) {
+	old := gtime.Location()
+	gtime.SetLocation(time.UTC)
+	defer gtime.SetLocation(old)
+
+	pool := NewFakePool()
+	r := NewLogRotation(pool)
+	create := "create table %s (id bigint, event_time bigint, player_id bigint)"
+	if err := r.Register("log_login", "create table log_login (id bigint)", 3); err == nil {
+		t.Fatal("create without placeholder should fail")
+	}
+	if err := r.Register("log_login", create, 3); err != nil {
+		t.Fatal(err)
+	}
+	name := func(s string) *DBData { return &DBData{Data: map[string][]byte{"name": []byte(s)}} }
+	pool.SetResult("select table_name as name from information_schema.tables where table_schema = database() and table_name like ?", []*DBData{
+		name("log_login_202503"), name("log_login_202411"), name("log_login_202501"), name("log_login_backup"), name("log_login_202412"),
+	}, nil)
+	for _, s := range []string{"create table log_login_202504 (id bigint, event_time bigint, player_id bigint)", "drop table log_login_202411", "drop table log_login_202412"} {
+		pool.SetResult(s, nil, nil)
+	}
+	now := time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC)
+	if err := r.Rotate(now); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(pool.Execs[1:], "\n")
+	want := "create table log_login_202504 (id bigint, event_time bigint, player_id bigint)\ndrop table log_login_202411\ndrop table log_login_202412"
+	if got != want {
+		t.Fatalf("execs:\n%s", got)
+	}
+	if r.TableFor("log_login", now) != "log_login_202503" || r.TableFor("log_other", now) != "log_other" {
+		t.Fatal("TableFor")
+	}
+
+	// Analytics按event_time写到对应月份
+	a := NewAnalytics()
+	a.pool = pool
+	a.SetRotation(r)
+	a.RegisterAnalytics("log_login", "player_id")
+	err := a.insert("log_login", []*analyticsRow{
+		{Table: "log_login", Time: now.Unix(), Values: []any{int64(1)}},
+		{Table: "log_login", Time: now.AddDate(0, 1, 0).Unix(), Values: []any{int64(2)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pool.Table("log_login_202503")) != 1 || len(pool.Table("log_login_202504")) != 1 {
+		t.Fatalf("rows = %v %v", pool.Table("log_login_202503"), pool.Table("log_login_202504"))
+	}
+}
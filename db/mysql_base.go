@@ -3,6 +3,7 @@ package db
 // 链接/查询mysql基本代码 重点不在这里
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
@@ -10,40 +11,87 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type SqlQuery struct {
-	FcId   int
-	Stmt   string
-	Args   []any
-	CbFunc func([]*DBData, error)
+	FcId     int
+	Stmt     string
+	Args     []any
+	CbFunc   func([]*DBData, error)
+	Priority QueryPriority
+	// Unlimited select不受结果集大小限制（max_result_rows/bytes，见result_limit.go），
+	// 只给一致性巡检这种必须拿到全量结果的内部读用，业务查询不要填
+	Unlimited bool
+
+	exec      func(mysql *MysqlPool) // 不为nil时Loop直接调它，不按Stmt的类型分派（分页查询这类多条语句的操作用）
+	enqueueAt time.Time              // AddQuery时填，算排队耗时用，见latency.go
 }
 
 type MysqlPool struct {
-	Inited    bool
-	Db        *sql.DB
-	m         sync.Mutex
-	queryList chan *SqlQuery
+	Inited     bool
+	Db         *sql.DB
+	m          sync.Mutex
+	queryLists [priorityCount]chan *SqlQuery // 按优先级分开的队列，见priority.go
+
+	slowThreshold time.Duration      // 0表示不记录慢查询
+	slowQueries   []*SlowQueryRecord // 最近的慢查询，最多保留maxSlowRecords条
+	tracer        Tracer             // nil表示没开trace
+	columnCache   map[string][]columnMeta
+	breaker       *circuitBreaker // nil表示没开熔断
+	tablePrefix   string
+	blobFormat    BlobFormat
+	inflight      atomic.Int32 // Loop正在执行的查询数（0或1），Drain用
+	timings       timingRing   // 排队+执行总耗时超标的查询，见latency.go
+	resultLimit   resultLimit
+	spill         *spillWAL // nil表示没开落盘，见spill.go
+	spillQueueLen int
+	tableStats    tableStats            // 按表的访问量，见table_stats.go
+	chaos         atomic.Pointer[chaos] // 故障注入，nil表示没开，见chaos.go
+	readOnly      atomic.Bool           // 只读模式，见read_only.go
 }
 
 type MysqlConf struct {
-	Username   string `xml:"user_name" json:"user_name"`
-	Password   string `xml:"password" json:"password"`
-	RemoteIp   string `xml:"remote_ip" json:"remote_ip"`
-	RemotePort int    `xml:"remote_port" json:"remote_port"`
-	DbName     string `xml:"db_name" json:"db_name"`
+	Username    string `xml:"user_name" json:"user_name"`
+	Password    string `xml:"password" json:"-"` // 明文密码，正式环境用下面几种之一，见secret.go
+	RemoteIp    string `xml:"remote_ip" json:"remote_ip"`
+	RemotePort  int    `xml:"remote_port" json:"remote_port"`
+	DbName      string `xml:"db_name" json:"db_name"`
+	SlowQueryMs int    `xml:"slow_query_ms" json:"slow_query_ms"` // 超过这个毫秒数算慢查询，select会顺手跑一次EXPLAIN，不填(0)不开
+
+	BreakerFailures    int `xml:"breaker_failures" json:"breaker_failures"`         // 连续失败多少次熔断，不填(0)不开
+	BreakerCooldownSec int `xml:"breaker_cooldown_sec" json:"breaker_cooldown_sec"` // 熔断后多久放探测查询，不填默认5秒
+
+	TablePrefix  string `xml:"table_prefix" json:"table_prefix"`   // 表名前缀，多个环境共用一个库时区分，见prefix.go
+	BlobCompress string `xml:"blob_compress" json:"blob_compress"` // SaveBlob的压缩格式none/gzip/snappy，不填不压缩，见blob.go
+
+	MaxResultRows     int    `xml:"max_result_rows" json:"max_result_rows"`         // 单次查询最多返回多少行，不填(0)不限，见result_limit.go
+	MaxResultBytes    int    `xml:"max_result_bytes" json:"max_result_bytes"`       // 单次查询结果最多多少字节，不填(0)不限
+	ResultLimitPolicy string `xml:"result_limit_policy" json:"result_limit_policy"` // 超限处理error/truncate，不填error
+
+	PasswordEnv       string `xml:"password_env" json:"password_env"`     // 从这个环境变量读密码
+	PasswordFile      string `xml:"password_file" json:"password_file"`   // 从这个文件读密码，权限必须是0600/0400
+	PasswordEncrypted string `xml:"password_encrypted" json:"-"`          // EncryptSecret生成的密文
+	SecretKeyEnvName  string `xml:"secret_key_env" json:"secret_key_env"` // 解密口令所在的环境变量，不填SERVER_SECRET_KEY
+
+	SpillDir      string `xml:"spill_dir" json:"spill_dir"`             // 队列积压时非关键写入落盘的目录，不填不落盘，见spill.go
+	SpillQueueLen int    `xml:"spill_queue_len" json:"spill_queue_len"` // 队列里积压到多少条开始落盘，不填(0)等队列满
+	SpillMaxMB    int    `xml:"spill_max_mb" json:"spill_max_mb"`       // 落盘文件上限，超了还是返回ErrQueueFull，不填256
+
+	Chaos *ChaosConf `xml:"chaos" json:"chaos"` // 故障注入，只给测试环境用，不配不开，见chaos.go
 }
 
 type DBData struct {
-	Data map[string][]byte // key-库表的列名，value-这条数据的这一列的值（用[]byte表示，之后在上层转化为需要的类型如protobuf的Unmarshal）
+	Data   map[string][]byte // key-库表的列名，value-这条数据的这一列的值（用[]byte表示，之后在上层转化为需要的类型如protobuf的Unmarshal）
+	Values map[string]any    // 按列类型转换后的值：int64/uint64/float64/time.Time/string，blob类还是[]byte，NULL是nil
 }
 
 func NewMysqlPool() *MysqlPool {
 	return &MysqlPool{
-		Inited:    false,
-		Db:        nil,
-		m:         sync.Mutex{},
-		queryList: nil,
+		Inited: false,
+		Db:     nil,
+		m:      sync.Mutex{},
 	}
 }
 
@@ -56,8 +104,12 @@ func (mysql *MysqlPool) InitMysqlPool(conf *MysqlConf) {
 	mysql.m.Lock()
 	defer mysql.m.Unlock()
 
-	var err error
-	mysql.Db, err = sql.Open("mysql", conf.Username+":"+conf.Password+"@tcp("+conf.RemoteIp+":"+strconv.Itoa(conf.RemotePort)+")/"+conf.DbName)
+	password, err := conf.ResolvePassword()
+	if err != nil {
+		fmt.Println("Init Mysql error: " + err.Error())
+		return
+	}
+	mysql.Db, err = sql.Open("mysql", conf.Username+":"+password+"@tcp("+conf.RemoteIp+":"+strconv.Itoa(conf.RemotePort)+")/"+conf.DbName)
 	if err != nil {
 		fmt.Println("Init Mysql error: " + err.Error())
 		return
@@ -69,8 +121,31 @@ func (mysql *MysqlPool) InitMysqlPool(conf *MysqlConf) {
 		fmt.Println("Init Mysql error: " + err.Error())
 		return
 	}
-	mysql.queryList = make(chan *SqlQuery, 10)
+	mysql.queryLists = newQueryLists()
+	mysql.slowThreshold = time.Duration(conf.SlowQueryMs) * time.Millisecond
+	mysql.tablePrefix = conf.TablePrefix
+	mysql.blobFormat, _ = ParseBlobFormat(conf.BlobCompress)
+	mysql.resultLimit.maxRows = conf.MaxResultRows
+	mysql.resultLimit.maxBytes = conf.MaxResultBytes
+	mysql.resultLimit.policy, _ = ParseResultLimitPolicy(conf.ResultLimitPolicy)
+	mysql.breaker = newBreaker(conf.BreakerFailures, time.Duration(conf.BreakerCooldownSec)*time.Second)
+	if conf.Chaos != nil {
+		mysql.SetChaos(conf.Chaos)
+	}
+	mysql.spillQueueLen = conf.SpillQueueLen
+	if mysql.spillQueueLen <= 0 || mysql.spillQueueLen > queryQueueSize {
+		mysql.spillQueueLen = queryQueueSize
+	}
+	if conf.SpillDir != "" {
+		if mysql.spill, err = openSpill(conf.SpillDir, int64(conf.SpillMaxMB)<<20); err != nil {
+			log.Printf("open mysql spill dir failed, writes will not be spilled: %s", err.Error())
+			mysql.spill = nil
+		}
+	}
 	mysql.Inited = true
+	if mysql.spill != nil {
+		go mysql.spillLoop(mysql.spill)
+	}
 	log.Printf("init mysql pool success")
 }
 
@@ -84,37 +159,59 @@ func (mysql *MysqlPool) ReleaseMysqlPool() {
 	defer mysql.m.Unlock()
 
 	mysql.Db.Close()
-	close(mysql.queryList)
+	for _, l := range mysql.queryLists {
+		close(l)
+	}
+	if mysql.spill != nil {
+		mysql.spill.close()
+	}
 	mysql.Inited = false
 	log.Printf("release mysql pool success")
 }
 
 func (mysql *MysqlPool) Loop() {
 	for mysql.Inited {
-		q := <-mysql.queryList
+		q := mysql.nextQuery()
 		if q == nil {
 			log.Printf("Loop detected nil ptr")
 			continue
 		}
-		log.Printf("query received, stmt = %s, args = %v", q.Stmt, q.Args)
-		sqlType := strings.ToLower(strings.Split(q.Stmt, " ")[0])
-		switch sqlType {
-		case "select":
-			result, err := mysql.Query(q.Stmt, q.Args...)
-			q.CbFunc(result, err)
-		case "insert":
-			fallthrough
-		case "update":
-			fallthrough
-		case "delete":
-			fallthrough
-		case "replace":
-			err := mysql.Exec(q.Stmt, q.Args)
-			q.CbFunc(nil, err)
-		default:
-			log.Printf("illegal mysql operation type %s", sqlType)
-			continue
+		mysql.inflight.Add(1)
+		start := time.Now()
+		mysql.handle(q)
+		mysql.observeLatency(q, start, time.Since(start))
+		mysql.inflight.Add(-1)
+	}
+}
+
+func (mysql *MysqlPool) handle(q *SqlQuery) {
+	log.Printf("query received, stmt = %s, args = %v", q.Stmt, q.Args)
+	if q.exec != nil {
+		q.exec(mysql)
+		return
+	}
+	sqlType := strings.ToLower(strings.Split(q.Stmt, " ")[0])
+	switch sqlType {
+	case "select":
+		var result []*DBData
+		var err error
+		if q.Unlimited {
+			result, err = mysql.QueryAll(q.Stmt, q.Args...)
+		} else {
+			result, err = mysql.Query(q.Stmt, q.Args...)
 		}
+		q.CbFunc(result, err)
+	case "insert":
+		fallthrough
+	case "update":
+		fallthrough
+	case "delete":
+		fallthrough
+	case "replace":
+		err := mysql.Exec(q.Stmt, q.Args...)
+		q.CbFunc(nil, err)
+	default:
+		log.Printf("illegal mysql operation type %s", sqlType)
 	}
 }
 
@@ -125,51 +222,179 @@ func GetDbPool() *MysqlPool {
 }
 
 // Query 需要确保sql里是1条查询语句，如果有多条select，需要循环rows.NextResultSet遍历所有结果集（建议憋搞那么复杂）
+// 查不到数据时返回ErrNoRows，断线返回ErrConnLost
 func (mysql *MysqlPool) Query(sql string, args ...any) (result []*DBData, err error) {
 	if !mysql.Inited {
-		fmt.Println("Query failed: Mysql not inited")
-		return
+		return nil, ErrNotInited
+	}
+	mysql.m.Lock()
+	defer mysql.m.Unlock()
+	return mysql.query(mysql.Db, sql, args...)
+}
+
+// QueryAll 同Query但不受结果集大小限制，导出、巡检这种少了行就会出错的内部读用，业务查询还是用Query
+func (mysql *MysqlPool) QueryAll(sql string, args ...any) (result []*DBData, err error) {
+	if !mysql.Inited {
+		return nil, ErrNotInited
 	}
 	mysql.m.Lock()
 	defer mysql.m.Unlock()
-	rows, err := mysql.Db.Query(sql, args...)
+	return mysql.queryLimit(mysql.Db, resultLimit{}, sql, args...)
+}
+
+// queryer *sql.DB和*sql.Conn都满足，需要固定在同一个连接上连续执行的语句传*sql.Conn
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// query 调用方需持有mysql.m
+func (mysql *MysqlPool) query(q queryer, sql string, args ...any) (result []*DBData, err error) {
+	return mysql.queryLimit(q, mysql.resultLimit, sql, args...)
+}
+
+func (mysql *MysqlPool) queryLimit(q queryer, limit resultLimit, sql string, args ...any) (result []*DBData, err error) {
+	raw := sql
+	sql = prefixTables(mysql.tablePrefix, sql)
+	if err = mysql.checkReadOnly(raw); err != nil {
+		return nil, err
+	}
+	if err = mysql.breaker.allow(); err != nil {
+		return nil, err
+	}
+	span := mysql.startSpan("mysql.Query", sql)
+	start := time.Now()
+	defer func() {
+		mysql.breaker.report(err)
+		span.End(err)
+		cost := time.Since(start)
+		mysql.checkSlow(q, sql, args, cost, true)
+		mysql.tableStats.record(raw, args, result, cost, err)
+		if err == nil {
+			fireReadHooks(raw, args)
+		}
+	}()
+	if err = mysql.chaos.Load().inject(); err != nil {
+		return nil, err
+	}
+	rows, err := q.QueryContext(context.Background(), sql, args...)
 	if err != nil {
-		return
+		return nil, wrapErr(err)
 	}
 	defer rows.Close()
+	return scanRows(rows, mysql.columnMetas(sql, rows), limit, sql)
+}
+
+// scanRows metas为nil时只填Data，limit见result_limit.go
+func scanRows(rows *sql.Rows, metas []columnMeta, limit resultLimit, stmt string) (result []*DBData, err error) {
 	columns, _ := rows.Columns()
 
+	totalBytes := 0
 	for rows.Next() {
 		b := &DBData{
 			Data: make(map[string][]byte),
 		}
+		if metas != nil {
+			b.Values = make(map[string]any, len(columns))
+		}
 		buff := make([]interface{}, len(columns))
 		scanners := make([][]byte, len(columns))
 		for i, _ := range buff {
 			buff[i] = &scanners[i]
 		}
 		if err := rows.Scan(buff...); err != nil {
-			log.Fatal(err)
+			return nil, wrapErr(err)
+		}
+		if limit.enabled() {
+			rowBytes := 0
+			for _, data := range scanners {
+				rowBytes += len(data)
+			}
+			if limit.exceeded(len(result)+1, totalBytes+rowBytes) {
+				if err = limit.onExceeded(stmt, len(result), totalBytes); err != nil {
+					return nil, err
+				}
+				break
+			}
+			totalBytes += rowBytes
 		}
 		for i, data := range scanners {
 			b.Data[columns[i]] = data
+			if metas != nil {
+				b.Values[columns[i]] = convertValue(metas[i].kind, data)
+			}
 		}
 		result = append(result, b)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+	if len(result) == 0 {
+		return nil, ErrNoRows
+	}
 	return
 }
 
 func (mysql *MysqlPool) Exec(sql string, args ...any) (err error) {
 	if !mysql.Inited {
-		fmt.Println("Query failed: Mysql not inited")
-		return
+		return ErrNotInited
 	}
 	mysql.m.Lock()
 	defer mysql.m.Unlock()
-	_, err = mysql.Db.Exec(sql, args...)
-	return
+	return mysql.exec(mysql.Db, sql, args...)
+}
+
+// execer *sql.DB、*sql.Conn、*sql.Tx都满足
+type execer interface {
+	queryer
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// exec 调用方需持有mysql.m
+func (mysql *MysqlPool) exec(e execer, sql string, args ...any) (err error) {
+	raw := sql
+	sql = prefixTables(mysql.tablePrefix, sql)
+	if err = mysql.checkReadOnly(raw); err != nil {
+		return err
+	}
+	if err = mysql.breaker.allow(); err != nil {
+		return err
+	}
+	span := mysql.startSpan("mysql.Exec", sql)
+	start := time.Now()
+	defer func() {
+		mysql.breaker.report(err)
+		span.End(err)
+		cost := time.Since(start)
+		mysql.checkSlow(e, sql, args, cost, false)
+		mysql.tableStats.record(raw, args, nil, cost, err)
+		// 事务里（只有*sql.Tx有Commit）的写入由Tx记下来，提交后再回调
+		if _, inTx := e.(interface{ Commit() error }); err == nil && !inTx {
+			fireWriteHooks(raw, args)
+		}
+	}()
+	if err = mysql.chaos.Load().inject(); err != nil {
+		return err
+	}
+	_, err = e.ExecContext(context.Background(), sql, args...)
+	return wrapErr(err)
 }
 
-func (mysql *MysqlPool) AddQuery(query *SqlQuery) {
-	mysql.queryList <- query
+// AddQuery 不阻塞调用方，队列满了直接返回ErrQueueFull，由业务层决定重试还是丢弃。开了落盘的话非关键写入落盘，见spill.go
+func (mysql *MysqlPool) AddQuery(query *SqlQuery) error {
+	if !mysql.Inited {
+		return ErrNotInited
+	}
+	query.enqueueAt = time.Now()
+	if spilled, err := mysql.trySpill(query, false); spilled {
+		return err
+	}
+	select {
+	case mysql.queueOf(query.Priority) <- query:
+		return nil
+	default:
+		if spilled, err := mysql.trySpill(query, true); spilled {
+			return err
+		}
+		return ErrQueueFull
+	}
 }
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CountMode 分页查询时总数怎么算
+type CountMode int32
+
+const (
+	CountNone      CountMode = 0 // 不算总数，Total返回-1
+	CountSeparate  CountMode = 1 // 另跑一条 SELECT COUNT(*) FROM (原语句) 子查询
+	CountFoundRows CountMode = 2 // 原语句加SQL_CALC_FOUND_ROWS，再在同一个连接上查FOUND_ROWS()（mysql8已标记废弃，老库用）
+)
+
+type PageResult struct {
+	Rows     []*DBData
+	Total    int64 // 不分页时的总行数，CountNone时为-1
+	Page     int
+	PageSize int
+}
+
+// QueryPage 分页查询，stmt是不带LIMIT的select语句，page从1开始。
+// 和Query不同，某一页没数据是正常情况，返回空Rows而不是ErrNoRows
+func (mysql *MysqlPool) QueryPage(stmt string, args []any, page int, pageSize int, mode CountMode) (ret *PageResult, err error) {
+	if !mysql.Inited {
+		return nil, ErrNotInited
+	}
+	if page < 1 || pageSize < 1 {
+		return nil, fmt.Errorf("QueryPage error: illegal page %d or pageSize %d", page, pageSize)
+	}
+	stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+	if !strings.HasPrefix(strings.ToLower(stmt), "select ") {
+		return nil, fmt.Errorf("QueryPage error: not a select statement: %s", stmt)
+	}
+	mysql.m.Lock()
+	defer mysql.m.Unlock()
+
+	// FOUND_ROWS必须和原语句在同一个连接上，这里统一拿一个连接用
+	conn, err := mysql.Db.Conn(context.Background())
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer conn.Close()
+
+	ret = &PageResult{Total: -1, Page: page, PageSize: pageSize}
+	pageStmt := stmt
+	if mode == CountFoundRows {
+		pageStmt = "SELECT SQL_CALC_FOUND_ROWS " + stmt[len("select "):]
+	}
+	pageStmt += " LIMIT ? OFFSET ?"
+	pageArgs := append(append([]any{}, args...), pageSize, (page-1)*pageSize)
+	ret.Rows, err = mysql.query(conn, pageStmt, pageArgs...)
+	if err != nil && !errors.Is(err, ErrNoRows) {
+		return nil, err
+	}
+
+	switch mode {
+	case CountSeparate:
+		ret.Total, err = mysql.queryCount(conn, "SELECT COUNT(*) AS total FROM ("+stmt+") AS page_t", args...)
+	case CountFoundRows:
+		ret.Total, err = mysql.queryCount(conn, "SELECT FOUND_ROWS() AS total")
+	default:
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// AddPageQuery QueryPage的异步版本，在Loop里执行后回调
+func (mysql *MysqlPool) AddPageQuery(stmt string, args []any, page int, pageSize int, mode CountMode, cb func(*PageResult, error)) error {
+	return mysql.AddQuery(&SqlQuery{
+		Stmt: stmt,
+		Args: args,
+		exec: func(mysql *MysqlPool) {
+			cb(mysql.QueryPage(stmt, args, page, pageSize, mode))
+		},
+	})
+}
+
+// queryCount 调用方需持有mysql.m
+func (mysql *MysqlPool) queryCount(q queryer, stmt string, args ...any) (int64, error) {
+	rows, err := mysql.query(q, stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(rows[0].Data["total"]), 10, 64)
+}
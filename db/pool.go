@@ -0,0 +1,11 @@
+package db
+
+// Pool 业务层依赖这个接口而不是*MysqlPool，单测时换成NewFakePool()就不需要连真实的mysql
+type Pool interface {
+	Query(sql string, args ...any) ([]*DBData, error)
+	Exec(sql string, args ...any) error
+	AddQuery(query *SqlQuery) error
+}
+
+var _ Pool = (*MysqlPool)(nil)
+var _ Pool = (*FakePool)(nil)
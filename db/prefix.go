@@ -0,0 +1,66 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+)
+
+// 表名前缀：多个开发环境共用一个mysql实例时，每个环境配不同的table_prefix（比如dev1_），
+// 业务代码里照常写表名，Query/Exec执行前自动把from/into/update/join/table后面的表名加上前缀。
+// 已经带前缀的、库名.表名形式的不处理。
+// 注意：
+// 1. 列名用表名限定（t.id）的写法不会跟着改，多表查询请用别名（from t as a ... a.id）
+// 2. 字符串常量里恰好出现"from xxx"也会被改，别在sql里拼这种文本（参数走?就没事）
+
+var tableRefReg = regexp.MustCompile("(?i)\\b(from|into|update|join|table)\\s+`?([A-Za-z_][A-Za-z0-9_]*)`?")
+
+// prefixTables 没配前缀时原样返回
+func prefixTables(prefix string, stmt string) string {
+	if prefix == "" {
+		return stmt
+	}
+	matches := tableRefReg.FindAllStringSubmatchIndex(stmt, -1)
+	if matches == nil {
+		return stmt
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		keyword := strings.ToLower(stmt[m[2]:m[3]])
+		nameStart, nameEnd := m[4], m[5]
+		name := stmt[nameStart:nameEnd]
+		if skipTableRef(stmt, m[0], nameEnd, keyword, name, prefix) {
+			continue
+		}
+		sb.WriteString(stmt[last:nameStart])
+		sb.WriteString(prefix)
+		sb.WriteString(name)
+		last = nameEnd
+	}
+	sb.WriteString(stmt[last:])
+	return sb.String()
+}
+
+func skipTableRef(stmt string, start int, nameEnd int, keyword string, name string, prefix string) bool {
+	if strings.HasPrefix(name, prefix) {
+		return true
+	}
+	// 库名.表名
+	rest := strings.TrimLeft(stmt[nameEnd:], "`")
+	if strings.HasPrefix(rest, ".") {
+		return true
+	}
+	if keyword == "update" {
+		before := strings.ToLower(strings.TrimSpace(stmt[:start]))
+		// on duplicate key update 后面是列名；select ... for update 后面是nowait之类
+		if strings.HasSuffix(before, "key") || strings.HasSuffix(before, "for") {
+			return true
+		}
+	}
+	return false
+}
+
+// Table 带上当前前缀的表名，日志、建表之类不经过Query/Exec的地方用
+func (mysql *MysqlPool) Table(name string) string {
+	return mysql.tablePrefix + name
+}
@@ -0,0 +1,65 @@
+package db
+
+// 查询优先级：每个优先级一条队列，Loop总是先把高优先级的取完，
+// 统计/日志这种大量低优先级写入不会拖慢玩家存档
+
+type QueryPriority int
+
+const (
+	PriorityNormal QueryPriority = iota // 不填就是这个
+	PriorityHigh                        // 玩家存档等关键写入
+	PriorityLow                         // 统计、日志等后台写入
+	priorityCount
+)
+
+func (p QueryPriority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityLow:
+		return "low"
+	}
+	return "normal"
+}
+
+const queryQueueSize = 10
+
+func newQueryLists() [priorityCount]chan *SqlQuery {
+	var lists [priorityCount]chan *SqlQuery
+	for i := range lists {
+		lists[i] = make(chan *SqlQuery, queryQueueSize)
+	}
+	return lists
+}
+
+func (mysql *MysqlPool) queueOf(p QueryPriority) chan *SqlQuery {
+	if p < 0 || p >= priorityCount {
+		p = PriorityNormal
+	}
+	return mysql.queryLists[p]
+}
+
+// nextQuery 按high>normal>low取，都没有就阻塞等任意一条。队列关闭后返回nil
+func (mysql *MysqlPool) nextQuery() *SqlQuery {
+	high, normal, low := mysql.queryLists[PriorityHigh], mysql.queryLists[PriorityNormal], mysql.queryLists[PriorityLow]
+	select {
+	case q := <-high:
+		return q
+	default:
+	}
+	select {
+	case q := <-high:
+		return q
+	case q := <-normal:
+		return q
+	default:
+	}
+	select {
+	case q := <-high:
+		return q
+	case q := <-normal:
+		return q
+	case q := <-low:
+		return q
+	}
+}
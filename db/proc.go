@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CallProc 调存储过程（有些老库把结算逻辑写在存储过程里）。
+// in按顺序传给前面的IN参数，后面跟outCount个OUT参数，拼出来是 CALL name(?, ?, @o1, @o2)，
+// 执行完在同一个连接上 SELECT @o1 AS o1, @o2 AS o2 取回来，用返回值的Int64("o1")这些取。outCount为0时返回nil。
+// 存储过程自己select出来的结果集会被丢掉，需要的话改成OUT参数
+func (mysql *MysqlPool) CallProc(name string, in []any, outCount int) (out *DBData, err error) {
+	if !mysql.Inited {
+		return nil, ErrNotInited
+	}
+	if !identReg.MatchString(name) {
+		return nil, fmt.Errorf("CallProc error: illegal procedure name %q", name)
+	}
+	if outCount < 0 {
+		return nil, fmt.Errorf("CallProc error: illegal outCount %d", outCount)
+	}
+	params := make([]string, 0, len(in)+outCount)
+	outs := make([]string, 0, outCount)
+	for range in {
+		params = append(params, "?")
+	}
+	for i := 1; i <= outCount; i++ {
+		params = append(params, "@o"+strconv.Itoa(i))
+		outs = append(outs, "@o"+strconv.Itoa(i)+" AS o"+strconv.Itoa(i))
+	}
+
+	mysql.m.Lock()
+	defer mysql.m.Unlock()
+
+	// @变量是连接级的，CALL和SELECT必须在同一个连接上
+	conn, err := mysql.Db.Conn(context.Background())
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer conn.Close()
+
+	if err = mysql.exec(conn, "CALL "+name+"("+strings.Join(params, ", ")+")", in...); err != nil {
+		return nil, err
+	}
+	if outCount == 0 {
+		return nil, nil
+	}
+	rows, err := mysql.query(conn, "SELECT "+strings.Join(outs, ", "))
+	if err != nil {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
+// AddCallProc CallProc的异步版本，在Loop里执行后回调
+func (mysql *MysqlPool) AddCallProc(name string, in []any, outCount int, cb func(*DBData, error)) error {
+	return mysql.AddQuery(&SqlQuery{
+		Stmt: "call " + name,
+		Args: in,
+		exec: func(mysql *MysqlPool) {
+			cb(mysql.CallProc(name, in, outCount))
+		},
+	})
+}
@@ -0,0 +1,30 @@
+package db
+
+import "log"
+
+// 只读模式：崩溃循环进安全模式时（见main的crashloop.go）打开，之后所有写语句（包括存储过程）直接返回ErrReadOnly，不会真的发到库里，
+// 查询照常。落盘文件（spill.go）里的写入也先不补，等关掉只读再补
+
+// readOnlyOps 只读模式下放行的语句
+var readOnlyOps = map[string]bool{"select": true, "show": true, "set": true, "explain": true, "desc": true, "describe": true, "with": true}
+
+func (mysql *MysqlPool) SetReadOnly(on bool) {
+	if mysql.readOnly.Swap(on) != on {
+		log.Printf("mysql read only = %v", on)
+	}
+}
+
+func (mysql *MysqlPool) ReadOnly() bool {
+	return mysql.readOnly.Load()
+}
+
+// checkReadOnly stmt是加前缀前的原语句
+func (mysql *MysqlPool) checkReadOnly(stmt string) error {
+	if !mysql.readOnly.Load() {
+		return nil
+	}
+	if op, _ := stmtTables(stmt); readOnlyOps[op] {
+		return nil
+	}
+	return ErrReadOnly
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	p := &MysqlPool{}
+	if err := p.checkReadOnly("insert into t values (1)"); err != nil {
+		t.Fatal(err)
+	}
+	p.SetReadOnly(true)
+	for _, stmt := range []string{"insert into t values (1)", " UPDATE t set a = 1", "call settle(?)", "delete from t", "replace into t values (1)"} {
+		if err := p.checkReadOnly(stmt); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	for _, stmt := range []string{"select * from t", "SHOW TABLES", "set names utf8mb4"} {
+		if err := p.checkReadOnly(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	p.SetReadOnly(false)
+	if p.ReadOnly() || p.checkReadOnly("delete from t") != nil {
+		t.Fatal("read only not cleared")
+	}
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"test/metrics"
+)
+
+// 结果集大小保护：忘了写LIMIT的select一次捞几十万行会把内存撑爆。
+// 配max_result_rows / max_result_bytes（按列值字节数累加，不算map本身的开销），超了按result_limit_policy处理：
+// error（默认）直接返回ErrResultTooLarge，truncate只返回前面没超的部分并打警告（调用方分不出结果少了，确认能接受再用）。都不配不限制。
+// 导出（DumpTable）、一致性巡检这种少了行就会出错的内部读不受限制，见QueryAll和SqlQuery.Unlimited
+
+type ResultLimitPolicy int
+
+const (
+	ResultLimitError    ResultLimitPolicy = 0
+	ResultLimitTruncate ResultLimitPolicy = 1
+)
+
+func ParseResultLimitPolicy(s string) (ResultLimitPolicy, error) {
+	switch s {
+	case "", "error":
+		return ResultLimitError, nil
+	case "truncate":
+		return ResultLimitTruncate, nil
+	}
+	return ResultLimitError, fmt.Errorf("unknown result_limit_policy %q, must be error/truncate", s)
+}
+
+type resultLimit struct {
+	maxRows  int // 0不限
+	maxBytes int // 0不限
+	policy   ResultLimitPolicy
+}
+
+func (l resultLimit) enabled() bool {
+	return l.maxRows > 0 || l.maxBytes > 0
+}
+
+// exceeded 算上当前这一行后的总行数/总字节数有没有超
+func (l resultLimit) exceeded(rows, bytes int) bool {
+	return l.maxRows > 0 && rows > l.maxRows || l.maxBytes > 0 && bytes > l.maxBytes
+}
+
+// onExceeded 超限时scanRows调用，truncate返回nil（调用方返回已读的部分），error返回ErrResultTooLarge。
+// 第一行就超了的话truncate也返回错误，不然调用方拿到的是ErrNoRows
+func (l resultLimit) onExceeded(stmt string, rows int, bytes int) error {
+	metrics.GetCounter("db.result.limited").Inc()
+	if l.policy == ResultLimitError || rows == 0 {
+		return fmt.Errorf("%w: stmt = %s, max_rows = %d, max_bytes = %d", ErrResultTooLarge, stmt, l.maxRows, l.maxBytes)
+	}
+	log.Printf("WARNING: result truncated at %d rows / %d bytes (max_rows = %d, max_bytes = %d), missing LIMIT? stmt = %s", rows, bytes, l.maxRows, l.maxBytes, stmt)
+	return nil
+}
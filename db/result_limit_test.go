@@ -0,0 +1,105 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// rowsDriver 每条select都返回n行(id, v)，写语句和事务什么都不做，只够测结果集限制和事务里的钩子
+type rowsDriver struct{ n int }
+
+type rowsConn struct{ n int }
+type rowsStmt struct{ n int }
+type fixedRows struct{ i, n int }
+type nopTx struct{}
+
+func (d *rowsDriver) Open(string) (driver.Conn, error)         { return &rowsConn{d.n}, nil }
+func (c *rowsConn) Prepare(string) (driver.Stmt, error)        { return &rowsStmt{c.n}, nil }
+func (c *rowsConn) Close() error                               { return nil }
+func (c *rowsConn) Begin() (driver.Tx, error)                  { return nopTx{}, nil }
+func (s *rowsStmt) Close() error                               { return nil }
+func (s *rowsStmt) NumInput() int                              { return -1 }
+func (s *rowsStmt) Exec([]driver.Value) (driver.Result, error) { return driver.ResultNoRows, nil }
+func (nopTx) Commit() error                                    { return nil }
+func (nopTx) Rollback() error                                  { return nil }
+func (s *rowsStmt) Query([]driver.Value) (driver.Rows, error)  { return &fixedRows{n: s.n}, nil }
+func (r *fixedRows) Columns() []string                         { return []string{"id", "v"} }
+func (r *fixedRows) Close() error                              { return nil }
+
+func (r *fixedRows) Next(dest []driver.Value) error {
+	if r.i >= r.n {
+		return io.EOF
+	}
+	r.i++
+	dest[0] = []byte(strconv.Itoa(r.i))
+	dest[1] = []byte("v" + strconv.Itoa(r.i))
+	return nil
+}
+
+func init() {
+	sql.Register("db_test_rows", &rowsDriver{n: 5})
+}
+
+// syncPool AddQuery直接在当前goroutine里执行，不用起Loop
+type syncPool struct{ *MysqlPool }
+
+func (p syncPool) AddQuery(q *SqlQuery) error {
+	p.handle(q)
+	return nil
+}
+
+func TestResultLimitInternalReaders(t *testing.T) {
+	conn, err := sql.Open("db_test_rows", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mysql := NewMysqlPool()
+	mysql.Db, mysql.Inited = conn, true
+	mysql.resultLimit = resultLimit{maxRows: 3}
+
+	if _, err := mysql.Query("select id, v from t"); !errors.Is(err, ErrResultTooLarge) {
+		t.Fatalf("default policy err = %v", err)
+	}
+	mysql.resultLimit.policy = ResultLimitTruncate
+	if rows, err := mysql.Query("select id, v from t"); err != nil || len(rows) != 3 {
+		t.Fatalf("truncate = %d rows, %v", len(rows), err)
+	}
+
+	// 导出拿全量
+	buf := &bytes.Buffer{}
+	if n, err := mysql.DumpTable("t", buf); err != nil || n != 5 || strings.Count(buf.String(), "\n") != 5 {
+		t.Fatalf("dump = %d, %v", n, err)
+	}
+
+	// 巡检拿全量，不会把超出上限的行当成MissingInDB
+	repaired := 0
+	c := &ConsistencyCheck[string]{
+		Name:     "limit",
+		Query:    "select id, v from t",
+		RowKey:   func(row *DBData) string { return row.String("id") },
+		RowValue: func(row *DBData) string { return row.String("v") },
+		Memory: func() map[string]string {
+			return map[string]string{"1": "v1", "2": "v2", "3": "v3", "4": "v4", "5": "v5"}
+		},
+		Policy:   RepairFromMemory,
+		RepairDB: func(Divergence[string]) *SqlQuery { repaired++; return nil },
+	}
+	for i := 0; i < 2; i++ {
+		var got []Divergence[string]
+		if err := c.Run(syncPool{mysql}, func(d []Divergence[string]) { got = d }); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0 || len(c.suspects) != 0 {
+			t.Fatalf("round %d divergence %v suspects %v", i, got, c.suspects)
+		}
+	}
+	if repaired != 0 {
+		t.Fatalf("repaired %d", repaired)
+	}
+}
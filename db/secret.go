@@ -0,0 +1,152 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// 数据库密码不写明文的几种方式，配置里四选一：
+// password：明文（本地开发用）
+// password_env：从环境变量读，容器/编排系统注入secret
+// password_file：从文件读（k8s挂载的secret、运维下发的文件），文件权限不能让同组和其他用户读（0600/0400）
+// password_encrypted：AES-256-GCM加密后的base64，启动时用环境变量（默认SERVER_SECRET_KEY，可以用secret_key_env改）里的口令解密。
+//   配置文件可以进版本库，口令只在部署机上有。生成密文：`SERVER_SECRET_KEY=xxx ./test -encrypt-secret`，从标准输入读明文
+
+const DefaultSecretKeyEnv = "SERVER_SECRET_KEY"
+
+var ErrSecretKeyMissing = errors.New("secret key env is empty")
+
+// secretKey 口令过一遍sha256当AES-256的key，口令长短随意
+func secretKey(passphrase string) []byte {
+	k := sha256.Sum256([]byte(passphrase))
+	return k[:]
+}
+
+// EncryptSecret 密文格式：base64(12字节nonce + 密文 + tag)
+func EncryptSecret(plain string, passphrase string) (string, error) {
+	gcm, err := newGCM(passphrase)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plain), nil)), nil
+}
+
+func DecryptSecret(blob string, passphrase string) (string, error) {
+	gcm, err := newGCM(passphrase)
+	if err != nil {
+		return "", err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(blob))
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: %w", err)
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", fmt.Errorf("decrypt secret: blob too short")
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: wrong key or corrupted blob")
+	}
+	return string(plain), nil
+}
+
+func newGCM(passphrase string) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, ErrSecretKeyMissing
+	}
+	block, err := aes.NewCipher(secretKey(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SecretKeyEnv 解密用的口令放在哪个环境变量
+func (conf *MysqlConf) SecretKeyEnv() string {
+	if conf.SecretKeyEnvName != "" {
+		return conf.SecretKeyEnvName
+	}
+	return DefaultSecretKeyEnv
+}
+
+// passwordSources 配了哪几种密码来源
+func (conf *MysqlConf) passwordSources() []string {
+	var ret []string
+	if conf.Password != "" {
+		ret = append(ret, "password")
+	}
+	if conf.PasswordEnv != "" {
+		ret = append(ret, "password_env")
+	}
+	if conf.PasswordFile != "" {
+		ret = append(ret, "password_file")
+	}
+	if conf.PasswordEncrypted != "" {
+		ret = append(ret, "password_encrypted")
+	}
+	return ret
+}
+
+// ResolvePassword 按配置的来源取出真正的密码
+func (conf *MysqlConf) ResolvePassword() (string, error) {
+	sources := conf.passwordSources()
+	if len(sources) == 0 {
+		return "", fmt.Errorf("one of password/password_env/password_file/password_encrypted is required")
+	}
+	if len(sources) > 1 {
+		return "", fmt.Errorf("only one password source allowed, got %s", strings.Join(sources, ", "))
+	}
+	switch {
+	case conf.PasswordEnv != "":
+		v := os.Getenv(conf.PasswordEnv)
+		if v == "" {
+			return "", fmt.Errorf("password_env: env %s is empty", conf.PasswordEnv)
+		}
+		return v, nil
+	case conf.PasswordFile != "":
+		return readSecretFile(conf.PasswordFile)
+	case conf.PasswordEncrypted != "":
+		v, err := DecryptSecret(conf.PasswordEncrypted, os.Getenv(conf.SecretKeyEnv()))
+		if errors.Is(err, ErrSecretKeyMissing) {
+			return "", fmt.Errorf("password_encrypted: env %s is empty", conf.SecretKeyEnv())
+		}
+		if err != nil {
+			return "", fmt.Errorf("password_encrypted: %w", err)
+		}
+		return v, nil
+	}
+	return conf.Password, nil
+}
+
+// readSecretFile 文件末尾的换行去掉；权限太宽直接拒绝，不是警告
+func readSecretFile(path string) (string, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("password_file: %w", err)
+	}
+	if runtime.GOOS != "windows" && st.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("password_file %s: permission %v too open, want 0600 or 0400", path, st.Mode().Perm())
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("password_file: %w", err)
+	}
+	v := strings.TrimRight(string(b), "\r\n")
+	if v == "" {
+		return "", fmt.Errorf("password_file %s is empty", path)
+	}
+	return v, nil
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestResolvePassword(t *testing.T) {
+	conf := &MysqlConf{}
+	if _, err := conf.ResolvePassword(); err == nil {
+		t.Fatal("no source should fail")
+	}
+	conf = &MysqlConf{Password: "a", PasswordEnv: "X"}
+	if _, err := conf.ResolvePassword(); err == nil {
+		t.Fatal("two sources should fail")
+	}
+
+	t.Setenv("TEST_DB_PWD", "from-env")
+	if v, err := (&MysqlConf{PasswordEnv: "TEST_DB_PWD"}).ResolvePassword(); err != nil || v != "from-env" {
+		t.Fatalf("env %q %v", v, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "pwd")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := (&MysqlConf{PasswordFile: path}).ResolvePassword(); err != nil || v != "from-file" {
+		t.Fatalf("file %q %v", v, err)
+	}
+	if runtime.GOOS != "windows" {
+		os.Chmod(path, 0644)
+		if _, err := (&MysqlConf{PasswordFile: path}).ResolvePassword(); err == nil {
+			t.Fatal("world readable file should fail")
+		}
+	}
+
+	blob, err := EncryptSecret("from-blob", "startup-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf = &MysqlConf{PasswordEncrypted: blob, SecretKeyEnvName: "TEST_DB_KEY"}
+	if _, err = conf.ResolvePassword(); err == nil {
+		t.Fatal("missing key should fail")
+	}
+	t.Setenv("TEST_DB_KEY", "wrong")
+	if _, err = conf.ResolvePassword(); err == nil {
+		t.Fatal("wrong key should fail")
+	}
+	t.Setenv("TEST_DB_KEY", "startup-key")
+	if v, err := conf.ResolvePassword(); err != nil || v != "from-blob" {
+		t.Fatalf("blob %q %v", v, err)
+	}
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+const maxSlowRecords = 100
+
+// SlowQueryRecord 一条慢查询记录。select语句会附带EXPLAIN的结果，其他语句Explain为nil
+type SlowQueryRecord struct {
+	Stmt    string
+	Args    []any
+	Cost    time.Duration
+	At      time.Time
+	Explain []*DBData
+}
+
+// Span 一次mysql操作对应的trace区间，End时传入这次操作的错误（成功传nil）
+type Span interface {
+	End(err error)
+}
+
+// Tracer 外部trace系统的接入点。接OpenTelemetry的话在业务层包一层adapter实现这个接口再SetTracer就行，db包本身不依赖otel
+type Tracer interface {
+	StartSpan(name string, stmt string) Span
+}
+
+type nopSpan struct{}
+
+func (nopSpan) End(error) {}
+
+// SetTracer 开启trace，传nil关闭
+func (mysql *MysqlPool) SetTracer(t Tracer) {
+	mysql.m.Lock()
+	defer mysql.m.Unlock()
+	mysql.tracer = t
+}
+
+// SlowQueries 返回最近的慢查询记录（旧的在前）
+func (mysql *MysqlPool) SlowQueries() []*SlowQueryRecord {
+	mysql.m.Lock()
+	defer mysql.m.Unlock()
+	ret := make([]*SlowQueryRecord, len(mysql.slowQueries))
+	copy(ret, mysql.slowQueries)
+	return ret
+}
+
+// startSpan 调用方需持有mysql.m
+func (mysql *MysqlPool) startSpan(name string, stmt string) Span {
+	if mysql.tracer == nil {
+		return nopSpan{}
+	}
+	return mysql.tracer.StartSpan(name, stmt)
+}
+
+// checkSlow 调用方需持有mysql.m。q传原语句用的那个queryer，否则连接数只有1的时候拿不到连接会卡死
+func (mysql *MysqlPool) checkSlow(q queryer, stmt string, args []any, cost time.Duration, isSelect bool) {
+	if mysql.slowThreshold <= 0 || cost < mysql.slowThreshold {
+		return
+	}
+	record := &SlowQueryRecord{
+		Stmt: stmt,
+		Args: args,
+		Cost: cost,
+		At:   time.Now(),
+	}
+	if isSelect && strings.HasPrefix(strings.ToLower(strings.TrimSpace(stmt)), "select") {
+		rows, err := q.QueryContext(context.Background(), "EXPLAIN "+stmt, args...)
+		if err != nil {
+			log.Printf("slow query explain failed: %s", err.Error())
+		} else {
+			record.Explain, _ = scanRows(rows, nil, resultLimit{}, stmt)
+			rows.Close()
+		}
+	}
+	log.Printf("slow query (%v): stmt = %s, args = %v", cost, stmt, args)
+	for _, row := range record.Explain {
+		log.Printf("  explain: %s", formatRow(row))
+	}
+	mysql.slowQueries = append(mysql.slowQueries, record)
+	if len(mysql.slowQueries) > maxSlowRecords {
+		mysql.slowQueries = mysql.slowQueries[len(mysql.slowQueries)-maxSlowRecords:]
+	}
+}
+
+func formatRow(row *DBData) string {
+	var sb strings.Builder
+	for k, v := range row.Data {
+		if sb.Len() > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(k)
+		sb.WriteString("=")
+		sb.Write(v)
+	}
+	return sb.String()
+}
@@ -0,0 +1,391 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"test/metrics"
+	"time"
+)
+
+// 队列溢出落盘：库挂了（或者慢到排不过来）的时候查询队列很快就满，AddQuery只能返回ErrQueueFull，非关键的写入就丢了。
+// 配了spill_dir之后，队列积压超过spill_queue_len时，非PriorityHigh的写语句（insert/update/delete/replace）追加到spill.wal，AddQuery照常返回nil；
+// 一旦开始落盘，之后同类写入都先落盘，保证顺序。后台每秒看一次：熔断没打开、普通和低优先级队列都空了，就按顺序把文件里的语句补执行，全部补完截断文件。
+// 补写进度记在spill.offset里，进程重启后接着补。回调函数存不进文件，只有同一个进程里补写时才会调（在补写goroutine里），重启后补写的没有回调。
+// PriorityHigh（存档）从不落盘，队列满了还是返回ErrQueueFull，由DirtySet重试
+
+const (
+	spillFileName      = "spill.wal"
+	spillOffsetName    = "spill.offset"
+	spillReplayBatch   = 100
+	defaultSpillMaxMB  = 256
+	spillCheckInterval = time.Second
+)
+
+type spillRecord struct {
+	Seq      uint64        `json:"seq"`
+	Stmt     string        `json:"stmt"`
+	Args     []spillArg    `json:"args"`
+	Priority QueryPriority `json:"priority"`
+}
+
+// spillArg 落盘的参数带上类型，补写时还原成同样的Go类型。
+// 直接json的话[]byte会变成base64字符串、time.Time变成RFC3339字符串，补写时就把这段文本写进列里了
+type spillArg struct {
+	v any
+}
+
+type spillArgJson struct {
+	T string `json:"t"` // n nil, i 有符号整数, u 无符号整数, f 浮点, s 字符串, b []byte, t time.Time, z bool
+	V string `json:"v,omitempty"`
+}
+
+// newSpillArgs 有不认识类型的参数时返回false，这种查询不落盘
+func newSpillArgs(args []any) ([]spillArg, bool) {
+	ret := make([]spillArg, len(args))
+	for i, v := range args {
+		if _, ok := encodeSpillArg(v); !ok {
+			return nil, false
+		}
+		ret[i] = spillArg{v}
+	}
+	return ret, true
+}
+
+func encodeSpillArg(v any) (spillArgJson, bool) {
+	switch x := v.(type) {
+	case nil:
+		return spillArgJson{T: "n"}, true
+	case int:
+		return spillArgJson{T: "i", V: strconv.FormatInt(int64(x), 10)}, true
+	case int8:
+		return spillArgJson{T: "i", V: strconv.FormatInt(int64(x), 10)}, true
+	case int16:
+		return spillArgJson{T: "i", V: strconv.FormatInt(int64(x), 10)}, true
+	case int32:
+		return spillArgJson{T: "i", V: strconv.FormatInt(int64(x), 10)}, true
+	case int64:
+		return spillArgJson{T: "i", V: strconv.FormatInt(x, 10)}, true
+	case uint:
+		return spillArgJson{T: "u", V: strconv.FormatUint(uint64(x), 10)}, true
+	case uint8:
+		return spillArgJson{T: "u", V: strconv.FormatUint(uint64(x), 10)}, true
+	case uint16:
+		return spillArgJson{T: "u", V: strconv.FormatUint(uint64(x), 10)}, true
+	case uint32:
+		return spillArgJson{T: "u", V: strconv.FormatUint(uint64(x), 10)}, true
+	case uint64:
+		return spillArgJson{T: "u", V: strconv.FormatUint(x, 10)}, true
+	case float32:
+		return spillArgJson{T: "f", V: strconv.FormatFloat(float64(x), 'g', -1, 32)}, true
+	case float64:
+		return spillArgJson{T: "f", V: strconv.FormatFloat(x, 'g', -1, 64)}, true
+	case string:
+		return spillArgJson{T: "s", V: x}, true
+	case []byte:
+		if x == nil {
+			return spillArgJson{T: "n"}, true
+		}
+		return spillArgJson{T: "b", V: base64.StdEncoding.EncodeToString(x)}, true
+	case time.Time:
+		return spillArgJson{T: "t", V: x.Format(time.RFC3339Nano)}, true
+	case bool:
+		return spillArgJson{T: "z", V: strconv.FormatBool(x)}, true
+	}
+	return spillArgJson{}, false
+}
+
+func (a spillArg) MarshalJSON() ([]byte, error) {
+	j, ok := encodeSpillArg(a.v)
+	if !ok {
+		return nil, fmt.Errorf("spill arg type %T not supported", a.v)
+	}
+	return json.Marshal(j)
+}
+
+func (a *spillArg) UnmarshalJSON(b []byte) error {
+	var j spillArgJson
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	var err error
+	switch j.T {
+	case "n":
+		a.v = nil
+	case "i":
+		a.v, err = strconv.ParseInt(j.V, 10, 64)
+	case "u":
+		a.v, err = strconv.ParseUint(j.V, 10, 64)
+	case "f":
+		a.v, err = strconv.ParseFloat(j.V, 64)
+	case "s":
+		a.v = j.V
+	case "b":
+		a.v, err = base64.StdEncoding.DecodeString(j.V)
+	case "t":
+		a.v, err = time.Parse(time.RFC3339Nano, j.V)
+	case "z":
+		a.v, err = strconv.ParseBool(j.V)
+	default:
+		err = fmt.Errorf("unknown spill arg type %q", j.T)
+	}
+	return err
+}
+
+type spillWAL struct {
+	m        sync.Mutex
+	dir      string
+	maxBytes int64
+	f        *os.File // 追加写
+	size     int64
+	offset   int64 // 已经补写到的位置
+	nextSeq  uint64
+	pending  int
+	cbs      map[uint64]func([]*DBData, error)
+}
+
+// openSpill 打开（没有就建）落盘文件，上次没补完的从spill.offset接着来，末尾写了一半的行截掉
+func openSpill(dir string, maxBytes int64) (*spillWAL, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultSpillMaxMB << 20
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &spillWAL{dir: dir, maxBytes: maxBytes, cbs: make(map[uint64]func([]*DBData, error))}
+	path := filepath.Join(dir, spillFileName)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if i := bytes.LastIndexByte(data, '\n'); i+1 != len(data) {
+		log.Printf("mysql spill: drop %d bytes of torn tail in %s", len(data)-i-1, path)
+		data = data[:i+1]
+		if err = os.Truncate(path, int64(len(data))); err != nil {
+			return nil, err
+		}
+	}
+	w.size = int64(len(data))
+	if b, err := os.ReadFile(filepath.Join(dir, spillOffsetName)); err == nil {
+		w.offset, _ = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	}
+	if w.offset < 0 || w.offset > w.size {
+		w.offset = 0
+	}
+	w.pending = bytes.Count(data[w.offset:], []byte{'\n'})
+	if lines := bytes.Split(bytes.TrimSpace(data), []byte{'\n'}); len(lines) > 0 && len(lines[len(lines)-1]) > 0 {
+		var last spillRecord
+		if json.Unmarshal(lines[len(lines)-1], &last) == nil {
+			w.nextSeq = last.Seq
+		}
+	}
+	if w.f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return nil, err
+	}
+	if w.pending > 0 {
+		log.Printf("mysql spill: %d writes left from last run in %s", w.pending, path)
+	}
+	metrics.GetGauge("db.spill.pending").Set(int64(w.pending))
+	return w, nil
+}
+
+// spillable 只有普通/低优先级的单条写语句能落盘，读和分页、存储过程这种带exec的不行；
+// 参数里有spillArg还原不了的类型也不落盘，队列满了照样返回ErrQueueFull
+func spillable(q *SqlQuery) bool {
+	if q.exec != nil || q.Priority == PriorityHigh {
+		return false
+	}
+	if _, ok := newSpillArgs(q.Args); !ok {
+		return false
+	}
+	switch strings.ToLower(strings.SplitN(strings.TrimSpace(q.Stmt), " ", 2)[0]) {
+	case "insert", "update", "delete", "replace":
+		return true
+	}
+	return false
+}
+
+// active 文件里还有没补写的，这时同类写入也要落盘，不然会插到前面去
+func (w *spillWAL) active() bool {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.pending > 0
+}
+
+func (w *spillWAL) append(q *SqlQuery) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	args, ok := newSpillArgs(q.Args)
+	if !ok {
+		return fmt.Errorf("spill args of %q not supported", q.Stmt)
+	}
+	w.nextSeq++
+	b, err := json.Marshal(&spillRecord{Seq: w.nextSeq, Stmt: q.Stmt, Args: args, Priority: q.Priority})
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if w.size+int64(len(b)) > w.maxBytes {
+		metrics.GetCounter("db.spill.full").Inc()
+		return ErrSpillFull
+	}
+	if _, err = w.f.Write(b); err != nil {
+		return err
+	}
+	if w.pending == 0 {
+		log.Printf("mysql spill: query queue backed up, spilling writes to %s", w.f.Name())
+	}
+	w.size += int64(len(b))
+	w.pending++
+	if q.CbFunc != nil {
+		w.cbs[w.nextSeq] = q.CbFunc
+	}
+	metrics.GetCounter("db.spill.written").Inc()
+	metrics.GetGauge("db.spill.pending").Set(int64(w.pending))
+	return nil
+}
+
+// replay 从offset开始最多补写batch条，exec返回断线/熔断类错误时停下，下次从这一条重来；
+// 其他错误（语句本身有问题）回调带上错误、跳过。全部补完时截断文件
+func (w *spillWAL) replay(exec func(stmt string, args []any) error, batch int) (int, error) {
+	w.m.Lock()
+	start, end := w.offset, w.size
+	w.m.Unlock()
+	if start >= end {
+		return 0, nil
+	}
+	f, err := os.Open(filepath.Join(w.dir, spillFileName))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(io.NewSectionReader(f, start, end-start))
+	pos, n := start, 0
+	var stopErr error
+	for n < batch {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			break // 读到end为止，end之后追加的下一轮再补
+		}
+		var rec spillRecord
+		if err = json.Unmarshal(line, &rec); err != nil {
+			log.Printf("mysql spill: skip bad record at %d: %s", pos, err.Error())
+			pos += int64(len(line))
+			w.done(0, pos)
+			continue
+		}
+		args := make([]any, len(rec.Args))
+		for i, a := range rec.Args {
+			args[i] = a.v
+		}
+		err = exec(rec.Stmt, args)
+		if isBreakerFailure(err) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrNotInited) || errors.Is(err, ErrReadOnly) {
+			stopErr = err
+			break
+		}
+		if err != nil {
+			log.Printf("mysql spill: replay seq %d failed, skipped: %s, stmt = %s", rec.Seq, err.Error(), rec.Stmt)
+			metrics.GetCounter("db.spill.failed").Inc()
+		}
+		pos += int64(len(line))
+		n++
+		if cb := w.done(rec.Seq, pos); cb != nil {
+			cb(nil, err)
+		}
+		metrics.GetCounter("db.spill.replayed").Inc()
+	}
+	if err := w.commit(); err != nil {
+		return n, err
+	}
+	return n, stopErr
+}
+
+// done 记一条补写完成，返回它的回调
+func (w *spillWAL) done(seq uint64, pos int64) func([]*DBData, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	w.offset = pos
+	w.pending--
+	metrics.GetGauge("db.spill.pending").Set(int64(w.pending))
+	cb := w.cbs[seq]
+	delete(w.cbs, seq)
+	return cb
+}
+
+// commit 补完了就截断，没补完就把进度写下来
+func (w *spillWAL) commit() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	offsetPath := filepath.Join(w.dir, spillOffsetName)
+	if w.offset < w.size {
+		return os.WriteFile(offsetPath, []byte(strconv.FormatInt(w.offset, 10)), 0644)
+	}
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+	w.size, w.offset, w.pending = 0, 0, 0
+	log.Printf("mysql spill: all spilled writes replayed")
+	if err := os.Remove(offsetPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (w *spillWAL) Pending() int {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.pending
+}
+
+func (w *spillWAL) close() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.f.Close()
+}
+
+// spillLoop 库恢复、队列空下来之后按顺序补写，ReleaseMysqlPool后退出
+func (mysql *MysqlPool) spillLoop(w *spillWAL) {
+	for mysql.Inited {
+		time.Sleep(spillCheckInterval)
+		for mysql.Inited && w.active() && mysql.BreakerState() != BreakerOpen && !mysql.ReadOnly() &&
+			len(mysql.queueOf(PriorityNormal)) == 0 && len(mysql.queueOf(PriorityLow)) == 0 {
+			n, err := w.replay(func(stmt string, args []any) error { return mysql.Exec(stmt, args...) }, spillReplayBatch)
+			if err != nil {
+				log.Printf("mysql spill: replay paused after %d writes: %s", n, err.Error())
+				break
+			}
+		}
+	}
+}
+
+// SpillPending 落盘还没补写的写入条数，没开落盘时是0
+func (mysql *MysqlPool) SpillPending() int {
+	if mysql.spill == nil {
+		return 0
+	}
+	return mysql.spill.Pending()
+}
+
+// trySpill 队列已经积压（full为true表示刚才塞队列没塞进去）或者已经在落盘时，把能落盘的写入落盘，返回是否处理了
+func (mysql *MysqlPool) trySpill(q *SqlQuery, full bool) (bool, error) {
+	if mysql.spill == nil || !spillable(q) {
+		return false, nil
+	}
+	if !full && !mysql.spill.active() && len(mysql.queueOf(q.Priority)) < mysql.spillQueueLen {
+		return false, nil
+	}
+	if err := mysql.spill.append(q); err != nil {
+		return true, fmt.Errorf("%w: %s", ErrQueueFull, err.Error())
+	}
+	return true, nil
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpill(t *testing.T) {
+	dir := t.TempDir()
+	w, err := openSpill(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spillable(&SqlQuery{Stmt: "select * from t"}) || spillable(&SqlQuery{Stmt: "update t set a = ?", Priority: PriorityHigh}) {
+		t.Fatal("reads and high priority writes must not spill")
+	}
+	var called []error
+	for i := 1; i <= 5; i++ {
+		q := &SqlQuery{Stmt: "insert into t (id) values (?)", Args: []any{int64(9007199254740993) + int64(i)}, Priority: PriorityLow}
+		if i == 1 {
+			q.CbFunc = func(_ []*DBData, err error) { called = append(called, err) }
+		}
+		if !spillable(q) {
+			t.Fatal("insert should be spillable")
+		}
+		if err = w.append(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !w.active() || w.Pending() != 5 {
+		t.Fatalf("pending = %d", w.Pending())
+	}
+
+	// 前两条成功，第三条断线：停在第三条
+	var got []string
+	down := false
+	exec := func(stmt string, args []any) error {
+		if down {
+			return fmt.Errorf("%w: boom", ErrConnLost)
+		}
+		got = append(got, fmt.Sprint(args[0]))
+		if len(got) == 2 {
+			down = true
+		}
+		return nil
+	}
+	n, err := w.replay(exec, 100)
+	if n != 2 || !errors.Is(err, ErrConnLost) {
+		t.Fatalf("replay = %d, %v", n, err)
+	}
+	if len(called) != 1 || called[0] != nil {
+		t.Fatalf("callback = %v", called)
+	}
+	if got[0] != "9007199254740994" {
+		t.Fatalf("big id lost precision: %s", got[0])
+	}
+	w.close()
+
+	// 重启：从offset接着补，末尾写了一半的行被截掉
+	f, _ := os.OpenFile(filepath.Join(dir, spillFileName), os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"seq":6,"stmt":"insert`)
+	f.Close()
+	w, err = openSpill(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Pending() != 3 {
+		t.Fatalf("pending after reopen = %d", w.Pending())
+	}
+	if err = w.append(&SqlQuery{Stmt: "delete from t where id = ?", Args: []any{1}}); err != nil {
+		t.Fatal(err)
+	}
+	down = false
+	if n, err = w.replay(exec, 100); n != 4 || err != nil {
+		t.Fatalf("replay after reopen = %d, %v", n, err)
+	}
+	if len(got) != 6 || got[5] != "1" || w.active() {
+		t.Fatalf("got %v, active %v", got, w.active())
+	}
+	if st, _ := os.Stat(filepath.Join(dir, spillFileName)); st.Size() != 0 {
+		t.Fatalf("wal not truncated: %d", st.Size())
+	}
+	if _, err = os.Stat(filepath.Join(dir, spillOffsetName)); !os.IsNotExist(err) {
+		t.Fatalf("offset file left: %v", err)
+	}
+	// 截断之后seq接着涨，回调不会串
+	if err = w.append(&SqlQuery{Stmt: "update t set a = ?", Args: []any{2}}); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, spillFileName))
+	var rec spillRecord
+	if err = json.Unmarshal(b, &rec); err != nil || rec.Seq != 7 {
+		t.Fatalf("seq after truncate = %d, %v", rec.Seq, err)
+	}
+	w.close()
+
+	small, err := openSpill(t.TempDir(), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer small.close()
+	if err = small.append(&SqlQuery{Stmt: "insert into t (a, b, c, d) values (?, ?, ?, ?)", Args: []any{1, 2, 3, 4}}); !errors.Is(err, ErrSpillFull) {
+		t.Fatalf("expected ErrSpillFull, got %v", err)
+	}
+}
+
+func TestSpillArgTypes(t *testing.T) {
+	w, err := openSpill(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+	payload := []byte{0x00, 0xFF, '"', '\n', 0x80}
+	at := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.FixedZone("CST", 8*3600))
+	args := []any{payload, at, int64(-3), uint64(1) << 63, 1.5, "text", nil, true}
+	q := &SqlQuery{Stmt: "insert into t values (?, ?, ?, ?, ?, ?, ?, ?)", Args: args, Priority: PriorityNormal}
+	if !spillable(q) {
+		t.Fatal("scalar args should be spillable")
+	}
+	if spillable(&SqlQuery{Stmt: "insert into t (a) values (?)", Args: []any{struct{}{}}}) {
+		t.Fatal("unknown arg type spilled")
+	}
+	if err = w.append(q); err != nil {
+		t.Fatal(err)
+	}
+	var got []any
+	if _, err = w.replay(func(_ string, a []any) error { got = a; return nil }, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(args) {
+		t.Fatalf("args %v", got)
+	}
+	if b, ok := got[0].([]byte); !ok || !bytes.Equal(b, payload) {
+		t.Fatalf("bytes arg = %T %v", got[0], got[0])
+	}
+	if ts, ok := got[1].(time.Time); !ok || !ts.Equal(at) {
+		t.Fatalf("time arg = %T %v", got[1], got[1])
+	}
+	want := []any{int64(-3), uint64(1) << 63, 1.5, "text", nil, true}
+	for i, v := range want {
+		if got[i+2] != v {
+			t.Fatalf("arg %d = %T %v, want %T %v", i+2, got[i+2], got[i+2], v, v)
+		}
+	}
+}
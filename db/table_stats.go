@@ -0,0 +1,156 @@
+package db
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"test/metrics"
+	"time"
+)
+
+// 按表统计访问量：每条语句执行完按表名累加次数、耗时、读出/写入的字节数，分库分表前先看看哪几张表是热点。
+// 表名从语句里解析（和表级钩子一样，不带table_prefix，写语句只算目标表，select涉及的每张表都算一次、字节数只算在第一张表上）；
+// CALL存储过程记在"proc:过程名"下，解析不出表的记在"(unknown)"下。解析不准的语句（拼出来的动态表名之类）用RecordTableAccess自己记
+
+const unknownTable = "(unknown)"
+
+// TableStat 一张表的累计访问量，Bytes按值的文本/二进制长度估算，数字算8字节
+type TableStat struct {
+	Table        string        `json:"table"`
+	Queries      int64         `json:"queries"`
+	Execs        int64         `json:"execs"`
+	Errors       int64         `json:"errors"`
+	RowsRead     int64         `json:"rows_read"`
+	BytesRead    int64         `json:"bytes_read"`
+	BytesWritten int64         `json:"bytes_written"`
+	Time         time.Duration `json:"time"`
+}
+
+type tableStats struct {
+	m    sync.Mutex
+	list map[string]*TableStat
+}
+
+var procNameReg = regexp.MustCompile("(?i)^\\s*call\\s+`?(\\w+)`?")
+
+func (s *tableStats) get(table string) *TableStat {
+	if s.list == nil {
+		s.list = make(map[string]*TableStat)
+	}
+	st, ok := s.list[table]
+	if !ok {
+		st = &TableStat{Table: table}
+		s.list[table] = st
+	}
+	return st
+}
+
+// record stmt是加前缀之前的原语句。rows只有select才有
+func (s *tableStats) record(stmt string, args []any, rows []*DBData, cost time.Duration, err error) {
+	op, tables := stmtTables(stmt)
+	if op == "call" {
+		if m := procNameReg.FindStringSubmatch(stmt); m != nil {
+			tables = []string{"proc:" + strings.ToLower(m[1])}
+		}
+	}
+	if len(tables) == 0 {
+		tables = []string{unknownTable}
+	}
+	var read, written, n int64
+	if op == "select" {
+		n = int64(len(rows))
+		for _, r := range rows {
+			for _, v := range r.Data {
+				read += int64(len(v))
+			}
+		}
+	} else {
+		written = argsBytes(args)
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for i, t := range tables {
+		st := s.get(t)
+		if op == "select" {
+			st.Queries++
+		} else {
+			st.Execs++
+		}
+		if err != nil && !errors.Is(err, ErrNoRows) {
+			st.Errors++
+		}
+		st.Time += cost
+		if i == 0 {
+			st.RowsRead += n
+			st.BytesRead += read
+			st.BytesWritten += written
+			metrics.GetCounter("db.table." + t + ".bytes_read").Add(read)
+			metrics.GetCounter("db.table." + t + ".bytes_written").Add(written)
+		}
+		metrics.GetCounter("db.table." + t + "." + op).Inc()
+	}
+}
+
+func argsBytes(args []any) int64 {
+	var n int64
+	for _, a := range args {
+		switch v := a.(type) {
+		case nil:
+		case string:
+			n += int64(len(v))
+		case []byte:
+			n += int64(len(v))
+		default:
+			n += 8
+		}
+	}
+	return n
+}
+
+// RecordTableAccess 解析不出表名的语句由调用方自己记一次，op是select/insert/update/delete/replace
+func (mysql *MysqlPool) RecordTableAccess(table string, op string, rows int, bytes int64, cost time.Duration) {
+	table = strings.ToLower(table)
+	op = strings.ToLower(op)
+	mysql.tableStats.m.Lock()
+	defer mysql.tableStats.m.Unlock()
+	st := mysql.tableStats.get(table)
+	if op == "select" {
+		st.Queries++
+		st.RowsRead += int64(rows)
+		st.BytesRead += bytes
+		metrics.GetCounter("db.table." + table + ".bytes_read").Add(bytes)
+	} else {
+		st.Execs++
+		st.BytesWritten += bytes
+		metrics.GetCounter("db.table." + table + ".bytes_written").Add(bytes)
+	}
+	st.Time += cost
+	metrics.GetCounter("db.table." + table + "." + op).Inc()
+}
+
+// Stats 每张表的累计访问量（拷贝），按读写次数从多到少
+func (mysql *MysqlPool) Stats() []TableStat {
+	mysql.tableStats.m.Lock()
+	ret := make([]TableStat, 0, len(mysql.tableStats.list))
+	for _, st := range mysql.tableStats.list {
+		ret = append(ret, *st)
+	}
+	mysql.tableStats.m.Unlock()
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i].Queries+ret[i].Execs, ret[j].Queries+ret[j].Execs
+		if a != b {
+			return a > b
+		}
+		return ret[i].Table < ret[j].Table
+	})
+	return ret
+}
+
+// ResetStats 清零，压测前后对比用
+func (mysql *MysqlPool) ResetStats() {
+	mysql.tableStats.m.Lock()
+	defer mysql.tableStats.m.Unlock()
+	mysql.tableStats.list = nil
+}
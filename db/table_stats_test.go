@@ -0,0 +1,44 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTableStats(t *testing.T) {
+	mysql := NewMysqlPool()
+	s := &mysql.tableStats
+	rows := []*DBData{{Data: map[string][]byte{"id": []byte("1"), "name": []byte("abc")}}, {Data: map[string][]byte{"id": []byte("2"), "name": []byte("de")}}}
+	s.record("select * from player where id > ?", []any{0}, rows, time.Millisecond, nil)
+	s.record("SELECT p.id FROM player p JOIN guild g ON p.gid = g.id", nil, nil, time.Millisecond, ErrNoRows)
+	s.record("insert into player (id, name) values (?, ?)", []any{int64(3), "xyz"}, nil, time.Millisecond, nil)
+	s.record("insert into mail (pid) select id from player", nil, nil, time.Millisecond, errors.New("boom"))
+	s.record("CALL settle_season(?, @o1)", []any{1}, nil, time.Millisecond, nil)
+	mysql.RecordTableAccess("Shard_7", "update", 0, 100, time.Millisecond)
+
+	got := map[string]TableStat{}
+	for _, st := range mysql.Stats() {
+		got[st.Table] = st
+	}
+	p := got["player"]
+	if p.Queries != 2 || p.Execs != 1 || p.RowsRead != 2 || p.BytesRead != 7 || p.BytesWritten != 11 || p.Errors != 0 || p.Time != 3*time.Millisecond {
+		t.Fatalf("player = %+v", p)
+	}
+	if g := got["guild"]; g.Queries != 1 || g.BytesRead != 0 {
+		t.Fatalf("guild = %+v", g)
+	}
+	if m := got["mail"]; m.Execs != 1 || m.Errors != 1 {
+		t.Fatalf("mail = %+v", m)
+	}
+	if got["proc:settle_season"].Execs != 1 || got["shard_7"].BytesWritten != 100 {
+		t.Fatalf("stats = %+v", got)
+	}
+	if list := mysql.Stats(); list[0].Table != "player" {
+		t.Fatalf("not sorted by ops: %+v", list)
+	}
+	mysql.ResetStats()
+	if len(mysql.Stats()) != 0 {
+		t.Fatal("reset failed")
+	}
+}
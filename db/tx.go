@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tx 事务。只能在RunTx/AddTx的回调里用，回调返回nil提交，返回error或者panic回滚。
+// 复杂的多步操作（两个玩家交易）可以用Savepoint/RollbackTo只撤销其中一段，不用整个事务作废
+type Tx struct {
+	mysql      *MysqlPool
+	tx         execer
+	savepoints []savepoint
+	writes     []TableEvent // 成功执行的写语句，提交后触发写钩子
+}
+
+// savepoint writes是建savepoint时已经记下的写语句数，RollbackTo时把之后的截掉，撤销的写入不触发钩子
+type savepoint struct {
+	name   string
+	writes int
+}
+
+func (tx *Tx) Query(sql string, args ...any) ([]*DBData, error) {
+	return tx.mysql.query(tx.tx, sql, args...)
+}
+
+func (tx *Tx) Exec(sql string, args ...any) error {
+	if err := tx.mysql.exec(tx.tx, sql, args...); err != nil {
+		return err
+	}
+	tx.writes = append(tx.writes, TableEvent{Stmt: sql, Args: args})
+	return nil
+}
+
+// Savepoint 同名的savepoint会覆盖之前的（mysql的行为）
+func (tx *Tx) Savepoint(name string) error {
+	if err := checkIdent(name); err != nil {
+		return err
+	}
+	// savepoint语句本身不是写入，不走tx.Exec
+	if err := tx.mysql.exec(tx.tx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	tx.forget(name)
+	tx.savepoints = append(tx.savepoints, savepoint{name: name, writes: len(tx.writes)})
+	return nil
+}
+
+// RollbackTo 撤销name之后的所有改动，name本身还在，可以再次RollbackTo；name之后建的savepoint失效
+func (tx *Tx) RollbackTo(name string) error {
+	i := tx.indexOf(name)
+	if i < 0 {
+		return fmt.Errorf("Tx::RollbackTo error: savepoint %s not found", name)
+	}
+	if err := tx.mysql.exec(tx.tx, "ROLLBACK TO SAVEPOINT "+name); err != nil {
+		return err
+	}
+	tx.savepoints = tx.savepoints[:i+1]
+	tx.writes = tx.writes[:tx.savepoints[i].writes]
+	return nil
+}
+
+// Release 删除name以及它之后建的savepoint，改动保留
+func (tx *Tx) Release(name string) error {
+	i := tx.indexOf(name)
+	if i < 0 {
+		return fmt.Errorf("Tx::Release error: savepoint %s not found", name)
+	}
+	if err := tx.mysql.exec(tx.tx, "RELEASE SAVEPOINT "+name); err != nil {
+		return err
+	}
+	tx.savepoints = tx.savepoints[:i]
+	return nil
+}
+
+func (tx *Tx) indexOf(name string) int {
+	for i, sp := range tx.savepoints {
+		if sp.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (tx *Tx) forget(name string) {
+	if i := tx.indexOf(name); i >= 0 {
+		tx.savepoints = append(tx.savepoints[:i], tx.savepoints[i+1:]...)
+	}
+}
+
+// RunTx 同步执行一个事务，期间独占连接池
+func (mysql *MysqlPool) RunTx(f func(tx *Tx) error) (err error) {
+	if !mysql.Inited {
+		return ErrNotInited
+	}
+	mysql.m.Lock()
+	defer mysql.m.Unlock()
+	if err = mysql.breaker.allow(); err != nil {
+		return err
+	}
+	sqlTx, err := mysql.Db.BeginTx(context.Background(), nil)
+	mysql.breaker.report(err)
+	if err != nil {
+		return wrapErr(err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			sqlTx.Rollback()
+		}
+	}()
+	tx := &Tx{mysql: mysql, tx: sqlTx}
+	if err = f(tx); err != nil {
+		return err
+	}
+	if err = sqlTx.Commit(); err != nil {
+		return wrapErr(err)
+	}
+	committed = true
+	for _, w := range tx.writes {
+		fireWriteHooks(w.Stmt, w.Args)
+	}
+	return nil
+}
+
+// AddTx RunTx的异步版本，在Loop里执行完后回调cb（cb在db goroutine里）
+func (mysql *MysqlPool) AddTx(f func(tx *Tx) error, cb func(error)) error {
+	return mysql.AddQuery(&SqlQuery{
+		Stmt: "tx",
+		exec: func(mysql *MysqlPool) {
+			cb(mysql.RunTx(f))
+		},
+	})
+}
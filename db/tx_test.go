@@ -0,0 +1,54 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestTxRollbackToSkipsHooks(t *testing.T) {
+	conn, err := sql.Open("db_test_rows", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mysql := NewMysqlPool()
+	mysql.Db, mysql.Inited = conn, true
+	var fired []string
+	id := OnTableWrite("tx_hook_t", func(ev TableEvent) { fired = append(fired, ev.Args[0].(string)) })
+	defer RemoveTableHook(id)
+
+	err = mysql.RunTx(func(tx *Tx) error {
+		tx.Exec("insert into tx_hook_t (a) values (?)", "keep")
+		if err := tx.Savepoint("sp1"); err != nil {
+			return err
+		}
+		tx.Exec("insert into tx_hook_t (a) values (?)", "undone")
+		tx.Savepoint("sp2")
+		tx.Exec("insert into tx_hook_t (a) values (?)", "undone too")
+		if err := tx.RollbackTo("sp1"); err != nil {
+			return err
+		}
+		// sp1还在，sp2失效
+		if err := tx.RollbackTo("sp2"); err == nil {
+			t.Error("savepoint after sp1 still valid")
+		}
+		tx.Exec("insert into tx_hook_t (a) values (?)", "after rollback")
+		tx.Savepoint("sp3")
+		tx.Exec("insert into tx_hook_t (a) values (?)", "released")
+		if err := tx.Release("sp3"); err != nil {
+			return err
+		}
+		for _, w := range tx.writes {
+			if strings.Contains(w.Stmt, "SAVEPOINT") {
+				t.Errorf("savepoint statement recorded as write: %s", w.Stmt)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fired, ","); got != "keep,after rollback,released" {
+		t.Fatalf("hooks fired for %s", got)
+	}
+}
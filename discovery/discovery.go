@@ -0,0 +1,313 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"test/db"
+	"test/metrics"
+	"test/wg"
+	"time"
+)
+
+// 服务发现：每个进程把自己（角色、地址、负载）写进server_node表并定时心跳，同时定时把整张表读回来，
+// 心跳超过ttl没更新的当作已下线。别的进程用Nodes/Pick找对端（比如网关进程找逻辑进程的link地址），或者Watch订阅上下线。
+// 没上etcd/consul，mysql反正每个进程都连着，几十个节点每几秒一次心跳没有压力
+//
+// 建表语句：
+// CREATE TABLE server_node (
+//   node_id VARCHAR(128) NOT NULL PRIMARY KEY,
+//   role VARCHAR(16) NOT NULL,
+//   addr VARCHAR(128) NOT NULL,
+//   load_value BIGINT NOT NULL DEFAULT 0,
+//   start_time BIGINT NOT NULL,
+//   update_time BIGINT NOT NULL
+// );
+
+var ErrNoNode = errors.New("no alive node")
+
+type DiscoveryConf struct {
+	NodeId        string `xml:"node_id" json:"node_id"`               // 不填用 主机名:角色:端口
+	AdvertiseHost string `xml:"advertise_host" json:"advertise_host"` // 别的进程连本进程用的host，不填用主机名
+	HeartbeatSec  int    `xml:"heartbeat_sec" json:"heartbeat_sec"`   // 心跳+刷新间隔，不填5秒
+	TtlSec        int    `xml:"ttl_sec" json:"ttl_sec"`               // 多久没心跳算下线，不填3倍心跳间隔
+}
+
+// Validate 检查配置，把所有问题一起返回
+func (conf *DiscoveryConf) Validate() (errs []error) {
+	if conf.HeartbeatSec < 0 {
+		errs = append(errs, fmt.Errorf("heartbeat_sec %d must not be negative", conf.HeartbeatSec))
+	}
+	if conf.TtlSec < 0 {
+		errs = append(errs, fmt.Errorf("ttl_sec %d must not be negative", conf.TtlSec))
+	}
+	if conf.TtlSec > 0 && conf.TtlSec <= conf.heartbeat() {
+		errs = append(errs, fmt.Errorf("ttl_sec %d must be greater than heartbeat_sec %d", conf.TtlSec, conf.heartbeat()))
+	}
+	return
+}
+
+func (conf *DiscoveryConf) heartbeat() int {
+	if conf.HeartbeatSec == 0 {
+		return 5
+	}
+	return conf.HeartbeatSec
+}
+
+func (conf *DiscoveryConf) ttl() int {
+	if conf.TtlSec == 0 {
+		return 3 * conf.heartbeat()
+	}
+	return conf.TtlSec
+}
+
+type Node struct {
+	Id         string `json:"id"`
+	Role       string `json:"role"`
+	Addr       string `json:"addr"`
+	Load       int64  `json:"load"` // 越小越闲，含义由角色自己定（网关是连接数）
+	StartTime  int64  `json:"start_time"`
+	UpdateTime int64  `json:"update_time"`
+}
+
+// Event Watch的回调参数，Up为false表示下线（心跳超时或者主动注销）
+type Event struct {
+	Node *Node
+	Up   bool
+}
+
+type watcher struct {
+	id   int
+	role string
+	f    func(Event)
+}
+
+type Registry struct {
+	pool   db.Pool
+	conf   *DiscoveryConf
+	self   *Node
+	load   func() int64
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	m        sync.RWMutex
+	nodes    map[string]*Node
+	watchers []watcher
+	nextId   int
+}
+
+func NewRegistry(pool db.Pool) *Registry {
+	return &Registry{
+		pool:  pool,
+		nodes: make(map[string]*Node),
+	}
+}
+
+var inst = NewRegistry(db.GetDbPool())
+
+func GetInst() *Registry {
+	return inst
+}
+
+// AdvertiseAddr 把监听地址（":9001"这种）换成别的进程能连的地址
+func AdvertiseAddr(conf *DiscoveryConf, listenAddr string) (string, error) {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return "", err
+	}
+	if conf.AdvertiseHost != "" {
+		host = conf.AdvertiseHost
+	} else if host == "" || host == "0.0.0.0" || host == "::" {
+		if host, err = os.Hostname(); err != nil {
+			return "", err
+		}
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// Start 注册本进程并开始心跳，role/addr是本进程对外的角色和地址，load每次心跳时调一次（会在discovery的goroutine里调，要并发安全），可以传nil。
+// 第一轮心跳和刷新同步做完才返回，返回之后Nodes就能查到其他节点
+func (r *Registry) Start(conf *DiscoveryConf, role string, addr string, load func() int64) error {
+	r.conf = conf
+	id := conf.NodeId
+	if id == "" {
+		host, _ := os.Hostname()
+		_, port, _ := net.SplitHostPort(addr)
+		id = fmt.Sprintf("%s:%s:%s", host, role, port)
+	}
+	now := time.Now().Unix()
+	r.self = &Node{Id: id, Role: role, Addr: addr, StartTime: now, UpdateTime: now}
+	r.load = load
+	if err := r.heartbeat(time.Now()); err != nil {
+		return err
+	}
+	if err := r.refresh(time.Now()); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(wg.ShutdownCtx())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go r.loop(ctx)
+	log.Printf("discovery: registered %s as %s at %s", id, role, addr)
+	return nil
+}
+
+func (r *Registry) loop(ctx context.Context) {
+	defer close(r.done)
+	interval := time.Duration(r.conf.heartbeat()) * time.Second
+	for wg.SleepCtx(ctx, interval) == nil {
+		now := time.Now()
+		if err := r.heartbeat(now); err != nil {
+			metrics.GetCounter("discovery.heartbeat.failed").Inc()
+			log.Printf("discovery heartbeat failed: %s", err.Error())
+		}
+		if err := r.refresh(now); err != nil {
+			log.Printf("discovery refresh failed: %s", err.Error())
+		}
+	}
+}
+
+// Stop 停止心跳并删掉自己的记录，别的进程下一次刷新就能看到下线，不用等ttl
+func (r *Registry) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+	if err := r.pool.Exec("delete from server_node where node_id = ?;", r.self.Id); err != nil {
+		log.Printf("discovery deregister %s failed: %s", r.self.Id, err.Error())
+	}
+}
+
+// Self 本进程的节点信息，没Start返回nil
+func (r *Registry) Self() *Node {
+	return r.self
+}
+
+func (r *Registry) heartbeat(now time.Time) error {
+	if r.load != nil {
+		r.self.Load = r.load()
+	}
+	r.self.UpdateTime = now.Unix()
+	return r.pool.Exec("replace into server_node (node_id, role, addr, load_value, start_time, update_time) values (?, ?, ?, ?, ?, ?);",
+		r.self.Id, r.self.Role, r.self.Addr, r.self.Load, r.self.StartTime, r.self.UpdateTime)
+}
+
+// refresh 读整张表，和上一次的结果比较，给Watch的回调发上下线
+func (r *Registry) refresh(now time.Time) error {
+	rows, err := r.pool.Query("select * from server_node;")
+	if err != nil && !errors.Is(err, db.ErrNoRows) {
+		return err
+	}
+	deadline := now.Unix() - int64(r.conf.ttl())
+	alive := make(map[string]*Node, len(rows))
+	for _, row := range rows {
+		n := &Node{
+			Id:         row.String("node_id"),
+			Role:       row.String("role"),
+			Addr:       row.String("addr"),
+			Load:       row.Int64("load_value"),
+			StartTime:  row.Int64("start_time"),
+			UpdateTime: row.Int64("update_time"),
+		}
+		if n.UpdateTime < deadline {
+			continue
+		}
+		if old, ok := alive[n.Id]; ok && old.UpdateTime >= n.UpdateTime {
+			continue
+		}
+		alive[n.Id] = n
+	}
+	r.m.Lock()
+	var events []Event
+	for id, n := range alive {
+		// 同一个id换了地址或者重启过，当作先下后上
+		if old, ok := r.nodes[id]; !ok || old.Addr != n.Addr || old.StartTime != n.StartTime {
+			if ok {
+				events = append(events, Event{Node: old, Up: false})
+			}
+			events = append(events, Event{Node: n, Up: true})
+		}
+	}
+	for id, old := range r.nodes {
+		if _, ok := alive[id]; !ok {
+			events = append(events, Event{Node: old, Up: false})
+		}
+	}
+	r.nodes = alive
+	watchers := append([]watcher(nil), r.watchers...)
+	r.m.Unlock()
+	metrics.GetGauge("discovery.nodes").Set(int64(len(alive)))
+	for _, e := range events {
+		log.Printf("discovery: node %s (%s %s) up=%v", e.Node.Id, e.Node.Role, e.Node.Addr, e.Up)
+		for _, w := range watchers {
+			if w.role == "" || w.role == e.Node.Role {
+				w.f(e)
+			}
+		}
+	}
+	return nil
+}
+
+// Watch 订阅某个角色（空串是所有角色）的节点上下线，先把当前已知的节点都当作上线回调一遍。
+// f在discovery的goroutine里执行，要动主循环的数据请自己丢回主循环。返回取消订阅的函数
+func (r *Registry) Watch(role string, f func(Event)) func() {
+	r.m.Lock()
+	r.nextId++
+	id := r.nextId
+	r.watchers = append(r.watchers, watcher{id: id, role: role, f: f})
+	var known []*Node
+	for _, n := range r.nodes {
+		if role == "" || n.Role == role {
+			known = append(known, n)
+		}
+	}
+	r.m.Unlock()
+	sort.Slice(known, func(i, j int) bool { return known[i].Id < known[j].Id })
+	for _, n := range known {
+		f(Event{Node: n, Up: true})
+	}
+	return func() {
+		r.m.Lock()
+		defer r.m.Unlock()
+		for i, w := range r.watchers {
+			if w.id == id {
+				r.watchers = append(r.watchers[:i], r.watchers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Nodes 某个角色当前活着的节点（空串是所有），按id排序，包括自己
+func (r *Registry) Nodes(role string) []*Node {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	var ret []*Node
+	for _, n := range r.nodes {
+		if role == "" || n.Role == role {
+			ret = append(ret, n)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Id < ret[j].Id })
+	return ret
+}
+
+// Pick 某个角色里负载最低的节点，一样低的取id最小的
+func (r *Registry) Pick(role string) (*Node, error) {
+	var best *Node
+	for _, n := range r.Nodes(role) {
+		if best == nil || n.Load < best.Load {
+			best = n
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w for role %s", ErrNoNode, role)
+	}
+	return best, nil
+}
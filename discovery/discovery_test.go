@@ -0,0 +1,74 @@
+package discovery
+
+import (
+	"test/db"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	pool := db.NewFakePool()
+	conf := &DiscoveryConf{HeartbeatSec: 1, TtlSec: 3}
+	game := NewRegistry(pool)
+	if err := game.Start(conf, "game", "10.0.0.1:9011", func() int64 { return 5 }); err != nil {
+		t.Fatal(err)
+	}
+	defer game.Stop()
+	game2 := NewRegistry(pool)
+	if err := game2.Start(&DiscoveryConf{NodeId: "game-2", HeartbeatSec: 1, TtlSec: 3}, "game", "10.0.0.2:9011", func() int64 { return 2 }); err != nil {
+		t.Fatal(err)
+	}
+	gw := NewRegistry(pool)
+	if err := gw.Start(conf, "gateway", "10.0.0.3:9001", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer gw.Stop()
+
+	var events []Event
+	cancel := gw.Watch("game", func(e Event) { events = append(events, e) })
+	defer cancel()
+	if len(events) != 2 || !events[0].Up || !events[1].Up {
+		t.Fatalf("initial events %+v", events)
+	}
+	if n := gw.Nodes(""); len(n) != 3 {
+		t.Fatalf("nodes %+v", n)
+	}
+	if n, err := gw.Pick("game"); err != nil || n.Id != "game-2" {
+		t.Fatalf("pick %+v %v", n, err)
+	}
+	if _, err := gw.Pick("chat"); err == nil {
+		t.Fatal("pick unknown role should fail")
+	}
+
+	// 主动注销，下一次刷新就能看到下线
+	game2.Stop()
+	events = nil
+	if err := gw.refresh(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Up || events[0].Node.Id != "game-2" {
+		t.Fatalf("events after stop %+v", events)
+	}
+	if n, _ := gw.Pick("game"); n == nil || n.Addr != "10.0.0.1:9011" {
+		t.Fatalf("pick after stop %+v", n)
+	}
+
+	// 心跳超时
+	events = nil
+	if err := gw.refresh(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Up {
+		t.Fatalf("events after ttl %+v", events)
+	}
+}
+
+func TestAdvertiseAddr(t *testing.T) {
+	addr, err := AdvertiseAddr(&DiscoveryConf{AdvertiseHost: "10.1.2.3"}, ":9001")
+	if err != nil || addr != "10.1.2.3:9001" {
+		t.Fatalf("%s %v", addr, err)
+	}
+	if addr, _ = AdvertiseAddr(&DiscoveryConf{}, "127.0.0.1:9001"); addr != "127.0.0.1:9001" {
+		t.Fatal(addr)
+	}
+}
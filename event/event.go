@@ -0,0 +1,71 @@
+package event
+
+// 事件总线：玩法模块发事件（击杀、升级、排行榜名次……），任务、成就之类的模块订阅，互相不用import。
+// 同步分发，在主循环里Publish和Subscribe，不加锁
+
+const (
+	TypeKill           = "kill"            // Param=怪物id，Value=数量
+	TypeLevelUp        = "level_up"        // Value=升到的等级
+	TypeRankAchieved   = "rank_achieved"   // Param=排行榜id，Value=名次
+	TypeQuestCompleted = "quest_completed" // Param=任务id
+)
+
+type Event struct {
+	Type     string
+	PlayerId int64
+	Param    int64
+	Value    int64
+}
+
+type subscriber struct {
+	id int
+	f  func(*Event)
+}
+
+type Bus struct {
+	subs map[string][]subscriber
+	seq  int
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[string][]subscriber),
+	}
+}
+
+var bus = NewBus()
+
+func GetInst() *Bus {
+	return bus
+}
+
+// Subscribe 返回取消订阅的函数
+func (b *Bus) Subscribe(typ string, f func(*Event)) (cancel func()) {
+	b.seq++
+	id := b.seq
+	b.subs[typ] = append(b.subs[typ], subscriber{id: id, f: f})
+	return func() {
+		list := b.subs[typ]
+		for i, s := range list {
+			if s.id == id {
+				b.subs[typ] = append(list[:i:i], list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish 按订阅顺序依次回调。回调里可以再Publish（比如任务完成又触发别的事件），但不要无限套娃
+func (b *Bus) Publish(e *Event) {
+	for _, s := range b.subs[e.Type] {
+		s.f(e)
+	}
+}
+
+func Subscribe(typ string, f func(*Event)) (cancel func()) {
+	return bus.Subscribe(typ, f)
+}
+
+func Publish(e *Event) {
+	bus.Publish(e)
+}
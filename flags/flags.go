@@ -0,0 +1,157 @@
+package flags
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"test/admin"
+	"test/audit"
+	"test/timer"
+	"time"
+)
+
+// 功能开关，配置文件格式：
+// <flags>
+//     <flag name="new_rank_settle" enabled="true"/>
+// </flags>
+// 文件里没写的开关一律当关闭处理，所以新功能默认是关的
+
+type flagItem struct {
+	Name    string `xml:"name,attr"`
+	Enabled bool   `xml:"enabled,attr"`
+}
+
+type flagFile struct {
+	Flags []flagItem `xml:"flag"`
+}
+
+type Flags struct {
+	path    string
+	current atomic.Value // map[string]bool，整体替换，读不加锁
+	modTime time.Time
+	m       sync.Mutex
+}
+
+var inst = &Flags{}
+
+func GetInst() *Flags {
+	return inst
+}
+
+// Enabled 任何goroutine都可以调
+func Enabled(name string) bool {
+	return inst.Enabled(name)
+}
+
+func (f *Flags) Enabled(name string) bool {
+	cur, _ := f.current.Load().(map[string]bool)
+	return cur[name]
+}
+
+// Load 第一次加载，之后用Reload
+func (f *Flags) Load(path string) error {
+	f.m.Lock()
+	f.path = path
+	f.m.Unlock()
+	return f.Reload()
+}
+
+// Reload 重新读文件，解析失败时保留旧的开关。记审计日志，操作人是system
+func (f *Flags) Reload() error {
+	return f.reload(audit.ActorSystem, "")
+}
+
+// reload 审计日志里before/after只记变了的开关，文件监听触发的没变化不记
+func (f *Flags) reload(actor, source string) (err error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	before, after := map[string]bool{}, map[string]bool{}
+	defer func() {
+		if err != nil || len(after) > 0 || actor != audit.ActorSystem {
+			audit.Record(actor, source, "flags.reload", f.path, before, after, err)
+		}
+	}()
+	st, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	ff := &flagFile{}
+	if err = xml.Unmarshal(b, ff); err != nil {
+		return err
+	}
+	next := make(map[string]bool, len(ff.Flags))
+	for _, item := range ff.Flags {
+		next[item.Name] = item.Enabled
+	}
+	old, _ := f.current.Load().(map[string]bool)
+	for name, on := range next {
+		if old[name] != on {
+			log.Printf("feature flag %s -> %v", name, on)
+			before[name], after[name] = old[name], on
+		}
+	}
+	for name, on := range old {
+		if _, ok := next[name]; !ok && on {
+			before[name], after[name] = true, false
+		}
+	}
+	f.current.Store(next)
+	f.modTime = st.ModTime()
+	return nil
+}
+
+// All 当前所有开关
+func (f *Flags) All() map[string]bool {
+	cur, _ := f.current.Load().(map[string]bool)
+	ret := make(map[string]bool, len(cur))
+	for k, v := range cur {
+		ret[k] = v
+	}
+	return ret
+}
+
+// StartWatch 用timer定期看文件修改时间，变了就重新加载
+func (f *Flags) StartWatch(interval time.Duration) {
+	timer.Every(interval, "flags_watch", func() {
+		f.m.Lock()
+		path, modTime := f.path, f.modTime
+		f.m.Unlock()
+		if st, err := os.Stat(path); err == nil && st.ModTime().After(modTime) {
+			if err = f.Reload(); err != nil {
+				log.Printf("feature flags reload failed, keep old flags: %s", err.Error())
+			}
+		}
+	})
+}
+
+type flagView struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// HTTPHandler GET列出所有开关，POST重新加载文件
+func (f *Flags) HTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			if err := f.reload(r.Header.Get(audit.ActorHeader), r.RemoteAddr); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		all := f.All()
+		list := make([]flagView, 0, len(all))
+		for k, v := range all {
+			list = append(list, flagView{Name: k, Enabled: v})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		admin.WriteJSON(w, list)
+	})
+}
@@ -0,0 +1,44 @@
+package flags
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReloadBadFileKeepsOld(t *testing.T) {
+	path := t.TempDir() + "/flags.xml"
+	write := func(s string) {
+		if err := os.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`<flags><flag name="new_rank_settle" enabled="true"/><flag name="old_shop" enabled="false"/></flags>`)
+	f := &Flags{}
+	if err := f.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Enabled("new_rank_settle") || f.Enabled("old_shop") || f.Enabled("missing") {
+		t.Fatalf("after load: %v", f.All())
+	}
+
+	// 写坏了的文件、被删掉的文件都不替换当前开关
+	write(`<flags><flag name="new_rank_settle" enabled="fals`)
+	if err := f.Reload(); err == nil {
+		t.Fatal("bad file reloaded")
+	}
+	os.Remove(path)
+	if err := f.Reload(); err == nil {
+		t.Fatal("missing file reloaded")
+	}
+	if all := f.All(); len(all) != 2 || !all["new_rank_settle"] {
+		t.Fatalf("old flags lost: %v", all)
+	}
+
+	write(`<flags><flag name="old_shop" enabled="true"/></flags>`)
+	if err := f.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if f.Enabled("new_rank_settle") || !f.Enabled("old_shop") {
+		t.Fatalf("after fixed reload: %v", f.All())
+	}
+}
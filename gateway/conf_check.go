@@ -0,0 +1,46 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Validate 检查配置，把所有问题一起返回
+func (conf *GatewayConf) Validate() (errs []error) {
+	if conf.ListenAddr == "" {
+		errs = append(errs, fmt.Errorf("listen_addr is required"))
+	} else if _, port, err := net.SplitHostPort(conf.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listen_addr %q: %s", conf.ListenAddr, err.Error()))
+	} else if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		errs = append(errs, fmt.Errorf("listen_addr %q: port out of range 1-65535", conf.ListenAddr))
+	}
+	if conf.IdleMinutes < 0 {
+		errs = append(errs, fmt.Errorf("idle_minutes %d must not be negative", conf.IdleMinutes))
+	}
+	for _, f := range []struct {
+		name string
+		v    int
+	}{{"max_sessions", conf.MaxSessions}, {"max_queue", conf.MaxQueue}, {"queue_notify_sec", conf.QueueNotifySec}} {
+		if f.v < 0 {
+			errs = append(errs, fmt.Errorf("%s %d must not be negative", f.name, f.v))
+		}
+	}
+	if conf.MaxConnPerIpPerMin < 0 {
+		errs = append(errs, fmt.Errorf("max_conn_per_ip_per_min %d must not be negative", conf.MaxConnPerIpPerMin))
+	}
+	for _, v := range []string{conf.MinVersion, conf.MaxVersion} {
+		if _, err := parseVersion(v); v != "" && err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, a := range [][2]string{{"upstream_addr", conf.UpstreamAddr}, {"link_listen_addr", conf.LinkListenAddr}} {
+		if _, _, err := net.SplitHostPort(a[1]); a[1] != "" && err != nil {
+			errs = append(errs, fmt.Errorf("%s %q: %s", a[0], a[1], err.Error()))
+		}
+	}
+	if _, ok := GetCodec(conf.Codec); conf.Codec != "" && !ok {
+		errs = append(errs, fmt.Errorf("codec %q unknown, available: %v", conf.Codec, codecNames()))
+	}
+	return
+}
@@ -0,0 +1,309 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"test/metrics"
+	"time"
+)
+
+type GatewayConf struct {
+	ListenAddr  string `xml:"listen_addr" json:"listen_addr"`
+	IdleMinutes int    `xml:"idle_minutes" json:"idle_minutes"` // 多少分钟没有任何数据就断开，0表示不清理
+	Codec       string `xml:"codec" json:"codec"`               // 消息体格式protobuf/json/msgpack，不填是protobuf，见codec.go
+	MinVersion  string `xml:"min_version" json:"min_version"`   // 支持的最低客户端版本，低于它握手时拒绝，不填不限制
+	MaxVersion  string `xml:"max_version" json:"max_version"`   // 已知的最高客户端版本，高于它的session会被标记，不填不限制
+
+	MaxConnPerIpPerMin int `xml:"max_conn_per_ip_per_min" json:"max_conn_per_ip_per_min"` // 单个IP每分钟最多新建多少连接，0不限制，见ipguard.go
+
+	// 登录排队，见queue.go
+	MaxSessions    int `xml:"max_sessions" json:"max_sessions"`         // 同时在线上限，超了的进队列，0不限制
+	MaxQueue       int `xml:"max_queue" json:"max_queue"`               // 队列最多多少人，满了直接拒绝，0不限制
+	QueueNotifySec int `xml:"queue_notify_sec" json:"queue_notify_sec"` // 多久给排队的推一次名次，不填5秒
+
+	// 多进程部署，见link.go
+	UpstreamAddr   string `xml:"upstream_addr" json:"upstream_addr"`       // -role=gateway时连的逻辑进程link地址
+	LinkListenAddr string `xml:"link_listen_addr" json:"link_listen_addr"` // -role=game时等网关进程连过来的地址
+}
+
+// Message 收到的一条业务消息，由主循环取出来Dispatch
+type Message struct {
+	Sess   *Session
+	Packet *Packet
+}
+
+type Handler func(sess *Session, body []byte)
+
+type Gateway struct {
+	m        sync.Mutex
+	sessions map[uint64]*Session
+	nextId   atomic.Uint64
+	listener net.Listener
+	recv     chan *Message
+	handlers map[uint16]Handler
+	conf     *GatewayConf
+	codec    Codec
+	versions atomic.Value // *versionRange，可以热更新
+	banList  *BanList
+	throttle *ipThrottle // nil表示不限制
+	queue    loginQueue  // g.m保护
+
+	dispatchHook   func(*Message) // Dispatch之前调用，命令日志用
+	replaySessions map[uint64]*Session
+
+	upstream         *upstream // 网关进程：业务消息转给逻辑进程，nil表示单进程
+	upstreamResolver func() (string, error)
+	linkListener     net.Listener // 逻辑进程：接受网关进程的link
+}
+
+func NewGateway() *Gateway {
+	return &Gateway{
+		sessions: make(map[uint64]*Session),
+		recv:     make(chan *Message, 1024),
+		handlers: make(map[uint16]Handler),
+	}
+}
+
+var gw = NewGateway()
+
+func GetInst() *Gateway {
+	return gw
+}
+
+// RegisterHandler 在Start之前注册，handler在主循环goroutine里执行
+func (g *Gateway) RegisterHandler(msgId uint16, h Handler) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.handlers[msgId] = h
+}
+
+func (g *Gateway) setup(conf *GatewayConf) error {
+	if conf.Codec == "" {
+		conf.Codec = DefaultCodec
+	}
+	if _, ok := GetCodec(conf.Codec); !ok {
+		return fmt.Errorf("gateway start error: unknown codec %q", conf.Codec)
+	}
+	if err := g.SetVersionRange(conf.MinVersion, conf.MaxVersion); err != nil {
+		return fmt.Errorf("gateway start error: %w", err)
+	}
+	g.conf = conf
+	g.codec, _ = GetCodec(conf.Codec)
+	return nil
+}
+
+// Start 单进程（-role=all）直接在本进程处理业务消息
+func (g *Gateway) Start(conf *GatewayConf) error {
+	if err := g.setup(conf); err != nil {
+		return err
+	}
+	return g.listen(conf)
+}
+
+// StartUpstream 网关进程（-role=gateway）用：照常监听客户端，业务消息转给conf.UpstreamAddr上的逻辑进程
+func (g *Gateway) StartUpstream(conf *GatewayConf) error {
+	if err := g.setup(conf); err != nil {
+		return err
+	}
+	g.upstream = &upstream{g: g, addr: conf.UpstreamAddr, resolve: g.upstreamResolver}
+	go g.upstream.run()
+	return g.listen(conf)
+}
+
+func (g *Gateway) listen(conf *GatewayConf) error {
+	l, err := net.Listen("tcp", conf.ListenAddr)
+	if err != nil {
+		return err
+	}
+	g.throttle = newIpThrottle(conf.MaxConnPerIpPerMin, time.Minute)
+	g.m.Lock()
+	g.queue.maxSessions, g.queue.maxQueue = conf.MaxSessions, conf.MaxQueue
+	g.m.Unlock()
+	if conf.MaxSessions > 0 {
+		notify := defaultQueueNotify
+		if conf.QueueNotifySec > 0 {
+			notify = time.Duration(conf.QueueNotifySec) * time.Second
+		}
+		g.startQueueNotifier(notify)
+	}
+	g.listener = l
+	go g.acceptLoop()
+	if conf.IdleMinutes > 0 {
+		g.startIdleReaper(time.Duration(conf.IdleMinutes) * time.Minute)
+	}
+	log.Printf("gateway listening on %s", conf.ListenAddr)
+	return nil
+}
+
+func (g *Gateway) Stop() {
+	if g.listener != nil {
+		g.listener.Close()
+	}
+	if g.linkListener != nil {
+		g.linkListener.Close()
+	}
+	if g.upstream != nil {
+		g.upstream.stop()
+	}
+	for _, s := range g.Sessions() {
+		s.Close()
+	}
+}
+
+// Codec 当前部署用的消息体格式，没Start时是protobuf
+func (g *Gateway) Codec() Codec {
+	if g.codec == nil {
+		c, _ := GetCodec(DefaultCodec)
+		return c
+	}
+	return g.codec
+}
+
+// Decode handler里解析消息体用，不用关心部署的是哪种格式
+func (g *Gateway) Decode(body []byte, v any) error {
+	return g.Codec().Unmarshal(body, v)
+}
+
+// SendMsg 按当前格式编码v发给s
+func (g *Gateway) SendMsg(s *Session, msgId uint16, v any) error {
+	body, err := g.Codec().Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Send(&Packet{MsgId: msgId, Body: body})
+}
+
+// Recv 主循环select这个channel
+func (g *Gateway) Recv() <-chan *Message {
+	return g.recv
+}
+
+// SetDispatchHook 每条消息分发前回调一次，传nil取消
+func (g *Gateway) SetDispatchHook(f func(*Message)) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.dispatchHook = f
+}
+
+// Dispatch 在主循环里调用，找到对应handler执行
+func (g *Gateway) Dispatch(msg *Message) {
+	g.m.Lock()
+	h, ok := g.handlers[msg.Packet.MsgId]
+	hook := g.dispatchHook
+	g.m.Unlock()
+	if hook != nil {
+		hook(msg)
+	}
+	if !ok {
+		log.Printf("gateway: no handler for msg %d from session %d", msg.Packet.MsgId, msg.Sess.Id)
+		return
+	}
+	h(msg.Sess, msg.Packet.Body)
+}
+
+func (g *Gateway) Sessions() []*Session {
+	g.m.Lock()
+	defer g.m.Unlock()
+	ret := make([]*Session, 0, len(g.sessions))
+	for _, s := range g.sessions {
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+func (g *Gateway) SessionCount() int {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return len(g.sessions)
+}
+
+func (g *Gateway) acceptLoop() {
+	for {
+		conn, err := g.listener.Accept()
+		if err != nil {
+			log.Printf("gateway accept stopped: %s", err.Error())
+			return
+		}
+		if g.upstream != nil && !g.upstream.up() {
+			metrics.GetCounter("gateway.accept.no_upstream").Inc()
+			conn.Close()
+			continue
+		}
+		if !g.admit(conn) {
+			conn.Close()
+			continue
+		}
+		s := newSession(g.nextId.Add(1), conn)
+		if !g.enqueue(s) {
+			s.Close()
+			continue
+		}
+		g.m.Lock()
+		g.sessions[s.Id] = s
+		g.m.Unlock()
+		go g.readLoop(s)
+	}
+}
+
+func (g *Gateway) readLoop(s *Session) {
+	defer func() {
+		s.Close()
+		g.m.Lock()
+		delete(g.sessions, s.Id)
+		g.m.Unlock()
+		s.releaseClientInfo()
+		g.leave(s)
+		s.linkMu.Lock()
+		if s.linkOpened {
+			g.upstream.send(frameClose, s.Id, nil)
+		}
+		s.linkMu.Unlock()
+	}()
+	for {
+		p, err := readPacket(s.conn)
+		if err != nil {
+			if !s.Closed() {
+				log.Printf("session %d read error: %s", s.Id, err.Error())
+			}
+			return
+		}
+		s.touch()
+		switch p.MsgId {
+		case MsgIdPing:
+			s.Send(&Packet{MsgId: MsgIdPong})
+		case MsgIdPong:
+		case MsgIdHandshake:
+			if !g.handleHandshake(s, p.Body) {
+				return
+			}
+			s.linkMu.Lock()
+			if info := s.ClientInfo(); info != nil && s.linkOpened {
+				b, _ := json.Marshal(info)
+				g.upstream.send(frameInfo, s.Id, b)
+			}
+			s.linkMu.Unlock()
+		default:
+			if !s.admitted.Load() {
+				// 还在排队
+				metrics.GetCounter("gateway.queue.dropped_msg").Inc()
+				continue
+			}
+			if s.ClientInfo() == nil && g.handshakeRequired() {
+				log.Printf("session %d (%s) sent msg %d before handshake, disconnect", s.Id, s.RemoteAddr(), p.MsgId)
+				return
+			}
+			if g.upstream != nil {
+				if err = g.upstream.send(frameMsg, s.Id, packetBody(p)); err != nil {
+					log.Printf("session %d forward msg %d failed: %s", s.Id, p.MsgId, err.Error())
+					return
+				}
+				continue
+			}
+			g.recv <- &Message{Sess: s, Packet: p}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"test/metrics"
+)
+
+// 版本握手：客户端连上后第一个包发MsgIdHandshake，网关按配置的min_version/max_version检查
+// 低于min_version：回HandshakeRejected然后断开（强更）
+// 高于max_version：回HandshakeFlagged，连接保留，session标记一下，业务可以据此关掉新版本才有的功能（灰度发版时新客户端先于服务器上线）
+// 握手包和回包固定用json，跟codec配置无关（握手时还没约定格式）
+// min/max都没配时不要求握手；配了之后没握手就发业务消息直接断开
+
+const (
+	MsgIdHandshake    uint16 = 3
+	MsgIdHandshakeAck uint16 = 4
+)
+
+const (
+	HandshakeOK       = 0
+	HandshakeFlagged  = 1
+	HandshakeRejected = 2
+	HandshakeBadReq   = 3
+)
+
+type HandshakeReq struct {
+	Version  string `json:"version"` // 1.2.3这种，段数不限
+	Platform string `json:"platform"`
+}
+
+type HandshakeAck struct {
+	Code       int    `json:"code"`
+	MinVersion string `json:"min_version,omitempty"`
+	MaxVersion string `json:"max_version,omitempty"`
+}
+
+// ClientInfo 握手成功后记在session上
+type ClientInfo struct {
+	Version  string
+	Platform string
+	Flagged  bool // 版本高于max_version
+}
+
+type versionRange struct {
+	min, max string
+}
+
+// parseVersion "1.2.3" -> [1 2 3]
+func parseVersion(v string) ([]int, error) {
+	if v == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+	parts := strings.Split(v, ".")
+	ret := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("illegal version %q", v)
+		}
+		ret[i] = n
+	}
+	return ret, nil
+}
+
+// compareVersion 段数不同时缺的段按0算（1.2 == 1.2.0）
+func compareVersion(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// SetVersionRange 热更新支持的版本范围，空字符串表示不限制。只影响之后的握手，已经连上的不踢
+func (g *Gateway) SetVersionRange(min, max string) error {
+	var lo, hi []int
+	var err error
+	if min != "" {
+		if lo, err = parseVersion(min); err != nil {
+			return err
+		}
+	}
+	if max != "" {
+		if hi, err = parseVersion(max); err != nil {
+			return err
+		}
+	}
+	if lo != nil && hi != nil && compareVersion(lo, hi) > 0 {
+		return fmt.Errorf("min version %s is greater than max version %s", min, max)
+	}
+	g.versions.Store(&versionRange{min: min, max: max})
+	log.Printf("gateway version range set to [%s, %s]", min, max)
+	return nil
+}
+
+func (g *Gateway) VersionRange() (min, max string) {
+	if r, ok := g.versions.Load().(*versionRange); ok {
+		return r.min, r.max
+	}
+	return "", ""
+}
+
+func (g *Gateway) handshakeRequired() bool {
+	min, max := g.VersionRange()
+	return min != "" || max != ""
+}
+
+// checkVersion 返回握手结果码
+func (g *Gateway) checkVersion(version string) int {
+	v, err := parseVersion(version)
+	if err != nil {
+		return HandshakeBadReq
+	}
+	min, max := g.VersionRange()
+	if min != "" {
+		if lo, _ := parseVersion(min); compareVersion(v, lo) < 0 {
+			return HandshakeRejected
+		}
+	}
+	if max != "" {
+		if hi, _ := parseVersion(max); compareVersion(v, hi) > 0 {
+			return HandshakeFlagged
+		}
+	}
+	return HandshakeOK
+}
+
+// handleHandshake 在读goroutine里执行，返回false表示要断开
+func (g *Gateway) handleHandshake(s *Session, body []byte) bool {
+	req := &HandshakeReq{}
+	code := HandshakeBadReq
+	if err := json.Unmarshal(body, req); err == nil {
+		code = g.checkVersion(req.Version)
+	}
+	min, max := g.VersionRange()
+	ack, _ := json.Marshal(&HandshakeAck{Code: code, MinVersion: min, MaxVersion: max})
+	s.Send(&Packet{MsgId: MsgIdHandshakeAck, Body: ack})
+	if code == HandshakeRejected || code == HandshakeBadReq {
+		metrics.GetCounter("gateway.handshake.rejected").Inc()
+		log.Printf("session %d (%s) handshake rejected, version %q platform %q", s.Id, s.RemoteAddr(), req.Version, req.Platform)
+		return false
+	}
+	if s.setClientInfo(&ClientInfo{Version: req.Version, Platform: req.Platform, Flagged: code == HandshakeFlagged}) {
+		if code == HandshakeFlagged {
+			metrics.GetCounter("gateway.handshake.flagged").Inc()
+		}
+	}
+	return true
+}
+
+func versionGauge(info *ClientInfo) *metrics.Gauge {
+	return metrics.GetGauge("gateway.session.version." + info.Platform + "." + info.Version)
+}
+
+// setClientInfo 重复握手只认第一次，返回是否是第一次
+func (s *Session) setClientInfo(info *ClientInfo) bool {
+	if !s.client.CompareAndSwap(nil, info) {
+		return false
+	}
+	versionGauge(info).Add(1)
+	return true
+}
+
+// ClientInfo 没握手返回nil
+func (s *Session) ClientInfo() *ClientInfo {
+	return s.client.Load()
+}
+
+// releaseClientInfo session移除时把版本分布计数减回去
+func (s *Session) releaseClientInfo() {
+	if info := s.client.Load(); info != nil {
+		versionGauge(info).Add(-1)
+	}
+}
@@ -0,0 +1,242 @@
+package gateway
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"test/admin"
+	"test/audit"
+	"test/db"
+	"test/metrics"
+	"time"
+)
+
+// accept时按IP拦截：封禁名单（存库，admin接口增删）+ 每个IP每分钟的新建连接数上限
+//
+// 建表语句：
+// CREATE TABLE ip_ban (
+//   ip VARCHAR(64) NOT NULL PRIMARY KEY,
+//   reason VARCHAR(255) NOT NULL DEFAULT '',
+//   create_time BIGINT NOT NULL,
+//   expire_time BIGINT NOT NULL DEFAULT 0
+// );
+
+type Ban struct {
+	Ip         string `json:"ip"`
+	Reason     string `json:"reason"`
+	CreateTime int64  `json:"create_time"`
+	ExpireTime int64  `json:"expire_time"` // 秒，0表示永久
+}
+
+func (b *Ban) active(now int64) bool {
+	return b.ExpireTime == 0 || b.ExpireTime > now
+}
+
+// BanList 内存里一份完整名单，accept时只查内存；增删同时写库
+type BanList struct {
+	pool db.Pool
+	m    sync.RWMutex
+	bans map[string]*Ban
+}
+
+func NewBanList(pool db.Pool) *BanList {
+	return &BanList{
+		pool: pool,
+		bans: make(map[string]*Ban),
+	}
+}
+
+// Load 启动时从库里读整张表，已过期的顺手删掉
+func (b *BanList) Load() error {
+	rows, err := b.pool.Query("select * from ip_ban;")
+	if err != nil && !errors.Is(err, db.ErrNoRows) {
+		return err
+	}
+	now := time.Now().Unix()
+	bans := make(map[string]*Ban, len(rows))
+	for _, row := range rows {
+		ban := &Ban{
+			Ip:         row.String("ip"),
+			Reason:     row.String("reason"),
+			CreateTime: row.Int64("create_time"),
+			ExpireTime: row.Int64("expire_time"),
+		}
+		if !ban.active(now) {
+			b.deleteRow(ban.Ip)
+			continue
+		}
+		bans[ban.Ip] = ban
+	}
+	b.m.Lock()
+	b.bans = bans
+	b.m.Unlock()
+	log.Printf("ip ban list loaded, %d entries", len(bans))
+	return nil
+}
+
+// Ban d<=0表示永久
+func (b *BanList) Ban(ip string, reason string, d time.Duration) error {
+	if net.ParseIP(ip) == nil {
+		return errors.New("illegal ip " + ip)
+	}
+	now := time.Now()
+	ban := &Ban{Ip: ip, Reason: reason, CreateTime: now.Unix()}
+	if d > 0 {
+		ban.ExpireTime = now.Add(d).Unix()
+	}
+	b.m.Lock()
+	b.bans[ip] = ban
+	b.m.Unlock()
+	log.Printf("ip %s banned until %d: %s", ip, ban.ExpireTime, reason)
+	return b.pool.AddQuery(&db.SqlQuery{
+		Stmt:     "replace into ip_ban (ip, reason, create_time, expire_time) values (?, ?, ?, ?);",
+		Args:     []any{ban.Ip, ban.Reason, ban.CreateTime, ban.ExpireTime},
+		Priority: db.PriorityHigh,
+		CbFunc: func(_ []*db.DBData, err error) {
+			if err != nil {
+				log.Printf("ip ban save failed, ip %s: %s", ip, err.Error())
+			}
+		},
+	})
+}
+
+func (b *BanList) Unban(ip string) error {
+	b.m.Lock()
+	delete(b.bans, ip)
+	b.m.Unlock()
+	log.Printf("ip %s unbanned", ip)
+	return b.deleteRow(ip)
+}
+
+func (b *BanList) deleteRow(ip string) error {
+	return b.pool.AddQuery(&db.SqlQuery{
+		Stmt: "delete from ip_ban where ip = ?;",
+		Args: []any{ip},
+		CbFunc: func(_ []*db.DBData, err error) {
+			if err != nil {
+				log.Printf("ip ban delete failed, ip %s: %s", ip, err.Error())
+			}
+		},
+	})
+}
+
+func (b *BanList) IsBanned(ip string) bool {
+	b.m.RLock()
+	ban, ok := b.bans[ip]
+	b.m.RUnlock()
+	return ok && ban.active(time.Now().Unix())
+}
+
+// List 只返回还有效的，按ip排序
+func (b *BanList) List() []*Ban {
+	now := time.Now().Unix()
+	b.m.RLock()
+	ret := make([]*Ban, 0, len(b.bans))
+	for _, ban := range b.bans {
+		if ban.active(now) {
+			ret = append(ret, ban)
+		}
+	}
+	b.m.RUnlock()
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Ip < ret[j].Ip })
+	return ret
+}
+
+// get 拷贝一份，没有返回nil
+func (b *BanList) get(ip string) *Ban {
+	b.m.RLock()
+	defer b.m.RUnlock()
+	if ban, ok := b.bans[ip]; ok {
+		c := *ban
+		return &c
+	}
+	return nil
+}
+
+// HTTPHandler 给admin用：GET列出，POST ?ip=&reason=&minutes=封禁（minutes不填是永久），DELETE ?ip=解封。增删都记审计日志
+func (b *BanList) HTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		ip := q.Get("ip")
+		var err error
+		switch r.Method {
+		case http.MethodPost:
+			minutes, _ := strconv.Atoi(q.Get("minutes"))
+			before := b.get(ip)
+			err = b.Ban(ip, q.Get("reason"), time.Duration(minutes)*time.Minute)
+			audit.RecordRequest(r, "gateway.ban", ip, before, b.get(ip), err)
+		case http.MethodDelete:
+			before := b.get(ip)
+			err = b.Unban(ip)
+			audit.RecordRequest(r, "gateway.unban", ip, before, b.get(ip), err)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		admin.WriteJSON(w, b.List())
+	})
+}
+
+// ipThrottle 固定窗口计数，只在acceptLoop里用，不加锁
+type ipThrottle struct {
+	limit       int
+	window      time.Duration
+	windowStart time.Time
+	counts      map[string]int
+}
+
+func newIpThrottle(limit int, window time.Duration) *ipThrottle {
+	if limit <= 0 {
+		return nil
+	}
+	return &ipThrottle{
+		limit:  limit,
+		window: window,
+		counts: make(map[string]int),
+	}
+}
+
+// allow nil表示不限制
+func (t *ipThrottle) allow(ip string, now time.Time) bool {
+	if t == nil {
+		return true
+	}
+	if now.Sub(t.windowStart) >= t.window {
+		t.windowStart = now
+		t.counts = make(map[string]int)
+	}
+	t.counts[ip]++
+	return t.counts[ip] <= t.limit
+}
+
+// SetBanList 在Start之前设置，nil表示不检查封禁
+func (g *Gateway) SetBanList(b *BanList) {
+	g.banList = b
+}
+
+func (g *Gateway) BanList() *BanList {
+	return g.banList
+}
+
+// admit accept之后马上调，返回false时直接关掉连接
+func (g *Gateway) admit(conn net.Conn) bool {
+	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		ip = conn.RemoteAddr().String()
+	}
+	if g.banList != nil && g.banList.IsBanned(ip) {
+		metrics.GetCounter("gateway.accept.banned").Inc()
+		return false
+	}
+	if !g.throttle.allow(ip, time.Now()) {
+		metrics.GetCounter("gateway.accept.throttled").Inc()
+		log.Printf("gateway: too many connections from %s, refused", ip)
+		return false
+	}
+	return true
+}
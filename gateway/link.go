@@ -0,0 +1,348 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"test/metrics"
+	"time"
+)
+
+// 多进程部署时网关进程和逻辑进程之间的连接（link）。
+// 网关进程（-role=gateway）照常接客户端、做握手/限流/保活，业务消息不进本地Recv，而是通过link转给逻辑进程；
+// 逻辑进程（-role=game）不监听客户端，只监听link，每个客户端在这边是一个"远端session"，handler里照样用sess.Send/SendMsg/Close，
+// 回包经link回到网关再写给客户端。一个逻辑进程可以挂多个网关，网关单独加机器就能水平扩
+//
+// 帧格式：4字节长度（大端，不含自身）+ 1字节类型 + 8字节网关那边的session id + 内容
+
+const (
+	frameOpen  byte = 1 // 网关->逻辑 新连接，内容是客户端地址
+	frameInfo  byte = 2 // 网关->逻辑 握手结果，内容是ClientInfo的json
+	frameMsg   byte = 3 // 网关->逻辑 业务消息，内容是2字节MsgId+Body
+	frameReply byte = 4 // 逻辑->网关 回包，格式同frameMsg
+	frameClose byte = 5 // 双向 连接断开/踢下线
+)
+
+const (
+	frameHeadLen     = 4 + 1 + 8
+	linkRedialPeriod = time.Second
+)
+
+type frame struct {
+	typ    byte
+	sessId uint64
+	data   []byte
+}
+
+func readFrame(r io.Reader) (*frame, error) {
+	head := make([]byte, frameHeadLen)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	l := binary.BigEndian.Uint32(head)
+	if l < frameHeadLen-4 || l > maxPacketLen+frameHeadLen {
+		return nil, fmt.Errorf("readFrame error: illegal frame length %d", l)
+	}
+	f := &frame{typ: head[4], sessId: binary.BigEndian.Uint64(head[5:])}
+	f.data = make([]byte, int(l)-(frameHeadLen-4))
+	if _, err := io.ReadFull(r, f.data); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func encodeFrame(typ byte, sessId uint64, data []byte) []byte {
+	buf := make([]byte, frameHeadLen+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(frameHeadLen-4+len(data)))
+	buf[4] = typ
+	binary.BigEndian.PutUint64(buf[5:], sessId)
+	copy(buf[frameHeadLen:], data)
+	return buf
+}
+
+// packetBody frameMsg/frameReply的内容：2字节MsgId+Body
+func packetBody(p *Packet) []byte {
+	buf := make([]byte, msgIdLen+len(p.Body))
+	binary.BigEndian.PutUint16(buf, p.MsgId)
+	copy(buf[msgIdLen:], p.Body)
+	return buf
+}
+
+func parsePacketBody(data []byte) (*Packet, error) {
+	if len(data) < msgIdLen {
+		return nil, fmt.Errorf("link packet too short: %d", len(data))
+	}
+	return &Packet{MsgId: binary.BigEndian.Uint16(data), Body: data[msgIdLen:]}, nil
+}
+
+// ---------- 网关进程这边 ----------
+
+// upstream 网关进程到逻辑进程的link，断了自动重连，断开期间不接新连接，已有的客户端全部断开（逻辑进程那边的状态已经没了）
+type upstream struct {
+	g       *Gateway
+	addr    string
+	resolve func() (string, error) // 每次（重）连之前调一次拿地址，nil就一直用addr
+	m       sync.Mutex
+	conn    net.Conn
+	closed  bool
+}
+
+func (u *upstream) up() bool {
+	u.m.Lock()
+	defer u.m.Unlock()
+	return u.conn != nil
+}
+
+func (u *upstream) send(typ byte, sessId uint64, data []byte) error {
+	u.m.Lock()
+	defer u.m.Unlock()
+	if u.conn == nil {
+		return fmt.Errorf("upstream %s not connected", u.addr)
+	}
+	_, err := u.conn.Write(encodeFrame(typ, sessId, data))
+	return err
+}
+
+func (u *upstream) run() {
+	for {
+		u.m.Lock()
+		closed := u.closed
+		u.m.Unlock()
+		if closed {
+			return
+		}
+		if u.resolve != nil {
+			addr, err := u.resolve()
+			if err != nil {
+				log.Printf("gateway upstream resolve failed, retry later: %s", err.Error())
+				time.Sleep(linkRedialPeriod)
+				continue
+			}
+			u.m.Lock()
+			u.addr = addr
+			u.m.Unlock()
+		}
+		conn, err := net.DialTimeout("tcp", u.addr, 3*time.Second)
+		if err != nil {
+			log.Printf("gateway upstream %s dial failed, retry later: %s", u.addr, err.Error())
+			time.Sleep(linkRedialPeriod)
+			continue
+		}
+		u.m.Lock()
+		u.conn = conn
+		u.m.Unlock()
+		metrics.GetGauge("gateway.link.up").Set(1)
+		log.Printf("gateway upstream %s connected", u.addr)
+		u.readLoop(conn)
+		u.m.Lock()
+		u.conn = nil
+		u.m.Unlock()
+		metrics.GetGauge("gateway.link.up").Set(0)
+		for _, s := range u.g.Sessions() {
+			s.Close()
+		}
+	}
+}
+
+func (u *upstream) readLoop(conn net.Conn) {
+	defer conn.Close()
+	for {
+		f, err := readFrame(conn)
+		if err != nil {
+			log.Printf("gateway upstream %s disconnected: %s", u.addr, err.Error())
+			return
+		}
+		u.g.m.Lock()
+		s, ok := u.g.sessions[f.sessId]
+		u.g.m.Unlock()
+		if !ok {
+			continue
+		}
+		switch f.typ {
+		case frameReply:
+			p, err := parsePacketBody(f.data)
+			if err != nil {
+				log.Printf("gateway upstream %s bad reply for session %d: %s", u.addr, f.sessId, err.Error())
+				continue
+			}
+			if err = s.Send(p); err != nil && !s.Closed() {
+				log.Printf("session %d send failed: %s", s.Id, err.Error())
+			}
+		case frameClose:
+			s.Close()
+		}
+	}
+}
+
+func (u *upstream) stop() {
+	u.m.Lock()
+	defer u.m.Unlock()
+	u.closed = true
+	if u.conn != nil {
+		u.conn.Close()
+	}
+}
+
+// SetUpstreamResolver 网关进程用服务发现找逻辑进程时，在StartUpstream之前设置，每次（重）连之前调f拿地址，配置里的upstream_addr就不用了
+func (g *Gateway) SetUpstreamResolver(f func() (string, error)) {
+	g.upstreamResolver = f
+}
+
+// ---------- 逻辑进程这边 ----------
+
+// linkConn 远端session的"连接"，写进来的是encodePacket编好的包，拆开后包成frameReply发回网关
+type linkConn struct {
+	l        *downLink
+	remoteId uint64
+	addr     string
+}
+
+type linkAddr string
+
+func (a linkAddr) Network() string { return "link" }
+func (a linkAddr) String() string  { return string(a) }
+
+func (c *linkConn) Read([]byte) (int, error) { return 0, net.ErrClosed }
+
+func (c *linkConn) Write(b []byte) (int, error) {
+	if len(b) < headLen+msgIdLen {
+		return 0, fmt.Errorf("link write: short packet")
+	}
+	if err := c.l.send(frameReply, c.remoteId, b[headLen:]); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close 逻辑进程这边主动断开（踢下线），通知网关关掉真实连接
+func (c *linkConn) Close() error {
+	c.l.remove(c.remoteId)
+	return c.l.send(frameClose, c.remoteId, nil)
+}
+
+func (c *linkConn) LocalAddr() net.Addr              { return c.l.conn.LocalAddr() }
+func (c *linkConn) RemoteAddr() net.Addr             { return linkAddr(c.addr) }
+func (c *linkConn) SetDeadline(time.Time) error      { return nil }
+func (c *linkConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *linkConn) SetWriteDeadline(time.Time) error { return nil }
+
+// downLink 逻辑进程接受的一条网关link
+type downLink struct {
+	g        *Gateway
+	conn     net.Conn
+	sendMu   sync.Mutex
+	m        sync.Mutex
+	sessions map[uint64]*Session // 网关那边的session id -> 本地session
+}
+
+func (l *downLink) send(typ byte, remoteId uint64, data []byte) error {
+	l.sendMu.Lock()
+	defer l.sendMu.Unlock()
+	_, err := l.conn.Write(encodeFrame(typ, remoteId, data))
+	return err
+}
+
+// remove 把远端session从link和网关里摘掉，返回被摘掉的session（已经不在了返回nil）
+func (l *downLink) remove(remoteId uint64) *Session {
+	l.m.Lock()
+	s, ok := l.sessions[remoteId]
+	delete(l.sessions, remoteId)
+	l.m.Unlock()
+	if !ok {
+		return nil
+	}
+	l.g.m.Lock()
+	delete(l.g.sessions, s.Id)
+	l.g.m.Unlock()
+	s.closed.Store(true)
+	s.releaseClientInfo()
+	return s
+}
+
+func (l *downLink) serve() {
+	defer func() {
+		l.conn.Close()
+		l.m.Lock()
+		ids := make([]uint64, 0, len(l.sessions))
+		for id := range l.sessions {
+			ids = append(ids, id)
+		}
+		l.m.Unlock()
+		for _, id := range ids {
+			l.remove(id)
+		}
+		metrics.GetGauge("gateway.link.count").Add(-1)
+	}()
+	metrics.GetGauge("gateway.link.count").Add(1)
+	for {
+		f, err := readFrame(l.conn)
+		if err != nil {
+			log.Printf("gateway link %s disconnected: %s", l.conn.RemoteAddr(), err.Error())
+			return
+		}
+		switch f.typ {
+		case frameOpen:
+			s := newSession(l.g.nextId.Add(1), &linkConn{l: l, remoteId: f.sessId, addr: string(f.data)})
+			l.m.Lock()
+			l.sessions[f.sessId] = s
+			l.m.Unlock()
+			l.g.m.Lock()
+			l.g.sessions[s.Id] = s
+			l.g.m.Unlock()
+		case frameInfo:
+			info := &ClientInfo{}
+			if s := l.session(f.sessId); s != nil && json.Unmarshal(f.data, info) == nil {
+				s.setClientInfo(info)
+			}
+		case frameMsg:
+			s := l.session(f.sessId)
+			if s == nil {
+				continue
+			}
+			p, err := parsePacketBody(f.data)
+			if err != nil {
+				log.Printf("gateway link %s bad msg for session %d: %s", l.conn.RemoteAddr(), f.sessId, err.Error())
+				continue
+			}
+			s.touch()
+			l.g.recv <- &Message{Sess: s, Packet: p}
+		case frameClose:
+			l.remove(f.sessId)
+		}
+	}
+}
+
+func (l *downLink) session(remoteId uint64) *Session {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.sessions[remoteId]
+}
+
+// StartLink 逻辑进程（-role=game）用，代替Start：不监听客户端，只在conf.LinkListenAddr上等网关进程连过来
+func (g *Gateway) StartLink(conf *GatewayConf) error {
+	if err := g.setup(conf); err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", conf.LinkListenAddr)
+	if err != nil {
+		return err
+	}
+	g.linkListener = l
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				log.Printf("gateway link accept stopped: %s", err.Error())
+				return
+			}
+			log.Printf("gateway link from %s", conn.RemoteAddr())
+			go (&downLink{g: g, conn: conn, sessions: make(map[uint64]*Session)}).serve()
+		}
+	}()
+	log.Printf("gateway link listening on %s", conf.LinkListenAddr)
+	return nil
+}
@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// 包格式：4字节长度（大端，不含自身，= 2 + len(Body)） + 2字节MsgId + Body
+const (
+	headLen      = 4
+	msgIdLen     = 2
+	maxPacketLen = 1 << 20
+)
+
+// 网关自己处理的消息号，不会转发给业务handler
+const (
+	MsgIdPing uint16 = 1
+	MsgIdPong uint16 = 2
+)
+
+type Packet struct {
+	MsgId uint16
+	Body  []byte
+}
+
+func readPacket(r io.Reader) (*Packet, error) {
+	head := make([]byte, headLen)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	l := binary.BigEndian.Uint32(head)
+	if l < msgIdLen || l > maxPacketLen {
+		return nil, fmt.Errorf("readPacket error: illegal packet length %d", l)
+	}
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return &Packet{
+		MsgId: binary.BigEndian.Uint16(buf[:msgIdLen]),
+		Body:  buf[msgIdLen:],
+	}, nil
+}
+
+func encodePacket(p *Packet) []byte {
+	buf := make([]byte, headLen+msgIdLen+len(p.Body))
+	binary.BigEndian.PutUint32(buf, uint32(msgIdLen+len(p.Body)))
+	binary.BigEndian.PutUint16(buf[headLen:], p.MsgId)
+	copy(buf[headLen+msgIdLen:], p.Body)
+	return buf
+}
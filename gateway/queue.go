@@ -0,0 +1,186 @@
+package gateway
+
+import (
+	"encoding/json"
+	"log"
+	"test/metrics"
+	"test/timer"
+	"time"
+)
+
+// 登录排队：配置了max_sessions后，在线（已放行）的session数到上限时新连接不拒绝，而是进队列，
+// 排队期间连接保持（可以ping、握手），业务消息直接丢掉；前面有人下线就按顺序放行，不会一下子把主循环压垮。
+// 排队状态用MsgIdQueueStatus推给客户端（固定json，和握手一样不走codec）：进队时推一次，之后每queue_notify_sec秒名次有变化时推，放行时推Admitted=true。
+// 队列也满了（max_queue）的回Full=true然后断开。排队的客户端要自己定时ping，不然会被idle_minutes踢掉。
+// 多进程部署时排队在网关进程做，放行之后才通知逻辑进程有这个session
+
+const MsgIdQueueStatus uint16 = 5
+
+const defaultQueueNotify = 5 * time.Second
+
+type QueueStatus struct {
+	Position int  `json:"position"`          // 前面还有几个人+1，放行后是0
+	Total    int  `json:"total"`             // 队列总人数
+	EtaSec   int  `json:"eta_sec,omitempty"` // 按最近一分钟的放行速度估的等待秒数，估不出来是0
+	Admitted bool `json:"admitted,omitempty"`
+	Full     bool `json:"full,omitempty"`
+}
+
+type loginQueue struct {
+	maxSessions int // 0表示不限
+	maxQueue    int // 0表示不限
+	admitted    int
+	waiting     []*Session
+	admitTimes  []time.Time // 最近一分钟的放行时间，估ETA用
+}
+
+// SetMaxSessions 热更新在线上限（0不限），调大时马上放行排队的
+func (g *Gateway) SetMaxSessions(max int) {
+	g.m.Lock()
+	g.queue.maxSessions = max
+	list := g.admitNextLocked(time.Now())
+	g.m.Unlock()
+	g.notifyAdmitted(list)
+	log.Printf("gateway max sessions set to %d", max)
+}
+
+// QueueLen 排队人数和已放行的session数
+func (g *Gateway) QueueLen() (waiting int, admitted int) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return len(g.queue.waiting), g.queue.admitted
+}
+
+// enqueue accept之后调，返回false表示队列满了，连接要断开
+func (g *Gateway) enqueue(s *Session) bool {
+	g.m.Lock()
+	q := &g.queue
+	if len(q.waiting) == 0 && (q.maxSessions <= 0 || q.admitted < q.maxSessions) {
+		q.admitted++
+		s.admitted.Store(true)
+		g.m.Unlock()
+		g.onAdmitted(s)
+		return true
+	}
+	if q.maxQueue > 0 && len(q.waiting) >= q.maxQueue {
+		g.m.Unlock()
+		metrics.GetCounter("gateway.queue.full").Inc()
+		sendQueueStatus(s, &QueueStatus{Full: true})
+		return false
+	}
+	q.waiting = append(q.waiting, s)
+	st := &QueueStatus{Position: len(q.waiting), Total: len(q.waiting), EtaSec: q.eta(len(q.waiting), time.Now())}
+	s.queuePos = st.Position
+	g.m.Unlock()
+	metrics.GetGauge("gateway.queue.waiting").Add(1)
+	sendQueueStatus(s, st)
+	return true
+}
+
+// leave session断开时调，放行的空出一个位置，排队的从队列里拿掉
+func (g *Gateway) leave(s *Session) {
+	g.m.Lock()
+	var list []*Session
+	if s.admitted.Load() {
+		g.queue.admitted--
+		list = g.admitNextLocked(time.Now())
+	} else {
+		for i, w := range g.queue.waiting {
+			if w == s {
+				g.queue.waiting = append(g.queue.waiting[:i], g.queue.waiting[i+1:]...)
+				metrics.GetGauge("gateway.queue.waiting").Add(-1)
+				break
+			}
+		}
+	}
+	g.m.Unlock()
+	g.notifyAdmitted(list)
+}
+
+// admitNextLocked 有空位就按顺序放行，调用方持有g.m
+func (g *Gateway) admitNextLocked(now time.Time) (list []*Session) {
+	q := &g.queue
+	for len(q.waiting) > 0 && (q.maxSessions <= 0 || q.admitted < q.maxSessions) {
+		s := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		q.admitted++
+		s.admitted.Store(true)
+		q.admitTimes = append(q.admitTimes, now)
+		list = append(list, s)
+	}
+	if len(list) > 0 {
+		metrics.GetGauge("gateway.queue.waiting").Add(-int64(len(list)))
+	}
+	return
+}
+
+func (g *Gateway) notifyAdmitted(list []*Session) {
+	for _, s := range list {
+		metrics.GetCounter("gateway.queue.admitted").Inc()
+		sendQueueStatus(s, &QueueStatus{Admitted: true})
+		g.onAdmitted(s)
+	}
+}
+
+// onAdmitted 放行之后逻辑进程才知道有这个session
+func (g *Gateway) onAdmitted(s *Session) {
+	if g.upstream == nil {
+		return
+	}
+	s.linkMu.Lock()
+	defer s.linkMu.Unlock()
+	g.upstream.send(frameOpen, s.Id, []byte(s.RemoteAddr()))
+	s.linkOpened = true
+	if info := s.ClientInfo(); info != nil {
+		b, _ := json.Marshal(info)
+		g.upstream.send(frameInfo, s.Id, b)
+	}
+}
+
+// eta 最近一分钟每放行一个平均多久，乘上名次
+func (q *loginQueue) eta(pos int, now time.Time) int {
+	cut := 0
+	for cut < len(q.admitTimes) && now.Sub(q.admitTimes[cut]) > time.Minute {
+		cut++
+	}
+	q.admitTimes = q.admitTimes[cut:]
+	if len(q.admitTimes) == 0 {
+		return 0
+	}
+	return pos * 60 / len(q.admitTimes)
+}
+
+func sendQueueStatus(s *Session, st *QueueStatus) {
+	b, _ := json.Marshal(st)
+	if err := s.Send(&Packet{MsgId: MsgIdQueueStatus, Body: b}); err != nil {
+		log.Printf("session %d send queue status failed: %s", s.Id, err.Error())
+	}
+}
+
+// startQueueNotifier 定期给名次变了的排队session推一次状态
+func (g *Gateway) startQueueNotifier(interval time.Duration) {
+	timer.Every(interval, "gateway_queue_notify", func() {
+		g.pushQueuePositions(time.Now())
+	})
+}
+
+func (g *Gateway) pushQueuePositions(now time.Time) {
+	type item struct {
+		s  *Session
+		st *QueueStatus
+	}
+	var list []item
+	g.m.Lock()
+	total := len(g.queue.waiting)
+	for i, s := range g.queue.waiting {
+		if s.queuePos == i+1 {
+			continue
+		}
+		s.queuePos = i + 1
+		list = append(list, item{s, &QueueStatus{Position: i + 1, Total: total, EtaSec: g.queue.eta(i+1, now)}})
+	}
+	g.m.Unlock()
+	for _, it := range list {
+		sendQueueStatus(it.s, it.st)
+	}
+}
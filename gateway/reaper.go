@@ -0,0 +1,45 @@
+package gateway
+
+import (
+	"log"
+	"test/metrics"
+	"test/timer"
+	"time"
+)
+
+// 空闲超时前多久先发一个保活ping，客户端回pong（或者发任何数据）就不会被踢
+const idlePingAhead = 30 * time.Second
+
+// startIdleReaper 用timer每隔一段时间扫一遍session，扫描本身在主循环里执行
+func (g *Gateway) startIdleReaper(idle time.Duration) {
+	interval := idle / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	timer.Every(interval, "gateway_idle_sweep", func() {
+		g.reapIdle(time.Now(), idle)
+	})
+}
+
+func (g *Gateway) reapIdle(now time.Time, idle time.Duration) {
+	reaped := 0
+	for _, s := range g.Sessions() {
+		idleFor := s.IdleFor(now)
+		if idleFor >= idle {
+			log.Printf("session %d (%s) idle for %v, disconnect", s.Id, s.RemoteAddr(), idleFor)
+			s.Close()
+			reaped++
+			continue
+		}
+		if idleFor >= idle-idlePingAhead && !s.pinged.Load() {
+			s.pinged.Store(true)
+			if err := s.Send(&Packet{MsgId: MsgIdPing}); err != nil {
+				log.Printf("session %d keepalive ping failed: %s", s.Id, err.Error())
+			}
+		}
+	}
+	if reaped > 0 {
+		metrics.GetCounter("gateway.session.reaped").Add(int64(reaped))
+	}
+	metrics.GetGauge("gateway.session.count").Set(int64(g.SessionCount()))
+}
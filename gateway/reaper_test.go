@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReapIdleKeepalive(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	got := make(chan uint16, 4)
+	go func() {
+		for {
+			p, err := readPacket(client)
+			if err != nil {
+				close(got)
+				return
+			}
+			got <- p.MsgId
+		}
+	}()
+	g := NewGateway()
+	s := newSession(1, server)
+	g.sessions[s.Id] = s
+	base := time.UnixMilli(s.lastActive.Load())
+	// 客户端回了pong（读循环收到任何数据都touch）
+	pong := func(at time.Time) {
+		s.touch()
+		s.lastActive.Store(at.UnixMilli())
+	}
+	expectPing := func(step string) {
+		select {
+		case id := <-got:
+			if id != MsgIdPing {
+				t.Fatalf("%s: got msg %d, want ping", step, id)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: no ping", step)
+		}
+	}
+	idle := time.Minute
+
+	g.reapIdle(base.Add(20*time.Second), idle)
+	g.reapIdle(base.Add(35*time.Second), idle)
+	expectPing("before reap")
+	// 已经ping过就不重复发
+	g.reapIdle(base.Add(40*time.Second), idle)
+	pong(base.Add(40 * time.Second))
+	g.reapIdle(base.Add(65*time.Second), idle)
+	if s.Closed() || len(got) != 0 {
+		t.Fatalf("session reaped after pong, closed %v, extra msgs %d", s.Closed(), len(got))
+	}
+	// 这次不回，到点被踢
+	g.reapIdle(base.Add(75*time.Second), idle)
+	expectPing("second round")
+	g.reapIdle(base.Add(100*time.Second), idle)
+	if !s.Closed() {
+		t.Fatal("idle session not reaped")
+	}
+}
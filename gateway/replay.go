@@ -0,0 +1,38 @@
+package gateway
+
+import (
+	"net"
+	"time"
+)
+
+// discardConn 重放用的假连接，写进去的东西全部丢掉，读直接EOF
+type discardConn struct{}
+
+type replayAddr struct{}
+
+func (replayAddr) Network() string { return "replay" }
+func (replayAddr) String() string  { return "replay" }
+
+func (discardConn) Read([]byte) (int, error)         { return 0, net.ErrClosed }
+func (discardConn) Write(b []byte) (int, error)      { return len(b), nil }
+func (discardConn) Close() error                     { return nil }
+func (discardConn) LocalAddr() net.Addr              { return replayAddr{} }
+func (discardConn) RemoteAddr() net.Addr             { return replayAddr{} }
+func (discardConn) SetDeadline(time.Time) error      { return nil }
+func (discardConn) SetReadDeadline(time.Time) error  { return nil }
+func (discardConn) SetWriteDeadline(time.Time) error { return nil }
+
+// ReplaySession 重放日志时用的session，同一个id返回同一个对象，不会进sessions列表
+func (g *Gateway) ReplaySession(id uint64) *Session {
+	g.m.Lock()
+	defer g.m.Unlock()
+	if g.replaySessions == nil {
+		g.replaySessions = make(map[uint64]*Session)
+	}
+	s, ok := g.replaySessions[id]
+	if !ok {
+		s = newSession(id, discardConn{})
+		g.replaySessions[id] = s
+	}
+	return s
+}
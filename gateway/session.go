@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Session struct {
+	Id         uint64
+	conn       net.Conn
+	lastActive atomic.Int64 // 最后一次收到客户端数据的时间（毫秒）
+	pinged     atomic.Bool  // 已经发过保活ping还没收到回复
+	closed     atomic.Bool
+	sendMu     sync.Mutex
+	client     atomic.Pointer[ClientInfo] // 版本握手的结果，见handshake.go
+	admitted   atomic.Bool                // 排队放行了，见queue.go
+	queuePos   int                        // 上次推给客户端的名次，g.m保护
+	linkMu     sync.Mutex                 // 多进程部署时保证先发open再发info
+	linkOpened bool                       // 已经通知逻辑进程，linkMu保护
+}
+
+func newSession(id uint64, conn net.Conn) *Session {
+	s := &Session{
+		Id:   id,
+		conn: conn,
+	}
+	s.touch()
+	return s
+}
+
+// touch 收到任何数据都算活跃
+func (s *Session) touch() {
+	s.lastActive.Store(time.Now().UnixMilli())
+	s.pinged.Store(false)
+}
+
+func (s *Session) IdleFor(now time.Time) time.Duration {
+	return now.Sub(time.UnixMilli(s.lastActive.Load()))
+}
+
+func (s *Session) RemoteAddr() string {
+	return s.conn.RemoteAddr().String()
+}
+
+func (s *Session) Send(p *Packet) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	_, err := s.conn.Write(encodePacket(p))
+	return err
+}
+
+// Close 可以重复调用，连接关掉之后读循环会退出并把session从管理器里移除
+func (s *Session) Close() {
+	if s.closed.CompareAndSwap(false, true) {
+		s.conn.Close()
+	}
+}
+
+func (s *Session) Closed() bool {
+	return s.closed.Load()
+}
@@ -0,0 +1,124 @@
+package gtime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 服务器时区和通用的时间格式。策划配置、日志、触发器时间统一用Layout，按服务器时区（配置<timezone>）解释，
+// 不要再到处手写"2006-01-02 15:04:05"和time.Local
+
+const (
+	Layout      = "2006-01-02 15:04:05"
+	LayoutMilli = "2006-01-02 15:04:05.000"
+	DateLayout  = "2006-01-02"
+)
+
+var loc atomic.Pointer[time.Location]
+
+// SetTimezone tz是IANA时区名（比如"Asia/Shanghai"），空串或"Local"用机器本地时区。启动时配置加载完调一次
+func SetTimezone(tz string) error {
+	if tz == "" {
+		tz = "Local"
+	}
+	l, err := time.LoadLocation(tz)
+	if err != nil {
+		return err
+	}
+	SetLocation(l)
+	return nil
+}
+
+// SetLocation 传nil恢复成机器本地时区
+func SetLocation(l *time.Location) {
+	loc.Store(l)
+}
+
+// Location 服务器时区，没设置过时是time.Local
+func Location() *time.Location {
+	if l := loc.Load(); l != nil {
+		return l
+	}
+	return time.Local
+}
+
+// Now 当前时间，已经转到服务器时区
+func Now() time.Time {
+	return time.Now().In(Location())
+}
+
+// FormatStandard 按服务器时区格式化成Layout
+func FormatStandard(t time.Time) string {
+	return t.In(Location()).Format(Layout)
+}
+
+// FormatMilli 带毫秒，日志用
+func FormatMilli(t time.Time) string {
+	return t.In(Location()).Format(LayoutMilli)
+}
+
+// FormatDate 服务器时区的日期，按天统计/每日上限这种当key用
+func FormatDate(t time.Time) string {
+	return t.In(Location()).Format(DateLayout)
+}
+
+// Parse 严格按Layout、服务器时区解析
+func Parse(s string) (time.Time, error) {
+	return time.ParseInLocation(Layout, s, Location())
+}
+
+// ParseIn 严格按Layout、指定时区解析，多地区时区见timer/zone.go
+func ParseIn(l *time.Location, s string) (time.Time, error) {
+	return time.ParseInLocation(Layout, s, l)
+}
+
+// 宽松解析依次尝试的格式，不带时区的按服务器时区解释
+var lenientLayouts = []string{
+	Layout,
+	LayoutMilli,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006/01/02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04",
+	DateLayout,
+	"2006/01/02",
+}
+
+// ParseLenient 策划表、GM命令里手填的时间：支持上面几种常见写法，以及秒/毫秒级的unix时间戳（按位数区分）
+func ParseLenient(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if len(s) >= 13 {
+			return time.UnixMilli(n).In(Location()), nil
+		}
+		return time.Unix(n, 0).In(Location()), nil
+	}
+	for _, layout := range lenientLayouts {
+		if t, err := time.ParseInLocation(layout, s, Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("gtime: cannot parse %q as time", s)
+}
+
+// StartOfDay t所在那天服务器时区的0点
+func StartOfDay(t time.Time) time.Time {
+	t = t.In(Location())
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// StartOfWeek t所在那周周一的0点（服务器时区）
+func StartOfWeek(t time.Time) time.Time {
+	d := StartOfDay(t)
+	offset := (int(d.Weekday()) + 6) % 7 // 周一为0
+	return time.Date(d.Year(), d.Month(), d.Day()-offset, 0, 0, 0, 0, d.Location())
+}
+
+// SameDay 服务器时区下是不是同一天
+func SameDay(a, b time.Time) bool {
+	return StartOfDay(a).Equal(StartOfDay(b))
+}
@@ -0,0 +1,56 @@
+package gtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimezone(t *testing.T) {
+	defer SetLocation(nil)
+	if err := SetTimezone("Asia/Shanghai"); err != nil {
+		t.Skip("no tzdata: " + err.Error())
+	}
+	ts := time.Date(2024, 3, 6, 17, 30, 0, 0, time.UTC) // 上海时间3月7日01:30，周四
+	if got := FormatStandard(ts); got != "2024-03-07 01:30:00" {
+		t.Fatalf("FormatStandard = %s", got)
+	}
+	if got := FormatStandard(StartOfDay(ts)); got != "2024-03-07 00:00:00" {
+		t.Fatalf("StartOfDay = %s", got)
+	}
+	if got := FormatStandard(StartOfWeek(ts)); got != "2024-03-04 00:00:00" {
+		t.Fatalf("StartOfWeek = %s", got)
+	}
+	if SameDay(ts, ts.Add(-2*time.Hour)) {
+		t.Fatal("SameDay should split at server midnight")
+	}
+	p, err := Parse("2024-03-07 01:30:00")
+	if err != nil || !p.Equal(ts) {
+		t.Fatalf("Parse = %v, %v", p, err)
+	}
+}
+
+func TestParseLenient(t *testing.T) {
+	defer SetLocation(nil)
+	SetLocation(time.UTC)
+	want := time.Date(2024, 3, 7, 1, 30, 0, 0, time.UTC)
+	for _, s := range []string{
+		"2024-03-07 01:30:00",
+		"2024-03-07T01:30:00",
+		"2024-03-07T09:30:00+08:00",
+		"2024/03/07 01:30:00",
+		" 2024-03-07 01:30 ",
+		"1709775000",
+		"1709775000000",
+	} {
+		got, err := ParseLenient(s)
+		if err != nil || !got.Equal(want) {
+			t.Fatalf("ParseLenient(%q) = %v, %v", s, got, err)
+		}
+	}
+	if got, err := ParseLenient("2024-03-07"); err != nil || !got.Equal(time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("ParseLenient date = %v, %v", got, err)
+	}
+	if _, err := ParseLenient("next tuesday"); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,266 @@
+package inventory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"test/db"
+	"test/tool_gen_code/result"
+	"time"
+)
+
+// 建表语句：
+// CREATE TABLE player_inventory (
+//   player_id BIGINT NOT NULL PRIMARY KEY,
+//   slots BLOB NOT NULL,
+//   update_time BIGINT NOT NULL
+// );
+//
+// 整个背包存一行json，改动只标脏，由DirtySet定时落库
+
+var (
+	ErrUnknownItem = errors.New("item template not found")
+	ErrNotEnough   = errors.New("not enough items")
+	ErrNoBag       = errors.New("bag not loaded")
+)
+
+const defaultCapacity = 100
+
+// Stack 一格道具
+type Stack struct {
+	ItemId int   `json:"item_id"`
+	Count  int32 `json:"count"`
+}
+
+type Bag struct {
+	PlayerId int64
+	Slots    []Stack // 不会有Count为0的格子
+}
+
+// Mailer 背包放不下的道具走邮件，由邮件模块实现
+type Mailer interface {
+	MailItems(playerId int64, items []Stack, reason string) error
+}
+
+type Manager struct {
+	pool     db.Pool
+	capacity int
+	mailer   Mailer
+	bags     map[int64]*Bag
+	dirty    *db.DirtySet[int64]
+}
+
+// NewManager capacity是格子数，<=0用默认100格；mailer为nil时放不下的道具只打日志
+func NewManager(pool db.Pool, capacity int, mailer Mailer) *Manager {
+	if capacity <= 0 {
+		capacity = defaultCapacity
+	}
+	m := &Manager{
+		pool:     pool,
+		capacity: capacity,
+		mailer:   mailer,
+		bags:     make(map[int64]*Bag),
+	}
+	m.dirty = db.NewDirtySet[int64](pool, "inventory", m.saveQuery)
+	return m
+}
+
+// StartFlush 定时落库
+func (m *Manager) StartFlush(interval time.Duration) {
+	m.dirty.StartFlush(interval)
+}
+
+func (m *Manager) saveQuery(playerId int64) *db.SqlQuery {
+	bag, ok := m.bags[playerId]
+	if !ok {
+		return nil
+	}
+	b, err := json.Marshal(bag.Slots)
+	if err != nil {
+		log.Printf("inventory marshal failed, player %d: %s", playerId, err.Error())
+		return nil
+	}
+	return &db.SqlQuery{
+		Stmt: "replace into player_inventory (player_id, slots, update_time) values (?, ?, ?);",
+		Args: []any{playerId, b, time.Now().Unix()},
+	}
+}
+
+// Load 从库里读背包，没有记录的是新玩家，给个空背包。
+// cb在db的Loop goroutine里执行，拿到的bag要回到主循环再Put
+func (m *Manager) Load(playerId int64, cb func(*Bag, error)) error {
+	return m.pool.AddQuery(&db.SqlQuery{
+		Stmt: "select * from player_inventory where player_id = ?;",
+		Args: []any{playerId},
+		CbFunc: func(data []*db.DBData, err error) {
+			if errors.Is(err, db.ErrNoRows) {
+				cb(&Bag{PlayerId: playerId}, nil)
+				return
+			}
+			if err != nil {
+				cb(nil, err)
+				return
+			}
+			bag := &Bag{PlayerId: playerId}
+			if err = json.Unmarshal(data[0].Data["slots"], &bag.Slots); err != nil {
+				cb(nil, err)
+				return
+			}
+			cb(bag, nil)
+		},
+	})
+}
+
+// Put 把Load到的背包挂到管理器上
+func (m *Manager) Put(bag *Bag) {
+	m.bags[bag.PlayerId] = bag
+}
+
+// Unload 玩家下线，先落库再卸载
+func (m *Manager) Unload(playerId int64) {
+	if q := m.saveQuery(playerId); q != nil {
+		q.Priority = db.PriorityHigh
+		q.CbFunc = func(_ []*db.DBData, err error) {
+			if err != nil {
+				log.Printf("inventory save on unload failed, player %d: %s", playerId, err.Error())
+			}
+		}
+		if err := m.pool.AddQuery(q); err != nil {
+			log.Printf("inventory save on unload failed, player %d: %s", playerId, err.Error())
+		}
+	}
+	delete(m.bags, playerId)
+}
+
+func (m *Manager) Bag(playerId int64) *Bag {
+	return m.bags[playerId]
+}
+
+func maxStack(itemId int) (int32, error) {
+	tpl := result.GetItemById(itemId)
+	if tpl == nil {
+		return 0, fmt.Errorf("%w: %d", ErrUnknownItem, itemId)
+	}
+	if tpl.MaxStack <= 0 {
+		return 1, nil
+	}
+	return tpl.MaxStack, nil
+}
+
+// Count 背包里某种道具的总数
+func (m *Manager) Count(playerId int64, itemId int) int32 {
+	bag, ok := m.bags[playerId]
+	if !ok {
+		return 0
+	}
+	var n int32
+	for _, s := range bag.Slots {
+		if s.ItemId == itemId {
+			n += s.Count
+		}
+	}
+	return n
+}
+
+// Add 先叠到已有的格子，再占空格子，还放不下的发邮件，返回走了邮件的数量
+func (m *Manager) Add(playerId int64, itemId int, count int32, reason string) (mailed int32, err error) {
+	bag, ok := m.bags[playerId]
+	if !ok {
+		return 0, ErrNoBag
+	}
+	if count <= 0 {
+		return 0, nil
+	}
+	limit, err := maxStack(itemId)
+	if err != nil {
+		return 0, err
+	}
+	left := count
+	for i := range bag.Slots {
+		if left == 0 {
+			break
+		}
+		s := &bag.Slots[i]
+		if s.ItemId != itemId || s.Count >= limit {
+			continue
+		}
+		n := limit - s.Count
+		if n > left {
+			n = left
+		}
+		s.Count += n
+		left -= n
+	}
+	for left > 0 && len(bag.Slots) < m.capacity {
+		n := limit
+		if n > left {
+			n = left
+		}
+		bag.Slots = append(bag.Slots, Stack{ItemId: itemId, Count: n})
+		left -= n
+	}
+	if left < count {
+		m.dirty.Mark(playerId)
+	}
+	if left > 0 {
+		m.overflow(playerId, itemId, left, limit, reason)
+	}
+	return left, nil
+}
+
+// overflow 放不下的按堆叠上限拆成多份附件
+func (m *Manager) overflow(playerId int64, itemId int, count int32, limit int32, reason string) {
+	var items []Stack
+	for count > 0 {
+		n := limit
+		if n > count {
+			n = count
+		}
+		items = append(items, Stack{ItemId: itemId, Count: n})
+		count -= n
+	}
+	if m.mailer == nil {
+		log.Printf("inventory full and no mailer, player %d lost items %v, reason %s", playerId, items, reason)
+		return
+	}
+	if err := m.mailer.MailItems(playerId, items, reason); err != nil {
+		log.Printf("inventory overflow mail failed, player %d items %v reason %s: %s", playerId, items, reason, err.Error())
+	}
+}
+
+// Remove 数量不够时整体失败，不会扣一半。从后往前扣
+func (m *Manager) Remove(playerId int64, itemId int, count int32) error {
+	bag, ok := m.bags[playerId]
+	if !ok {
+		return ErrNoBag
+	}
+	if count <= 0 {
+		return nil
+	}
+	if m.Count(playerId, itemId) < count {
+		return ErrNotEnough
+	}
+	left := count
+	for i := len(bag.Slots) - 1; i >= 0 && left > 0; i-- {
+		s := &bag.Slots[i]
+		if s.ItemId != itemId {
+			continue
+		}
+		n := s.Count
+		if n > left {
+			n = left
+		}
+		s.Count -= n
+		left -= n
+	}
+	slots := bag.Slots[:0]
+	for _, s := range bag.Slots {
+		if s.Count > 0 {
+			slots = append(slots, s)
+		}
+	}
+	bag.Slots = slots
+	m.dirty.Mark(playerId)
+	return nil
+}
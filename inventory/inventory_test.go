@@ -0,0 +1,131 @@
+package inventory
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"test/db"
+	"test/offline"
+	"test/tool_gen_code/result"
+	"testing"
+)
+
+const (
+	potion = 1001 // 一格叠10个
+	sword  = 1002 // 不能叠
+)
+
+func loadItems(t *testing.T) {
+	if err := result.LoadItem([]*result.Item{
+		{Id: potion, Name: "potion", MaxStack: 10},
+		{Id: sword, Name: "sword", MaxStack: 1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestManager(t *testing.T, capacity int, mailer Mailer) *Manager {
+	loadItems(t)
+	m := NewManager(db.NewFakePool(), capacity, mailer)
+	if err := m.Load(1, func(bag *Bag, err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Put(bag)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestAddStack(t *testing.T) {
+	m := newTestManager(t, 10, nil)
+	if _, err := m.Add(1, potion, 7, "test"); err != nil {
+		t.Fatal(err)
+	}
+	// 先把第一格叠满，剩下的占新格子
+	if _, err := m.Add(1, potion, 15, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Add(1, sword, 2, "test"); err != nil {
+		t.Fatal(err)
+	}
+	want := []Stack{{potion, 10}, {potion, 10}, {potion, 2}, {sword, 1}, {sword, 1}}
+	if got := m.Bag(1).Slots; !reflect.DeepEqual(got, want) {
+		t.Fatalf("slots %v, want %v", got, want)
+	}
+	if m.Count(1, potion) != 22 {
+		t.Fatalf("count = %d", m.Count(1, potion))
+	}
+	if _, err := m.Add(1, 9999, 1, "test"); !errors.Is(err, ErrUnknownItem) {
+		t.Fatalf("unknown item err = %v", err)
+	}
+	if _, err := m.Add(2, potion, 1, "test"); !errors.Is(err, ErrNoBag) {
+		t.Fatalf("unloaded bag err = %v", err)
+	}
+}
+
+type fakeMailer struct {
+	mails [][]Stack
+}
+
+func (f *fakeMailer) MailItems(_ int64, items []Stack, _ string) error {
+	f.mails = append(f.mails, items)
+	return nil
+}
+
+func TestAddOverflowToMail(t *testing.T) {
+	mailer := &fakeMailer{}
+	m := newTestManager(t, 2, mailer)
+	m.Add(1, sword, 1, "test")
+	// 剩1格叠10个，多出来的25个按堆叠上限拆成几份附件
+	mailed, err := m.Add(1, potion, 35, "quest")
+	if err != nil || mailed != 25 {
+		t.Fatalf("mailed = %d, %v", mailed, err)
+	}
+	if want := []Stack{{sword, 1}, {potion, 10}}; !reflect.DeepEqual(m.Bag(1).Slots, want) {
+		t.Fatalf("slots %v", m.Bag(1).Slots)
+	}
+	if want := [][]Stack{{{potion, 10}, {potion, 10}, {potion, 5}}}; !reflect.DeepEqual(mailer.mails, want) {
+		t.Fatalf("mails %v", mailer.mails)
+	}
+}
+
+func TestOfflineMailer(t *testing.T) {
+	pool := db.NewFakePool()
+	mailer := &OfflineMailer{Store: offline.NewStore(pool, 0), MsgType: 7}
+	m := newTestManager(t, 1, mailer)
+	m.Add(1, sword, 2, "shop")
+	rows := pool.Table("offline_msg")
+	if len(rows) != 1 || rows[0].String("player_id") != "1" || rows[0].String("msg_type") != "7" {
+		t.Fatalf("offline rows %v", rows)
+	}
+	var mail itemMail
+	if err := json.Unmarshal(rows[0].Data["payload"], &mail); err != nil {
+		t.Fatal(err)
+	}
+	if mail.Reason != "shop" || !reflect.DeepEqual(mail.Items, []Stack{{sword, 1}}) {
+		t.Fatalf("mail %+v", mail)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	m := newTestManager(t, 10, nil)
+	m.Add(1, potion, 25, "test")
+	m.Add(1, sword, 1, "test")
+	before := append([]Stack(nil), m.Bag(1).Slots...)
+	// 不够时整体失败，背包不变
+	if err := m.Remove(1, potion, 26); !errors.Is(err, ErrNotEnough) {
+		t.Fatalf("remove err = %v", err)
+	}
+	if !reflect.DeepEqual(m.Bag(1).Slots, before) {
+		t.Fatalf("failed remove changed bag: %v", m.Bag(1).Slots)
+	}
+	// 从后往前扣，扣空的格子去掉
+	if err := m.Remove(1, potion, 8); err != nil {
+		t.Fatal(err)
+	}
+	if want := []Stack{{potion, 10}, {potion, 7}, {sword, 1}}; !reflect.DeepEqual(m.Bag(1).Slots, want) {
+		t.Fatalf("slots %v", m.Bag(1).Slots)
+	}
+}
@@ -0,0 +1,25 @@
+package inventory
+
+import (
+	"encoding/json"
+	"test/offline"
+)
+
+// OfflineMailer 还没有正式的邮件模块，先把附件当离线消息存起来，玩家登录时由邮件逻辑取出
+type OfflineMailer struct {
+	Store   *offline.Store
+	MsgType int32 // 业务约定的"道具邮件"消息类型
+}
+
+type itemMail struct {
+	Reason string  `json:"reason"`
+	Items  []Stack `json:"items"`
+}
+
+func (o *OfflineMailer) MailItems(playerId int64, items []Stack, reason string) error {
+	b, err := json.Marshal(&itemMail{Reason: reason, Items: items})
+	if err != nil {
+		return err
+	}
+	return o.Store.Push(playerId, o.MsgType, b)
+}
@@ -0,0 +1,118 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// 命令日志：把所有进到主循环的输入（客户端消息、timer触发）按顺序记下来，
+// 线上出了问题把文件拷回本地用-replay喂回分发器，就能按原顺序重放一遍
+
+type Kind string
+
+const (
+	KindMsg   Kind = "msg"
+	KindTimer Kind = "timer"
+)
+
+// Entry 一行一条，json格式
+type Entry struct {
+	At     int64  `json:"at"` // 记录时间，毫秒
+	Kind   Kind   `json:"kind"`
+	SessId uint64 `json:"sess_id,omitempty"`
+	MsgId  uint16 `json:"msg_id,omitempty"`
+	Body   []byte `json:"body,omitempty"`
+	Name   string `json:"name,omitempty"`    // 触发器名
+	FireAt int64  `json:"fire_at,omitempty"` // 触发器的触发时间（秒）
+}
+
+type Recorder struct {
+	m   sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// Open 追加模式打开日志文件
+func Open(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &Recorder{
+		f:   f,
+		w:   w,
+		enc: json.NewEncoder(w),
+	}, nil
+}
+
+func (r *Recorder) write(e *Entry) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	e.At = time.Now().UnixMilli()
+	if err := r.enc.Encode(e); err != nil {
+		fmt.Println("journal write error: " + err.Error())
+	}
+}
+
+func (r *Recorder) RecordMsg(sessId uint64, msgId uint16, body []byte) {
+	r.write(&Entry{Kind: KindMsg, SessId: sessId, MsgId: msgId, Body: body})
+}
+
+func (r *Recorder) RecordTimer(name string, fireAt int64) {
+	r.write(&Entry{Kind: KindTimer, Name: name, FireAt: fireAt})
+}
+
+// Flush 主循环每个tick调一次就行，不用每条都落盘
+func (r *Recorder) Flush() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.w.Flush()
+}
+
+func (r *Recorder) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	return r.f.Close()
+}
+
+// Dispatcher 重放时的分发目标，主程序实现
+type Dispatcher interface {
+	DispatchMsg(e *Entry)
+	FireTimer(e *Entry)
+}
+
+// Replay 按记录顺序把日志喂给d，返回重放了多少条
+func Replay(path string, d Dispatcher) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	n := 0
+	for dec.More() {
+		e := &Entry{}
+		if err = dec.Decode(e); err != nil {
+			return n, fmt.Errorf("journal replay decode error at entry %d: %w", n+1, err)
+		}
+		switch e.Kind {
+		case KindMsg:
+			d.DispatchMsg(e)
+		case KindTimer:
+			d.FireTimer(e)
+		default:
+			return n, fmt.Errorf("journal replay error: unknown kind %s at entry %d", e.Kind, n+1)
+		}
+		n++
+	}
+	return n, nil
+}
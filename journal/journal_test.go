@@ -0,0 +1,85 @@
+package journal
+
+import (
+	"fmt"
+	"strings"
+	"test/gateway"
+	"test/timer"
+	"testing"
+	"time"
+)
+
+// world 一套分发目标：网关handler和timer回调都按到达顺序记到log里
+type world struct {
+	g   *gateway.Gateway
+	sim *timer.Simulator
+	log []string
+}
+
+func newWorld(base time.Time) *world {
+	w := &world{g: gateway.NewGateway(), sim: timer.NewSimulator(base)}
+	w.g.RegisterHandler(100, func(s *gateway.Session, body []byte) {
+		w.log = append(w.log, fmt.Sprintf("msg %d %s", s.Id, body))
+	})
+	// t2、t3在同一秒，按注册顺序触发
+	for _, tr := range []struct {
+		name string
+		sec  int
+	}{{"t1", 1}, {"t2", 3}, {"t3", 3}} {
+		name := tr.name
+		w.sim.Push(base.Add(time.Duration(tr.sec)*time.Second), timer.Trigger{Name: name, Fun: func(int64, interface{}) { w.log = append(w.log, "timer "+name) }})
+	}
+	return w
+}
+
+func (w *world) DispatchMsg(e *Entry) {
+	w.g.Dispatch(&gateway.Message{
+		Sess:   w.g.ReplaySession(e.SessId),
+		Packet: &gateway.Packet{MsgId: e.MsgId, Body: e.Body},
+	})
+}
+
+func (w *world) FireTimer(e *Entry) {
+	w.sim.TriggerUntil(e.FireAt)
+}
+
+func TestReplayOrder(t *testing.T) {
+	path := t.TempDir() + "/cmd.journal"
+	rec, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	live := newWorld(base)
+	live.g.SetDispatchHook(func(msg *gateway.Message) {
+		rec.RecordMsg(msg.Sess.Id, msg.Packet.MsgId, msg.Packet.Body)
+	})
+	live.sim.SetFireHook(func(trigger timer.Trigger) {
+		rec.RecordTimer(trigger.Name, trigger.Now)
+	})
+	send := func(sessId uint64, body string) {
+		live.DispatchMsg(&Entry{SessId: sessId, MsgId: 100, Body: []byte(body)})
+	}
+	send(1, "a")
+	live.sim.Advance(time.Second)
+	send(2, "b")
+	send(1, "c")
+	live.sim.Advance(2 * time.Second)
+	send(2, "d")
+	if err = rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay := newWorld(base)
+	n, err := Replay(path, replay)
+	if err != nil || n != 7 {
+		t.Fatalf("replay = %d %v", n, err)
+	}
+	want := "msg 1 a|timer t1|msg 2 b|msg 1 c|timer t2|timer t3|msg 2 d"
+	if got := strings.Join(live.log, "|"); got != want {
+		t.Fatalf("live order %s", got)
+	}
+	if got := strings.Join(replay.log, "|"); got != want {
+		t.Fatalf("replay order %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"test/wg"
+	"time"
+)
+
+// 别的goroutine（admin接口等）要读写主循环的数据时，把函数丢到主循环里执行，不用给各模块加锁
+var loopCalls = make(chan func(), 64)
+
+var errLoopBusy = errors.New("main loop did not respond in time")
+
+// runOnLoop 在主循环goroutine里执行f并等它跑完，主循环卡住或者已经退出时超时返回
+func runOnLoop(f func(), timeout time.Duration) error {
+	done := make(chan struct{})
+	call := func() {
+		f()
+		close(done)
+	}
+	tm := time.NewTimer(timeout)
+	defer tm.Stop()
+	select {
+	case loopCalls <- call:
+	case <-tm.C:
+		return errLoopBusy
+	}
+	select {
+	case <-done:
+		return nil
+	case <-tm.C:
+		return errLoopBusy
+	}
+}
+
+// postOnLoop 把f丢给主循环执行，不等它跑完。主循环忙时排队等着，停服后返回false（f不会执行）。
+// 给wg.HTTPDo这种异步回调用
+func postOnLoop(f func()) bool {
+	select {
+	case loopCalls <- f:
+		return true
+	case <-wg.ShutdownCtx().Done():
+		return false
+	}
+}
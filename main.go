@@ -1,44 +1,115 @@
 package main
 
 import (
-	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"test/admin"
+	"test/audit"
+	"test/backup"
 	"test/db"
+	"test/discovery"
+	"test/flags"
+	"test/gateway"
+	"test/gtime"
+	"test/metrics"
 	"test/timer"
 	"test/tool_gen_code"
+	"test/wg"
 	"time"
 )
 
-type ServerConf struct {
-	MysqlConf *db.MysqlConf `xml:"mysql" json:"mysql"`
-}
-
 func main() {
-	if err := tool_gen_code.Gen(); err != nil {
+	allowBreaking := flag.Bool("allow-breaking", false, "allow tool_gen_code to remove or retype generated fields")
+	genStamp := flag.Bool("gen-stamp", false, "stamp tool_gen_code/result with the chart.xlsx hash and build time, reported by /conf/version")
+	journalPath := flag.String("journal", "", "record inbound messages and timer firings to this file")
+	replayPath := flag.String("replay", "", "replay a command journal file and exit")
+	daemon := flag.Bool("daemon", false, "run in background, write pid file and redirect output to log dir")
+	stop := flag.Bool("stop", false, "send SIGTERM to the server recorded in the pid file and wait for it to exit")
+	pidFile := flag.String("pid", "server.pid", "pid file for -daemon and -stop")
+	logDir := flag.String("log-dir", "logs", "log dir for -daemon")
+	backupList := flag.Bool("backup-list", false, "print backups in the configured backup store and exit")
+	encryptSecret := flag.Bool("encrypt-secret", false, "read a secret from stdin, encrypt it with the key in $"+db.DefaultSecretKeyEnv+" and print the blob for password_encrypted")
+	role := flag.String("role", roleAll, "process role: all (single process), gateway (client connections only) or game (game logic only)")
+	backupRestore := flag.String("backup-restore", "", "restore state from this backup (or \"latest\") before opening the gateway")
+	safeMode := flag.Bool("safe-mode", false, "start in safe mode: gateway closed, db read only, admin api only")
+	crashStatePath := flag.String("crash-state", "crash_state.json", "state file for crash-loop detection")
+	flag.Parse()
+	if *encryptSecret {
+		os.Exit(runEncryptSecret())
+	}
+	if *stop {
+		os.Exit(stopDaemon(*pidFile))
+	}
+	if *daemon && !isDaemonChild() {
+		if err := startDaemon(*pidFile, *logDir); err != nil {
+			fmt.Fprintf(os.Stderr, "start daemon failed: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if *daemon {
+		if err := writePidFile(*pidFile); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		defer removePidFile(*pidFile)
+		startLogRotate(*logDir)
+	}
+	conf := mustLoadConf("configs/main_conf.xml", *role)
+	if err := gtime.SetTimezone(conf.Timezone); err != nil {
 		panic(err)
 	}
-	confFile, err := os.ReadFile("configs/main_conf.xml")
-	if err != nil {
-		panic(fmt.Sprintf("Server start failed in read config: %s", err.Error()))
+	// 导出备份列表、回放这种工具用法不算运行
+	if !*backupList && *replayPath == "" {
+		runTracker = beginRun(*crashStatePath, conf.CrashLoop, *safeMode, time.Now())
 	}
-	conf := &ServerConf{}
-	err = xml.Unmarshal(confFile, conf)
-	if err != nil {
-		panic(fmt.Sprintf("Server start failed in main_conf.xml unmarshal error: %s", err.Error()))
+	if err := tool_gen_code.Gen(&tool_gen_code.GenOptions{AllowBreaking: *allowBreaking, Stamp: *genStamp}); err != nil {
+		panic(err)
+	}
+	timer.GetInst().SetMaxJump(time.Duration(conf.TimerMaxJumpSec) * time.Second)
+	timer.GetInst().SetLimit(conf.TimerLimit)
+	metrics.GetTickBudget().SetThreshold(time.Duration(conf.TickBudgetMs) * time.Millisecond)
+	wg.SetLoopPoster(postOnLoop)
+	admin.GetInst().SetStage(admin.StageConfigLoaded)
+	// admin最先开，启动过程中/healthz、/readyz就能访问，编排系统能看到卡在哪一步
+	if conf.AdminConf != nil && *replayPath == "" {
+		registerAdminHandlers()
+		if err := admin.GetInst().Start(conf.AdminConf); err != nil {
+			panic(fmt.Sprintf("Server start failed in admin listen: %s", err.Error()))
+		}
+		defer admin.GetInst().Stop()
 	}
 	db.GetDbPool().InitMysqlPool(conf.MysqlConf)
+	if inSafeMode() {
+		db.GetDbPool().SetReadOnly(true)
+	}
+	if err := audit.GetInst().Open(conf.AuditFile, db.GetDbPool()); err != nil {
+		panic(fmt.Sprintf("Server start failed in open audit log: %s", err.Error()))
+	}
+	defer audit.GetInst().Close()
 	defer db.GetDbPool().ReleaseMysqlPool()
 	go db.GetDbPool().Loop()
+	db.GetAnalytics().Start(db.GetDbPool(), db.AnalyticsOptions{SpoolDir: "analytics_spool"})
+	defer db.GetAnalytics().Stop()
+	defer handleCrash()
+	if db.GetDbPool().Inited {
+		admin.GetInst().SetStage(admin.StageDbConnected)
+	}
 
-	go db.GetDbPool().AddQuery(&db.SqlQuery{
+	err := db.GetDbPool().AddQuery(&db.SqlQuery{
 		FcId: 1,
 		Stmt: "select * from test_table where id = ?;",
 		Args: []any{1},
 		CbFunc: func(data []*db.DBData, err error) {
+			if errors.Is(err, db.ErrNoRows) {
+				log.Println("test_table has no row with id = 1")
+				return
+			}
 			if err != nil {
 				log.Println(err.Error())
 				return
@@ -46,7 +117,78 @@ func main() {
 			log.Printf("%v", data[0].Data)
 		},
 	})
+	if err != nil {
+		log.Printf("add query failed: %s", err.Error())
+	}
+	// 网关进程没有需要备份的状态
+	if conf.BackupConf != nil && *role != roleGateway {
+		if err = backup.GetInst().Open(conf.BackupConf); err != nil {
+			panic(fmt.Sprintf("Server start failed in open backup store: %s", err.Error()))
+		}
+		registerBackupSources()
+	}
+	if *backupList {
+		names, err := backup.GetInst().List()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		for _, n := range names {
+			fmt.Println(n)
+		}
+		return
+	}
+	if *replayPath != "" {
+		runReplay(*replayPath)
+		return
+	}
+	if *journalPath != "" {
+		if err = startJournal(*journalPath); err != nil {
+			panic(fmt.Sprintf("Server start failed in open journal: %s", err.Error()))
+		}
+		defer stopJournal()
+	}
+	if conf.FlagsFile != "" {
+		if err = flags.GetInst().Load(conf.FlagsFile); err != nil {
+			panic(fmt.Sprintf("Server start failed in load feature flags: %s", err.Error()))
+		}
+		flags.GetInst().StartWatch(10 * time.Second)
+	}
+	banList := gateway.NewBanList(db.GetDbPool())
+	if err = banList.Load(); err != nil {
+		log.Printf("load ip ban list failed, start with empty list: %s", err.Error())
+	}
+	gateway.GetInst().SetBanList(banList)
+	if inSafeMode() {
+		serveSafeMode(conf.AdminConf != nil)
+		return
+	}
+	if *backupRestore != "" {
+		restored, err := backup.GetInst().Restore(*backupRestore)
+		if err != nil {
+			panic(fmt.Sprintf("Server start failed in restore backup: %s", err.Error()))
+		}
+		log.Printf("backup %s restored: %v", *backupRestore, restored)
+	}
+	backup.GetInst().Start()
+	admin.GetInst().Handle("/gateway/bans", banList.HTTPHandler())
+	admin.GetInst().SetStage(admin.StageCachesWarmed)
+	if err = startGateway(*role, conf.GatewayConf, conf.DiscoveryConf != nil); err != nil {
+		panic(fmt.Sprintf("Server start failed in gateway listen: %s", err.Error()))
+	}
+	defer gateway.GetInst().Stop()
+	if conf.DiscoveryConf != nil {
+		if err = startDiscovery(*role, conf); err != nil {
+			panic(fmt.Sprintf("Server start failed in discovery register: %s", err.Error()))
+		}
+		defer discovery.GetInst().Stop()
+		if *role != roleGateway {
+			startJobLock()
+		}
+	}
+	admin.GetInst().SetStage(admin.StageListenersOpen)
 	Loop()
+	runTracker.endRun(true, "")
 }
 
 func Loop() {
@@ -57,7 +199,8 @@ func Loop() {
 	// SIGINT(interrupt): kill -2 非守护进程模式下敲ctrl+C属于此列。
 	// SIGKILL(kill): kill -9 没有遗言的强杀（捕捉不到的信号，进程直接寄，下面receive signal日志都不会打印，所以在notify里注册也没什么用，可以不写）。不要乱用。Goland的停止按钮疑似SIGKILL（debug没抓到）
 	// SIGTERM(terminate): kill -15 有遗言的退出。kill命令默认值，外部一般发这个指令杀进程（所以上面notify要指定SIGTERM）。
-	tk := time.NewTicker(1 * time.Second)
+	// -daemon启动的话用 ./test -stop 停服，它会按pid文件发SIGTERM并等进程退出，不用再手动找pid
+	tk := timer.NewAlignedTicker(1 * time.Second) // 对齐整秒，秒级触发器不会晚将近1秒
 	defer tk.Stop()
 	looping := true
 	for looping {
@@ -68,14 +211,33 @@ func Loop() {
 				continue
 			}
 			log.Printf("receive signal %v, exit program", sig.String())
+			admin.GetInst().SetStage(admin.StageStopping)
+			wg.Shutdown("signal", sig.String())
 			looping = false
 			close(c)
 		case t, ok := <-tk.C:
 			if !ok {
 				continue
 			}
-			fmt.Printf("now: %s\n", t.Format("2006-01-02 15:04:05.000"))
-			timer.GetInst().Trigger(t.Format("2006-01-02 15:04:05"))
+			fmt.Printf("now: %s\n", gtime.FormatMilli(t))
+			metrics.GetTickBudget().Tick(t)
+			if inSafeMode() {
+				continue
+			}
+			timer.GetInst().Tick(time.Now())
+			timer.GetKeyed().Fire(t)
+			if journalRec != nil {
+				journalRec.Flush()
+			}
+		case <-timer.GetInst().Kicked():
+			// 有触发器要马上执行，不等下一秒打点
+			if !inSafeMode() {
+				metrics.GetTickBudget().Measure("timer.kick", func() { timer.GetInst().Tick(time.Now()) })
+			}
+		case msg := <-gateway.GetInst().Recv():
+			metrics.GetTickBudget().Measure(fmt.Sprintf("msg.%d", msg.Packet.MsgId), func() { gateway.GetInst().Dispatch(msg) })
+		case f := <-loopCalls:
+			metrics.GetTickBudget().Measure("loop_call", f)
 		}
 	}
 }
@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 主循环耗时预算：主循环每个tick（两次整秒打点之间）里执行的消息handler、触发器回调、loop call都按名字记下耗时，
+// tick结束时汇总成一份报告，总耗时超过阈值就把最耗时的几项打出来，方便找是谁把主循环卡住了。
+// 只在主循环里Tick/Observe，锁只是为了admin接口能从别的goroutine读报告
+
+const (
+	defaultBudgetThreshold = 200 * time.Millisecond
+	defaultBudgetTopN      = 5
+	maxSlowTickReports     = 20
+)
+
+type BudgetEntry struct {
+	Name  string        `json:"name"`
+	Count int           `json:"count"`
+	Cost  time.Duration `json:"cost"`
+	Max   time.Duration `json:"max"`
+}
+
+// TickReport 一个tick的耗时汇总，Top按Cost从大到小
+type TickReport struct {
+	Start time.Time     `json:"start"`
+	Busy  time.Duration `json:"busy"` // 所有记录项的耗时之和
+	Count int           `json:"count"`
+	Top   []BudgetEntry `json:"top"`
+}
+
+func (r *TickReport) String() string {
+	parts := make([]string, 0, len(r.Top))
+	for _, e := range r.Top {
+		parts = append(parts, fmt.Sprintf("%s x%d %v (max %v)", e.Name, e.Count, e.Cost, e.Max))
+	}
+	return fmt.Sprintf("busy %v in %d calls, top: %s", r.Busy, r.Count, strings.Join(parts, ", "))
+}
+
+type TickBudget struct {
+	m         sync.Mutex
+	threshold time.Duration
+	topN      int
+	start     time.Time
+	entries   map[string]*BudgetEntry
+	busy      time.Duration
+	count     int
+	slow      []*TickReport // 最近超预算的tick，旧的在前
+	slowTicks int64
+}
+
+func NewTickBudget() *TickBudget {
+	return &TickBudget{
+		threshold: defaultBudgetThreshold,
+		topN:      defaultBudgetTopN,
+		entries:   make(map[string]*BudgetEntry),
+	}
+}
+
+var budget = NewTickBudget()
+
+func GetTickBudget() *TickBudget {
+	return budget
+}
+
+// SetThreshold d<=0用默认的200ms
+func (b *TickBudget) SetThreshold(d time.Duration) {
+	if d <= 0 {
+		d = defaultBudgetThreshold
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.threshold = d
+}
+
+// Observe 记一次耗时，name建议带上类别前缀，比如 msg.1001 、timer.daily_reset
+func (b *TickBudget) Observe(name string, cost time.Duration) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	e, ok := b.entries[name]
+	if !ok {
+		e = &BudgetEntry{Name: name}
+		b.entries[name] = e
+	}
+	e.Count++
+	e.Cost += cost
+	if cost > e.Max {
+		e.Max = cost
+	}
+	b.busy += cost
+	b.count++
+}
+
+// Measure 执行f并记到name下
+func (b *TickBudget) Measure(name string, f func()) {
+	start := time.Now()
+	f()
+	b.Observe(name, time.Since(start))
+}
+
+// Tick 结束上一个tick并开始新的，主循环每次整秒打点时调。上一个tick超预算时打日志并返回报告，否则返回nil
+func (b *TickBudget) Tick(now time.Time) *TickReport {
+	b.m.Lock()
+	defer b.m.Unlock()
+	var report *TickReport
+	if !b.start.IsZero() {
+		GetHistogram("loop.tick.busy").Observe(b.busy)
+		if b.busy >= b.threshold {
+			report = b.report()
+			b.slowTicks++
+			b.slow = append(b.slow, report)
+			if len(b.slow) > maxSlowTickReports {
+				b.slow = b.slow[1:]
+			}
+			GetCounter("loop.tick.slow").Inc()
+			log.Printf("main loop tick %s over budget %v: %s", b.start.Format("15:04:05"), b.threshold, report.String())
+		}
+	}
+	b.start = now
+	b.entries = make(map[string]*BudgetEntry)
+	b.busy = 0
+	b.count = 0
+	return report
+}
+
+// report 调用方持有锁
+func (b *TickBudget) report() *TickReport {
+	r := &TickReport{Start: b.start, Busy: b.busy, Count: b.count}
+	for _, e := range b.entries {
+		r.Top = append(r.Top, *e)
+	}
+	sort.Slice(r.Top, func(i, j int) bool {
+		if r.Top[i].Cost != r.Top[j].Cost {
+			return r.Top[i].Cost > r.Top[j].Cost
+		}
+		return r.Top[i].Name < r.Top[j].Name
+	})
+	if len(r.Top) > b.topN {
+		r.Top = r.Top[:b.topN]
+	}
+	return r
+}
+
+// Current 当前tick到目前为止的汇总
+func (b *TickBudget) Current() *TickReport {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.report()
+}
+
+// SlowTicks 最近超预算的tick报告（旧的在前）和累计超预算次数
+func (b *TickBudget) SlowTicks() ([]*TickReport, int64) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return append([]*TickReport(nil), b.slow...), b.slowTicks
+}
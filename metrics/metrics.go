@@ -0,0 +1,189 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 进程内的简易指标，不依赖prometheus之类的外部库。
+// 指标名用点分隔，比如 timer.callback.daily_reset ，各模块自己拼名字，第一次Get的时候自动创建
+
+type Counter struct {
+	v atomic.Int64
+}
+
+func (c *Counter) Add(n int64) {
+	c.v.Add(n)
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+func (c *Counter) Value() int64 {
+	return c.v.Load()
+}
+
+type Gauge struct {
+	v atomic.Int64
+}
+
+func (g *Gauge) Set(n int64) {
+	g.v.Store(n)
+}
+
+func (g *Gauge) Add(n int64) {
+	g.v.Add(n)
+}
+
+func (g *Gauge) Value() int64 {
+	return g.v.Load()
+}
+
+// Histogram 只记次数、总耗时、最大耗时，够看平均值和毛刺了
+type Histogram struct {
+	m     sync.Mutex
+	count int64
+	sum   time.Duration
+	max   time.Duration
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+type HistogramValue struct {
+	Count int64
+	Sum   time.Duration
+	Avg   time.Duration
+	Max   time.Duration
+}
+
+func (h *Histogram) Value() HistogramValue {
+	h.m.Lock()
+	defer h.m.Unlock()
+	ret := HistogramValue{Count: h.count, Sum: h.sum, Max: h.max}
+	if h.count > 0 {
+		ret.Avg = h.sum / time.Duration(h.count)
+	}
+	return ret
+}
+
+type Registry struct {
+	m          sync.Mutex
+	counters   map[string]*Counter
+	gauges     map[string]*Gauge
+	histograms map[string]*Histogram
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		counters:   make(map[string]*Counter),
+		gauges:     make(map[string]*Gauge),
+		histograms: make(map[string]*Histogram),
+	}
+}
+
+func (r *Registry) Counter(name string) *Counter {
+	r.m.Lock()
+	defer r.m.Unlock()
+	c, ok := r.counters[name]
+	if !ok {
+		c = &Counter{}
+		r.counters[name] = c
+	}
+	return c
+}
+
+func (r *Registry) Gauge(name string) *Gauge {
+	r.m.Lock()
+	defer r.m.Unlock()
+	g, ok := r.gauges[name]
+	if !ok {
+		g = &Gauge{}
+		r.gauges[name] = g
+	}
+	return g
+}
+
+func (r *Registry) Histogram(name string) *Histogram {
+	r.m.Lock()
+	defer r.m.Unlock()
+	h, ok := r.histograms[name]
+	if !ok {
+		h = &Histogram{}
+		r.histograms[name] = h
+	}
+	return h
+}
+
+// Snapshot 所有指标当前值，给日志/admin接口输出用
+type Snapshot struct {
+	Counters   map[string]int64
+	Gauges     map[string]int64
+	Histograms map[string]HistogramValue
+}
+
+func (r *Registry) Snapshot() *Snapshot {
+	r.m.Lock()
+	defer r.m.Unlock()
+	s := &Snapshot{
+		Counters:   make(map[string]int64, len(r.counters)),
+		Gauges:     make(map[string]int64, len(r.gauges)),
+		Histograms: make(map[string]HistogramValue, len(r.histograms)),
+	}
+	for k, v := range r.counters {
+		s.Counters[k] = v.Value()
+	}
+	for k, v := range r.gauges {
+		s.Gauges[k] = v.Value()
+	}
+	for k, v := range r.histograms {
+		s.Histograms[k] = v.Value()
+	}
+	return s
+}
+
+// Names 所有已注册的指标名（排序后），调试用
+func (r *Registry) Names() []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+	var ret []string
+	for k := range r.counters {
+		ret = append(ret, k)
+	}
+	for k := range r.gauges {
+		ret = append(ret, k)
+	}
+	for k := range r.histograms {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+var reg = NewRegistry()
+
+func GetInst() *Registry {
+	return reg
+}
+
+func GetCounter(name string) *Counter {
+	return reg.Counter(name)
+}
+
+func GetGauge(name string) *Gauge {
+	return reg.Gauge(name)
+}
+
+func GetHistogram(name string) *Histogram {
+	return reg.Histogram(name)
+}
@@ -0,0 +1,139 @@
+package offline
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync/atomic"
+	"test/db"
+	"test/timer"
+	"time"
+)
+
+// 建表语句：
+// CREATE TABLE offline_msg (
+//   msg_id BIGINT NOT NULL PRIMARY KEY,
+//   player_id BIGINT NOT NULL,
+//   msg_type INT NOT NULL,
+//   payload BLOB,
+//   create_time BIGINT NOT NULL,
+//   expire_time BIGINT NOT NULL,
+//   KEY idx_player (player_id),
+//   KEY idx_expire (expire_time)
+// );
+
+const defaultTTL = 7 * 24 * time.Hour
+
+// Msg 一条离线消息，Payload由业务自己序列化（比如邮件通知、排行榜奖励的protobuf）
+type Msg struct {
+	MsgId      int64
+	PlayerId   int64
+	MsgType    int32
+	Payload    []byte
+	CreateTime int64
+	ExpireTime int64
+}
+
+type Store struct {
+	pool db.Pool
+	ttl  time.Duration
+	seq  atomic.Int64
+}
+
+// NewStore ttl<=0时用默认的7天
+func NewStore(pool db.Pool, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &Store{
+		pool: pool,
+		ttl:  ttl,
+	}
+}
+
+// nextMsgId 毫秒时间戳左移+进程内序号，单进程内不重复
+func (s *Store) nextMsgId() int64 {
+	return time.Now().UnixMilli()<<12 | (s.seq.Add(1) & 0xfff)
+}
+
+// Push 给离线玩家存一条消息，下次登录时Deliver取出
+func (s *Store) Push(playerId int64, msgType int32, payload []byte) error {
+	now := time.Now()
+	return s.pool.AddQuery(&db.SqlQuery{
+		Stmt: "insert into offline_msg (msg_id, player_id, msg_type, payload, create_time, expire_time) values (?, ?, ?, ?, ?, ?);",
+		Args: []any{s.nextMsgId(), playerId, msgType, payload, now.Unix(), now.Add(s.ttl).Unix()},
+		CbFunc: func(_ []*db.DBData, err error) {
+			if err != nil {
+				log.Printf("offline msg push failed, player %d, type %d: %s", playerId, msgType, err.Error())
+			}
+		},
+	})
+}
+
+// Deliver 玩家登录时调用，取出所有未过期的离线消息交给cb（按创建先后排列），取出后从库里删掉。
+// cb在db的Loop goroutine里执行，需要碰主循环数据的话自己转一下
+func (s *Store) Deliver(playerId int64, cb func([]*Msg)) error {
+	return s.pool.AddQuery(&db.SqlQuery{
+		Stmt: "select * from offline_msg where player_id = ?;",
+		Args: []any{playerId},
+		CbFunc: func(data []*db.DBData, err error) {
+			if err != nil {
+				if !errors.Is(err, db.ErrNoRows) {
+					log.Printf("offline msg load failed, player %d: %s", playerId, err.Error())
+				}
+				cb(nil)
+				return
+			}
+			now := time.Now().Unix()
+			var msgs []*Msg
+			for _, row := range data {
+				m := parseMsg(row)
+				if m.ExpireTime > now {
+					msgs = append(msgs, m)
+				}
+				// 只删这次读到的，读完之后新push进来的留到下次
+				s.pool.AddQuery(&db.SqlQuery{
+					Stmt:   "delete from offline_msg where msg_id = ?;",
+					Args:   []any{m.MsgId},
+					CbFunc: func([]*db.DBData, error) {},
+				})
+			}
+			sortMsgs(msgs)
+			cb(msgs)
+		},
+	})
+}
+
+// StartCleanup 用timer定期删掉过期消息（玩家一直不登录的话消息不会被Deliver删除）
+func (s *Store) StartCleanup(interval time.Duration) {
+	timer.Every(interval, "offline_msg_cleanup", func() {
+		err := s.pool.AddQuery(&db.SqlQuery{
+			Stmt:     "delete from offline_msg where expire_time < ?;",
+			Args:     []any{time.Now().Unix()},
+			Priority: db.PriorityLow,
+			CbFunc: func(_ []*db.DBData, err error) {
+				if err != nil {
+					log.Printf("offline msg cleanup failed: %s", err.Error())
+				}
+			},
+		})
+		if err != nil {
+			log.Printf("offline msg cleanup not queued: %s", err.Error())
+		}
+	})
+}
+
+func parseMsg(row *db.DBData) *Msg {
+	return &Msg{
+		MsgId:      row.Int64("msg_id"),
+		PlayerId:   row.Int64("player_id"),
+		MsgType:    int32(row.Int64("msg_type")),
+		Payload:    row.Data["payload"],
+		CreateTime: row.Int64("create_time"),
+		ExpireTime: row.Int64("expire_time"),
+	}
+}
+
+func sortMsgs(msgs []*Msg) {
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].MsgId < msgs[j].MsgId })
+}
@@ -0,0 +1,70 @@
+package offline
+
+import (
+	"strconv"
+	"test/db"
+	"testing"
+	"time"
+)
+
+func msgRow(msgId, playerId, expire int64, payload string) *db.DBData {
+	itoa := func(v int64) []byte { return []byte(strconv.FormatInt(v, 10)) }
+	return &db.DBData{Data: map[string][]byte{
+		"msg_id":      itoa(msgId),
+		"player_id":   itoa(playerId),
+		"msg_type":    []byte("1"),
+		"payload":     []byte(payload),
+		"create_time": itoa(msgId),
+		"expire_time": itoa(expire),
+	}}
+}
+
+func TestDeliver(t *testing.T) {
+	pool := db.NewFakePool()
+	s := NewStore(pool, 0)
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Hour).Unix()
+	pool.SetTable("offline_msg", []*db.DBData{
+		msgRow(3, 1, future, "c"),
+		msgRow(1, 1, future, "a"),
+		msgRow(2, 1, past, "expired"),
+		msgRow(4, 2, future, "other player"),
+		msgRow(5, 1, future, "b"),
+	})
+	var got []*Msg
+	if err := s.Deliver(1, func(msgs []*Msg) {
+		got = msgs
+		// 回调时才push进来的不能被这次删掉
+		if err := s.Push(1, 1, []byte("late")); err != nil {
+			t.Fatal(err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var payloads []string
+	for _, m := range got {
+		payloads = append(payloads, string(m.Payload))
+	}
+	if len(got) != 3 || payloads[0] != "a" || payloads[1] != "c" || payloads[2] != "b" {
+		t.Fatalf("delivered %v", payloads)
+	}
+	left := pool.Table("offline_msg")
+	if len(left) != 2 || string(left[0].Data["payload"]) != "other player" || string(left[1].Data["payload"]) != "late" {
+		var rows []string
+		for _, r := range left {
+			rows = append(rows, string(r.Data["payload"]))
+		}
+		t.Fatalf("rows left %v", rows)
+	}
+
+	// 没有消息时也要回调
+	called := false
+	if err := s.Deliver(3, func(msgs []*Msg) {
+		called = true
+		if msgs != nil {
+			t.Fatalf("msgs %v", msgs)
+		}
+	}); err != nil || !called {
+		t.Fatalf("deliver with no rows: called %v, %v", called, err)
+	}
+}
@@ -0,0 +1,245 @@
+package quest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"test/db"
+	"test/event"
+	"test/inventory"
+	"test/tool_gen_code/result"
+	"time"
+)
+
+// 建表语句：
+// CREATE TABLE player_quest (
+//   player_id BIGINT NOT NULL PRIMARY KEY,
+//   data BLOB NOT NULL,
+//   update_time BIGINT NOT NULL
+// );
+//
+// 任务定义来自生成的配置（result.Quest），进度由事件总线上的事件推动，完成后发奖励到背包（放不下的背包自己转邮件）
+
+var (
+	ErrUnknownQuest = errors.New("quest template not found")
+	ErrAccepted     = errors.New("quest already accepted")
+	ErrNoPlayer     = errors.New("player quests not loaded")
+)
+
+// Mode 一种事件怎么推进度
+type Mode int32
+
+const (
+	ModeAccumulate Mode = iota // 累加Value（击杀数）
+	ModeReachMax               // 取达到过的最大值，>=Count完成（等级）
+	ModeReachMin               // 取达到过的最小值，<=Count完成（排名，越小越好）
+)
+
+var modes = map[string]Mode{
+	event.TypeLevelUp:      ModeReachMax,
+	event.TypeRankAchieved: ModeReachMin,
+}
+
+// RegisterMode 新事件类型不是累加的话在这里登记，默认累加
+func RegisterMode(eventType string, m Mode) {
+	modes[eventType] = m
+}
+
+type Progress struct {
+	QuestId  int   `json:"quest_id"`
+	Value    int64 `json:"value"`
+	Started  bool  `json:"started"` // ReachMin要区分"还没有值"和0
+	Finished bool  `json:"finished"`
+}
+
+type playerQuests struct {
+	Quests map[int]*Progress `json:"quests"`
+}
+
+type Tracker struct {
+	pool    db.Pool
+	inv     *inventory.Manager
+	players map[int64]*playerQuests
+	dirty   *db.DirtySet[int64]
+	cancels map[string]func()
+	bus     *event.Bus
+}
+
+func NewTracker(pool db.Pool, inv *inventory.Manager) *Tracker {
+	t := &Tracker{
+		pool:    pool,
+		inv:     inv,
+		players: make(map[int64]*playerQuests),
+		cancels: make(map[string]func()),
+	}
+	t.dirty = db.NewDirtySet[int64](pool, "quest", t.saveQuery)
+	return t
+}
+
+// Start 订阅所有任务配置里用到的事件类型，配置加载（result.LoadQuest）之后调，重载配置后再调一次
+func (t *Tracker) Start(bus *event.Bus) {
+	t.bus = bus
+	for _, q := range result.QuestById {
+		if _, ok := t.cancels[q.Event]; ok {
+			continue
+		}
+		t.cancels[q.Event] = bus.Subscribe(q.Event, t.onEvent)
+	}
+}
+
+func (t *Tracker) Stop() {
+	for typ, cancel := range t.cancels {
+		cancel()
+		delete(t.cancels, typ)
+	}
+}
+
+func (t *Tracker) StartFlush(interval time.Duration) {
+	t.dirty.StartFlush(interval)
+}
+
+func (t *Tracker) saveQuery(playerId int64) *db.SqlQuery {
+	pq, ok := t.players[playerId]
+	if !ok {
+		return nil
+	}
+	b, err := json.Marshal(pq)
+	if err != nil {
+		log.Printf("quest marshal failed, player %d: %s", playerId, err.Error())
+		return nil
+	}
+	return &db.SqlQuery{
+		Stmt: "replace into player_quest (player_id, data, update_time) values (?, ?, ?);",
+		Args: []any{playerId, b, time.Now().Unix()},
+	}
+}
+
+// Load cb在db的Loop goroutine里执行，回到主循环之后再调Put
+func (t *Tracker) Load(playerId int64, cb func(data []byte, err error)) error {
+	return t.pool.AddQuery(&db.SqlQuery{
+		Stmt: "select * from player_quest where player_id = ?;",
+		Args: []any{playerId},
+		CbFunc: func(data []*db.DBData, err error) {
+			if errors.Is(err, db.ErrNoRows) {
+				cb(nil, nil)
+				return
+			}
+			if err != nil {
+				cb(nil, err)
+				return
+			}
+			cb(data[0].Data["data"], nil)
+		},
+	})
+}
+
+// Put data是Load拿到的数据，新玩家传nil
+func (t *Tracker) Put(playerId int64, data []byte) error {
+	pq := &playerQuests{}
+	if data != nil {
+		if err := json.Unmarshal(data, pq); err != nil {
+			return err
+		}
+	}
+	if pq.Quests == nil {
+		pq.Quests = make(map[int]*Progress)
+	}
+	t.players[playerId] = pq
+	return nil
+}
+
+// Unload 玩家下线，先落库再卸载
+func (t *Tracker) Unload(playerId int64) {
+	if q := t.saveQuery(playerId); q != nil {
+		q.Priority = db.PriorityHigh
+		q.CbFunc = func(_ []*db.DBData, err error) {
+			if err != nil {
+				log.Printf("quest save on unload failed, player %d: %s", playerId, err.Error())
+			}
+		}
+		if err := t.pool.AddQuery(q); err != nil {
+			log.Printf("quest save on unload failed, player %d: %s", playerId, err.Error())
+		}
+	}
+	delete(t.players, playerId)
+}
+
+func (t *Tracker) Accept(playerId int64, questId int) error {
+	pq, ok := t.players[playerId]
+	if !ok {
+		return ErrNoPlayer
+	}
+	if result.GetQuestById(questId) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownQuest, questId)
+	}
+	if _, ok := pq.Quests[questId]; ok {
+		return ErrAccepted
+	}
+	pq.Quests[questId] = &Progress{QuestId: questId}
+	t.dirty.Mark(playerId)
+	return nil
+}
+
+func (t *Tracker) Get(playerId int64, questId int) *Progress {
+	pq, ok := t.players[playerId]
+	if !ok {
+		return nil
+	}
+	return pq.Quests[questId]
+}
+
+func (t *Tracker) onEvent(e *event.Event) {
+	pq, ok := t.players[e.PlayerId]
+	if !ok {
+		return
+	}
+	for _, p := range pq.Quests {
+		if p.Finished {
+			continue
+		}
+		tpl := result.GetQuestById(p.QuestId)
+		if tpl == nil || tpl.Event != e.Type || (tpl.Target != 0 && tpl.Target != e.Param) {
+			continue
+		}
+		if !advance(p, modes[e.Type], e.Value, tpl.Count) {
+			t.dirty.Mark(e.PlayerId)
+			continue
+		}
+		p.Finished = true
+		t.dirty.Mark(e.PlayerId)
+		t.reward(e.PlayerId, tpl)
+		t.bus.Publish(&event.Event{Type: event.TypeQuestCompleted, PlayerId: e.PlayerId, Param: int64(tpl.Id)})
+	}
+}
+
+// advance 更新进度，返回是否完成
+func advance(p *Progress, mode Mode, v int64, need int64) bool {
+	switch mode {
+	case ModeReachMax:
+		if !p.Started || v > p.Value {
+			p.Value = v
+		}
+		p.Started = true
+		return p.Value >= need
+	case ModeReachMin:
+		if !p.Started || v < p.Value {
+			p.Value = v
+		}
+		p.Started = true
+		return p.Value <= need
+	default:
+		p.Started = true
+		p.Value += v
+		return p.Value >= need
+	}
+}
+
+func (t *Tracker) reward(playerId int64, tpl *result.Quest) {
+	if tpl.RewardItem == 0 || tpl.RewardCount <= 0 || t.inv == nil {
+		return
+	}
+	if _, err := t.inv.Add(playerId, tpl.RewardItem, tpl.RewardCount, fmt.Sprintf("quest_%d", tpl.Id)); err != nil {
+		log.Printf("quest %d reward failed, player %d: %s", tpl.Id, playerId, err.Error())
+	}
+}
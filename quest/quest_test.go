@@ -0,0 +1,92 @@
+package quest
+
+import (
+	"test/db"
+	"test/event"
+	"test/inventory"
+	"test/offline"
+	"test/tool_gen_code/result"
+	"testing"
+)
+
+const potion = 1001
+
+func TestQuestReward(t *testing.T) {
+	if err := result.LoadItem([]*result.Item{{Id: potion, Name: "potion", MaxStack: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := result.LoadQuest([]*result.Quest{
+		{Id: 1, Event: event.TypeKill, Target: 7, Count: 3, RewardItem: potion, RewardCount: 5},
+		{Id: 2, Event: event.TypeLevelUp, Count: 10, RewardItem: potion, RewardCount: 30},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	pool := db.NewFakePool()
+	// 背包只有2格，放不下的走离线邮件
+	inv := inventory.NewManager(pool, 2, &inventory.OfflineMailer{Store: offline.NewStore(pool, 0), MsgType: 1})
+	inv.Load(1, func(bag *inventory.Bag, err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		inv.Put(bag)
+	})
+	tr := NewTracker(pool, inv)
+	load := func() {
+		if err := tr.Load(1, func(data []byte, err error) {
+			if err == nil {
+				err = tr.Put(1, data)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load()
+	bus := event.NewBus()
+	tr.Start(bus)
+	defer tr.Stop()
+	var completed []int64
+	bus.Subscribe(event.TypeQuestCompleted, func(e *event.Event) { completed = append(completed, e.Param) })
+
+	if err := tr.Accept(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	tr.Accept(1, 2)
+	if err := tr.Accept(1, 3); err == nil {
+		t.Fatal("unknown quest accepted")
+	}
+
+	bus.Publish(&event.Event{Type: event.TypeKill, PlayerId: 1, Param: 8, Value: 5}) // 不是目标怪
+	bus.Publish(&event.Event{Type: event.TypeKill, PlayerId: 1, Param: 7, Value: 2})
+	if p := tr.Get(1, 1); p.Value != 2 || p.Finished || inv.Count(1, potion) != 0 {
+		t.Fatalf("progress %+v, potions %d", p, inv.Count(1, potion))
+	}
+	bus.Publish(&event.Event{Type: event.TypeKill, PlayerId: 1, Param: 7, Value: 2})
+	if p := tr.Get(1, 1); !p.Finished || inv.Count(1, potion) != 5 || len(completed) != 1 || completed[0] != 1 {
+		t.Fatalf("progress %+v, potions %d, completed %v", p, inv.Count(1, potion), completed)
+	}
+	// 完成之后不再推进，也不会重复发奖
+	bus.Publish(&event.Event{Type: event.TypeKill, PlayerId: 1, Param: 7, Value: 2})
+	if tr.Get(1, 1).Value != 4 || inv.Count(1, potion) != 5 {
+		t.Fatalf("finished quest advanced: %+v", tr.Get(1, 1))
+	}
+
+	// 等级取最大值，奖励30个：背包补满到20个，剩下10个发邮件
+	bus.Publish(&event.Event{Type: event.TypeLevelUp, PlayerId: 1, Value: 12})
+	bus.Publish(&event.Event{Type: event.TypeLevelUp, PlayerId: 1, Value: 9})
+	if p := tr.Get(1, 2); !p.Finished || p.Value != 12 {
+		t.Fatalf("level quest %+v", p)
+	}
+	if inv.Count(1, potion) != 20 || len(pool.Table("offline_msg")) != 1 || len(completed) != 2 {
+		t.Fatalf("potions %d, mails %d, completed %v", inv.Count(1, potion), len(pool.Table("offline_msg")), completed)
+	}
+
+	// 下线落库，重新加载进度还在
+	tr.Unload(1)
+	load()
+	if p := tr.Get(1, 2); p == nil || !p.Finished || p.Value != 12 {
+		t.Fatalf("reloaded %+v", p)
+	}
+}
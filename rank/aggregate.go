@@ -0,0 +1,102 @@
+package rank
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// AggregateRank 公会/队伍榜：榜上的值是成员贡献之和，同时记录每个成员的贡献明细，结算时按贡献分奖励
+// K是公会id，M是成员id
+type AggregateRank[K comparable, M comparable, V SortableInt] struct {
+	*RankBase[K, V]
+	members map[K]map[M]V
+}
+
+func NewAggregateRank[K comparable, M comparable, V SortableInt](opts ...Option) *AggregateRank[K, M, V] {
+	return &AggregateRank[K, M, V]{
+		RankBase: NewRank[K, V](opts...),
+		members:  make(map[K]map[M]V),
+	}
+}
+
+// AddContribution 成员给公会加分，公会不在榜上时自动上榜
+func (a *AggregateRank[K, M, V]) AddContribution(guildId K, memberId M, delta V) error {
+	ms, ok := a.members[guildId]
+	if !ok {
+		ms = make(map[M]V)
+	}
+	ms[memberId] += delta
+	if err := a.setTotal(guildId, a.dict[guildId]+delta); err != nil {
+		ms[memberId] -= delta
+		return err
+	}
+	a.members[guildId] = ms
+	return nil
+}
+
+// RemoveMember 成员退出公会，扣掉他的贡献（不想扣分的玩法就别调这个）
+func (a *AggregateRank[K, M, V]) RemoveMember(guildId K, memberId M) error {
+	ms, ok := a.members[guildId]
+	if !ok {
+		return fmt.Errorf("AggregateRank::RemoveMember error: guild %v not exist", guildId)
+	}
+	v, ok := ms[memberId]
+	if !ok {
+		return fmt.Errorf("AggregateRank::RemoveMember error: member %v not in guild %v", memberId, guildId)
+	}
+	if err := a.setTotal(guildId, a.dict[guildId]-v); err != nil {
+		return err
+	}
+	delete(ms, memberId)
+	return nil
+}
+
+// RemoveGuild 公会解散
+func (a *AggregateRank[K, M, V]) RemoveGuild(guildId K) error {
+	if err := a.RemoveRankerByKey(guildId); err != nil {
+		return err
+	}
+	delete(a.members, guildId)
+	return nil
+}
+
+func (a *AggregateRank[K, M, V]) setTotal(guildId K, total V) error {
+	r := &Ranker[K, V]{
+		RankerId:   guildId,
+		Value:      total,
+		UpdateTime: time.Now().UnixMilli(),
+	}
+	if _, ok := a.dict[guildId]; ok {
+		return a.UpdateRankerData(r)
+	}
+	return a.AddRanker(r)
+}
+
+// MemberShare 一个成员的贡献和占公会总分的比例
+type MemberShare[M comparable, V SortableInt] struct {
+	MemberId M
+	Value    V
+	Ratio    float64
+}
+
+// MemberShares 公会成员贡献明细，按贡献从高到低，结算分奖励用
+func (a *AggregateRank[K, M, V]) MemberShares(guildId K) []MemberShare[M, V] {
+	ms := a.members[guildId]
+	total := a.dict[guildId]
+	ret := make([]MemberShare[M, V], 0, len(ms))
+	for m, v := range ms {
+		share := MemberShare[M, V]{MemberId: m, Value: v}
+		if total > 0 {
+			share.Ratio = float64(v) / float64(total)
+		}
+		ret = append(ret, share)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Value != ret[j].Value {
+			return ret[i].Value > ret[j].Value
+		}
+		return keyLess(ret[i].MemberId, ret[j].MemberId)
+	})
+	return ret
+}
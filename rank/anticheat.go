@@ -0,0 +1,170 @@
+package rank
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// 反作弊校验：UpdateRankerData真正改榜之前按榜的配置逐条检查，不通过的拒绝更新（返回ErrSuspiciousUpdate），
+// 同时给OnSuspicious注册的回调发一个事件（封号、告警、记审计日志由业务做）。AddRanker不检查（新上榜、从快照恢复的初始分不算"变动"）。
+// 内置规则用Option按榜配置：
+// 1. WithMaxDelta 单次涨分上限（掉分不算，扣分惩罚是正常的）
+// 2. WithMaxGainPerHour 每个ranker一小时内累计涨分上限，窗口从这小时第一次涨分开始算
+// 3. WithMonotonic 分数只能涨不能掉（累计充值、历史最高这种榜）
+// 业务特有的规则用AddValidator加。刚上线拿不准阈值时先WithAntiCheatReportOnly()只报不拦，看一阵事件再改成拦截
+// 时间用Ranker.UpdateTime（毫秒），没填按当前时间
+
+var ErrSuspiciousUpdate = errors.New("rank update rejected by anti-cheat")
+
+const (
+	RuleMaxDelta   = "max_delta"
+	RuleHourlyGain = "hourly_gain"
+	RuleMonotonic  = "monotonic"
+)
+
+// Validator 自定义校验，old是更新前的分数，返回非nil表示可疑
+type Validator[K comparable, V SortableInt] func(old V, r *Ranker[K, V]) error
+
+// SuspiciousEvent 一次可疑更新。Rejected为false表示只报不拦（ReportOnly），更新照常生效了
+type SuspiciousEvent[K comparable, V SortableInt] struct {
+	Key        K
+	Old        V
+	New        V
+	UpdateTime int64
+	Rule       string
+	Reason     error
+	Rejected   bool
+}
+
+type antiCheatOptions struct {
+	maxDelta       int64
+	maxGainPerHour int64
+	monotonic      bool
+	reportOnly     bool
+}
+
+type namedValidator[K comparable, V SortableInt] struct {
+	name string
+	f    Validator[K, V]
+}
+
+type hourGain struct {
+	start  int64 // 窗口开始时间，毫秒
+	gained int64
+}
+
+type antiCheat[K comparable, V SortableInt] struct {
+	validators   []namedValidator[K, V]
+	onSuspicious func(SuspiciousEvent[K, V])
+	gains        map[K]*hourGain
+}
+
+// WithMaxDelta 单次UpdateRankerData最多涨max分
+func WithMaxDelta(max int64) Option {
+	return func(o *rankOptions) {
+		o.maxDelta = max
+	}
+}
+
+// WithMaxGainPerHour 同一个ranker一小时内最多涨max分
+func WithMaxGainPerHour(max int64) Option {
+	return func(o *rankOptions) {
+		o.maxGainPerHour = max
+	}
+}
+
+// WithMonotonic 分数不允许下降
+func WithMonotonic() Option {
+	return func(o *rankOptions) {
+		o.monotonic = true
+	}
+}
+
+// WithAntiCheatReportOnly 违规只发事件不拒绝
+func WithAntiCheatReportOnly() Option {
+	return func(o *rankOptions) {
+		o.reportOnly = true
+	}
+}
+
+// AddValidator 加一条自定义规则，name用在事件的Rule和日志里。按添加顺序在内置规则之后执行
+func (rb *RankBase[K, V]) AddValidator(name string, f Validator[K, V]) {
+	rb.antiCheat.validators = append(rb.antiCheat.validators, namedValidator[K, V]{name: name, f: f})
+}
+
+// OnSuspicious 可疑更新的回调，在UpdateRankerData里同步调用（主循环），不要在回调里改这个榜
+func (rb *RankBase[K, V]) OnSuspicious(f func(SuspiciousEvent[K, V])) {
+	rb.antiCheat.onSuspicious = f
+}
+
+// checkUpdate 不通过且要拦截时返回错误。key不存在的不管，交给后面的更新报错。
+// 恢复和合并跨服变动时不检查：这些分数在产生的地方已经校验过，这里再拦会让各服的榜永远对不齐
+func (rb *RankBase[K, V]) checkUpdate(r *Ranker[K, V]) error {
+	if rb.replaying || rb.merging {
+		return nil
+	}
+	old, ok := rb.dict[r.Key()]
+	if !ok {
+		return nil
+	}
+	now := r.UpdateTime
+	if now == 0 {
+		now = time.Now().UnixMilli()
+	}
+	delta := int64(r.Value) - int64(old)
+	if r.Value < old {
+		delta = -int64(old - r.Value)
+	}
+	var w *hourGain
+	if rb.maxGainPerHour > 0 && delta > 0 {
+		w = rb.antiCheat.gains[r.Key()]
+		if w == nil || now-w.start >= time.Hour.Milliseconds() {
+			w = &hourGain{start: now}
+		}
+	}
+	check := func(rule string, reason error) error {
+		if reason == nil {
+			return nil
+		}
+		e := SuspiciousEvent[K, V]{Key: r.Key(), Old: old, New: r.Value, UpdateTime: now, Rule: rule, Reason: reason, Rejected: !rb.reportOnly}
+		log.Printf("rank anti-cheat: key %v %v -> %v violates %s: %s, rejected = %v", e.Key, old, r.Value, rule, reason.Error(), e.Rejected)
+		if rb.antiCheat.onSuspicious != nil {
+			rb.antiCheat.onSuspicious(e)
+		}
+		if rb.reportOnly {
+			return nil
+		}
+		return fmt.Errorf("%w: key %v %s: %s", ErrSuspiciousUpdate, r.Key(), rule, reason.Error())
+	}
+	if rb.monotonic && delta < 0 {
+		if err := check(RuleMonotonic, fmt.Errorf("score decreased %v -> %v", old, r.Value)); err != nil {
+			return err
+		}
+	}
+	if rb.maxDelta > 0 && delta > rb.maxDelta {
+		if err := check(RuleMaxDelta, fmt.Errorf("gained %d in one update, max %d", delta, rb.maxDelta)); err != nil {
+			return err
+		}
+	}
+	if w != nil && w.gained+delta > rb.maxGainPerHour {
+		if err := check(RuleHourlyGain, fmt.Errorf("gained %d within an hour, max %d", w.gained+delta, rb.maxGainPerHour)); err != nil {
+			return err
+		}
+	}
+	for _, v := range rb.antiCheat.validators {
+		if err := check(v.name, v.f(old, r)); err != nil {
+			return err
+		}
+	}
+	// 全部通过（或者只报不拦）才计入这小时的涨分
+	if w != nil {
+		w.gained += delta
+		if rb.antiCheat.gains == nil {
+			rb.antiCheat.gains = make(map[K]*hourGain)
+		}
+		rb.antiCheat.gains[r.Key()] = w
+	}
+	return nil
+}
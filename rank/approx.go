@@ -0,0 +1,193 @@
+package rank
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 几千万人的榜不可能每个人都精确排名（跳表也扛不住），这里只精确维护前topN名，
+// 其他人按分数分桶计数，回答"你超过了96.8%的玩家"这种问题：先数比你所在的桶更高的桶里有多少人（树状数组，O(log 桶数)），
+// 桶内按分数均匀分布线性插值。桶越细越准，分数分布很偏的话min/max尽量贴着实际范围设
+
+type ApproxRank[K comparable, V SortableInt] struct {
+	topN     int
+	top      []*Ranker[K, V] // 精确的前topN名，按名次排好
+	scores   map[K]*Ranker[K, V]
+	minScore int64
+	width    int64 // 每个桶覆盖的分数区间
+	counts   []int64
+	tree     []int64 // 树状数组，下标0是分数最高的桶，前缀和=比这个桶高的人数
+}
+
+// NewApproxRank 分数落在[minScore, maxScore]里分buckets个桶，超出范围的算进两头的桶
+func NewApproxRank[K comparable, V SortableInt](topN int, minScore V, maxScore V, buckets int) (*ApproxRank[K, V], error) {
+	if topN < 0 || buckets <= 0 || maxScore <= minScore {
+		return nil, fmt.Errorf("NewApproxRank error: illegal topN %d, buckets %d or score range [%v, %v]", topN, buckets, minScore, maxScore)
+	}
+	width := (int64(maxScore) - int64(minScore) + int64(buckets)) / int64(buckets)
+	return &ApproxRank[K, V]{
+		topN:     topN,
+		scores:   make(map[K]*Ranker[K, V]),
+		minScore: int64(minScore),
+		width:    width,
+		counts:   make([]int64, buckets),
+		tree:     make([]int64, buckets+1),
+	}, nil
+}
+
+// bucketOf 返回桶下标（0是最高分的桶）
+func (a *ApproxRank[K, V]) bucketOf(v V) int {
+	i := (int64(v) - a.minScore) / a.width
+	if int64(v) < a.minScore {
+		i = 0
+	}
+	if i >= int64(len(a.counts)) {
+		i = int64(len(a.counts)) - 1
+	}
+	return len(a.counts) - 1 - int(i)
+}
+
+func (a *ApproxRank[K, V]) addBucket(b int, delta int64) {
+	a.counts[b] += delta
+	for i := b + 1; i < len(a.tree); i += i & -i {
+		a.tree[i] += delta
+	}
+}
+
+// above 比桶b分数更高的桶里的总人数
+func (a *ApproxRank[K, V]) above(b int) int64 {
+	n := int64(0)
+	for i := b; i > 0; i -= i & -i {
+		n += a.tree[i]
+	}
+	return n
+}
+
+func (a *ApproxRank[K, V]) Len() int {
+	return len(a.scores)
+}
+
+// Set 新增或更新
+func (a *ApproxRank[K, V]) Set(k K, v V, updateTime int64) {
+	removed := false
+	if old, ok := a.scores[k]; ok {
+		a.addBucket(a.bucketOf(old.Value), -1)
+		removed = a.removeTop(k)
+	}
+	r := &Ranker[K, V]{RankerId: k, Value: v, UpdateTime: updateTime}
+	a.scores[k] = r
+	a.addBucket(a.bucketOf(v), 1)
+	if removed && len(a.top) > 0 && r.Less(a.top[len(a.top)-1]) {
+		// 原来在前topN名里，新分数还比剩下的最后一名高（涨分一般都是这样），榜外的人不可能超过它，直接放回去
+		a.insertTop(r)
+	} else if removed {
+		// 掉到剩下的最后一名后面了，和榜外的人一起重新选
+		a.refillTop()
+	} else {
+		a.insertTop(r)
+	}
+}
+
+func (a *ApproxRank[K, V]) Remove(k K) {
+	old, ok := a.scores[k]
+	if !ok {
+		return
+	}
+	delete(a.scores, k)
+	a.addBucket(a.bucketOf(old.Value), -1)
+	if a.removeTop(k) {
+		a.refillTop()
+	}
+}
+
+func (a *ApproxRank[K, V]) removeTop(k K) bool {
+	for i, r := range a.top {
+		if r.RankerId == k {
+			a.top = append(a.top[:i], a.top[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// insertTop 比第topN名高才插进去，挤出去的那个只留在桶里
+func (a *ApproxRank[K, V]) insertTop(r *Ranker[K, V]) {
+	if a.topN == 0 {
+		return
+	}
+	i := sort.Search(len(a.top), func(i int) bool { return r.Less(a.top[i]) })
+	if i >= a.topN {
+		return
+	}
+	a.top = append(a.top, nil)
+	copy(a.top[i+1:], a.top[i:])
+	a.top[i] = r
+	if len(a.top) > a.topN {
+		a.top = a.top[:a.topN]
+	}
+}
+
+// refillTop 前topN名有人变分/被删后空出来的位置，要从所有人里找回来，O(n log topN)。
+// 大部分榜只涨分不掉分，这种情况很少发生
+func (a *ApproxRank[K, V]) refillTop() {
+	if len(a.top) >= a.topN || len(a.top) == len(a.scores) {
+		return
+	}
+	in := make(map[K]struct{}, len(a.top))
+	for _, r := range a.top {
+		in[r.RankerId] = struct{}{}
+	}
+	for k, r := range a.scores {
+		if _, ok := in[k]; !ok {
+			a.insertTop(r)
+		}
+	}
+}
+
+// ExactRank 前topN名返回精确名次，之外的返回false
+func (a *ApproxRank[K, V]) ExactRank(k K) (int32, bool) {
+	for i, r := range a.top {
+		if r.RankerId == k {
+			return int32(i + 1), true
+		}
+	}
+	return 0, false
+}
+
+// Top 精确的前topN名
+func (a *ApproxRank[K, V]) Top() []*Ranker[K, V] {
+	return append([]*Ranker[K, V](nil), a.top...)
+}
+
+// TopPercent 估算k排在前百分之几（0~100，越小越靠前），前topN名按精确名次算
+func (a *ApproxRank[K, V]) TopPercent(k K) (float64, error) {
+	r, ok := a.scores[k]
+	if !ok {
+		return 0, fmt.Errorf("ApproxRank::TopPercent error: key %v not exist", k)
+	}
+	if rank, ok := a.ExactRank(k); ok {
+		return float64(rank) * 100 / float64(len(a.scores)), nil
+	}
+	return a.TopPercentOf(r.Value), nil
+}
+
+// TopPercentOf 估算一个分数排在前百分之几（不在榜上的分数也能问，比如"打到这个分能进前10%吗"）
+func (a *ApproxRank[K, V]) TopPercentOf(v V) float64 {
+	total := len(a.scores)
+	if total == 0 {
+		return 0
+	}
+	b := a.bucketOf(v)
+	ahead := float64(a.above(b))
+	// 桶内线性插值：桶的上沿减去分数，占桶宽的比例就是桶内大约有多少人在前面
+	low := a.minScore + int64(len(a.counts)-1-b)*a.width
+	frac := float64(low+a.width-int64(v)) / float64(a.width)
+	if frac < 0 {
+		frac = 0
+	}
+	if frac > 1 {
+		frac = 1
+	}
+	ahead += frac * float64(a.counts[b])
+	return (ahead + 1) * 100 / float64(total)
+}
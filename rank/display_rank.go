@@ -0,0 +1,121 @@
+package rank
+
+// 同分同名次：默认名次就是在榜上的位置（1,2,3,4），有些玩法要求同分的显示同一个名次：
+// RankModeCompetition是1,1,3,4（同分并列，后面的跳过被占掉的名次，体育比赛的排法），RankModeDense是1,1,2,3（不跳）。
+// 位置（Ordinal）照样是唯一的，发奖、翻页还是按位置；显示名次（Rank）给客户端看。
+// Competition按分数在跳表上二分，O(log²n)；Dense要数前面有几种不同的分数，O(名次)，榜很长时别在热路径上查靠后的名次
+
+type RankMode int32
+
+const (
+	RankModeOrdinal     RankMode = 0 // 按位置，同分也分先后（默认）
+	RankModeCompetition RankMode = 1 // 1,1,3
+	RankModeDense       RankMode = 2 // 1,1,2
+)
+
+func WithRankMode(m RankMode) Option {
+	return func(o *rankOptions) {
+		o.rankMode = m
+	}
+}
+
+// DisplayRank Ordinal是在榜上的位置，Rank是按这个榜的RankMode给客户端显示的名次
+type DisplayRank struct {
+	Ordinal int32
+	Rank    int32
+}
+
+type RankedEntry[K comparable, V SortableInt] struct {
+	*Ranker[K, V]
+	DisplayRank
+}
+
+// firstOfScore 分数是v的第一个位置，ordinal是其中一个分数为v的位置
+func (rb *RankBase[K, V]) firstOfScore(v V, ordinal int32) (int32, error) {
+	lo, hi := int32(1), ordinal
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		e, err := rb.GetRankerDataByRank(mid)
+		if err != nil {
+			return 0, err
+		}
+		if e.Value > v {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// displayRankAt 位置ordinal上的节点r的显示名次
+func (rb *RankBase[K, V]) displayRankAt(r *Ranker[K, V], ordinal int32) (int32, error) {
+	switch rb.rankMode {
+	case RankModeCompetition:
+		return rb.firstOfScore(r.Value, ordinal)
+	case RankModeDense:
+		first, err := rb.firstOfScore(r.Value, ordinal)
+		if err != nil || first == 1 {
+			return 1, err
+		}
+		above, err := rb.Range(1, first-1)
+		if err != nil {
+			return 0, err
+		}
+		n := int32(1)
+		for i := 1; i < len(above); i++ {
+			if above[i].Value != above[i-1].Value {
+				n++
+			}
+		}
+		return n + 1, nil
+	}
+	return ordinal, nil
+}
+
+// GetDisplayRank 没上榜返回错误，和GetRank一样
+func (rb *RankBase[K, V]) GetDisplayRank(k K) (DisplayRank, error) {
+	ordinal, err := rb.GetRank(k)
+	if err != nil {
+		return DisplayRank{}, err
+	}
+	r, err := rb.GetRankerDataByKey(k)
+	if err != nil {
+		return DisplayRank{}, err
+	}
+	rank, err := rb.displayRankAt(r, ordinal)
+	if err != nil {
+		return DisplayRank{}, err
+	}
+	return DisplayRank{Ordinal: ordinal, Rank: rank}, nil
+}
+
+// RangeWithRank 同Range，每一项带上位置和显示名次。只有第一项要查一次，后面的顺着算
+func (rb *RankBase[K, V]) RangeWithRank(start int32, end int32) ([]RankedEntry[K, V], error) {
+	list, err := rb.Range(start, end)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	ret := make([]RankedEntry[K, V], len(list))
+	rank, err := rb.displayRankAt(list[0], start)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range list {
+		ordinal := start + int32(i)
+		if i > 0 {
+			switch {
+			case rb.rankMode == RankModeOrdinal:
+				rank = ordinal
+			case r.Value == list[i-1].Value:
+				// 同分同名次
+			case rb.rankMode == RankModeDense:
+				rank++
+			default:
+				rank = ordinal
+			}
+		}
+		ret[i] = RankedEntry[K, V]{Ranker: r, DisplayRank: DisplayRank{Ordinal: ordinal, Rank: rank}}
+	}
+	return ret, nil
+}
@@ -0,0 +1,139 @@
+package rank
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"test/gtime"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 导出给运营看的结算报表（csv或者xlsx），列：名次、RankerId、分数、最后更新时间
+
+var exportHeader = []string{"rank", "ranker_id", "value", "update_time"}
+
+type exportRow struct {
+	rank       int32
+	rankerId   string
+	value      string
+	updateTime string
+}
+
+// collect 取[start, end]名次的数据，end超过榜上人数时按榜上人数
+func (rb *RankBase[K, V]) collect(start int32, end int32) ([]exportRow, error) {
+	if start < 1 || end < start {
+		return nil, fmt.Errorf("RankBase::Export error: illegal range [%d, %d]", start, end)
+	}
+	if cnt := rb.rankMain.GetElementsCount(); end > cnt {
+		end = cnt
+	}
+	if end < start {
+		return nil, nil
+	}
+	list, err := rb.Range(start, end)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]exportRow, 0, len(list))
+	for i, r := range list {
+		rows = append(rows, exportRow{
+			rank:       start + int32(i),
+			rankerId:   fmt.Sprint(r.RankerId),
+			value:      strconv.FormatInt(int64(r.Value), 10),
+			updateTime: gtime.FormatStandard(time.UnixMilli(r.UpdateTime)),
+		})
+	}
+	return rows, nil
+}
+
+func (rb *RankBase[K, V]) ExportCSV(w io.Writer, start int32, end int32) error {
+	rows, err := rb.collect(start, end)
+	if err != nil {
+		return err
+	}
+	return writeCSV(w, rows)
+}
+
+func (rb *RankBase[K, V]) ExportXLSX(w io.Writer, start int32, end int32) error {
+	rows, err := rb.collect(start, end)
+	if err != nil {
+		return err
+	}
+	return writeXLSX(w, rows)
+}
+
+func writeCSV(w io.Writer, rows []exportRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportHeader); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := cw.Write([]string{strconv.Itoa(int(r.rank)), r.rankerId, r.value, r.updateTime}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeXLSX(w io.Writer, rows []exportRow) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := "Sheet1"
+	header := make([]any, len(exportHeader))
+	for i, h := range exportHeader {
+		header[i] = h
+	}
+	if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+		return err
+	}
+	for i, r := range rows {
+		v, _ := strconv.ParseInt(r.value, 10, 64)
+		line := []any{r.rank, r.rankerId, v, r.updateTime}
+		if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", i+2), &line); err != nil {
+			return err
+		}
+	}
+	return f.Write(w)
+}
+
+// ExportHandler 给admin接口用：GET ?start=1&end=100&format=csv|xlsx。
+// 排行榜不是并发安全的，run负责把取数据的函数放到排行榜所在的goroutine（主循环）里执行，写http响应在外面做
+func ExportHandler[K comparable, V SortableInt](name string, rb *RankBase[K, V], run func(func()) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		start, err1 := strconv.Atoi(q.Get("start"))
+		end, err2 := strconv.Atoi(q.Get("end"))
+		if err1 != nil || err2 != nil {
+			http.Error(w, "start and end are required", http.StatusBadRequest)
+			return
+		}
+		var rows []exportRow
+		var err error
+		if runErr := run(func() { rows, err = rb.collect(int32(start), int32(end)) }); runErr != nil {
+			http.Error(w, runErr.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filename := fmt.Sprintf("%s_%d_%d_%s", name, start, end, time.Now().Format("20060102_150405"))
+		if q.Get("format") == "xlsx" {
+			w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+			w.Header().Set("Content-Disposition", "attachment; filename="+filename+".xlsx")
+			err = writeXLSX(w, rows)
+		} else {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", "attachment; filename="+filename+".csv")
+			err = writeCSV(w, rows)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
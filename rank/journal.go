@@ -0,0 +1,219 @@
+package rank
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"test/timer"
+	"time"
+)
+
+// 预写日志：快照（WriteSnapshot）一般几分钟一次，中间崩了这几分钟的分数变动就丢了。
+// 挂上Journal之后榜上每次增删改追加一行到日志文件，每秒Flush一次（写文件+fsync），崩溃最多丢最近一秒的变动。
+// 每行记的是变动之后的完整数据（或者删除），重复重放结果一样，所以恢复时在最近一次快照上按顺序重放日志就行，不用精确对齐快照的位置。
+// 每次WriteSnapshot成功后日志轮转一次：当前文件改名成path.1，新开一个空文件。恢复时先重放path.1再重放path，
+// 这样最近一次快照没存下来（备份失败）、只能用上一份快照时也不会丢数据。
+// 恢复用ReplayJournal，重放时不过反作弊、不写日志。只能在主循环里用，和榜本身一样
+
+type journalLine[K comparable, V SortableInt] struct {
+	Remove bool `json:"remove,omitempty"`
+	snapshotLine[K, V]
+}
+
+type Journal[K comparable, V SortableInt] struct {
+	path   string
+	f      *os.File
+	w      *bufio.Writer
+	enc    *json.Encoder
+	dirty  bool
+	errors int64
+	closed bool
+
+	stopFlush func() // StartFlush之后才有
+}
+
+func openJournalFile[K comparable, V SortableInt](j *Journal[K, V]) error {
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	j.f = f
+	j.w = bufio.NewWriter(f)
+	j.enc = json.NewEncoder(j.w)
+	return nil
+}
+
+// OpenJournal 追加模式打开日志并挂到榜上，一个榜只能挂一个。启动时先ReadSnapshot、ReplayJournal恢复完再挂
+func (rb *RankBase[K, V]) OpenJournal(path string) (*Journal[K, V], error) {
+	if rb.journal != nil {
+		return nil, fmt.Errorf("RankBase::OpenJournal error: journal %s already opened", rb.journal.path)
+	}
+	j := &Journal[K, V]{path: path}
+	if err := openJournalFile(j); err != nil {
+		return nil, err
+	}
+	rb.journal = j
+	return j, nil
+}
+
+// appendJournal r为nil表示删除
+func (rb *RankBase[K, V]) appendJournal(k K, r *Ranker[K, V]) {
+	j := rb.journal
+	if j == nil || rb.replaying {
+		return
+	}
+	line := &journalLine[K, V]{Remove: r == nil}
+	line.RankerId = k
+	if r != nil {
+		line.Value, line.UpdateTime, line.Matches, line.Payload = r.Value, r.UpdateTime, r.Matches, r.Payload
+	}
+	if err := j.enc.Encode(line); err != nil {
+		j.errors++
+		log.Printf("rank journal %s write failed: %s", j.path, err.Error())
+		return
+	}
+	j.dirty = true
+}
+
+// Flush 写到文件并fsync，没有新变动时什么都不做
+func (j *Journal[K, V]) Flush() error {
+	if !j.dirty || j.closed {
+		return nil
+	}
+	if err := j.w.Flush(); err != nil {
+		j.errors++
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		j.errors++
+		return err
+	}
+	j.dirty = false
+	return nil
+}
+
+// StartFlush 用timer每interval Flush一次，Close之后停
+func (j *Journal[K, V]) StartFlush(interval time.Duration) {
+	j.stopFlush = timer.Every(interval, "rank_journal_flush", func() {
+		if err := j.Flush(); err != nil {
+			log.Printf("rank journal %s flush failed: %s", j.path, err.Error())
+		}
+	})
+}
+
+// Errors 写入、刷盘失败的次数
+func (j *Journal[K, V]) Errors() int64 {
+	return j.errors
+}
+
+// rotate 快照写成功后调，当前文件变成path.1
+func (j *Journal[K, V]) rotate() error {
+	if j.closed {
+		return nil
+	}
+	j.dirty = true
+	if err := j.Flush(); err != nil {
+		return err
+	}
+	j.f.Close()
+	if err := os.Rename(j.path, j.path+".1"); err != nil {
+		// 改名失败还接着往原文件写，下次快照再试
+		if err2 := openJournalFile(j); err2 != nil {
+			return err2
+		}
+		return err
+	}
+	return openJournalFile(j)
+}
+
+// CloseJournal 刷盘后关文件并从榜上摘下来，停服时调
+func (rb *RankBase[K, V]) CloseJournal() error {
+	j := rb.journal
+	if j == nil {
+		return nil
+	}
+	rb.journal = nil
+	if j.stopFlush != nil {
+		j.stopFlush()
+	}
+	err := j.Flush()
+	j.closed = true
+	if e := j.f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// ReplayJournal 按顺序把path.1和path里的变动重放到榜上（文件不存在跳过），返回重放了多少条。
+// 解析不了的行（磁盘坏块、写坏了的）打日志跳过；最后一行没写完（崩溃时）的忽略，并且把文件截到最后一个完整行，
+// 不然之后OpenJournal接着往半行后面追加，这一行和下一条拼在一起，下次恢复就读不出来了
+func (rb *RankBase[K, V]) ReplayJournal(path string) (int, error) {
+	rb.replaying = true
+	defer func() { rb.replaying = false }()
+	total := 0
+	for _, p := range []string{path + ".1", path} {
+		f, err := os.Open(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return total, err
+		}
+		n, valid, err := rb.replayJournal(f)
+		f.Close()
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("rank journal %s: %w", p, err)
+		}
+		if st, err := os.Stat(p); err == nil && st.Size() > valid {
+			log.Printf("rank journal %s: truncated last line dropped, %d bytes", p, st.Size()-valid)
+			if err = os.Truncate(p, valid); err != nil {
+				return total, fmt.Errorf("rank journal %s: %w", p, err)
+			}
+		}
+	}
+	return total, nil
+}
+
+// replayJournal 返回重放的条数和最后一个完整行结束的位置
+func (rb *RankBase[K, V]) replayJournal(r io.Reader) (n int, valid int64, err error) {
+	br := bufio.NewReader(r)
+	skipped := 0
+	for {
+		b, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			break // 没有换行的最后一行是没写完的
+		}
+		if err != nil {
+			return n, valid, err
+		}
+		valid += int64(len(b))
+		line := &journalLine[K, V]{}
+		if err = json.Unmarshal(b, line); err != nil {
+			skipped++
+			log.Printf("rank journal: bad line at offset %d skipped: %s", valid-int64(len(b)), err.Error())
+			continue
+		}
+		_, exist := rb.dict[line.RankerId]
+		switch {
+		case line.Remove && exist:
+			err = rb.RemoveRankerByKey(line.RankerId)
+		case line.Remove:
+		case exist:
+			err = rb.UpdateRankerData(line.ranker())
+		default:
+			err = rb.AddRanker(line.ranker())
+		}
+		if err != nil {
+			return n, valid, err
+		}
+		n++
+	}
+	if skipped > 0 {
+		log.Printf("rank journal: %d bad lines skipped, %d replayed", skipped, n)
+	}
+	return n, valid, nil
+}
@@ -0,0 +1,74 @@
+package rank
+
+import (
+	"unsafe"
+
+	"github.com/aruyuna9531/skiplist"
+)
+
+// 跳表每层索引节点大约覆盖下一层多少个节点（skiplist在link超过5时从中间拆分，实际在3~6之间，取个中间值估算）
+const estimateIndexFanout = 4
+
+// MemStats 排行榜内存占用统计
+// skiplist包没有导出每层的节点数，LevelNodes是按固定扇出估算的，只看数量级，不要当精确值用
+type MemStats struct {
+	Elements    int32   // 榜上数据节点数
+	DictEntries int     // 排行榜自己的dict条目数（正常应该等于Elements+Unqualified，不等说明有脏数据）
+	Unqualified int     // 不满足上榜条件、没进跳表的条目数
+	Layers      int32   // 跳表层数（含底层）
+	LevelNodes  []int64 // 每层节点数，[0]是底层（估算）
+	ApproxBytes int64   // 估算的总字节数（跳表节点+Ranker本体+两份dict）
+}
+
+func (rb *RankBase[K, V]) MemStats() *MemStats {
+	st := &MemStats{
+		Elements:    rb.rankMain.GetElementsCount(),
+		DictEntries: len(rb.dict),
+		Unqualified: len(rb.unqualified),
+		Layers:      rb.rankMain.GetLayersCount(),
+	}
+	var k K
+	var v V
+	nodeSize := int64(unsafe.Sizeof(skiplist.SkipListNode[K]{}))
+	rankerSize := int64(unsafe.Sizeof(Ranker[K, V]{}))
+	ptrSize := int64(unsafe.Sizeof(uintptr(0)))
+
+	totalNodes := int64(0)
+	n := int64(st.Elements)
+	for i := int32(0); i < st.Layers; i++ {
+		// 每层还有头尾两个哨兵节点
+		st.LevelNodes = append(st.LevelNodes, n+2)
+		totalNodes += n + 2
+		n /= estimateIndexFanout
+	}
+	st.ApproxBytes = totalNodes*nodeSize +
+		int64(st.Elements)*rankerSize +
+		int64(st.Elements)*(int64(unsafe.Sizeof(k))+ptrSize) + // skiplist内部的key->node
+		int64(st.DictEntries)*(int64(unsafe.Sizeof(k))+int64(unsafe.Sizeof(v))) // rb.dict
+	return st
+}
+
+// Compact 按当前排名顺序把所有节点重新插进一个新跳表，顺便重建dict。
+// skiplist的索引是确定性建的（link超过5就从中间拆分，没有随机层数），按排名顺序重插之后每段索引都回到拆分后的长度，层级是均匀的。
+// 大量增删之后索引层会变得不均匀（删除只做局部调整），可以在低峰期（比如结算后）调一次。
+// 重建期间排行榜不可用，调用方要保证没有其他goroutine同时读写
+func (rb *RankBase[K, V]) Compact() error {
+	all, err := rb.GetAllRankers()
+	if err != nil && rb.rankMain.GetElementsCount() > 0 {
+		return err
+	}
+	newList := skiplist.NewSkipList[K]()
+	newDict := make(map[K]V, len(all))
+	for _, r := range all {
+		if err = newList.Add(r); err != nil {
+			return err
+		}
+		newDict[r.Key()] = r.Value
+	}
+	for k, r := range rb.unqualified {
+		newDict[k] = r.Value
+	}
+	rb.rankMain = newList
+	rb.dict = newDict
+	return nil
+}
@@ -0,0 +1,272 @@
+package rank
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"test/timer"
+	"time"
+)
+
+// 只读镜像：榜本身不是并发安全的，只能在主循环里读写。运营导出、admin统计这种重查询放到别的goroutine的话，
+// 用NewMirror建一份镜像，榜上每次增删改把变动（delta）丢进镜像的队列，镜像在自己的goroutine里应用，查询加读锁，完全不碰原榜。
+// 镜像是最终一致的：Lag()是还没应用的变动数。队列满了不会阻塞主循环，而是丢掉后续delta、重发一次全量快照。
+// 拍全量要遍历整个榜，所以每个镜像最多每mirrorResyncInterval拍一次，间隔内的变动直接丢掉，到点由timer补拍（没有新变动也会补上）。
+// 镜像里按名次排好的数组+按key记的当前数据，查名次是二分，增删是一次内存搬移，不逐个比较
+
+const (
+	defaultMirrorQueue   = 4096
+	mirrorResyncInterval = time.Second
+)
+
+type mirrorDelta[K comparable, V SortableInt] struct {
+	snapshot []Ranker[K, V] // 不为nil时整体替换
+	ranker   Ranker[K, V]   // 更新后的完整数据（不含rankPtr）
+	removed  bool
+}
+
+type Mirror[K comparable, V SortableInt] struct {
+	tieBreak TieBreak
+	in       chan mirrorDelta[K, V]
+	done     chan struct{}
+	closed   atomic.Bool
+	stale    atomic.Bool // 丢过delta，等待全量快照
+	sent     atomic.Int64
+	applied  atomic.Int64
+
+	mu    sync.RWMutex
+	list  []Ranker[K, V]     // 按名次排好序
+	index map[K]Ranker[K, V] // 当前数据，按它二分查到在list里的位置
+
+	// 下面只在主循环里用
+	resyncInterval time.Duration
+	lastResync     time.Time
+	resyncQueued   bool // 已经挂了到点补拍的触发器
+	resyncs        int  // 拍过几次全量（不含建的时候那次）
+}
+
+// NewMirror queueSize<=0用默认值。建好时先推一份当前全量，之后增量跟随。要在主循环里调
+func (rb *RankBase[K, V]) NewMirror(queueSize int) *Mirror[K, V] {
+	if queueSize <= 0 {
+		queueSize = defaultMirrorQueue
+	}
+	m := &Mirror[K, V]{
+		tieBreak: rb.tieBreak,
+		in:       make(chan mirrorDelta[K, V], queueSize),
+		done:     make(chan struct{}),
+		index:    make(map[K]Ranker[K, V]),
+
+		resyncInterval: mirrorResyncInterval,
+	}
+	m.send(mirrorDelta[K, V]{snapshot: rb.mirrorSnapshot()})
+	rb.mirrors = append(rb.mirrors, m)
+	go m.run()
+	return m
+}
+
+func (rb *RankBase[K, V]) mirrorSnapshot() []Ranker[K, V] {
+	all, _ := rb.GetAllRankers()
+	snap := make([]Ranker[K, V], 0, len(all))
+	for _, r := range all {
+		snap = append(snap, Ranker[K, V]{RankerId: r.RankerId, Value: r.Value, UpdateTime: r.UpdateTime, Matches: r.Matches, Payload: r.Payload})
+	}
+	return snap
+}
+
+// feedMirrors 榜上key变了之后调，按key现在在不在跳表里发更新或者删除
+func (rb *RankBase[K, V]) feedMirrors(k K) {
+	if len(rb.mirrors) == 0 {
+		return
+	}
+	d := mirrorDelta[K, V]{ranker: Ranker[K, V]{RankerId: k}, removed: true}
+	if nd, err := rb.rankMain.GetElementByKey(k); err == nil {
+		r := nd.(*Ranker[K, V])
+		d = mirrorDelta[K, V]{ranker: Ranker[K, V]{RankerId: k, Value: r.Value, UpdateTime: r.UpdateTime, Matches: r.Matches, Payload: r.Payload}}
+	}
+	alive := rb.mirrors[:0]
+	for _, m := range rb.mirrors {
+		if m.closed.Load() {
+			continue
+		}
+		alive = append(alive, m)
+		if m.stale.Load() {
+			// 全量快照里会包含这次变动
+			rb.resyncMirror(m)
+			continue
+		}
+		if !m.send(d) {
+			m.stale.Store(true)
+			rb.resyncMirror(m)
+		}
+	}
+	rb.mirrors = alive
+}
+
+// resyncMirror 给丢过delta的镜像补发全量，距离上次拍不到resyncInterval、或者这次队列还是满的，挂一个触发器到点再试
+func (rb *RankBase[K, V]) resyncMirror(m *Mirror[K, V]) {
+	now := time.Now()
+	if next := m.lastResync.Add(m.resyncInterval); now.Before(next) {
+		rb.queueResync(m, next)
+		return
+	}
+	m.lastResync = now
+	m.resyncs++
+	if m.send(mirrorDelta[K, V]{snapshot: rb.mirrorSnapshot()}) {
+		m.stale.Store(false)
+		return
+	}
+	rb.queueResync(m, now.Add(m.resyncInterval))
+}
+
+func (rb *RankBase[K, V]) queueResync(m *Mirror[K, V], at time.Time) {
+	if m.resyncQueued {
+		return
+	}
+	m.resyncQueued = true
+	// timer是秒级的，往后取整，不然到点时还差零点几秒又要再挂一次
+	err := timer.PushTriggerAt(at.Truncate(time.Second).Add(time.Second), timer.Trigger{
+		Fun: func(int64, interface{}) {
+			m.resyncQueued = false
+			if m.stale.Load() && !m.closed.Load() {
+				rb.resyncMirror(m)
+			}
+		},
+		Name: "rank_mirror_resync",
+	})
+	if err != nil {
+		// 挂不上就等下一次变动再补
+		m.resyncQueued = false
+		log.Printf("rank mirror resync not scheduled: %s", err.Error())
+	}
+}
+
+func (m *Mirror[K, V]) send(d mirrorDelta[K, V]) bool {
+	select {
+	case m.in <- d:
+		m.sent.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *Mirror[K, V]) run() {
+	for {
+		select {
+		case <-m.done:
+			return
+		case d := <-m.in:
+			m.apply(d)
+			m.applied.Add(1)
+		}
+	}
+}
+
+func (m *Mirror[K, V]) less(a, b *Ranker[K, V]) bool {
+	if a.Value != b.Value {
+		return a.Value > b.Value
+	}
+	switch m.tieBreak {
+	case TieBreakLaterFirst:
+		if a.UpdateTime != b.UpdateTime {
+			return a.UpdateTime > b.UpdateTime
+		}
+	case TieBreakKeyOrder:
+	default:
+		if a.UpdateTime != b.UpdateTime {
+			return a.UpdateTime < b.UpdateTime
+		}
+	}
+	return keyLess(a.RankerId, b.RankerId)
+}
+
+// search 第一个不排在r前面的位置
+func (m *Mirror[K, V]) search(r *Ranker[K, V]) int {
+	return sort.Search(len(m.list), func(i int) bool { return !m.less(&m.list[i], r) })
+}
+
+func (m *Mirror[K, V]) apply(d mirrorDelta[K, V]) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d.snapshot != nil {
+		m.list = d.snapshot
+		m.index = make(map[K]Ranker[K, V], len(d.snapshot))
+		for _, r := range d.snapshot {
+			m.index[r.RankerId] = r
+		}
+		return
+	}
+	k := d.ranker.RankerId
+	if i := m.find(k); i >= 0 {
+		m.list = append(m.list[:i], m.list[i+1:]...)
+		delete(m.index, k)
+	}
+	if d.removed {
+		return
+	}
+	i := m.search(&d.ranker)
+	m.list = append(m.list, Ranker[K, V]{})
+	copy(m.list[i+1:], m.list[i:])
+	m.list[i] = d.ranker
+	m.index[k] = d.ranker
+}
+
+// find 调用方持有锁，不在镜像里返回-1。排序规则最后按key比，没有并列，用当前数据二分就能定位
+func (m *Mirror[K, V]) find(k K) int {
+	r, ok := m.index[k]
+	if !ok {
+		return -1
+	}
+	if i := m.search(&r); i < len(m.list) && m.list[i].RankerId == k {
+		return i
+	}
+	return -1
+}
+
+// Rank 名次从1开始，不在榜上返回false
+func (m *Mirror[K, V]) Rank(k K) (int32, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := m.find(k)
+	return int32(i + 1), i >= 0
+}
+
+// Range 第start到end名（含），返回拷贝，超出范围的部分截掉
+func (m *Mirror[K, V]) Range(start int32, end int32) []Ranker[K, V] {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if start < 1 {
+		start = 1
+	}
+	if int(end) > len(m.list) {
+		end = int32(len(m.list))
+	}
+	if start > end {
+		return nil
+	}
+	return append([]Ranker[K, V](nil), m.list[start-1:end]...)
+}
+
+func (m *Mirror[K, V]) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.list)
+}
+
+// Lag 已经发出但镜像还没应用的变动数，0表示已经追上（不包括stale期间丢掉的）
+func (m *Mirror[K, V]) Lag() int64 {
+	return m.sent.Load() - m.applied.Load()
+}
+
+// Stale 队列满丢过delta、还在等全量快照时为true，这期间的查询结果可能缺变动
+func (m *Mirror[K, V]) Stale() bool {
+	return m.stale.Load()
+}
+
+// Close 停掉镜像的goroutine，榜会在下次变动时把它摘掉
+func (m *Mirror[K, V]) Close() {
+	if m.closed.CompareAndSwap(false, true) {
+		close(m.done)
+	}
+}
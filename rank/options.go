@@ -0,0 +1,53 @@
+package rank
+
+import "fmt"
+
+// TieBreak 同分时谁排前面
+type TieBreak int32
+
+const (
+	TieBreakEarlierFirst TieBreak = 0 // 先达到这个分数的排前面（默认，大部分榜单是这个规则）
+	TieBreakLaterFirst   TieBreak = 1 // 后达到的排前面（比如伤害榜，最新打出这个伤害的人上榜）
+	TieBreakKeyOrder     TieBreak = 2 // 不看时间，按RankerId从小到大
+)
+
+type rankOptions struct {
+	tieBreak         TieBreak
+	minScore         int64
+	hasMinScore      bool
+	minMatches       int32
+	visibleRank      int32    // 给客户端看的名次上限，见visible.go
+	rankMode         RankMode // 同分的显示名次，见display_rank.go
+	antiCheatOptions          // 反作弊规则，见anticheat.go
+}
+
+// Option NewRank的可选参数
+type Option func(*rankOptions)
+
+func WithTieBreak(t TieBreak) Option {
+	return func(o *rankOptions) {
+		o.tieBreak = t
+	}
+}
+
+// keyLess K只约束了comparable，没法直接比大小，常用的整数和字符串key单独处理，其他类型按打印出来的字符串比
+func keyLess[K comparable](a, b K) bool {
+	switch av := any(a).(type) {
+	case int:
+		return av < any(b).(int)
+	case int32:
+		return av < any(b).(int32)
+	case int64:
+		return av < any(b).(int64)
+	case uint:
+		return av < any(b).(uint)
+	case uint32:
+		return av < any(b).(uint32)
+	case uint64:
+		return av < any(b).(uint64)
+	case string:
+		return av < any(b).(string)
+	default:
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	}
+}
@@ -0,0 +1,39 @@
+package rank
+
+// 每个ranker可以带一份展示用的Payload（名字、头像、区服id……业务自己序列化成[]byte），
+// Range、镜像、快照都会带上，排行榜页面不用再按id逐行查一遍玩家信息。
+// 榜不解析Payload，也不参与排序。UpdateRankerData时Payload传nil表示保留原来的；
+// 镜像在别的goroutine里读同一个切片，所以不要原地改Payload的内容，要换就整个换（SetPayload）
+
+// payloadOf 当前的Payload，没有这个key返回nil
+func (rb *RankBase[K, V]) payloadOf(k K) []byte {
+	if r, ok := rb.unqualified[k]; ok {
+		return r.Payload
+	}
+	if r, err := rb.GetRankerDataByKey(k); err == nil {
+		return r.Payload
+	}
+	return nil
+}
+
+// SetPayload 只换展示数据（改名、换头像），不动分数和名次
+func (rb *RankBase[K, V]) SetPayload(k K, payload []byte) error {
+	if r, ok := rb.unqualified[k]; ok {
+		r.Payload = payload
+		rb.appendJournal(k, r)
+		return nil
+	}
+	r, err := rb.GetRankerDataByKey(k)
+	if err != nil {
+		return err
+	}
+	r.Payload = payload
+	rb.feedMirrors(k)
+	rb.appendJournal(k, r)
+	return nil
+}
+
+// GetPayload 没有这个key返回nil
+func (rb *RankBase[K, V]) GetPayload(k K) []byte {
+	return rb.payloadOf(k)
+}
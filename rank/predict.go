@@ -0,0 +1,75 @@
+package rank
+
+import "fmt"
+
+// 假设查询：某个分数现在能排第几、进前N名要多少分，不往榜里插东西。"再得X分进入前100名"这种UI用。
+// 按名次在跳表上二分（每次按名次取节点是O(log n)，总共O(log²n)），在主循环里调
+
+// ahead value为v的新节点会不会排在e前面。同分时按这个榜的规则：默认先到先得，新来的排在同分的后面；
+// TieBreakLaterFirst排在同分的前面；TieBreakKeyOrder不知道key，保守按排在后面算
+func (rb *RankBase[K, V]) ahead(v V, e *Ranker[K, V]) bool {
+	if rb.tieBreak == TieBreakLaterFirst {
+		return v >= e.Value
+	}
+	return v > e.Value
+}
+
+// PredictRank 分数v现在能排第几，低于上榜最低分返回0。不排除任何人（已经在榜上的玩家问自己涨分后的名次用PredictRankFor）
+func (rb *RankBase[K, V]) PredictRank(v V) int32 {
+	if rb.hasMinScore && int64(v) < rb.minScore {
+		return 0
+	}
+	// 找第一个v能排在它前面的名次
+	lo, hi := int32(1), rb.rankMain.GetElementsCount()+1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		e, err := rb.GetRankerDataByRank(mid)
+		if err != nil {
+			return 0
+		}
+		if rb.ahead(v, e) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo
+}
+
+// PredictRankFor k的分数变成v之后排第几，k自己现在在榜上的位置不算
+func (rb *RankBase[K, V]) PredictRankFor(k K, v V) int32 {
+	r := rb.PredictRank(v)
+	if r == 0 || !rb.Qualified(k) {
+		return r
+	}
+	if cur, err := rb.GetRank(k); err == nil && cur < r {
+		r--
+	}
+	return r
+}
+
+// ScoreToReach 现在至少要多少分才能排到第rank名（含），榜上人数不到rank时只要够上榜最低分
+func (rb *RankBase[K, V]) ScoreToReach(rank int32) (V, error) {
+	if rank <= 0 {
+		return 0, fmt.Errorf("RankBase::ScoreToReach error: illegal rank %d", rank)
+	}
+	var need V
+	if rb.hasMinScore && rb.minScore > 0 {
+		need = V(rb.minScore)
+	}
+	if rank > rb.rankMain.GetElementsCount() {
+		return need, nil
+	}
+	e, err := rb.GetRankerDataByRank(rank)
+	if err != nil {
+		return 0, err
+	}
+	v := e.Value
+	if rb.tieBreak != TieBreakLaterFirst {
+		v++
+	}
+	if v > need {
+		need = v
+	}
+	return need, nil
+}
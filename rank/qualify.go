@@ -0,0 +1,57 @@
+package rank
+
+// 上榜资格：不满足条件的ranker照样记在dict里（分数照常累计），但不进跳表，不出现在排名里，
+// 等哪次更新满足条件了再自动上榜。比如竞技场要求至少打满10场才上榜
+
+// WithMinScore 分数低于min的不上榜
+func WithMinScore(min int64) Option {
+	return func(o *rankOptions) {
+		o.minScore = min
+		o.hasMinScore = true
+	}
+}
+
+// WithMinMatches 场次（Ranker.Matches）少于min的不上榜
+func WithMinMatches(min int32) Option {
+	return func(o *rankOptions) {
+		o.minMatches = min
+	}
+}
+
+// SetQualifier 自定义上榜条件，在最低分、最少场次之外再判断。Option不带泛型参数，所以单独一个方法。
+// 只对之后的Add/Update生效，已经在榜上的不会重新判断
+func (rb *RankBase[K, V]) SetQualifier(f func(*Ranker[K, V]) bool) {
+	rb.qualifier = f
+}
+
+func (rb *RankBase[K, V]) qualified(r *Ranker[K, V]) bool {
+	if rb.hasMinScore && int64(r.Value) < rb.minScore {
+		return false
+	}
+	if r.Matches < rb.minMatches {
+		return false
+	}
+	if rb.qualifier != nil && !rb.qualifier(r) {
+		return false
+	}
+	return true
+}
+
+// Qualified k是否在榜上可见（不存在也返回false）
+func (rb *RankBase[K, V]) Qualified(k K) bool {
+	if _, ok := rb.dict[k]; !ok {
+		return false
+	}
+	_, hidden := rb.unqualified[k]
+	return !hidden
+}
+
+// GetUnqualified 取还没上榜的ranker数据
+func (rb *RankBase[K, V]) GetUnqualified(k K) (*Ranker[K, V], bool) {
+	r, ok := rb.unqualified[k]
+	return r, ok
+}
+
+func (rb *RankBase[K, V]) UnqualifiedCount() int {
+	return len(rb.unqualified)
+}
@@ -19,6 +19,8 @@ type Ranker[K comparable, V SortableInt] struct {
 	RankerId   K
 	Value      V
 	UpdateTime int64
+	Matches    int32  // 参与场次，只有设置了WithMinMatches的榜才用
+	Payload    []byte // 展示用的附带数据（名字、头像、区服……），业务自己序列化，榜不解析，见payload.go
 	rankPtr    *RankBase[K, V]
 }
 
@@ -41,7 +43,24 @@ func (r *Ranker[K, V]) Less(i skiplist.ISkiplistElement[K]) bool {
 	if r.Value < ii.Value {
 		return false
 	}
-	return r.UpdateTime < ii.UpdateTime
+	tieBreak := TieBreakEarlierFirst
+	if r.rankPtr != nil {
+		tieBreak = r.rankPtr.tieBreak
+	}
+	switch tieBreak {
+	case TieBreakLaterFirst:
+		if r.UpdateTime != ii.UpdateTime {
+			return r.UpdateTime > ii.UpdateTime
+		}
+	case TieBreakKeyOrder:
+		return keyLess(r.RankerId, ii.RankerId)
+	default:
+		if r.UpdateTime != ii.UpdateTime {
+			return r.UpdateTime < ii.UpdateTime
+		}
+	}
+	// 时间也相同时按key兜底，保证两个不同节点之间一定分得出先后（skiplist不接受等值节点）
+	return keyLess(r.RankerId, ii.RankerId)
 }
 
 // GetRank 获得这个节点在所在排行榜上的排名（rankPtr是用在这儿的）不需要大费周章地在业务层找具体排行榜实例的位置避免出差错。（用在使用Range批量捞起区间内ranker，要取它们的实际排名写到邮件里）
@@ -53,19 +72,57 @@ func (r *Ranker[K, V]) GetRank() (ret int32, err error) {
 }
 
 type RankBase[K comparable, V SortableInt] struct {
-	rankMain *skiplist.SkipList[K]
-	dict     map[K]V
-}
-
-func NewRank[K comparable, V SortableInt]() *RankBase[K, V] {
+	rankOptions
+	rankMain    *skiplist.SkipList[K]
+	dict        map[K]V             // 包括还没上榜的
+	unqualified map[K]*Ranker[K, V] // 不满足上榜条件的，不在跳表里
+	qualifier   func(*Ranker[K, V]) bool
+	topSubs     []*topNSub[K, V]
+	topSubSeq   int
+	mirrors     []*Mirror[K, V]
+	antiCheat   antiCheat[K, V]
+	shadows     []*Shadow[K, V]
+	journal     *Journal[K, V] // 见journal.go
+	replaying   bool           // 正在从快照、日志恢复，不过反作弊、不写日志
+	merging     bool           // 正在合并别的服同步过来的变动（对面已经校验过），不过反作弊，日志照写
+}
+
+func NewRank[K comparable, V SortableInt](opts ...Option) *RankBase[K, V] {
+	o := &rankOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
 	return &RankBase[K, V]{
-		rankMain: skiplist.NewSkipList[K](),
-		dict:     make(map[K]V),
+		rankOptions: *o,
+		rankMain:    skiplist.NewSkipList[K](),
+		dict:        make(map[K]V),
+		unqualified: make(map[K]*Ranker[K, V]),
 	}
 }
 
 func (rb *RankBase[K, V]) AddRanker(e *Ranker[K, V]) (err error) {
+	defer func() {
+		if err == nil && len(rb.topSubs) > 0 {
+			rb.notifyTopN()
+		}
+		if err == nil {
+			rb.feedMirrors(e.Key())
+			rb.feedShadows(e.Key(), e)
+			rb.appendJournal(e.Key(), e)
+		}
+	}()
 	e.rankPtr = rb
+	if _, ok := rb.unqualified[e.Key()]; ok {
+		return fmt.Errorf("RankBase::AddRanker error: key %v already exists", e.Key())
+	}
+	if !rb.qualified(e) {
+		if _, ok := rb.dict[e.Key()]; ok {
+			return fmt.Errorf("RankBase::AddRanker error: key %v already exists", e.Key())
+		}
+		rb.unqualified[e.Key()] = e
+		rb.dict[e.Key()] = e.Value
+		return nil
+	}
 	defer func() {
 		if err == nil {
 			rb.dict[e.Key()] = e.Value
@@ -75,32 +132,66 @@ func (rb *RankBase[K, V]) AddRanker(e *Ranker[K, V]) (err error) {
 }
 
 func (rb *RankBase[K, V]) RemoveRanker(e *Ranker[K, V]) (err error) {
+	return rb.RemoveRankerByKey(e.Key())
+}
+
+func (rb *RankBase[K, V]) RemoveRankerByKey(k K) (err error) {
 	defer func() {
+		if err == nil && len(rb.topSubs) > 0 {
+			rb.notifyTopN()
+		}
 		if err == nil {
-			delete(rb.dict, e.Key())
+			rb.feedMirrors(k)
+			rb.feedShadows(k, nil)
+			rb.appendJournal(k, nil)
 		}
 	}()
-	return rb.rankMain.DeleteByKey(e.Key())
-}
-
-func (rb *RankBase[K, V]) RemoveRankerByKey(k K) (err error) {
+	delete(rb.antiCheat.gains, k)
+	if _, ok := rb.unqualified[k]; ok {
+		delete(rb.unqualified, k)
+		delete(rb.dict, k)
+		return nil
+	}
 	defer func() {
-		if err != nil {
+		if err == nil {
 			delete(rb.dict, k)
 		}
 	}()
 	return rb.rankMain.DeleteByKey(k)
 }
 
-func (rb *RankBase[K, V]) UpdateRankerData(newData IRanker[K]) (err error) {
-	err = rb.rankMain.DeleteByKey(newData.Key())
-	if err != nil {
+func (rb *RankBase[K, V]) UpdateRankerData(newData *Ranker[K, V]) (err error) {
+	if err = rb.checkUpdate(newData); err != nil {
+		return
+	}
+	defer func() {
+		if err == nil && len(rb.topSubs) > 0 {
+			rb.notifyTopN()
+		}
+		if err == nil {
+			rb.feedMirrors(newData.Key())
+			rb.feedShadows(newData.Key(), newData)
+			rb.appendJournal(newData.Key(), newData)
+		}
+	}()
+	if newData.Payload == nil {
+		newData.Payload = rb.payloadOf(newData.Key())
+	}
+	if _, ok := rb.unqualified[newData.Key()]; ok {
+		delete(rb.unqualified, newData.Key())
+	} else if err = rb.rankMain.DeleteByKey(newData.Key()); err != nil {
 		return
 	}
 	newData.rankPtr = rb
+	if !rb.qualified(newData) {
+		// 分数掉到门槛以下（或者自定义条件不满足了）就从榜上撤下来
+		rb.unqualified[newData.Key()] = newData
+		rb.dict[newData.Key()] = newData.Value
+		return nil
+	}
 	defer func() {
 		if err == nil {
-			rb.dict[e.Key()] = e.Value
+			rb.dict[newData.Key()] = newData.Value
 		}
 	}()
 	return rb.rankMain.Add(newData)
@@ -114,13 +205,13 @@ func (rb *RankBase[K, V]) GetReverseRank(rankerKey K) (ret int32, err error) {
 	return rb.rankMain.GetReverseRankByKey(rankerKey)
 }
 
-func (rb *RankBase[K, V]) Range(startAt int32, endAt int32) (ret []IRanker[K], err error) {
+func (rb *RankBase[K, V]) Range(startAt int32, endAt int32) (ret []*Ranker[K, V], err error) {
 	nds, err := rb.rankMain.GetRange(startAt, endAt)
 	if err != nil {
 		return
 	}
 	for _, nd := range nds {
-		ndv, ok := nd.(IRanker[K])
+		ndv, ok := nd.(*Ranker[K, V])
 		if !ok {
 			panic("RankBase::Range error: existing element from GetRange is not kind of RankerBase")
 		}
@@ -1,7 +1,15 @@
 package rank
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"test/timer"
 	"testing"
 	"time"
 )
@@ -51,3 +59,671 @@ func TestRank(t *testing.T) {
 	}
 	log.Printf("\n")
 }
+
+func TestMemStatsCompact(t *testing.T) {
+	r := NewRank[int, int]()
+	for i := 1; i <= 5; i++ {
+		r.AddRanker(&Ranker[int, int]{RankerId: i, Value: i * 10, UpdateTime: int64(i)})
+	}
+	before := r.MemStats()
+	if before.Elements != 5 || before.DictEntries != 5 || before.LevelNodes[0] != 7 {
+		t.Fatalf("unexpected stats before compact: %+v", before)
+	}
+	if err := r.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after := r.MemStats()
+	if after.Elements != 5 || after.ApproxBytes <= 0 || len(after.LevelNodes) != int(after.Layers) {
+		t.Fatalf("unexpected stats after compact: %+v", after)
+	}
+	top, err := r.GetRankerDataByRank(1)
+	if err != nil || top.RankerId != 5 {
+		t.Fatalf("rank broken after compact: %v %v", top, err)
+	}
+	if rk, _ := top.GetRank(); rk != 1 {
+		t.Fatalf("rankPtr broken after compact: %d", rk)
+	}
+}
+
+func TestTieBreak(t *testing.T) {
+	cases := []struct {
+		tieBreak TieBreak
+		first    int
+	}{
+		{TieBreakEarlierFirst, 3},
+		{TieBreakLaterFirst, 1},
+		{TieBreakKeyOrder, 1},
+	}
+	for _, c := range cases {
+		r := NewRank[int, int](WithTieBreak(c.tieBreak))
+		r.AddRanker(&Ranker[int, int]{RankerId: 3, Value: 100, UpdateTime: 1})
+		r.AddRanker(&Ranker[int, int]{RankerId: 2, Value: 100, UpdateTime: 2})
+		r.AddRanker(&Ranker[int, int]{RankerId: 1, Value: 100, UpdateTime: 3})
+		top, err := r.GetRankerDataByRank(1)
+		if err != nil || top.RankerId != c.first {
+			t.Fatalf("tie break %d: expect %d first, got %v %v", c.tieBreak, c.first, top, err)
+		}
+	}
+}
+
+func TestAggregateRank(t *testing.T) {
+	r := NewAggregateRank[int, int64, int]()
+	r.AddContribution(1, 100, 30)
+	r.AddContribution(1, 101, 10)
+	r.AddContribution(2, 200, 25)
+	r.AddContribution(3, 300, 5)
+	if rk, _ := r.GetRank(1); rk != 1 {
+		t.Fatalf("guild 1 should be first, got %d", rk)
+	}
+	r.RemoveMember(1, 100)
+	if rk, _ := r.GetRank(1); rk != 2 {
+		t.Fatalf("guild 1 should drop to 2nd, got %d", rk)
+	}
+	r.AddContribution(1, 102, 30)
+	shares := r.MemberShares(1)
+	if len(shares) != 2 || shares[0].MemberId != 102 || shares[0].Ratio != 0.75 {
+		t.Fatalf("unexpected shares: %+v", shares)
+	}
+}
+
+func TestSyncBoard(t *testing.T) {
+	a := NewSyncBoard[int, int]("s1")
+	b := NewSyncBoard[int, int]("s2")
+	a.Set(&Ranker[int, int]{RankerId: 1, Value: 10, UpdateTime: 100})
+	a.Set(&Ranker[int, int]{RankerId: 2, Value: 20, UpdateTime: 100})
+	b.Set(&Ranker[int, int]{RankerId: 2, Value: 50, UpdateTime: 200})
+	b.Set(&Ranker[int, int]{RankerId: 3, Value: 30, UpdateTime: 100})
+	da, _ := a.ExportDeltas()
+	db, _ := b.ExportDeltas()
+	a.MergeDeltas(db)
+	b.MergeDeltas(da)
+	for _, board := range []*SyncBoard[int, int]{a, b} {
+		top, err := board.GetRankerDataByRank(1)
+		if err != nil || top.RankerId != 2 || top.Value != 50 {
+			t.Fatalf("board %s not converged: %v %v", board.serverId, top, err)
+		}
+		if board.rankMain.GetElementsCount() != 3 {
+			t.Fatalf("board %s should have 3 rankers", board.serverId)
+		}
+	}
+}
+
+func TestSyncBoardRetry(t *testing.T) {
+	a := NewSyncBoard[int, int]("s1")
+	b := NewSyncBoard[int, int]("s2")
+	// 每个服收到的第一次推送都失败
+	serve := func(board *SyncBoard[int, int]) *httptest.Server {
+		var calls atomic.Int32
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				http.Error(w, "down", http.StatusServiceUnavailable)
+				return
+			}
+			board.ServeHTTP(w, r)
+		}))
+	}
+	sa, sb := serve(a), serve(b)
+	defer sa.Close()
+	defer sb.Close()
+	client := &http.Client{Timeout: time.Second}
+
+	a.Set(&Ranker[int, int]{RankerId: 1, Value: 10, UpdateTime: 100})
+	a.Set(&Ranker[int, int]{RankerId: 2, Value: 20, UpdateTime: 100})
+	b.Set(&Ranker[int, int]{RankerId: 2, Value: 50, UpdateTime: 200})
+	b.Set(&Ranker[int, int]{RankerId: 3, Value: 30, UpdateTime: 100})
+	converged := func() bool {
+		for _, board := range []*SyncBoard[int, int]{a, b} {
+			top, err := board.GetRankerDataByRank(1)
+			if err != nil || top.RankerId != 2 || top.Value != 50 || board.rankMain.GetElementsCount() != 3 || board.Unacked("") != 0 {
+				return false
+			}
+		}
+		return true
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for !converged() {
+		if time.Now().After(deadline) {
+			t.Fatalf("not converged, unacked a %d b %d", a.Unacked(""), b.Unacked(""))
+		}
+		a.syncOnce(client, []string{sb.URL})
+		b.syncOnce(client, []string{sa.URL})
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 本地旧的写入不会覆盖已经合并进来的新数据
+	if err := a.Set(&Ranker[int, int]{RankerId: 2, Value: 99, UpdateTime: 150}); err == nil {
+		t.Fatal("stale local write accepted")
+	}
+	if d, _ := a.GetRankerDataByKey(2); d.Value != 50 {
+		t.Fatalf("stale local write applied: %+v", d)
+	}
+}
+
+func TestQualify(t *testing.T) {
+	r := NewRank[int, int](WithMinScore(10), WithMinMatches(5))
+	r.AddRanker(&Ranker[int, int]{RankerId: 1, Value: 50, Matches: 5, UpdateTime: 100})
+	r.AddRanker(&Ranker[int, int]{RankerId: 2, Value: 80, Matches: 3, UpdateTime: 100})
+	r.AddRanker(&Ranker[int, int]{RankerId: 3, Value: 5, Matches: 9, UpdateTime: 100})
+	if _, err := r.GetRank(2); err == nil || r.Qualified(2) || r.UnqualifiedCount() != 2 {
+		t.Fatalf("ranker 2 should be hidden")
+	}
+	r.UpdateRankerData(&Ranker[int, int]{RankerId: 2, Value: 80, Matches: 5, UpdateTime: 200})
+	if rk, err := r.GetRank(2); err != nil || rk != 1 {
+		t.Fatalf("ranker 2 should be first after qualifying, got %d %v", rk, err)
+	}
+	if st := r.MemStats(); st.DictEntries != 3 || st.Unqualified != 1 {
+		t.Fatalf("unexpected mem stats %+v", st)
+	}
+}
+
+func TestTopNFeed(t *testing.T) {
+	r := NewRank[int, int]()
+	r.AddRanker(&Ranker[int, int]{RankerId: 1, Value: 30, UpdateTime: 100})
+	r.AddRanker(&Ranker[int, int]{RankerId: 2, Value: 20, UpdateTime: 100})
+	var got []TopNDelta[int, int]
+	r.SubscribeTopN(2, func(d []TopNDelta[int, int]) { got = d })
+	if len(got) != 2 || got[0].Kind != TopNEntered {
+		t.Fatalf("subscribe should push full top n, got %+v", got)
+	}
+	got = nil
+	r.AddRanker(&Ranker[int, int]{RankerId: 3, Value: 10, UpdateTime: 100})
+	if got != nil {
+		t.Fatalf("outside top n should not notify, got %+v", got)
+	}
+	r.AddRanker(&Ranker[int, int]{RankerId: 4, Value: 25, UpdateTime: 100})
+	kinds := map[int]TopNDeltaKind{}
+	for _, d := range got {
+		kinds[d.RankerId] = d.Kind
+	}
+	if len(got) != 2 || kinds[4] != TopNEntered || kinds[2] != TopNLeft {
+		t.Fatalf("unexpected deltas %+v", got)
+	}
+}
+
+func TestSampleInRange(t *testing.T) {
+	r := NewRank[int, int]()
+	for i := 1; i <= 5; i++ {
+		r.AddRanker(&Ranker[int, int]{RankerId: i, Value: i * 10, UpdateTime: 100})
+	}
+	a, err := r.SampleInRange(2, 5, 2, 42)
+	if err != nil || len(a) != 2 {
+		t.Fatalf("sample failed: %v %v", a, err)
+	}
+	b, _ := r.SampleInRange(2, 5, 2, 42)
+	if a[0] != b[0] || a[1] != b[1] {
+		t.Fatalf("same seed should give same sample")
+	}
+	for _, x := range a {
+		if rk, _ := x.GetRank(); rk < 2 || rk > 5 {
+			t.Fatalf("sampled rank %d out of range", rk)
+		}
+	}
+	if all, _ := r.SampleInRange(4, 100, 10, 1); len(all) != 2 {
+		t.Fatalf("should return whole band when n exceeds it, got %d", len(all))
+	}
+}
+
+func TestTemporaryRank(t *testing.T) {
+	var settled []*Ranker[int, int]
+	tr, err := NewTemporaryRank[int, int](9001, time.Now().Add(time.Hour), func(final []*Ranker[int, int]) { settled = final })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewTemporaryRank[int, int](9001, time.Now().Add(time.Hour), nil); err == nil {
+		t.Fatalf("duplicated activity id accepted")
+	}
+	for i := 1; i <= 3; i++ {
+		tr.AddRanker(&Ranker[int, int]{RankerId: i, Value: i * 10, UpdateTime: int64(i)})
+	}
+	if len(GetManager().List()) != 1 {
+		t.Fatalf("board not registered")
+	}
+	if err = GetManager().Settle(9001); err != nil {
+		t.Fatal(err)
+	}
+	if len(settled) != 3 || settled[0].RankerId != 3 {
+		t.Fatalf("settle result wrong: %v", settled)
+	}
+	if !tr.Closed() || tr.Len() != 0 || len(GetManager().List()) != 0 {
+		t.Fatalf("board not freed after settle")
+	}
+	if tr.AddRanker(&Ranker[int, int]{RankerId: 4, Value: 1}) == nil {
+		t.Fatalf("add after settle accepted")
+	}
+	for _, p := range timer.GetInst().Dump() {
+		if p.Tags.Has(tempRankTag(9001)) {
+			t.Fatalf("settle trigger not canceled")
+		}
+	}
+}
+
+func TestApproxRank(t *testing.T) {
+	a, err := NewApproxRank[int, int](3, 0, 9999, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10000; i++ {
+		a.Set(i, i, int64(i))
+	}
+	if r, ok := a.ExactRank(9999); !ok || r != 1 {
+		t.Fatalf("top1 exact rank = %d %v", r, ok)
+	}
+	if _, ok := a.ExactRank(9996); ok {
+		t.Fatalf("rank 4 should not be exact")
+	}
+	// 分数均匀分布时，分数i大约排在前(10000-i)/100 %
+	for _, k := range []int{9000, 5000, 1234, 10} {
+		p, _ := a.TopPercent(k)
+		want := float64(10000-k) / 100
+		if p < want-0.5 || p > want+0.5 {
+			t.Errorf("key %d top %.2f%%, want about %.2f%%", k, p, want)
+		}
+	}
+	// 前三名有人掉分，要从剩下的人里补上
+	a.Set(9999, 1, 20000)
+	if top := a.Top(); len(top) != 3 || top[0].RankerId != 9998 || top[2].RankerId != 9996 {
+		t.Fatalf("top not refilled: %v %v %v", top[0].RankerId, top[1].RankerId, top[2].RankerId)
+	}
+	a.Remove(9998)
+	if r, ok := a.ExactRank(9995); !ok || r != 3 || a.Len() != 9999 {
+		t.Fatalf("after remove: rank %d %v len %d", r, ok, a.Len())
+	}
+}
+
+func TestMirror(t *testing.T) {
+	r := NewRank[int, int]()
+	r.AddRanker(&Ranker[int, int]{RankerId: 1, Value: 10, UpdateTime: 1})
+	m := r.NewMirror(2)
+	defer m.Close()
+	m.resyncInterval = 0 // 每次变动都可以补全量，不用等timer
+	r.AddRanker(&Ranker[int, int]{RankerId: 2, Value: 30, UpdateTime: 2})
+	r.AddRanker(&Ranker[int, int]{RankerId: 3, Value: 20, UpdateTime: 3})
+	r.AddRanker(&Ranker[int, int]{RankerId: 4, Value: 20, UpdateTime: 1})
+	wait := func() {
+		for i := 0; i < 1000 && (m.Lag() > 0 || m.Stale()); i++ {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	wait()
+	// 队列只有2，中间可能丢过delta，最后一次变动时会补发全量
+	r.AddRanker(&Ranker[int, int]{RankerId: 5, Value: 5, UpdateTime: 1})
+	wait()
+	got := m.Range(1, 10)
+	want := []int{2, 4, 3, 1, 5}
+	if len(got) != len(want) {
+		t.Fatalf("mirror len %d, want %d", len(got), len(want))
+	}
+	for i, k := range want {
+		if got[i].RankerId != k {
+			t.Fatalf("mirror rank %d = %d, want %d", i+1, got[i].RankerId, k)
+		}
+	}
+	if rk, ok := m.Rank(3); !ok || rk != 3 {
+		t.Fatalf("mirror Rank(3) = %d %v", rk, ok)
+	}
+}
+
+func TestMirrorResync(t *testing.T) {
+	r := NewRank[int, int]()
+	m := r.NewMirror(1)
+	defer m.Close()
+	// 镜像goroutine卡在apply上，队列很快就满
+	m.mu.Lock()
+	for i := 1; i <= 5; i++ {
+		r.AddRanker(&Ranker[int, int]{RankerId: i, Value: i * 10, UpdateTime: 1, Matches: int32(i)})
+	}
+	if !m.Stale() || m.resyncs != 1 || !m.resyncQueued {
+		t.Fatalf("stale %v resyncs %d queued %v", m.Stale(), m.resyncs, m.resyncQueued)
+	}
+	m.mu.Unlock()
+	for i := 0; i < 1000 && m.Lag() > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	// 到点补拍（相当于timer触发）
+	m.lastResync = time.Time{}
+	r.resyncMirror(m)
+	for i := 0; i < 1000 && (m.Lag() > 0 || m.Stale()); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	r.UpdateRankerData(&Ranker[int, int]{RankerId: 2, Value: 60, UpdateTime: 2, Matches: 7})
+	for i := 0; i < 1000 && m.Lag() > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	got := m.Range(1, 5)
+	if len(got) != 5 || got[0].RankerId != 2 || got[0].Matches != 7 || got[4].Matches != 1 {
+		t.Fatalf("mirror after resync %+v", got)
+	}
+	for i, k := range []int{2, 5, 4, 3, 1} {
+		if rk, ok := m.Rank(k); !ok || rk != int32(i+1) {
+			t.Fatalf("mirror Rank(%d) = %d %v", k, rk, ok)
+		}
+	}
+}
+
+func TestVisibleRank(t *testing.T) {
+	r := NewRank[int, int](WithVisibleRank(3), WithMinScore(1))
+	for i := 1; i <= 4; i++ {
+		r.AddRanker(&Ranker[int, int]{RankerId: i, Value: 100 - i, UpdateTime: 1})
+	}
+	r.AddRanker(&Ranker[int, int]{RankerId: 5, Value: 0, UpdateTime: 1})
+	if c, err := r.GetRankForClient(2); err != nil || c.String() != "2" {
+		t.Fatalf("rank 2 = %v %v", c, err)
+	}
+	if c, _ := r.GetRankForClient(4); !c.Capped || c.String() != "3+" {
+		t.Fatalf("rank 4 = %v", c)
+	}
+	if c, err := r.GetRankForClient(5); err != nil || c.Ranked {
+		t.Fatalf("unqualified = %v %v", c, err)
+	}
+	if list, err := r.RangeForClient(2, 10); err != nil || len(list) != 2 {
+		t.Fatalf("RangeForClient = %d %v", len(list), err)
+	}
+	if _, err := r.RangeForClient(4, 10); err != ErrRankNotVisible {
+		t.Fatalf("expect ErrRankNotVisible, got %v", err)
+	}
+}
+
+func TestPredictRank(t *testing.T) {
+	r := NewRank[int, int](WithMinScore(10))
+	for i, v := range []int{100, 80, 80, 50, 20} {
+		r.AddRanker(&Ranker[int, int]{RankerId: i + 1, Value: v, UpdateTime: int64(i)})
+	}
+	cases := map[int]int32{200: 1, 100: 2, 90: 2, 80: 4, 60: 4, 10: 6, 5: 0}
+	for v, want := range cases {
+		if got := r.PredictRank(v); got != want {
+			t.Fatalf("PredictRank(%d) = %d, want %d", v, got, want)
+		}
+	}
+	if r.rankMain.GetElementsCount() != 5 {
+		t.Fatal("PredictRank should not modify the board")
+	}
+	// 第4名（50分）涨到90分：现在在他前面的是100、80、80，排第2
+	if got := r.PredictRankFor(4, 90); got != 2 {
+		t.Fatalf("PredictRankFor = %d", got)
+	}
+	if got := r.PredictRankFor(1, 100); got != 1 {
+		t.Fatalf("PredictRankFor self = %d", got)
+	}
+	if v, err := r.ScoreToReach(3); err != nil || v != 81 {
+		t.Fatalf("ScoreToReach(3) = %d %v", v, err)
+	}
+	if v, _ := r.ScoreToReach(100); v != 10 {
+		t.Fatalf("ScoreToReach(100) = %d", v)
+	}
+
+	later := NewRank[int, int](WithTieBreak(TieBreakLaterFirst))
+	later.AddRanker(&Ranker[int, int]{RankerId: 1, Value: 80, UpdateTime: 1})
+	if got := later.PredictRank(80); got != 1 {
+		t.Fatalf("later-first PredictRank = %d", got)
+	}
+	if v, _ := later.ScoreToReach(1); v != 80 {
+		t.Fatalf("later-first ScoreToReach = %d", v)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	r := NewRank[int, int](WithMinScore(10))
+	r.AddRanker(&Ranker[int, int]{RankerId: 1, Value: 50, UpdateTime: 1, Payload: []byte("alice")})
+	r.AddRanker(&Ranker[int, int]{RankerId: 2, Value: 5, UpdateTime: 1, Payload: []byte("bob")})
+	m := r.NewMirror(0)
+	defer m.Close()
+	// 更新分数不带Payload，保留原来的；不够格的上榜之后也带着
+	r.UpdateRankerData(&Ranker[int, int]{RankerId: 1, Value: 60, UpdateTime: 2})
+	r.UpdateRankerData(&Ranker[int, int]{RankerId: 2, Value: 70, UpdateTime: 2})
+	list, _ := r.Range(1, 2)
+	if len(list) != 2 || string(list[0].Payload) != "bob" || string(list[1].Payload) != "alice" {
+		t.Fatalf("range payload %v", list)
+	}
+	if err := r.SetPayload(1, []byte("alice2")); err != nil || string(r.GetPayload(1)) != "alice2" {
+		t.Fatalf("SetPayload %v", err)
+	}
+	for i := 0; i < 1000 && m.Lag() > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if got := m.Range(1, 2); len(got) != 2 || string(got[1].Payload) != "alice2" {
+		t.Fatalf("mirror payload %v", got)
+	}
+	var buf bytes.Buffer
+	if err := r.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r2 := NewRank[int, int]()
+	if err := r2.ReadSnapshot(&buf); err != nil || string(r2.GetPayload(2)) != "bob" {
+		t.Fatalf("snapshot payload %q %v", r2.GetPayload(2), err)
+	}
+}
+
+func TestSyncBoardMergeSkipsAntiCheat(t *testing.T) {
+	a := NewSyncBoard[int, int]("s1")
+	b := NewSyncBoard[int, int]("s2", WithMaxGainPerHour(100))
+	a.Set(&Ranker[int, int]{RankerId: 1, Value: 10, UpdateTime: 100})
+	da, _ := a.ExportDeltas()
+	b.MergeDeltas(da)
+	// s1那边已经接受的大幅涨分，合并到s2时不能被s2的反作弊拦下
+	a.Set(&Ranker[int, int]{RankerId: 1, Value: 5000, UpdateTime: 200})
+	da, _ = a.ExportDeltas()
+	if n, err := b.MergeDeltas(da); n != 1 || err != nil {
+		t.Fatalf("merge = %d, %v", n, err)
+	}
+	if got, _ := b.GetRankerDataByKey(1); got == nil || got.Value != 5000 || b.versions[1].updateTime != 200 {
+		t.Fatalf("merged ranker %v, version %v", got, b.versions[1])
+	}
+	// 本地写还是要过反作弊
+	if err := b.Set(&Ranker[int, int]{RankerId: 1, Value: 9000, UpdateTime: 300}); !errors.Is(err, ErrSuspiciousUpdate) {
+		t.Fatalf("local set err = %v", err)
+	}
+}
+
+func TestAntiCheat(t *testing.T) {
+	r := NewRank[int, int](WithMaxDelta(100), WithMaxGainPerHour(150), WithMonotonic())
+	var events []SuspiciousEvent[int, int]
+	r.OnSuspicious(func(e SuspiciousEvent[int, int]) { events = append(events, e) })
+	r.AddValidator("even_only", func(old int, rk *Ranker[int, int]) error {
+		if rk.Value%2 != 0 {
+			return fmt.Errorf("odd score %d", rk.Value)
+		}
+		return nil
+	})
+	r.AddRanker(&Ranker[int, int]{RankerId: 1, Value: 1000, UpdateTime: 1})
+	r.AddRanker(&Ranker[int, int]{RankerId: 2, Value: 500, UpdateTime: 1})
+	hour := time.Hour.Milliseconds()
+	cases := []struct {
+		value int
+		at    int64
+		rule  string
+	}{
+		{1200, 2, RuleMaxDelta},
+		{900, 3, RuleMonotonic},
+		{1081, 4, "even_only"},
+		{1080, 5, ""},
+		{1160, 6, RuleHourlyGain}, // 这小时已经涨了80
+		{1150, 7, ""},
+		{1240, 5 + hour, ""}, // 窗口从第一次涨分（5）开始，满一小时重新算
+	}
+	for _, c := range cases {
+		err := r.UpdateRankerData(&Ranker[int, int]{RankerId: 1, Value: c.value, UpdateTime: c.at})
+		if c.rule == "" {
+			if err != nil {
+				t.Fatalf("%d at %d rejected: %v", c.value, c.at, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrSuspiciousUpdate) || events[len(events)-1].Rule != c.rule || !events[len(events)-1].Rejected {
+			t.Fatalf("%d at %d: err %v, events %+v", c.value, c.at, err, events)
+		}
+	}
+	if len(events) != 4 {
+		t.Fatalf("events %+v", events)
+	}
+	if v, _ := r.GetRankerDataByKey(1); v.Value != 1240 {
+		t.Fatalf("value %d", v.Value)
+	}
+
+	// 只报不拦
+	lax := NewRank[int, int](WithMaxDelta(10), WithAntiCheatReportOnly())
+	var n int
+	lax.OnSuspicious(func(e SuspiciousEvent[int, int]) {
+		if e.Rejected || e.Old != 1 || e.New != 100 {
+			t.Fatalf("event %+v", e)
+		}
+		n++
+	})
+	lax.AddRanker(&Ranker[int, int]{RankerId: 1, Value: 1, UpdateTime: 1})
+	if err := lax.UpdateRankerData(&Ranker[int, int]{RankerId: 1, Value: 100, UpdateTime: 2}); err != nil || n != 1 {
+		t.Fatalf("report only: %v, %d events", err, n)
+	}
+}
+
+func TestShadowBoard(t *testing.T) {
+	r := NewRank[int, int]()
+	r.AddRanker(&Ranker[int, int]{RankerId: 1, Value: 300, Matches: 30, UpdateTime: 1})
+	r.AddRanker(&Ranker[int, int]{RankerId: 2, Value: 200, Matches: 5, UpdateTime: 1})
+	// 新公式：场均分
+	s := r.AttachShadow(func(rk *Ranker[int, int]) int { return rk.Value / int(rk.Matches) }, WithMinMatches(5))
+	r.AddRanker(&Ranker[int, int]{RankerId: 3, Value: 100, Matches: 2, UpdateTime: 2})
+	r.UpdateRankerData(&Ranker[int, int]{RankerId: 1, Value: 330, Matches: 31, UpdateTime: 3})
+	if v, _ := s.Board.GetRankerDataByKey(1); v == nil || v.Value != 10 {
+		t.Fatalf("shadow value %+v", v)
+	}
+	if s.Board.Qualified(3) || !r.Qualified(3) {
+		t.Fatal("shadow should apply its own qualification")
+	}
+	rep := r.CompareShadow(s, 3)
+	if rep.Overlap != 2 || rep.Moved != 2 || len(rep.Diffs) != 3 {
+		t.Fatalf("report %+v", rep)
+	}
+	if d := rep.Diffs[0]; d.Key != 1 || d.Rank != 1 || d.ShadowRank != 2 {
+		t.Fatalf("diff %+v", d)
+	}
+	if d := rep.Diffs[2]; d.Key != 3 || d.Rank != 3 || d.ShadowRank != 0 {
+		t.Fatalf("diff %+v", d)
+	}
+	s.Detach()
+	r.UpdateRankerData(&Ranker[int, int]{RankerId: 2, Value: 900, Matches: 6, UpdateTime: 4})
+	if v, _ := s.Board.GetRankerDataByKey(2); v.Value != 40 || s.Errors() != 0 {
+		t.Fatalf("detached shadow still updated %+v", v)
+	}
+}
+
+func TestDisplayRank(t *testing.T) {
+	scores := []int{100, 80, 80, 50, 50}
+	build := func(m RankMode) *RankBase[int, int] {
+		r := NewRank[int, int](WithRankMode(m))
+		for i, v := range scores {
+			r.AddRanker(&Ranker[int, int]{RankerId: i + 1, Value: v, UpdateTime: int64(i)})
+		}
+		return r
+	}
+	for _, c := range []struct {
+		mode RankMode
+		want []int32
+	}{
+		{RankModeOrdinal, []int32{1, 2, 3, 4, 5}},
+		{RankModeCompetition, []int32{1, 2, 2, 4, 4}},
+		{RankModeDense, []int32{1, 2, 2, 3, 3}},
+	} {
+		r := build(c.mode)
+		for i, want := range c.want {
+			d, err := r.GetDisplayRank(i + 1)
+			if err != nil || d.Ordinal != int32(i+1) || d.Rank != want {
+				t.Fatalf("mode %d key %d = %+v %v, want %d", c.mode, i+1, d, err, want)
+			}
+		}
+		// 从中间开始取也要对
+		list, err := r.RangeWithRank(3, 5)
+		if err != nil || len(list) != 3 {
+			t.Fatalf("mode %d range = %v %v", c.mode, list, err)
+		}
+		for i, e := range list {
+			if e.Ordinal != int32(i+3) || e.Rank != c.want[i+2] || e.RankerId != i+3 {
+				t.Fatalf("mode %d range[%d] = %+v", c.mode, i, e.DisplayRank)
+			}
+		}
+	}
+	if cr, _ := build(RankModeCompetition).GetRankForClient(5); cr.String() != "4" {
+		t.Fatalf("client rank = %v", cr)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	path := t.TempDir() + "/arena.journal"
+	r := NewRank[int, int]()
+	j, err := r.OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddRanker(&Ranker[int, int]{RankerId: 1, Value: 10, UpdateTime: 1})
+	r.AddRanker(&Ranker[int, int]{RankerId: 2, Value: 20, UpdateTime: 2})
+	var snap bytes.Buffer
+	if err = r.WriteSnapshot(&snap); err != nil {
+		t.Fatal(err)
+	}
+	// 快照之后的变动
+	r.UpdateRankerData(&Ranker[int, int]{RankerId: 1, Value: 900, UpdateTime: 3})
+	r.AddRanker(&Ranker[int, int]{RankerId: 3, Value: 5, UpdateTime: 4})
+	r.SetPayload(3, []byte("bob"))
+	r.UpdateRankerData(&Ranker[int, int]{RankerId: 3, Value: 1500, UpdateTime: 5})
+	if err = j.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// 崩溃时最后一行只写了一半
+	r.CloseJournal()
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"id":2,"val`)
+	f.Close()
+
+	check := func(name string, got *RankBase[int, int]) {
+		want := map[int]int{1: 900, 2: 20, 3: 1500}
+		for k, v := range want {
+			d, err := got.GetRankerDataByKey(k)
+			if err != nil || d.Value != v {
+				t.Fatalf("%s: key %d = %+v %v", name, k, d, err)
+			}
+		}
+		if p := got.GetPayload(3); string(p) != "bob" {
+			t.Fatalf("%s: payload = %q", name, p)
+		}
+		if rk, _ := got.GetRank(3); rk != 1 {
+			t.Fatalf("%s: rank of 3 = %d", name, rk)
+		}
+	}
+	// 最近的快照+日志；反作弊不拦重放
+	r2 := NewRank[int, int](WithMaxDelta(100))
+	if err = r2.ReadSnapshot(bytes.NewReader(snap.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	n, err := r2.ReplayJournal(path)
+	if err != nil || n != 6 {
+		t.Fatalf("replay = %d %v", n, err)
+	}
+	check("latest", r2)
+	// 最近的快照没存下来，用空榜（更早的快照）也能恢复
+	r3 := NewRank[int, int]()
+	if _, err = r3.ReplayJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	check("older", r3)
+	// 重放时半行已经截掉了，重新挂上日志接着写不会拼到半行后面；中间写坏的行跳过
+	if b, _ := os.ReadFile(path); len(b) == 0 || b[len(b)-1] != '\n' {
+		t.Fatalf("journal not truncated to last full line: %q", b)
+	}
+	f, _ = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("garbage\n")
+	f.Close()
+	j3, err := r3.OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r3.OpenJournal(path); err == nil {
+		t.Fatal("second journal should fail")
+	}
+	r3.UpdateRankerData(&Ranker[int, int]{RankerId: 2, Value: 30, UpdateTime: 6})
+	j3.Flush()
+	r3.CloseJournal()
+	r4 := NewRank[int, int]()
+	if n, err = r4.ReplayJournal(path); err != nil || n != 7 {
+		t.Fatalf("replay after reopen = %d %v", n, err)
+	}
+	if d, _ := r4.GetRankerDataByKey(2); d == nil || d.Value != 30 {
+		t.Fatalf("key 2 after reopen = %+v", d)
+	}
+}
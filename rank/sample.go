@@ -0,0 +1,50 @@
+package rank
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// SampleInRange 在名次[startRank, endRank]里均匀随机抽n个不重复的ranker，按名次从前到后返回。
+// 同样的seed和同样的榜单数据抽出来的结果一样（匹配候选、幸运抽奖要能复现）。
+// endRank超过榜上人数时按榜上人数算，区间内人数不足n时全部返回
+func (rb *RankBase[K, V]) SampleInRange(startRank int32, endRank int32, n int, seed int64) ([]*Ranker[K, V], error) {
+	if startRank < 1 || endRank < startRank {
+		return nil, fmt.Errorf("RankBase::SampleInRange error: illegal range [%d, %d]", startRank, endRank)
+	}
+	if cnt := rb.rankMain.GetElementsCount(); endRank > cnt {
+		endRank = cnt
+	}
+	if n <= 0 || endRank < startRank {
+		return nil, nil
+	}
+	size := int64(endRank - startRank + 1)
+	if int64(n) >= size {
+		return rb.Range(startRank, endRank)
+	}
+	// Floyd抽样：只需要n次随机，不用把整个区间洗一遍
+	r := rand.New(rand.NewSource(seed))
+	picked := make(map[int64]struct{}, n)
+	for j := size - int64(n); j < size; j++ {
+		v := r.Int63n(j + 1)
+		if _, ok := picked[v]; ok {
+			v = j
+		}
+		picked[v] = struct{}{}
+	}
+	ranks := make([]int64, 0, n)
+	for v := range picked {
+		ranks = append(ranks, v)
+	}
+	sort.Slice(ranks, func(i, j int) bool { return ranks[i] < ranks[j] })
+	ret := make([]*Ranker[K, V], 0, n)
+	for _, v := range ranks {
+		r, err := rb.GetRankerDataByRank(startRank + int32(v))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
@@ -0,0 +1,137 @@
+package rank
+
+import "log"
+
+// 影子榜：策划想换计分公式（比如积分 = 胜场*3 + 伤害/1000），上线前先挂一个影子榜跑一阵，
+// 主榜每次增删改都同步到影子榜，分数用新公式重新算，排序规则、上榜门槛、反作弊按影子榜自己的Option。
+// 影子榜只是看效果用的，同步出错只打日志记次数，不影响主榜；玩家看到的、发奖用的还是主榜。
+// 用CompareShadow对比两个榜前N名的差异，确定要换了就把公式改到业务里，Detach掉影子榜
+
+// Shadow 挂在主榜上的影子榜。Board可以直接查（Range、GetRank……），但不要往里写
+type Shadow[K comparable, V SortableInt] struct {
+	Board    *RankBase[K, V]
+	score    func(*Ranker[K, V]) V
+	errors   int64
+	detached bool
+}
+
+// AttachShadow 挂一个影子榜，score用主榜的ranker数据算出影子榜上的分数。挂上时先把主榜现有的ranker（包括还没上榜的）全部灌进去。在主循环里调
+func (rb *RankBase[K, V]) AttachShadow(score func(*Ranker[K, V]) V, opts ...Option) *Shadow[K, V] {
+	s := &Shadow[K, V]{Board: NewRank[K, V](opts...), score: score}
+	for k := range rb.dict {
+		if r, ok := rb.unqualified[k]; ok {
+			s.apply(k, r)
+		} else if r, err := rb.GetRankerDataByKey(k); err == nil {
+			s.apply(k, r)
+		}
+	}
+	rb.shadows = append(rb.shadows, s)
+	return s
+}
+
+// Detach 不再同步，影子榜的数据留着还能查
+func (s *Shadow[K, V]) Detach() {
+	s.detached = true
+}
+
+// Errors 同步到影子榜失败的次数（多半是影子榜自己的反作弊规则拦了）
+func (s *Shadow[K, V]) Errors() int64 {
+	return s.errors
+}
+
+// apply r为nil表示主榜上删掉了
+func (s *Shadow[K, V]) apply(k K, r *Ranker[K, V]) {
+	var err error
+	_, exists := s.Board.dict[k]
+	switch {
+	case r == nil:
+		if exists {
+			err = s.Board.RemoveRankerByKey(k)
+		}
+	default:
+		c := &Ranker[K, V]{RankerId: r.RankerId, Value: s.score(r), UpdateTime: r.UpdateTime, Matches: r.Matches, Payload: r.Payload}
+		if exists {
+			err = s.Board.UpdateRankerData(c)
+		} else {
+			err = s.Board.AddRanker(c)
+		}
+	}
+	if err != nil {
+		s.errors++
+		log.Printf("rank shadow: sync key %v failed: %s", k, err.Error())
+	}
+}
+
+// feedShadows 主榜上的改动成功之后调
+func (rb *RankBase[K, V]) feedShadows(k K, r *Ranker[K, V]) {
+	if len(rb.shadows) == 0 {
+		return
+	}
+	alive := rb.shadows[:0]
+	for _, s := range rb.shadows {
+		if s.detached {
+			continue
+		}
+		alive = append(alive, s)
+		s.apply(k, r)
+	}
+	rb.shadows = alive
+}
+
+// ShadowDiff 一个ranker在两个榜上的名次，0表示不在对应榜的前N名里
+type ShadowDiff[K comparable] struct {
+	Key        K     `json:"key"`
+	Rank       int32 `json:"rank"`
+	ShadowRank int32 `json:"shadow_rank"`
+}
+
+// ShadowReport 前N名的对比
+type ShadowReport[K comparable] struct {
+	TopN    int32           `json:"top_n"`
+	Overlap int             `json:"overlap"` // 两边前N名都有的人数
+	Moved   int             `json:"moved"`   // 都在前N名但名次不同的人数
+	Diffs   []ShadowDiff[K] `json:"diffs"`   // 名次不同的（包括只在一边前N名里的），按主榜名次、再按影子榜名次
+}
+
+// CompareShadow 对比主榜和影子榜的前n名
+func (rb *RankBase[K, V]) CompareShadow(s *Shadow[K, V], n int32) ShadowReport[K] {
+	rep := ShadowReport[K]{TopN: n}
+	mainTop := rb.top(n)
+	shadowTop := s.Board.top(n)
+	shadowRank := make(map[K]int32, len(shadowTop))
+	for i, r := range shadowTop {
+		shadowRank[r.RankerId] = int32(i + 1)
+	}
+	inMain := make(map[K]bool, len(mainTop))
+	for i, r := range mainTop {
+		inMain[r.RankerId] = true
+		sr, ok := shadowRank[r.RankerId]
+		if ok {
+			rep.Overlap++
+		}
+		if sr != int32(i+1) {
+			if ok {
+				rep.Moved++
+			}
+			rep.Diffs = append(rep.Diffs, ShadowDiff[K]{Key: r.RankerId, Rank: int32(i + 1), ShadowRank: sr})
+		}
+	}
+	for i, r := range shadowTop {
+		if !inMain[r.RankerId] {
+			rep.Diffs = append(rep.Diffs, ShadowDiff[K]{Key: r.RankerId, ShadowRank: int32(i + 1)})
+		}
+	}
+	return rep
+}
+
+// top 前n名，不够n个时返回全部
+func (rb *RankBase[K, V]) top(n int32) []*Ranker[K, V] {
+	if c := rb.rankMain.GetElementsCount(); c < n {
+		n = c
+	}
+	if n <= 0 {
+		return nil
+	}
+	ret, _ := rb.Range(1, n)
+	return ret
+}
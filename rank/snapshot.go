@@ -0,0 +1,73 @@
+package rank
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+)
+
+// 整榜快照（备份/恢复用）：一行一个ranker的json，包括还不够上榜资格的。要在主循环里调
+
+type snapshotLine[K comparable, V SortableInt] struct {
+	RankerId   K      `json:"id"`
+	Value      V      `json:"value"`
+	UpdateTime int64  `json:"update_time"`
+	Matches    int32  `json:"matches,omitempty"`
+	Payload    []byte `json:"payload,omitempty"`
+}
+
+func (l *snapshotLine[K, V]) ranker() *Ranker[K, V] {
+	return &Ranker[K, V]{RankerId: l.RankerId, Value: l.Value, UpdateTime: l.UpdateTime, Matches: l.Matches, Payload: l.Payload}
+}
+
+// WriteSnapshot 先榜上的（按名次）再不够格的。挂了Journal的写成功后轮转日志
+func (rb *RankBase[K, V]) WriteSnapshot(w io.Writer) error {
+	all, err := rb.GetAllRankers()
+	if err != nil && rb.rankMain.GetElementsCount() > 0 {
+		return err
+	}
+	for _, r := range rb.unqualified {
+		all = append(all, r)
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, r := range all {
+		if err = enc.Encode(&snapshotLine[K, V]{RankerId: r.RankerId, Value: r.Value, UpdateTime: r.UpdateTime, Matches: r.Matches, Payload: r.Payload}); err != nil {
+			return err
+		}
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if rb.journal != nil {
+		if err = rb.journal.rotate(); err != nil {
+			log.Printf("rank journal %s rotate failed: %s", rb.journal.path, err.Error())
+		}
+	}
+	return nil
+}
+
+// ReadSnapshot 按快照逐条写回榜上（已经存在的key会被覆盖），一般对着空榜在启动时调。不过反作弊、不写日志
+func (rb *RankBase[K, V]) ReadSnapshot(r io.Reader) error {
+	rb.replaying = true
+	defer func() { rb.replaying = false }()
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for dec.More() {
+		line := &snapshotLine[K, V]{}
+		if err := dec.Decode(line); err != nil {
+			return err
+		}
+		ranker := line.ranker()
+		var err error
+		if _, exist := rb.dict[line.RankerId]; exist {
+			err = rb.UpdateRankerData(ranker)
+		} else {
+			err = rb.AddRanker(ranker)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
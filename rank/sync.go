@@ -0,0 +1,283 @@
+package rank
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"test/timer"
+	"time"
+)
+
+// 跨服排行榜同步：每个服只把自己本地产生的变动（delta）定时推给所有其他服（全连通，不转发别人的delta），
+// 收到的delta按UpdateTime合并，同一个key以UpdateTime大的为准（相同时按服务器id字典序大的为准），最终各服收敛到同一个全局榜。
+// 每个peer单独一个待发队列，推送成功（对方回200）才从队列里删，失败了下次tick接着推，对方宕机期间的变动恢复后会补上；
+// 同一个key在队列里只留最新的一条，队列最多和榜一样大
+
+// SyncEntry 一条变动，Removed为true表示删除（带时间的墓碑，防止旧的更新把删掉的人加回来）
+type SyncEntry[K comparable, V SortableInt] struct {
+	RankerId   K      `json:"id"`
+	Value      V      `json:"value"`
+	UpdateTime int64  `json:"update_time"`
+	Removed    bool   `json:"removed,omitempty"`
+	Origin     string `json:"origin"`
+}
+
+type syncVersion struct {
+	updateTime int64
+	origin     string
+}
+
+func (v syncVersion) newerThan(o syncVersion) bool {
+	if v.updateTime != o.updateTime {
+		return v.updateTime > o.updateTime
+	}
+	return v.origin > o.origin
+}
+
+type SyncBoard[K comparable, V SortableInt] struct {
+	*RankBase[K, V]
+	serverId string
+	pending  map[K]*SyncEntry[K, V] // 本地变动，下次Export（或者同步tick分到各peer的队列）时取走
+	versions map[K]syncVersion
+	inbox    chan []*SyncEntry[K, V]
+
+	outbox   map[string]map[K]*SyncEntry[K, V] // 每个peer还没确认收到的变动
+	inflight map[string]bool                   // 正在推送的peer，同一个peer同时只推一批
+	acks     chan syncAck[K, V]
+}
+
+// syncAck 推送结果，推送goroutine发回主循环处理
+type syncAck[K comparable, V SortableInt] struct {
+	peer string
+	sent map[K]*SyncEntry[K, V]
+	err  error
+}
+
+func NewSyncBoard[K comparable, V SortableInt](serverId string, opts ...Option) *SyncBoard[K, V] {
+	return &SyncBoard[K, V]{
+		RankBase: NewRank[K, V](opts...),
+		serverId: serverId,
+		pending:  make(map[K]*SyncEntry[K, V]),
+		versions: make(map[K]syncVersion),
+		inbox:    make(chan []*SyncEntry[K, V], 64),
+		outbox:   make(map[string]map[K]*SyncEntry[K, V]),
+		inflight: make(map[string]bool),
+	}
+}
+
+// checkLocal 本地写入也按版本比较：已经合并过更新的（别的服UpdateTime更大的）变动时拒绝，不然本地旧数据会覆盖掉它
+func (s *SyncBoard[K, V]) checkLocal(k K, ver syncVersion) error {
+	if cur, ok := s.versions[k]; ok && cur.newerThan(ver) {
+		return fmt.Errorf("SyncBoard error: ranker %v already has a newer update (time %d from %s)", k, cur.updateTime, cur.origin)
+	}
+	return nil
+}
+
+// Set 本地写入（上榜或更新），走这个而不是直接AddRanker/UpdateRankerData，否则变动不会同步出去。
+// 这个key已经有UpdateTime更大的变动（别的服同步过来的）时返回错误，不写
+func (s *SyncBoard[K, V]) Set(r *Ranker[K, V]) error {
+	ver := syncVersion{updateTime: r.UpdateTime, origin: s.serverId}
+	if err := s.checkLocal(r.RankerId, ver); err != nil {
+		return err
+	}
+	if err := s.apply(r.RankerId, r.Value, r.UpdateTime, false); err != nil {
+		return err
+	}
+	s.versions[r.RankerId] = ver
+	s.pending[r.RankerId] = &SyncEntry[K, V]{RankerId: r.RankerId, Value: r.Value, UpdateTime: r.UpdateTime, Origin: s.serverId}
+	return nil
+}
+
+// Remove 本地删除，和Set一样有更新的变动时返回错误
+func (s *SyncBoard[K, V]) Remove(k K, updateTime int64) error {
+	ver := syncVersion{updateTime: updateTime, origin: s.serverId}
+	if err := s.checkLocal(k, ver); err != nil {
+		return err
+	}
+	if err := s.apply(k, 0, updateTime, true); err != nil {
+		return err
+	}
+	s.versions[k] = ver
+	s.pending[k] = &SyncEntry[K, V]{RankerId: k, UpdateTime: updateTime, Removed: true, Origin: s.serverId}
+	return nil
+}
+
+func (s *SyncBoard[K, V]) apply(k K, v V, updateTime int64, removed bool) error {
+	_, exist := s.dict[k]
+	if removed {
+		if !exist {
+			return nil
+		}
+		return s.RemoveRankerByKey(k)
+	}
+	r := &Ranker[K, V]{RankerId: k, Value: v, UpdateTime: updateTime}
+	if exist {
+		return s.UpdateRankerData(r)
+	}
+	return s.AddRanker(r)
+}
+
+// ExportDeltas 取出本地变动并清空，自己搬运delta（不用StartSync）时用。用了StartSync就不要再调，否则取走的变动不会推给peers
+func (s *SyncBoard[K, V]) ExportDeltas() ([]byte, error) {
+	if len(s.pending) == 0 {
+		return nil, nil
+	}
+	list := make([]*SyncEntry[K, V], 0, len(s.pending))
+	for _, e := range s.pending {
+		list = append(list, e)
+	}
+	b, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	s.pending = make(map[K]*SyncEntry[K, V])
+	return b, nil
+}
+
+// MergeDeltas 合并别的服的变动，返回实际生效的条数（比本地旧的会被忽略）
+func (s *SyncBoard[K, V]) MergeDeltas(b []byte) (int, error) {
+	var list []*SyncEntry[K, V]
+	if err := json.Unmarshal(b, &list); err != nil {
+		return 0, err
+	}
+	return s.merge(list), nil
+}
+
+func (s *SyncBoard[K, V]) merge(list []*SyncEntry[K, V]) int {
+	s.merging = true
+	defer func() { s.merging = false }()
+	n := 0
+	for _, e := range list {
+		ver := syncVersion{updateTime: e.UpdateTime, origin: e.Origin}
+		if cur, ok := s.versions[e.RankerId]; ok && !ver.newerThan(cur) {
+			continue
+		}
+		if err := s.apply(e.RankerId, e.Value, e.UpdateTime, e.Removed); err != nil {
+			log.Printf("rank sync merge %v from %s failed: %s", e.RankerId, e.Origin, err.Error())
+			continue
+		}
+		s.versions[e.RankerId] = ver
+		n++
+	}
+	return n
+}
+
+// ServeHTTP 接收其他服推过来的delta，只做解码入队，真正的合并在主循环的同步tick里做
+func (s *SyncBoard[K, V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var list []*SyncEntry[K, V]
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16<<20)).Decode(&list); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	select {
+	case s.inbox <- list:
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "sync inbox full", http.StatusServiceUnavailable)
+	}
+}
+
+// StartSync 用timer每interval跑一次：合并收到的delta，把各peer还没确认的delta推过去（peers是其他服同步接口的完整url）
+func (s *SyncBoard[K, V]) StartSync(peers []string, interval time.Duration) {
+	client := &http.Client{Timeout: interval}
+	timer.Every(interval, "rank_sync", func() {
+		s.syncOnce(client, peers)
+	})
+}
+
+func (s *SyncBoard[K, V]) syncOnce(client *http.Client, peers []string) {
+	if s.acks == nil {
+		// 每个peer同时最多一批在推，结果发回来不会阻塞
+		s.acks = make(chan syncAck[K, V], len(peers))
+	}
+	for drained := false; !drained; {
+		select {
+		case list := <-s.inbox:
+			s.merge(list)
+		case a := <-s.acks:
+			s.ack(a)
+		default:
+			drained = true
+		}
+	}
+	if len(s.pending) > 0 {
+		for _, peer := range peers {
+			box := s.outbox[peer]
+			if box == nil {
+				box = make(map[K]*SyncEntry[K, V])
+				s.outbox[peer] = box
+			}
+			for k, e := range s.pending {
+				box[k] = e
+			}
+		}
+		s.pending = make(map[K]*SyncEntry[K, V])
+	}
+	for _, peer := range peers {
+		box := s.outbox[peer]
+		if s.inflight[peer] || len(box) == 0 {
+			continue
+		}
+		sent := make(map[K]*SyncEntry[K, V], len(box))
+		list := make([]*SyncEntry[K, V], 0, len(box))
+		for k, e := range box {
+			sent[k] = e
+			list = append(list, e)
+		}
+		b, err := json.Marshal(list)
+		if err != nil {
+			log.Printf("rank sync export to %s failed: %s", peer, err.Error())
+			continue
+		}
+		s.inflight[peer] = true
+		go func(peer string) {
+			s.acks <- syncAck[K, V]{peer: peer, sent: sent, err: postDeltas(client, peer, b)}
+		}(peer)
+	}
+}
+
+// ack 推送成功的从peer的队列里删掉（推送期间又变了的留着下次推），失败的全部留着
+func (s *SyncBoard[K, V]) ack(a syncAck[K, V]) {
+	s.inflight[a.peer] = false
+	if a.err != nil {
+		log.Printf("rank sync push %d entries to %s failed, retry next tick: %s", len(a.sent), a.peer, a.err.Error())
+		return
+	}
+	box := s.outbox[a.peer]
+	for k, e := range a.sent {
+		if box[k] == e {
+			delete(box, k)
+		}
+	}
+}
+
+// Unacked 还没推送成功的变动数，peer为空时是所有peer的总和
+func (s *SyncBoard[K, V]) Unacked(peer string) int {
+	if peer != "" {
+		return len(s.outbox[peer])
+	}
+	n := 0
+	for _, box := range s.outbox {
+		n += len(box)
+	}
+	return n
+}
+
+func postDeltas(client *http.Client, url string, b []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
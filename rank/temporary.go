@@ -0,0 +1,171 @@
+package rank
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"test/gtime"
+	"test/timer"
+	"time"
+)
+
+// 限时活动的临时排行榜：创建时登记到Manager，并在timer里挂一个endTime的结算触发器，
+// 到点自动回调结算（发奖）然后释放榜上数据，活动做完忘了删榜也不会一直占着内存
+
+type tempBoard interface {
+	ActivityId() int64
+	EndTime() time.Time
+	Len() int32
+	settle()
+	close()
+}
+
+// Manager 管理当前所有临时榜，和timer一样只在主循环里用
+type Manager struct {
+	boards map[int64]tempBoard
+}
+
+var manager = &Manager{boards: make(map[int64]tempBoard)}
+
+func GetManager() *Manager {
+	return manager
+}
+
+// TempBoardInfo admin看用
+type TempBoardInfo struct {
+	ActivityId int64     `json:"activity_id"`
+	EndTime    time.Time `json:"end_time"`
+	Len        int32     `json:"len"`
+}
+
+func (m *Manager) List() []TempBoardInfo {
+	ret := make([]TempBoardInfo, 0, len(m.boards))
+	for _, b := range m.boards {
+		ret = append(ret, TempBoardInfo{ActivityId: b.ActivityId(), EndTime: b.EndTime(), Len: b.Len()})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ActivityId < ret[j].ActivityId })
+	return ret
+}
+
+// Get 拿到的要自己断言成*TemporaryRank[K, V]
+func (m *Manager) Get(activityId int64) (any, bool) {
+	b, ok := m.boards[activityId]
+	return b, ok
+}
+
+// Settle 提前结算（活动提前结束），结算后照常释放
+func (m *Manager) Settle(activityId int64) error {
+	b, ok := m.boards[activityId]
+	if !ok {
+		return fmt.Errorf("rank Manager::Settle error: activity %d has no temporary rank", activityId)
+	}
+	b.settle()
+	return nil
+}
+
+// Destroy 不结算直接释放（活动作废）
+func (m *Manager) Destroy(activityId int64) error {
+	b, ok := m.boards[activityId]
+	if !ok {
+		return fmt.Errorf("rank Manager::Destroy error: activity %d has no temporary rank", activityId)
+	}
+	b.close()
+	return nil
+}
+
+type TemporaryRank[K comparable, V SortableInt] struct {
+	*RankBase[K, V]
+	activityId int64
+	endTime    time.Time
+	onSettle   func(final []*Ranker[K, V])
+	closed     bool
+}
+
+func tempRankTag(activityId int64) string {
+	return fmt.Sprintf("rank:temp:%d", activityId)
+}
+
+// NewTemporaryRank onSettle在endTime（主循环里）拿到最终排名（按名次排好），可以为nil。同一个活动id不能同时有两个榜。
+// 结算触发器超过待触发上限注册不上时返回错误（包着timer.ErrPendingLimit）
+func NewTemporaryRank[K comparable, V SortableInt](activityId int64, endTime time.Time, onSettle func(final []*Ranker[K, V]), opts ...Option) (*TemporaryRank[K, V], error) {
+	if _, ok := manager.boards[activityId]; ok {
+		return nil, fmt.Errorf("NewTemporaryRank error: activity %d already has a temporary rank", activityId)
+	}
+	if !endTime.After(time.Now()) {
+		return nil, fmt.Errorf("NewTemporaryRank error: end time %s already passed", gtime.FormatStandard(endTime))
+	}
+	tr := &TemporaryRank[K, V]{
+		RankBase:   NewRank[K, V](opts...),
+		activityId: activityId,
+		endTime:    endTime,
+		onSettle:   onSettle,
+	}
+	err := timer.PushTriggerAt(endTime, timer.Trigger{
+		Fun:  func(int64, interface{}) { tr.settle() },
+		Name: "temp_rank_settle",
+		Tags: timer.Tags{tempRankTag(activityId)},
+	})
+	if err != nil {
+		// 结算触发器没注册上的话这个榜永远不会结算，干脆不建
+		return nil, fmt.Errorf("NewTemporaryRank error: activity %d settle trigger: %w", activityId, err)
+	}
+	manager.boards[activityId] = tr
+	return tr, nil
+}
+
+func (tr *TemporaryRank[K, V]) ActivityId() int64 {
+	return tr.activityId
+}
+
+func (tr *TemporaryRank[K, V]) EndTime() time.Time {
+	return tr.endTime
+}
+
+func (tr *TemporaryRank[K, V]) Closed() bool {
+	return tr.closed
+}
+
+func (tr *TemporaryRank[K, V]) Len() int32 {
+	return tr.rankMain.GetElementsCount()
+}
+
+// AddRanker 结算之后不再接受数据
+func (tr *TemporaryRank[K, V]) AddRanker(e *Ranker[K, V]) error {
+	if tr.closed {
+		return fmt.Errorf("TemporaryRank::AddRanker error: activity %d already settled", tr.activityId)
+	}
+	return tr.RankBase.AddRanker(e)
+}
+
+func (tr *TemporaryRank[K, V]) UpdateRankerData(newData *Ranker[K, V]) error {
+	if tr.closed {
+		return fmt.Errorf("TemporaryRank::UpdateRankerData error: activity %d already settled", tr.activityId)
+	}
+	return tr.RankBase.UpdateRankerData(newData)
+}
+
+func (tr *TemporaryRank[K, V]) settle() {
+	if tr.closed {
+		return
+	}
+	if tr.onSettle != nil {
+		final, err := tr.GetAllRankers()
+		if err != nil && tr.Len() > 0 {
+			log.Printf("temporary rank %d settle failed to read rankers: %s", tr.activityId, err.Error())
+		}
+		tr.onSettle(final)
+	}
+	log.Printf("temporary rank %d settled, %d rankers", tr.activityId, tr.Len())
+	tr.close()
+}
+
+// close 换成一个空榜让旧数据被回收，取消还没到点的结算触发器，从Manager里移除
+func (tr *TemporaryRank[K, V]) close() {
+	if tr.closed {
+		return
+	}
+	tr.closed = true
+	tr.RankBase = NewRank[K, V]()
+	timer.CancelWhere(func(tags timer.Tags) bool { return tags.Has(tempRankTag(tr.activityId)) })
+	delete(manager.boards, tr.activityId)
+}
@@ -0,0 +1,97 @@
+package rank
+
+// 前N名变动推送：榜上数据每次变动后对比前N名，只把变化的部分（进榜/出榜/名次变化/分数变化）推给订阅者，
+// 网关拿去推给在看排行榜的客户端，不用每次重发整页
+
+type TopNDeltaKind int32
+
+const (
+	TopNEntered TopNDeltaKind = 1 // 新进前N
+	TopNLeft    TopNDeltaKind = 2 // 掉出前N（包括被删除、变成不够格）
+	TopNMoved   TopNDeltaKind = 3 // 名次变了
+	TopNScored  TopNDeltaKind = 4 // 名次没变，分数变了
+)
+
+type TopNDelta[K comparable, V SortableInt] struct {
+	Kind     TopNDeltaKind
+	RankerId K
+	Rank     int32 // Left时为0
+	OldRank  int32 // Entered时为0
+	Value    V
+}
+
+type topNSub[K comparable, V SortableInt] struct {
+	id   int
+	n    int32
+	last map[K]topNSlot[V]
+	cb   func([]TopNDelta[K, V])
+}
+
+type topNSlot[V SortableInt] struct {
+	rank  int32
+	value V
+}
+
+// SubscribeTopN 订阅前n名的变化，订阅时会先推一次全量（全部是Entered）。返回取消订阅的函数
+// 回调在修改排行榜的goroutine里同步执行，不要在回调里再改这个榜
+func (rb *RankBase[K, V]) SubscribeTopN(n int32, cb func([]TopNDelta[K, V])) (cancel func()) {
+	rb.topSubSeq++
+	sub := &topNSub[K, V]{id: rb.topSubSeq, n: n, last: map[K]topNSlot[V]{}, cb: cb}
+	rb.topSubs = append(rb.topSubs, sub)
+	rb.diffTopN(sub)
+	return func() {
+		for i, s := range rb.topSubs {
+			if s.id == sub.id {
+				rb.topSubs = append(rb.topSubs[:i], rb.topSubs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (rb *RankBase[K, V]) notifyTopN() {
+	for _, sub := range rb.topSubs {
+		rb.diffTopN(sub)
+	}
+}
+
+func (rb *RankBase[K, V]) diffTopN(sub *topNSub[K, V]) {
+	cur := make(map[K]topNSlot[V], sub.n)
+	var order []K
+	end := sub.n
+	if cnt := rb.rankMain.GetElementsCount(); cnt < end {
+		end = cnt
+	}
+	if end > 0 {
+		top, err := rb.Range(1, end)
+		if err != nil {
+			return
+		}
+		for i, r := range top {
+			cur[r.Key()] = topNSlot[V]{rank: int32(i + 1), value: r.Value}
+			order = append(order, r.Key())
+		}
+	}
+	var deltas []TopNDelta[K, V]
+	for k, old := range sub.last {
+		if _, ok := cur[k]; !ok {
+			deltas = append(deltas, TopNDelta[K, V]{Kind: TopNLeft, RankerId: k, OldRank: old.rank, Value: rb.dict[k]})
+		}
+	}
+	for _, k := range order {
+		now := cur[k]
+		old, ok := sub.last[k]
+		switch {
+		case !ok:
+			deltas = append(deltas, TopNDelta[K, V]{Kind: TopNEntered, RankerId: k, Rank: now.rank, Value: now.value})
+		case old.rank != now.rank:
+			deltas = append(deltas, TopNDelta[K, V]{Kind: TopNMoved, RankerId: k, Rank: now.rank, OldRank: old.rank, Value: now.value})
+		case old.value != now.value:
+			deltas = append(deltas, TopNDelta[K, V]{Kind: TopNScored, RankerId: k, Rank: now.rank, OldRank: old.rank, Value: now.value})
+		}
+	}
+	sub.last = cur
+	if len(deltas) > 0 {
+		sub.cb(deltas)
+	}
+}
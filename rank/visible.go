@@ -0,0 +1,79 @@
+package rank
+
+import (
+	"errors"
+	"strconv"
+)
+
+// 给客户端看的名次上限：常见需求是只在前10000名里显示精确名次，之外显示"10000+"。
+// 业务handler统一用GetRankForClient，不要各自拿GetRank的结果再判断
+
+// WithVisibleRank 超过max名的只告诉客户端"max+"，不配（0）不限制
+func WithVisibleRank(max int32) Option {
+	return func(o *rankOptions) {
+		o.visibleRank = max
+	}
+}
+
+// ClientRank 给客户端的名次。Ranked为false表示没上榜（没有分数或者不满足上榜条件）
+type ClientRank struct {
+	Rank   int32 // Capped时是上限值本身
+	Capped bool  // 真实名次在上限之外
+	Ranked bool
+}
+
+// String 给客户端显示的文本："123"、"10000+"，没上榜是空串
+func (c ClientRank) String() string {
+	if !c.Ranked {
+		return ""
+	}
+	if c.Capped {
+		return strconv.Itoa(int(c.Rank)) + "+"
+	}
+	return strconv.Itoa(int(c.Rank))
+}
+
+// ClientRankOf 按这个榜的上限换算一个真实名次（名次<=0当作没上榜）
+func (rb *RankBase[K, V]) ClientRankOf(rank int32) ClientRank {
+	if rank <= 0 {
+		return ClientRank{}
+	}
+	if rb.visibleRank > 0 && rank > rb.visibleRank {
+		return ClientRank{Rank: rb.visibleRank, Capped: true, Ranked: true}
+	}
+	return ClientRank{Rank: rank, Ranked: true}
+}
+
+// GetRankForClient 没上榜（不在跳表里，包括不够上榜资格的）返回Ranked=false而不是错误。配了WithRankMode时用显示名次
+func (rb *RankBase[K, V]) GetRankForClient(k K) (ClientRank, error) {
+	if !rb.Qualified(k) {
+		return ClientRank{}, nil
+	}
+	r, err := rb.GetDisplayRank(k)
+	if err != nil {
+		return ClientRank{}, err
+	}
+	return rb.ClientRankOf(r.Rank), nil
+}
+
+// ErrRankNotVisible RangeForClient的起始名次已经超过上限
+var ErrRankNotVisible = errors.New("rank beyond visible range")
+
+// RangeForClient 按名次取一段给客户端，超过上限的部分不返回（上限之外的榜单本来就不该让客户端翻到）
+func (rb *RankBase[K, V]) RangeForClient(start int32, end int32) ([]*Ranker[K, V], error) {
+	if rb.visibleRank > 0 {
+		if start > rb.visibleRank {
+			return nil, ErrRankNotVisible
+		}
+		if end > rb.visibleRank {
+			end = rb.visibleRank
+		}
+	}
+	if cnt := rb.rankMain.GetElementsCount(); end > cnt {
+		end = cnt
+	}
+	if start > end {
+		return nil, nil
+	}
+	return rb.Range(start, end)
+}
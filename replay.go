@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"test/gateway"
+	"test/journal"
+	"test/timer"
+)
+
+var journalRec *journal.Recorder
+
+// startJournal 打开命令日志，挂到gateway分发和timer触发上
+func startJournal(path string) error {
+	rec, err := journal.Open(path)
+	if err != nil {
+		return err
+	}
+	journalRec = rec
+	gateway.GetInst().SetDispatchHook(func(msg *gateway.Message) {
+		rec.RecordMsg(msg.Sess.Id, msg.Packet.MsgId, msg.Packet.Body)
+	})
+	timer.GetInst().SetFireHook(func(trigger timer.Trigger) {
+		rec.RecordTimer(trigger.Name, trigger.Now)
+	})
+	log.Printf("command journal recording to %s", path)
+	return nil
+}
+
+func stopJournal() {
+	if journalRec == nil {
+		return
+	}
+	if err := journalRec.Close(); err != nil {
+		log.Printf("close command journal error: %s", err.Error())
+	}
+	journalRec = nil
+}
+
+type replayDispatcher struct{}
+
+func (replayDispatcher) DispatchMsg(e *journal.Entry) {
+	gateway.GetInst().Dispatch(&gateway.Message{
+		Sess:   gateway.GetInst().ReplaySession(e.SessId),
+		Packet: &gateway.Packet{MsgId: e.MsgId, Body: e.Body},
+	})
+}
+
+func (replayDispatcher) FireTimer(e *journal.Entry) {
+	timer.GetInst().TriggerUntil(e.FireAt)
+}
+
+// runReplay 重放模式：不开监听，按日志顺序跑完就退出
+func runReplay(path string) {
+	timer.TimerTestCode()
+	n, err := journal.Replay(path, replayDispatcher{})
+	if err != nil {
+		log.Printf("replay stopped after %d entries: %s", n, err.Error())
+		return
+	}
+	log.Printf("replay finished, %d entries", n)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"test/db"
+	"test/discovery"
+	"test/gateway"
+	"test/timer"
+	"time"
+)
+
+// 进程角色（-role）。同一个二进制可以拆成多个进程跑，网关和逻辑之间走gateway的link（见gateway/link.go）：
+// all：单进程，网关+逻辑都在本进程（默认，和以前一样）
+// gateway：只接客户端（握手、限流、封禁、保活），业务消息转给gateway.upstream_addr上的逻辑进程，可以开多个水平扩
+// game：不监听客户端，在gateway.link_listen_addr上等网关进程连过来，业务handler、timer、备份都在这里跑
+// mysql两种角色都连：网关进程只用来读写ip封禁表，业务数据只有逻辑进程读写
+const (
+	roleAll     = "all"
+	roleGateway = "gateway"
+	roleGame    = "game"
+)
+
+// checkRole 角色和配置对不上的问题，跟配置检查一起报
+func checkRole(role string, conf *ServerConf) []string {
+	switch role {
+	case roleAll:
+	case roleGateway:
+		if conf.GatewayConf != nil && conf.GatewayConf.UpstreamAddr == "" && conf.DiscoveryConf == nil {
+			return []string{"<gateway> upstream_addr or <discovery> is required for -role=gateway"}
+		}
+	case roleGame:
+		if conf.GatewayConf != nil && conf.GatewayConf.LinkListenAddr == "" {
+			return []string{"<gateway> link_listen_addr is required for -role=game"}
+		}
+	default:
+		return []string{fmt.Sprintf("unknown -role %q, want %s|%s|%s", role, roleAll, roleGateway, roleGame)}
+	}
+	return nil
+}
+
+// startGateway 按角色开监听。配了服务发现时网关进程每次连逻辑进程都挑负载最低的那个，不看upstream_addr
+func startGateway(role string, conf *gateway.GatewayConf, useDiscovery bool) error {
+	switch role {
+	case roleGateway:
+		if useDiscovery {
+			gateway.GetInst().SetUpstreamResolver(func() (string, error) {
+				n, err := discovery.GetInst().Pick(roleGame)
+				if err != nil {
+					return "", err
+				}
+				return n.Addr, nil
+			})
+		}
+		return gateway.GetInst().StartUpstream(conf)
+	case roleGame:
+		return gateway.GetInst().StartLink(conf)
+	default:
+		return gateway.GetInst().Start(conf)
+	}
+}
+
+// startDiscovery 监听都开好之后再注册，别的进程查到的时候已经能连上了。网关进程登记客户端地址，逻辑进程登记link地址，负载都是连接数
+func startDiscovery(role string, conf *ServerConf) error {
+	listen := conf.GatewayConf.ListenAddr
+	if role == roleGame {
+		listen = conf.GatewayConf.LinkListenAddr
+	}
+	addr, err := discovery.AdvertiseAddr(conf.DiscoveryConf, listen)
+	if err != nil {
+		return err
+	}
+	return discovery.GetInst().Start(conf.DiscoveryConf, role, addr, func() int64 {
+		return int64(gateway.GetInst().SessionCount())
+	})
+}
+
+// startJobLock 多进程部署时Singleton触发器（每日结算之类）按node_id抢mysql锁，整个集群只跑一次；单进程不设Locker
+func startJobLock() {
+	l := db.NewJobLock(db.GetDbPool(), discovery.GetInst().Self().Id)
+	if err := l.Prune(time.Now().AddDate(0, 0, -7)); err != nil {
+		log.Printf("prune job_lock failed: %s", err.Error())
+	}
+	timer.GetInst().SetLocker(l)
+}
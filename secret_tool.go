@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"test/db"
+)
+
+// runEncryptSecret -encrypt-secret：从标准输入读一行明文，用环境变量里的口令加密，输出填到password_encrypted的密文。
+// 明文不走命令行参数，不会留在shell历史和ps里
+func runEncryptSecret() int {
+	key := os.Getenv(db.DefaultSecretKeyEnv)
+	if key == "" {
+		fmt.Fprintf(os.Stderr, "env %s is empty\n", db.DefaultSecretKeyEnv)
+		return 1
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintf(os.Stderr, "read secret from stdin failed: %s\n", err.Error())
+		return 1
+	}
+	blob, err := db.EncryptSecret(strings.TrimRight(line, "\r\n"), key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	fmt.Println(blob)
+	return 0
+}
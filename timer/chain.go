@@ -0,0 +1,90 @@
+package timer
+
+import (
+	"log"
+	"time"
+)
+
+// 链式触发器：一串有先后依赖的定时流程（截止报名 -> 5分钟后开赛 -> 30分钟后结算）声明一次，不用自己算时间戳：
+//
+//	timer.After(signupEnd, closeSignup).
+//		Then(startMatch, 5*time.Minute).
+//		Then(settle, 30*time.Minute)
+//
+// 每一步的delay从上一步回调执行完的时刻算起，上一步晚触发了（卡顿、时间跳变补触发）后面整体顺延，不会出现"还没开赛就结算"。
+// 只在主循环里用：After立刻注册第一步，同一次调用里接着Then不会有竞争
+
+type chainStep struct {
+	trigger Trigger
+	delay   time.Duration
+}
+
+type Chain struct {
+	t         *Timer
+	steps     []chainStep // 还没注册的后续步骤
+	cancelled bool
+	done      bool
+}
+
+// After 在at注册第一步，返回的Chain用Then接后续步骤。
+// 第一步超过待触发上限注册不上时打日志，返回的Chain是已取消的状态；后面的步骤是续上的，不受上限限制
+func (t *Timer) After(at time.Time, first Trigger) *Chain {
+	c := &Chain{t: t}
+	if err := t.pushAt(at.Unix(), c.wrap(first)); err != nil {
+		log.Printf("chain %s not started: %s", groupOf(first), err.Error())
+		c.cancelled = true
+	}
+	return c
+}
+
+func After(at time.Time, first Trigger) *Chain {
+	return tm.After(at, first)
+}
+
+// Then 上一步执行完delay之后执行trigger
+func (c *Chain) Then(trigger Trigger, delay time.Duration) *Chain {
+	c.steps = append(c.steps, chainStep{trigger: trigger, delay: delay})
+	return c
+}
+
+// Cancel 还没执行的步骤都不再执行，在某一步的回调里调也可以（中止后续流程）
+func (c *Chain) Cancel() {
+	c.cancelled = true
+}
+
+// Done 所有步骤都执行完了
+func (c *Chain) Done() bool {
+	return c.done
+}
+
+// Pending 还没执行的步骤数（包括已经注册在等待中的那一步）
+func (c *Chain) Pending() int {
+	if c.done || c.cancelled {
+		return 0
+	}
+	return len(c.steps) + 1
+}
+
+// wrap 包一层：执行完注册下一步。Param、Name、Tags保持原样，统计、Dump、CancelWhere都按原触发器算
+func (c *Chain) wrap(trigger Trigger) Trigger {
+	f := trigger.Fun
+	trigger.Fun = func(now int64, param interface{}) {
+		if c.cancelled {
+			return
+		}
+		f(now, param)
+		if c.cancelled {
+			return
+		}
+		if len(c.steps) == 0 {
+			c.done = true
+			return
+		}
+		next := c.steps[0]
+		c.steps = c.steps[1:]
+		step := c.wrap(next.trigger)
+		step.exempt = true
+		c.t.pushAt(c.t.now().Add(next.delay).Unix(), step)
+	}
+	return trigger
+}
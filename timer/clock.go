@@ -0,0 +1,88 @@
+package timer
+
+import (
+	"log"
+	"test/gtime"
+	"test/metrics"
+	"time"
+)
+
+// 墙上时间跳变（NTP校时、手动改系统时间）的处理。主循环每次打点调Tick(time.Now())：
+// - 用单调时钟和墙上时间的差判断跳了多少，超过jumpLogThreshold打日志、记指标timer.clock.jump
+// - 往前跳：中间跳过的秒上的触发器一次补触发（按时间顺序）；掉tick（主循环卡了）也一样补
+// - 往回跳：已经触发过的触发器已经从队列里摘掉了，不会再触发一次；游标跟着退回去，之后新注册的按新的墙上时间正常触发
+// - 注册到已经走过的秒上的（Restore回来的过期触发器、回调里往当前秒push的）下一次Tick补触发
+// - 往前跳太多（maxJump，比如系统时间被误设到明年）时每次Tick最多往前补maxJump，不会一下把一年的每日触发器全打出去，
+//   时间真的是对的话之后每次Tick继续补，时间被改回来的话多出来的那段就不会触发
+
+const jumpLogThreshold = 2 * time.Second
+
+type clockState struct {
+	lastWall  int64     // 已经触发到哪一秒（含）
+	overdue   bool      // 有触发器注册到了lastWall及之前
+	lastMono  time.Time // 上一次Tick时的time.Now()，带单调时钟读数
+	maxJump   time.Duration
+	jumps     int64
+	lastDelta time.Duration
+}
+
+// SetMaxJump 每次Tick最多往前补多长时间的触发器，0不限制
+func (t *Timer) SetMaxJump(d time.Duration) {
+	t.clockState.maxJump = d
+}
+
+// ClockJumps 检测到的跳变次数和最近一次跳了多少（正数是往前跳）
+func (t *Timer) ClockJumps() (int64, time.Duration) {
+	return t.clockState.jumps, t.clockState.lastDelta
+}
+
+// Tick 主循环每次打点调一次，now用time.Now()（要带单调时钟读数才能判断跳变，AlignedTicker发出来的整秒时间不带）。
+// 触发所有到点的触发器：包括这一秒、掉tick漏掉的秒、往前跳过的秒，每个触发器只会触发一次
+func (t *Timer) Tick(now time.Time) {
+	cs := &t.clockState
+	wall := now.Unix()
+	if !cs.lastMono.IsZero() {
+		// Sub两边都带单调读数时用的是单调时钟，Round(0)去掉单调读数之后比的是墙上时间
+		mono := now.Sub(cs.lastMono)
+		delta := now.Round(0).Sub(cs.lastMono.Round(0)) - mono
+		if delta >= jumpLogThreshold || delta <= -jumpLogThreshold {
+			cs.jumps++
+			cs.lastDelta = delta
+			metrics.GetCounter("timer.clock.jump").Inc()
+			log.Printf("timer: wall clock jumped %v (now %s)", delta, gtime.FormatStandard(now))
+		}
+	}
+	cs.lastMono = now
+	if cs.lastWall == 0 {
+		// 第一次Tick：Restore回来的过期触发器也在这里补
+		cs.lastWall = wall
+		t.TriggerUntil(wall)
+		return
+	}
+	if cs.overdue {
+		cs.overdue = false
+		t.TriggerUntil(cs.lastWall)
+	}
+	if wall <= cs.lastWall {
+		// 往回跳了（走过的秒上的触发器都已经摘掉了，游标退回去不会重复触发），或者同一秒打了两次点
+		cs.lastWall = wall
+		return
+	}
+	until := wall
+	if cs.maxJump > 0 && wall-cs.lastWall > int64(cs.maxJump/time.Second) {
+		until = cs.lastWall + int64(cs.maxJump/time.Second)
+		log.Printf("timer: catch-up limited to %v, fired until %s, %ds left", cs.maxJump,
+			gtime.FormatStandard(time.Unix(until, 0)), wall-until)
+	}
+	// 先挪游标再触发，回调里往已经走过的秒上push的会被标成overdue，下次Tick补
+	if until-cs.lastWall <= 60 {
+		// 正常情况每次只走1秒，逐秒触发不用扫整个map
+		for ts := cs.lastWall + 1; ts <= until; ts++ {
+			cs.lastWall = ts
+			t.triggerAt(ts)
+		}
+	} else {
+		cs.lastWall = until
+		t.TriggerUntil(until)
+	}
+}
@@ -0,0 +1,84 @@
+package timer
+
+import (
+	"log"
+	"time"
+)
+
+// Countdown 倒计时（拍卖结束、boss狂暴之类），每秒回调一次剩余时间，到0回调onFinish
+type Countdown struct {
+	t        *Timer
+	endAt    int64
+	canceled bool
+	onTick   func(remaining time.Duration)
+	onFinish func()
+}
+
+// NewCountdown 从现在开始倒计时d（按秒取整），onTick可以传nil只要结束回调。
+// 超过待触发上限注册不上时打日志，返回的Countdown是已取消的状态
+func (t *Timer) NewCountdown(d time.Duration, onTick func(remaining time.Duration), onFinish func()) *Countdown {
+	now := t.now().Unix()
+	c := &Countdown{
+		t:        t,
+		endAt:    now + int64(d/time.Second),
+		onTick:   onTick,
+		onFinish: onFinish,
+	}
+	if err := c.schedule(now+1, false); err != nil {
+		// 第一次就没注册上，当作已取消，不会有任何回调
+		log.Printf("countdown not started: %s", err.Error())
+		c.canceled = true
+	}
+	return c
+}
+
+func NewCountdown(d time.Duration, onTick func(remaining time.Duration), onFinish func()) *Countdown {
+	return tm.NewCountdown(d, onTick, onFinish)
+}
+
+// schedule exempt为true时是已经开始的倒计时续上下一秒，不受待触发上限限制
+func (c *Countdown) schedule(ts int64, exempt bool) error {
+	if ts > c.endAt {
+		ts = c.endAt
+	}
+	return c.t.pushAt(ts, Trigger{
+		Fun:    c.fire,
+		Name:   "countdown",
+		exempt: exempt,
+	})
+}
+
+func (c *Countdown) fire(now int64, _ interface{}) {
+	if c.canceled {
+		return
+	}
+	remaining := c.endAt - now
+	if remaining <= 0 {
+		c.canceled = true
+		if c.onFinish != nil {
+			c.onFinish()
+		}
+		return
+	}
+	if c.onTick != nil {
+		c.onTick(time.Duration(remaining) * time.Second)
+	}
+	c.schedule(now+1, true)
+}
+
+// Cancel 取消之后不会再有任何回调（已经注册在timer里的触发器到点空跑一次）
+func (c *Countdown) Cancel() {
+	c.canceled = true
+}
+
+// Remaining 剩余时间，已结束或已取消返回0
+func (c *Countdown) Remaining() time.Duration {
+	if c.canceled {
+		return 0
+	}
+	r := c.endAt - c.t.now().Unix()
+	if r < 0 {
+		r = 0
+	}
+	return time.Duration(r) * time.Second
+}
@@ -0,0 +1,73 @@
+package timer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"test/gtime"
+	"time"
+)
+
+const maxParamSummary = 128
+
+// PendingTrigger 还没触发的触发器的快照，给admin接口看的，不能拿来还原触发器
+type PendingTrigger struct {
+	FireAt     time.Time `json:"fire_at"` // 按注册时的时区显示
+	Zone       string    `json:"zone"`
+	Name       string    `json:"name"`
+	Param      string    `json:"param"` // fmt出来的参数，太长会截断
+	Persistent bool      `json:"persistent"`
+	Tags       Tags      `json:"tags,omitempty"`
+}
+
+// Dump 按触发时间排序返回所有待触发的触发器，停服维护前看看会漏掉哪些
+func (t *Timer) Dump() []PendingTrigger {
+	var ret []PendingTrigger
+	for ts, list := range t.triggers {
+		for _, trigger := range list {
+			loc := trigger.Loc
+			if loc == nil {
+				loc = gtime.Location()
+			}
+			name := trigger.Name
+			if name == "" {
+				name = "unnamed"
+			}
+			ret = append(ret, PendingTrigger{
+				FireAt:     time.Unix(ts, 0).In(loc),
+				Zone:       loc.String(),
+				Name:       name,
+				Param:      summarizeParam(trigger.Param),
+				Persistent: trigger.persistent,
+				Tags:       trigger.Tags,
+			})
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if !ret[i].FireAt.Equal(ret[j].FireAt) {
+			return ret[i].FireAt.Before(ret[j].FireAt)
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func summarizeParam(p interface{}) string {
+	if p == nil {
+		return ""
+	}
+	var s string
+	switch v := p.(type) {
+	case json.RawMessage: // 持久化触发器的参数
+		s = string(v)
+	case []byte:
+		s = string(v)
+	default:
+		s = fmt.Sprintf("%v", p)
+	}
+	if len(s) > maxParamSummary {
+		s = strings.ToValidUTF8(s[:maxParamSummary], "") + "..."
+	}
+	return s
+}
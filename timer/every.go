@@ -0,0 +1,29 @@
+package timer
+
+import "time"
+
+// 周期任务：刷盘、巡检、清理这类框架内部每隔一段时间跑一次的任务统一用Every，不要再手写"回调里push自己"的闭包。
+// Every注册的触发器不受待触发上限（limit.go）限制，也不会被evict_oldest挤掉：
+// 业务把某一组或者总数刷满时，上限只拦新来的业务触发器，不能把刷盘、对账这种任务永久停掉
+
+// Every 每interval在主循环里执行一次fn，第一次在interval之后。只能在主循环里调。
+// 返回的stop调了之后不再执行（已经注册的那一次到点空跑），不需要停的忽略返回值就行
+func (t *Timer) Every(interval time.Duration, name string, fn func()) (stop func()) {
+	stopped := false
+	var run func(int64, interface{})
+	run = func(int64, interface{}) {
+		if stopped {
+			return
+		}
+		fn()
+		if !stopped {
+			t.pushAt(t.now().Add(interval).Unix(), Trigger{Fun: run, Name: name, exempt: true})
+		}
+	}
+	t.pushAt(t.now().Add(interval).Unix(), Trigger{Fun: run, Name: name, exempt: true})
+	return func() { stopped = true }
+}
+
+func Every(interval time.Duration, name string, fn func()) (stop func()) {
+	return tm.Every(interval, name, fn)
+}
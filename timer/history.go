@@ -0,0 +1,104 @@
+package timer
+
+import (
+	"fmt"
+	"test/gtime"
+	"time"
+)
+
+// 触发记录：每个触发过的触发器记一条（计划时间、实际时间、名字、耗时、错误），最近historySize条留在环形缓冲里，
+// admin的/timer/history能直接查"凌晨4点的重置到底跑没跑"，不用去翻日志。
+// 回调没有返回值，要记错误的话在回调里调SetFireError；回调panic也会记一条再继续往上抛
+
+const historySize = 1000
+
+// FiredEntry 一次触发
+type FiredEntry struct {
+	Name      string        `json:"name"`
+	Scheduled time.Time     `json:"scheduled"` // 注册的触发时间（含jitter）
+	FiredAt   time.Time     `json:"fired_at"`  // 实际执行的时间，补触发时会比Scheduled晚
+	Duration  time.Duration `json:"duration"`
+	Param     string        `json:"param,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+type history struct {
+	buf  []FiredEntry
+	next int
+	full bool
+}
+
+func (h *history) add(e FiredEntry) {
+	if h.buf == nil {
+		h.buf = make([]FiredEntry, historySize)
+	}
+	h.buf[h.next] = e
+	h.next++
+	if h.next == len(h.buf) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// SetFireError 在触发器回调里调，给这次触发的记录带上错误（比如结算失败），不在回调里调无效
+func (t *Timer) SetFireError(err error) {
+	if t.firing != nil && err != nil {
+		t.firing.Error = err.Error()
+	}
+}
+
+func SetFireError(err error) {
+	tm.SetFireError(err)
+}
+
+// fire 执行一个触发器并记录。回调panic时记下来再抛出去，交给外面的崩溃处理
+func (t *Timer) fire(trigger Trigger) {
+	name := trigger.Name
+	if name == "" {
+		name = "unnamed"
+	}
+	loc := trigger.Loc
+	if loc == nil {
+		loc = gtime.Location()
+	}
+	e := &FiredEntry{Name: name, Scheduled: time.Unix(trigger.Now, 0).In(loc), FiredAt: t.now(), Param: summarizeParam(trigger.Param)}
+	outer := t.firing
+	t.firing = e
+	start := time.Now()
+	defer func() {
+		e.Duration = time.Since(start)
+		t.firing = outer
+		if r := recover(); r != nil {
+			e.Error = fmt.Sprintf("panic: %v", r)
+			t.hist.add(*e)
+			panic(r)
+		}
+		t.hist.add(*e)
+		t.record(trigger.Name, e.Duration)
+	}()
+	trigger.Fun(trigger.Now, trigger.Param)
+}
+
+// History 最近的触发记录，新的在前。name不为空时只看这个名字的，limit<=0表示全部
+func (t *Timer) History(name string, limit int) []FiredEntry {
+	var ret []FiredEntry
+	n := t.hist.next
+	if t.hist.full {
+		n = len(t.hist.buf)
+	}
+	for i := 0; i < n; i++ {
+		idx := t.hist.next - 1 - i
+		if idx < 0 {
+			idx += len(t.hist.buf)
+		}
+		e := t.hist.buf[idx]
+		if name != "" && e.Name != name {
+			continue
+		}
+		ret = append(ret, e)
+		if limit > 0 && len(ret) >= limit {
+			break
+		}
+	}
+	return ret
+}
@@ -0,0 +1,28 @@
+package timer
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+// 打散：几百万玩家的每日任务都注册在04:00的话那一秒的tick会卡很久，
+// 给触发器填Jitter，实际触发时间会在[注册时间, 注册时间+Jitter)之间分散开。
+// 填了JitterKey（比如玩家id）的话同一个key每次偏移都一样，玩家每天看到的刷新时间是稳定的
+
+// jitterOffset 秒级偏移
+func jitterOffset(trigger Trigger) int64 {
+	window := int64(trigger.Jitter / time.Second)
+	if window <= 1 {
+		return 0
+	}
+	if trigger.JitterKey == 0 {
+		return rand.Int63n(window)
+	}
+	h := fnv.New64a()
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(trigger.JitterKey))
+	h.Write(b[:])
+	return int64(h.Sum64() % uint64(window))
+}
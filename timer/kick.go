@@ -0,0 +1,27 @@
+package timer
+
+import (
+	"test/metrics"
+)
+
+// 立即触发：主循环每秒打点一次，"马上执行"的触发器（push到当前秒或者已经过去的时间）最多要等将近1秒。
+// Kick让主循环不等下一次打点、马上跑一次Tick；往已经走过的秒上push时会自动Kick。
+// 主循环select里监听Kicked()，收到就Tick(time.Now())。多次Kick在主循环处理之前合并成一次，任何goroutine都能调，不阻塞
+
+// Kick 没有接Kicked()的Timer（比如Simulator）什么都不做
+func (t *Timer) Kick() {
+	select {
+	case t.kick <- struct{}{}:
+		metrics.GetCounter("timer.kick").Inc()
+	default:
+	}
+}
+
+// Kicked 主循环监听这个channel
+func (t *Timer) Kicked() <-chan struct{} {
+	return t.kick
+}
+
+func Kick() {
+	tm.Kick()
+}
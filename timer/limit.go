@@ -0,0 +1,210 @@
+package timer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"test/metrics"
+)
+
+// 待触发数上限：某个功能写出bug（比如每次回调push两个自己）时触发器会无限膨胀，直到进程OOM。
+// 配了上限后总数或者某一类（按Name分组，没名字的归unnamed）超了按策略处理：
+// - reject：新的不注册，PushAt返回ErrPendingLimit
+// - evict_oldest：挤掉同组（总数超了就是全部）里最早要触发的那个，保证新的能进来
+// - log_only：照样注册，只打日志
+// 每种情况都记指标timer.limit.<策略>.<组名>，日志每个组每1000次打一条，不会刷屏。
+// Every注册的周期任务和已经在跑的周期触发器续上的下一次（PushDaily、倒计时、链式触发器的后续步骤）不受上限限制也不会被挤掉，
+// 上限只拦新来的，不会让已经注册成功的周期流程中途断掉。
+// 待触发数按组的统计任何时候都有（不配上限也有），PendingCount看，gauge是timer.pending
+
+var ErrPendingLimit = errors.New("timer: pending trigger limit reached")
+
+type LimitPolicy int
+
+const (
+	LimitReject LimitPolicy = iota
+	LimitEvictOldest
+	LimitLogOnly
+)
+
+func (p LimitPolicy) String() string {
+	switch p {
+	case LimitEvictOldest:
+		return "evict_oldest"
+	case LimitLogOnly:
+		return "log_only"
+	}
+	return "reject"
+}
+
+func ParseLimitPolicy(s string) (LimitPolicy, error) {
+	switch s {
+	case "", "reject":
+		return LimitReject, nil
+	case "evict_oldest":
+		return LimitEvictOldest, nil
+	case "log_only":
+		return LimitLogOnly, nil
+	}
+	return LimitReject, fmt.Errorf("unknown timer limit policy %q", s)
+}
+
+type LimitConf struct {
+	MaxPending  int    `xml:"max_pending" json:"max_pending"`     // 全部待触发的上限，0不限制
+	MaxPerGroup int    `xml:"max_per_group" json:"max_per_group"` // 每一类的默认上限，0不限制，单独的类用SetGroupLimit
+	Policy      string `xml:"policy" json:"policy"`               // reject（默认）/evict_oldest/log_only
+}
+
+func (c *LimitConf) Validate() (errs []error) {
+	if c.MaxPending < 0 {
+		errs = append(errs, fmt.Errorf("max_pending %d must not be negative", c.MaxPending))
+	}
+	if c.MaxPerGroup < 0 {
+		errs = append(errs, fmt.Errorf("max_per_group %d must not be negative", c.MaxPerGroup))
+	}
+	if _, err := ParseLimitPolicy(c.Policy); err != nil {
+		errs = append(errs, err)
+	}
+	return
+}
+
+type pendingLimit struct {
+	maxTotal    int
+	maxPerGroup int
+	groupMax    map[string]int // 单独设置的组上限，优先于maxPerGroup
+	policy      LimitPolicy
+	total       int
+	groups      map[string]int
+	hits        map[string]int64 // 每组超限次数，打日志限频用
+}
+
+func groupOf(trigger Trigger) string {
+	if trigger.Name == "" {
+		return "unnamed"
+	}
+	return trigger.Name
+}
+
+// SetLimit conf为nil表示不限制
+func (t *Timer) SetLimit(conf *LimitConf) error {
+	l := &t.limit
+	if conf == nil {
+		l.maxTotal, l.maxPerGroup, l.policy = 0, 0, LimitReject
+		return nil
+	}
+	p, err := ParseLimitPolicy(conf.Policy)
+	if err != nil {
+		return err
+	}
+	l.maxTotal, l.maxPerGroup, l.policy = conf.MaxPending, conf.MaxPerGroup, p
+	return nil
+}
+
+// SetGroupLimit 单独设置某一类的上限，覆盖max_per_group，n为0时恢复默认
+func (t *Timer) SetGroupLimit(group string, n int) {
+	if t.limit.groupMax == nil {
+		t.limit.groupMax = make(map[string]int)
+	}
+	if n == 0 {
+		delete(t.limit.groupMax, group)
+		return
+	}
+	t.limit.groupMax[group] = n
+}
+
+// PendingCount group为空时是全部待触发数
+func (t *Timer) PendingCount(group string) int {
+	if group == "" {
+		return t.limit.total
+	}
+	return t.limit.groups[group]
+}
+
+func (l *pendingLimit) groupLimit(group string) int {
+	if n, ok := l.groupMax[group]; ok {
+		return n
+	}
+	return l.maxPerGroup
+}
+
+// admit pushAt注册前调，返回非nil表示不注册
+func (t *Timer) admit(trigger Trigger) error {
+	if trigger.exempt {
+		return nil
+	}
+	l := &t.limit
+	group := groupOf(trigger)
+	groupFull := false
+	if n := l.groupLimit(group); n > 0 && l.groups[group] >= n {
+		groupFull = true
+	} else if l.maxTotal <= 0 || l.total < l.maxTotal {
+		return nil
+	}
+	if l.hits == nil {
+		l.hits = make(map[string]int64)
+	}
+	l.hits[group]++
+	metrics.GetCounter("timer.limit." + l.policy.String() + "." + group).Inc()
+	if l.hits[group]%1000 == 1 {
+		log.Printf("timer: pending limit reached (group %s %d, total %d), policy %s, hit %d times", group, l.groups[group], l.total, l.policy, l.hits[group])
+	}
+	switch l.policy {
+	case LimitReject:
+		return ErrPendingLimit
+	case LimitEvictOldest:
+		if groupFull {
+			t.evictOldest(func(tr Trigger) bool { return groupOf(tr) == group })
+		} else {
+			t.evictOldest(nil)
+		}
+	}
+	return nil
+}
+
+// evictOldest 去掉满足match（nil表示全部）的最早要触发的一个，要遍历所有时间点，不受限制的跳过
+func (t *Timer) evictOldest(match func(Trigger) bool) {
+	oldest, idx := int64(0), -1
+	for ts, list := range t.triggers {
+		if idx >= 0 && ts >= oldest {
+			continue
+		}
+		for i, trigger := range list {
+			if !trigger.exempt && (match == nil || match(trigger)) {
+				oldest, idx = ts, i
+				break
+			}
+		}
+	}
+	if idx < 0 {
+		return
+	}
+	list := t.triggers[oldest]
+	t.uncount(list[idx])
+	log.Printf("timer: evicted trigger %s at %d to make room", groupOf(list[idx]), oldest)
+	list = append(list[:idx], list[idx+1:]...)
+	if len(list) == 0 {
+		delete(t.triggers, oldest)
+	} else {
+		t.triggers[oldest] = list
+	}
+}
+
+func (t *Timer) count(trigger Trigger) {
+	l := &t.limit
+	if l.groups == nil {
+		l.groups = make(map[string]int)
+	}
+	l.total++
+	l.groups[groupOf(trigger)]++
+	metrics.GetGauge("timer.pending").Set(int64(l.total))
+}
+
+func (t *Timer) uncount(trigger Trigger) {
+	l := &t.limit
+	l.total--
+	group := groupOf(trigger)
+	if l.groups[group]--; l.groups[group] <= 0 {
+		delete(l.groups, group)
+	}
+	metrics.GetGauge("timer.pending").Set(int64(l.total))
+}
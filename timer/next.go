@@ -0,0 +1,61 @@
+package timer
+
+import "time"
+
+// 下一次触发时间：主循环可以按它决定睡多久（没有触发器时不用每秒醒），功能层可以显示"距离下次重置还有3h12m"。
+// Timer底层是无序map，这里是O(触发时间点个数)的遍历，别在每个玩家请求里调，显示用的结果可以缓存到下次触发
+
+// NextFireTime 最近一个待触发的时间（已经算上打散偏移），没有待触发的返回false
+func (t *Timer) NextFireTime() (time.Time, bool) {
+	return t.nextFireTime(func(Trigger) bool { return true })
+}
+
+// NextFireTimeForGroup 按触发器名字（Trigger.Name，同类触发器用同一个名字）查最近一次，比如NextFireTimeForGroup("daily_reset")
+func (t *Timer) NextFireTimeForGroup(group string) (time.Time, bool) {
+	return t.nextFireTime(func(trigger Trigger) bool { return trigger.Name == group })
+}
+
+func (t *Timer) nextFireTime(match func(Trigger) bool) (time.Time, bool) {
+	var next int64
+	found := false
+	for ts, list := range t.triggers {
+		if found && ts >= next {
+			continue
+		}
+		for _, trigger := range list {
+			if match(trigger) {
+				next, found = ts, true
+				break
+			}
+		}
+	}
+	if !found {
+		return time.Time{}, false
+	}
+	return time.Unix(next, 0), true
+}
+
+func NextFireTime() (time.Time, bool) {
+	return tm.NextFireTime()
+}
+
+func NextFireTimeForGroup(group string) (time.Time, bool) {
+	return tm.NextFireTimeForGroup(group)
+}
+
+// NextFireTime 分片触发器的版本，取各分片堆顶的最小值
+func (st *ShardedTimer) NextFireTime() (time.Time, bool) {
+	var next int64
+	found := false
+	for _, s := range st.shards {
+		s.m.Lock()
+		if len(s.heap) > 0 && (!found || s.heap[0].at < next) {
+			next, found = s.heap[0].at, true
+		}
+		s.m.Unlock()
+	}
+	if !found {
+		return time.Time{}, false
+	}
+	return time.Unix(next, 0), true
+}
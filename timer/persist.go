@@ -0,0 +1,142 @@
+package timer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// 需要跨进程重启保留的触发器（比如玩家的建筑升级完成时间）。
+// 闭包没法序列化，所以持久化触发器只存 名字+触发时间+参数json，重启后按名字找RegisterPersistHandler注册的处理函数重建。
+//
+// 存档格式带版本号。Trigger或者参数结构变了的时候：
+// 1. PersistVersion加1
+// 2. RegisterMigration(旧版本号, 转换函数)，把旧版本的triggers数组转成新版本的格式
+// Restore时从存档的版本开始逐个版本迁移到当前版本
+
+const PersistVersion = 1
+
+type PersistedTrigger struct {
+	Name   string          `json:"name"`
+	FireAt int64           `json:"fire_at"`
+	Param  json.RawMessage `json:"param,omitempty"`
+	Tags   Tags            `json:"tags,omitempty"`
+}
+
+type persistBlob struct {
+	Version  int             `json:"version"`
+	Triggers json.RawMessage `json:"triggers"` // 不同版本格式可能不同，迁移完再解析
+}
+
+// PersistHandler 持久化触发器的处理函数，param是Push时传入参数的json
+type PersistHandler func(now int64, param json.RawMessage)
+
+var (
+	persistHandlers = make(map[string]PersistHandler)
+	migrations      = make(map[int]func(json.RawMessage) (json.RawMessage, error))
+)
+
+// RegisterPersistHandler 启动时（Restore之前）注册
+func RegisterPersistHandler(name string, h PersistHandler) {
+	persistHandlers[name] = h
+}
+
+// RegisterMigration 注册从fromVersion迁移到fromVersion+1的转换，入参和返回都是triggers数组的json
+func RegisterMigration(fromVersion int, f func(json.RawMessage) (json.RawMessage, error)) {
+	migrations[fromVersion] = f
+}
+
+// PushPersistent 注册一个持久化触发器，name必须已经RegisterPersistHandler，param要能json序列化。tags会跟着一起存。
+// 超过待触发上限被拒绝时返回ErrPendingLimit
+func (t *Timer) PushPersistent(at time.Time, name string, param any, tags ...string) error {
+	h, ok := persistHandlers[name]
+	if !ok {
+		return fmt.Errorf("PushPersistent error: handler %s not registered", name)
+	}
+	raw, err := json.Marshal(param)
+	if err != nil {
+		return err
+	}
+	return t.pushPersistent(at.Unix(), name, raw, tags, h)
+}
+
+func PushPersistent(at time.Time, name string, param any, tags ...string) error {
+	return tm.PushPersistent(at, name, param, tags...)
+}
+
+func (t *Timer) pushPersistent(ts int64, name string, raw json.RawMessage, tags Tags, h PersistHandler) error {
+	return t.pushAt(ts, Trigger{
+		Fun: func(now int64, p interface{}) {
+			h(now, p.(json.RawMessage))
+		},
+		Param:      raw,
+		Name:       name,
+		Tags:       tags,
+		persistent: true,
+	})
+}
+
+// Save 把还没触发的持久化触发器存成blob（普通触发器不管）
+func (t *Timer) Save() ([]byte, error) {
+	var list []PersistedTrigger
+	for ts, triggers := range t.triggers {
+		for _, trigger := range triggers {
+			if !trigger.persistent {
+				continue
+			}
+			list = append(list, PersistedTrigger{
+				Name:   trigger.Name,
+				FireAt: ts,
+				Param:  trigger.Param.(json.RawMessage),
+				Tags:   trigger.Tags,
+			})
+		}
+	}
+	raw, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&persistBlob{Version: PersistVersion, Triggers: raw})
+}
+
+// Restore 从Save的blob恢复，返回恢复了多少个。找不到处理函数的、超过待触发上限注册不上的触发器打日志跳过，不算在里面。
+// 已经过了触发时间的也会恢复，下一次Tick时补触发（见clock.go）
+func (t *Timer) Restore(b []byte) (int, error) {
+	blob := &persistBlob{}
+	if err := json.Unmarshal(b, blob); err != nil {
+		return 0, err
+	}
+	if blob.Version > PersistVersion {
+		return 0, fmt.Errorf("Restore error: blob version %d is newer than current %d", blob.Version, PersistVersion)
+	}
+	raw := blob.Triggers
+	for v := blob.Version; v < PersistVersion; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return 0, fmt.Errorf("Restore error: no migration registered from version %d", v)
+		}
+		var err error
+		if raw, err = m(raw); err != nil {
+			return 0, fmt.Errorf("Restore error: migrate from version %d failed: %w", v, err)
+		}
+	}
+	var list []PersistedTrigger
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, p := range list {
+		h, ok := persistHandlers[p.Name]
+		if !ok {
+			log.Printf("timer restore: handler %s not registered, trigger at %d dropped", p.Name, p.FireAt)
+			continue
+		}
+		if err := t.pushPersistent(p.FireAt, p.Name, p.Param, p.Tags, h); err != nil {
+			log.Printf("timer restore: trigger %s at %d dropped: %s", p.Name, p.FireAt, err.Error())
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,230 @@
+package timer
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"test/metrics"
+	"time"
+)
+
+// 按key（玩家id）分片的触发器，给上百万个玩家级持久触发器用（建筑升级、行军到达之类）。
+// 全局的Timer是一个map，没有锁也没法按玩家取消；这里每个分片一把锁 + 一个最小堆，
+// Push/Cancel都是O(log n)，不同玩家的Push落在不同分片上互不阻塞。
+// 到点的回调在调Fire/FireShard的goroutine里执行，主循环每秒调一次Fire；
+// 分片数足够多时也可以每个分片交给一个goroutine调FireShard，回调自己注意并发
+
+const defaultShardCount = 64
+
+type keyedItem struct {
+	id      uint64
+	key     int64
+	at      int64 // 秒级时间戳，已经加上打散偏移
+	trigger Trigger
+	index   int // 在堆里的下标，heap.Fix/Remove用
+}
+
+type shardHeap []*keyedItem
+
+func (h shardHeap) Len() int { return len(h) }
+func (h shardHeap) Less(i, j int) bool {
+	if h[i].at != h[j].at {
+		return h[i].at < h[j].at
+	}
+	return h[i].id < h[j].id // 同一秒按注册顺序
+}
+func (h shardHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *shardHeap) Push(x any) {
+	item := x.(*keyedItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+func (h *shardHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	item.index = -1
+	return item
+}
+
+type timerShard struct {
+	m     sync.Mutex
+	heap  shardHeap
+	byId  map[uint64]*keyedItem
+	byKey map[int64]map[uint64]struct{}
+	fired int64
+}
+
+func (s *timerShard) remove(item *keyedItem) {
+	heap.Remove(&s.heap, item.index)
+	delete(s.byId, item.id)
+	ids := s.byKey[item.key]
+	delete(ids, item.id)
+	if len(ids) == 0 {
+		delete(s.byKey, item.key)
+	}
+}
+
+type ShardedTimer struct {
+	shards []*timerShard
+	nextId atomic.Uint64
+}
+
+// NewShardedTimer n<=0时用默认的64个分片
+func NewShardedTimer(n int) *ShardedTimer {
+	if n <= 0 {
+		n = defaultShardCount
+	}
+	st := &ShardedTimer{shards: make([]*timerShard, n)}
+	for i := range st.shards {
+		st.shards[i] = &timerShard{
+			byId:  make(map[uint64]*keyedItem),
+			byKey: make(map[int64]map[uint64]struct{}),
+		}
+	}
+	return st
+}
+
+var keyed = NewShardedTimer(defaultShardCount)
+
+func GetKeyed() *ShardedTimer {
+	return keyed
+}
+
+// shardIndex 玩家id一般是连续的，乘一个大奇数打散一下再取模
+func (st *ShardedTimer) shardIndex(key int64) int {
+	return int((uint64(key) * 0x9E3779B97F4A7C15 >> 32) % uint64(len(st.shards)))
+}
+
+// Push 注册key名下的一个触发器，返回的id用于Cancel。Jitter/JitterKey同样生效
+func (st *ShardedTimer) Push(key int64, at time.Time, trigger Trigger) uint64 {
+	item := &keyedItem{
+		id:      st.nextId.Add(1),
+		key:     key,
+		at:      at.Unix() + jitterOffset(trigger),
+		trigger: trigger,
+	}
+	item.trigger.Now = item.at
+	s := st.shards[st.shardIndex(key)]
+	s.m.Lock()
+	defer s.m.Unlock()
+	heap.Push(&s.heap, item)
+	s.byId[item.id] = item
+	ids, ok := s.byKey[key]
+	if !ok {
+		ids = make(map[uint64]struct{})
+		s.byKey[key] = ids
+	}
+	ids[item.id] = struct{}{}
+	return item.id
+}
+
+// Cancel 已经触发过或者不存在时返回false
+func (st *ShardedTimer) Cancel(key int64, id uint64) bool {
+	s := st.shards[st.shardIndex(key)]
+	s.m.Lock()
+	defer s.m.Unlock()
+	item, ok := s.byId[id]
+	if !ok || item.key != key {
+		return false
+	}
+	s.remove(item)
+	return true
+}
+
+// CancelKey 取消key名下所有触发器（比如删号），返回取消的个数
+func (st *ShardedTimer) CancelKey(key int64) int {
+	s := st.shards[st.shardIndex(key)]
+	s.m.Lock()
+	defer s.m.Unlock()
+	ids := s.byKey[key]
+	n := len(ids)
+	for id := range ids {
+		s.remove(s.byId[id])
+	}
+	return n
+}
+
+// FireShard 触发第i个分片里所有时间<=now的触发器，返回触发个数。
+// 先在锁里把到点的摘下来，解锁后再执行回调，所以回调里可以再Push/Cancel
+func (st *ShardedTimer) FireShard(i int, now time.Time) int {
+	s := st.shards[i]
+	ts := now.Unix()
+	var due []*keyedItem
+	s.m.Lock()
+	for len(s.heap) > 0 && s.heap[0].at <= ts {
+		item := s.heap[0]
+		s.remove(item)
+		due = append(due, item)
+	}
+	s.fired += int64(len(due))
+	s.m.Unlock()
+	for _, item := range due {
+		name := item.trigger.Name
+		if name == "" {
+			name = "unnamed"
+		}
+		start := time.Now()
+		item.trigger.Fun(item.trigger.Now, item.trigger.Param)
+		cost := time.Since(start)
+		metrics.GetHistogram("timer.callback." + name).Observe(cost)
+		metrics.GetTickBudget().Observe("timer."+name, cost)
+	}
+	return len(due)
+}
+
+// Fire 按顺序触发所有分片，主循环每个tick调一次
+func (st *ShardedTimer) Fire(now time.Time) int {
+	n := 0
+	for i := range st.shards {
+		n += st.FireShard(i, now)
+	}
+	return n
+}
+
+type ShardStat struct {
+	Shard   int   `json:"shard"`
+	Pending int   `json:"pending"`
+	Keys    int   `json:"keys"`
+	Fired   int64 `json:"fired"`
+}
+
+// Stats 各分片当前的待触发数、key数和累计触发数，并把总数和不均衡度写到metrics：
+// timer.keyed.pending，timer.keyed.imbalance_pct（最多的分片比平均多百分之几）
+func (st *ShardedTimer) Stats() []ShardStat {
+	ret := make([]ShardStat, len(st.shards))
+	total, max := 0, 0
+	for i, s := range st.shards {
+		s.m.Lock()
+		ret[i] = ShardStat{Shard: i, Pending: len(s.heap), Keys: len(s.byKey), Fired: s.fired}
+		s.m.Unlock()
+		total += ret[i].Pending
+		if ret[i].Pending > max {
+			max = ret[i].Pending
+		}
+	}
+	metrics.GetGauge("timer.keyed.pending").Set(int64(total))
+	imbalance := int64(0)
+	if total > 0 {
+		avg := float64(total) / float64(len(st.shards))
+		imbalance = int64((float64(max)/avg - 1) * 100)
+	}
+	metrics.GetGauge("timer.keyed.imbalance_pct").Set(imbalance)
+	return ret
+}
+
+// Len 所有分片的待触发总数
+func (st *ShardedTimer) Len() int {
+	n := 0
+	for _, s := range st.shards {
+		s.m.Lock()
+		n += len(s.heap)
+		s.m.Unlock()
+	}
+	return n
+}
@@ -0,0 +1,78 @@
+package timer
+
+import (
+	"fmt"
+	"time"
+)
+
+// FiredRecord Simulator里每个被触发的触发器记一条
+type FiredRecord struct {
+	At    int64       // 触发器注册的触发时间（秒级时间戳）
+	Param interface{} // 触发器参数
+}
+
+// Simulator 单测用的虚拟时钟。持有一个独立的Timer实例（不碰全局的tm），
+// 由测试代码调Advance一秒一秒地推进虚拟时间，到点的触发器在Advance里同步执行，并按触发顺序记到Fired里。
+// 这样测跨天重置之类的逻辑时不需要sleep，也不会因为机器慢而抖动
+type Simulator struct {
+	*Timer
+	now   time.Time
+	Fired []FiredRecord
+}
+
+func NewSimulator(start time.Time) *Simulator {
+	s := &Simulator{
+		Timer: &Timer{triggers: map[int64][]Trigger{}},
+		now:   start.Truncate(time.Second),
+	}
+	s.Timer.clock = s.Now
+	return s
+}
+
+// Now 当前虚拟时间
+func (s *Simulator) Now() time.Time {
+	return s.now
+}
+
+// Push 按虚拟时间注册一个触发器。at等于当前虚拟秒的在下一次Advance的第一步触发；
+// 早于当前虚拟时间的永远不会被触发，直接返回错误
+func (s *Simulator) Push(at time.Time, trigger Trigger) error {
+	if at.Unix() < s.now.Unix() {
+		return fmt.Errorf("Simulator::Push error: at %d is before virtual now %d", at.Unix(), s.now.Unix())
+	}
+	return s.PushAt(at, trigger)
+}
+
+// Advance 把虚拟时间往后推d（按秒推进，不足1秒的部分舍去），经过的每一秒都跑一次触发
+func (s *Simulator) Advance(d time.Duration) {
+	s.AdvanceTo(s.now.Add(d))
+}
+
+// AdvanceTo 推进到指定时间点（含），早于当前虚拟时间时什么都不做。
+// 第一步先跑当前虚拟秒，把上次推进之后注册在这一秒的触发器补上
+func (s *Simulator) AdvanceTo(to time.Time) {
+	end := to.Truncate(time.Second)
+	if end.Before(s.now) {
+		return
+	}
+	s.fireAt(s.now)
+	for s.now.Before(end) {
+		s.now = s.now.Add(time.Second)
+		s.fireAt(s.now)
+	}
+}
+
+func (s *Simulator) fireAt(at time.Time) {
+	for _, trigger := range s.triggerAt(at.Unix()) {
+		s.Fired = append(s.Fired, FiredRecord{At: trigger.Now, Param: trigger.Param})
+	}
+}
+
+// Pending 还没触发的触发器数量
+func (s *Simulator) Pending() int {
+	n := 0
+	for _, list := range s.triggers {
+		n += len(list)
+	}
+	return n
+}
@@ -0,0 +1,550 @@
+package timer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimulator(t *testing.T) {
+	start := time.Date(2024, 1, 1, 23, 59, 50, 0, time.Local)
+	s := NewSimulator(start)
+	resetCount := 0
+	var dailyReset func(int64, interface{})
+	dailyReset = func(now int64, _ interface{}) {
+		resetCount++
+		// 重置逻辑在回调里注册下一次重置
+		s.Push(time.Unix(now, 0).AddDate(0, 0, 1), Trigger{Fun: dailyReset, Param: "reset"})
+	}
+	s.Push(time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local), Trigger{Fun: dailyReset, Param: "reset"})
+	s.Push(start.Add(5*time.Second), Trigger{Fun: func(int64, interface{}) {}, Param: "first"})
+
+	s.Advance(3 * 24 * time.Hour)
+	if resetCount != 3 {
+		t.Fatalf("expect 3 resets, got %d", resetCount)
+	}
+	if len(s.Fired) != 4 || s.Fired[0].Param != "first" || s.Fired[1].Param != "reset" {
+		t.Fatalf("unexpected fire order: %v", s.Fired)
+	}
+	if s.Pending() != 1 {
+		t.Fatalf("expect next reset pending, got %d", s.Pending())
+	}
+}
+
+func TestSimulatorPushNow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	s := NewSimulator(start)
+	var fired []string
+	push := func(at time.Time, name string) error {
+		return s.Push(at, Trigger{Fun: func(int64, interface{}) { fired = append(fired, name) }, Param: name})
+	}
+	// 注册在当前虚拟秒的，下一次推进的第一步就触发，排在后面各秒之前
+	push(start.Add(time.Second), "next")
+	push(start, "now")
+	s.Advance(time.Second)
+	if strings.Join(fired, ",") != "now,next" {
+		t.Fatalf("fired %v", fired)
+	}
+	// 推进0秒也会补上当前秒
+	push(s.Now(), "zero")
+	s.Advance(0)
+	if strings.Join(fired, ",") != "now,next,zero" || s.Pending() != 0 {
+		t.Fatalf("fired %v, pending %d", fired, s.Pending())
+	}
+	if err := push(start, "past"); err == nil || s.Pending() != 0 {
+		t.Fatalf("push into the past err = %v", err)
+	}
+}
+
+func TestCountdown(t *testing.T) {
+	s := NewSimulator(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local))
+	var ticks []time.Duration
+	finished := 0
+	c := s.NewCountdown(3*time.Second, func(remaining time.Duration) {
+		ticks = append(ticks, remaining)
+	}, func() {
+		finished++
+	})
+	s.Advance(10 * time.Second)
+	if len(ticks) != 2 || ticks[0] != 2*time.Second || ticks[1] != time.Second || finished != 1 {
+		t.Fatalf("unexpected countdown callbacks: %v, finished %d", ticks, finished)
+	}
+	if c.Remaining() != 0 {
+		t.Fatalf("expect 0 remaining, got %v", c.Remaining())
+	}
+	c2 := s.NewCountdown(5*time.Second, nil, func() { finished++ })
+	s.Advance(2 * time.Second)
+	if c2.Remaining() != 3*time.Second {
+		t.Fatalf("expect 3s remaining, got %v", c2.Remaining())
+	}
+	c2.Cancel()
+	s.Advance(10 * time.Second)
+	if finished != 1 {
+		t.Fatalf("canceled countdown should not finish")
+	}
+}
+
+func TestPersistRestore(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	var got []string
+	RegisterPersistHandler("test_build_done", func(now int64, param json.RawMessage) {
+		got = append(got, string(param))
+	})
+	s := NewSimulator(start)
+	if err := s.PushPersistent(start.Add(5*time.Second), "test_build_done", map[string]int{"building": 3}); err != nil {
+		t.Fatal(err)
+	}
+	s.Push(start.Add(5*time.Second), Trigger{Fun: func(int64, interface{}) {}})
+	b, err := s.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s2 := NewSimulator(start)
+	if n, err := s2.Restore(b); err != nil || n != 1 {
+		t.Fatalf("restore failed: %d %v", n, err)
+	}
+	s2.Advance(10 * time.Second)
+	if len(got) != 1 || got[0] != `{"building":3}` {
+		t.Fatalf("unexpected restored fire: %v", got)
+	}
+
+	// 版本0的老格式参数是裸数字，迁移成新格式
+	RegisterMigration(0, func(raw json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(strings.Replace(string(raw), `"param":3`, `"param":{"building":3}`, 1)), nil
+	})
+	defer delete(migrations, 0)
+	old := fmt.Sprintf(`{"version":0,"triggers":[{"name":"test_build_done","fire_at":%d,"param":3}]}`, start.Add(time.Second).Unix())
+	s3 := NewSimulator(start)
+	if n, err := s3.Restore([]byte(old)); err != nil || n != 1 {
+		t.Fatalf("restore old version failed: %d %v", n, err)
+	}
+	s3.Advance(2 * time.Second)
+	if len(got) != 2 || got[1] != `{"building":3}` {
+		t.Fatalf("unexpected migrated fire: %v", got)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 3, 59, 0, 0, time.Local)
+	s := NewSimulator(start)
+	at := start.Add(time.Minute)
+	fired := map[int64]int64{}
+	for key := int64(1); key <= 50; key++ {
+		k := key
+		s.Push(at, Trigger{
+			Fun:       func(now int64, _ interface{}) { fired[k] = now },
+			Jitter:    5 * time.Minute,
+			JitterKey: k,
+		})
+	}
+	s.Advance(10 * time.Minute)
+	seconds := map[int64]bool{}
+	for k, now := range fired {
+		if now < at.Unix() || now >= at.Add(5*time.Minute).Unix() {
+			t.Fatalf("key %d fired at %d, out of jitter window", k, now)
+		}
+		if now != at.Unix()+jitterOffset(Trigger{Jitter: 5 * time.Minute, JitterKey: k}) {
+			t.Fatalf("key %d offset not stable", k)
+		}
+		seconds[now] = true
+	}
+	if len(fired) != 50 || len(seconds) < 10 {
+		t.Fatalf("triggers not spread: %d fired in %d distinct seconds", len(fired), len(seconds))
+	}
+}
+
+func TestShardedTimer(t *testing.T) {
+	st := NewShardedTimer(8)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	var fired []int64
+	ids := map[int64]uint64{}
+	for key := int64(1); key <= 100; key++ {
+		k := key
+		ids[k] = st.Push(k, base.Add(time.Duration(k%10)*time.Second), Trigger{
+			Fun: func(int64, interface{}) { fired = append(fired, k) },
+		})
+	}
+	if !st.Cancel(5, ids[5]) || st.Cancel(5, ids[5]) || st.Cancel(6, ids[7]) {
+		t.Fatalf("cancel result wrong")
+	}
+	st.Push(7, base.Add(time.Hour), Trigger{Fun: func(int64, interface{}) {}})
+	if n := st.CancelKey(7); n != 2 {
+		t.Fatalf("CancelKey(7) = %d, want 2", n)
+	}
+	if n := st.Fire(base.Add(4 * time.Second)); n != 50 {
+		t.Fatalf("fired %d, want 50", n)
+	}
+	if n := st.Fire(base.Add(time.Minute)); n != 48 || st.Len() != 0 {
+		t.Fatalf("fired %d, left %d", n, st.Len())
+	}
+	for _, k := range fired {
+		if k == 5 || k == 7 {
+			t.Fatalf("canceled key %d fired", k)
+		}
+	}
+	total := int64(0)
+	for _, s := range st.Stats() {
+		if s.Fired == 0 {
+			t.Errorf("shard %d never used, keys not spread", s.Shard)
+		}
+		total += s.Fired
+	}
+	if total != 98 {
+		t.Fatalf("total fired %d, want 98", total)
+	}
+}
+
+func TestCancelWhere(t *testing.T) {
+	start := time.Date(2024, 2, 10, 0, 0, 0, 0, time.Local)
+	s := NewSimulator(start)
+	for i := 1; i <= 3; i++ {
+		s.Push(start.Add(time.Duration(i)*time.Minute), Trigger{Fun: func(int64, interface{}) {}, Param: "spring", Tags: Tags{"activity:springfestival"}})
+		s.Push(start.Add(time.Duration(i)*time.Minute), Trigger{Fun: func(int64, interface{}) {}, Param: "other", Tags: Tags{"activity:lantern"}})
+	}
+	s.Push(start.Add(time.Minute), Trigger{Fun: func(int64, interface{}) {}, Param: "untagged"})
+	if n := s.CancelWhere(func(tags Tags) bool { return tags.Has("activity:springfestival") }); n != 3 {
+		t.Fatalf("canceled %d, want 3", n)
+	}
+	s.Advance(time.Hour)
+	for _, f := range s.Fired {
+		if f.Param == "spring" {
+			t.Fatalf("canceled trigger fired")
+		}
+	}
+	if len(s.Fired) != 4 {
+		t.Fatalf("fired %d, want 4", len(s.Fired))
+	}
+}
+
+func TestNextFireTime(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	s := NewSimulator(start)
+	if _, ok := s.NextFireTime(); ok {
+		t.Fatalf("empty timer should have no next fire time")
+	}
+	s.Push(start.Add(3*time.Hour+12*time.Minute), Trigger{Fun: func(int64, interface{}) {}, Name: "daily_reset"})
+	s.Push(start.Add(10*time.Second), Trigger{Fun: func(int64, interface{}) {}, Name: "build_done"})
+	if next, ok := s.NextFireTime(); !ok || !next.Equal(start.Add(10*time.Second)) {
+		t.Fatalf("NextFireTime = %v %v", next, ok)
+	}
+	if next, ok := s.NextFireTimeForGroup("daily_reset"); !ok || next.Sub(s.Now()) != 3*time.Hour+12*time.Minute {
+		t.Fatalf("NextFireTimeForGroup = %v %v", next, ok)
+	}
+	if _, ok := s.NextFireTimeForGroup("none"); ok {
+		t.Fatalf("unknown group should have no next fire time")
+	}
+	s.Advance(time.Minute)
+	if next, _ := s.NextFireTime(); !next.Equal(start.Add(3*time.Hour + 12*time.Minute)) {
+		t.Fatalf("NextFireTime after fire = %v", next)
+	}
+}
+
+func TestTickClockJump(t *testing.T) {
+	tm := &Timer{}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	var fired []int64
+	push := func(at time.Time) {
+		tm.pushAt(at.Unix(), Trigger{Fun: func(now int64, _ interface{}) { fired = append(fired, now-base.Unix()) }})
+	}
+	push(base.Add(-time.Minute)) // 启动前就过期的（Restore回来的）
+	push(base.Add(2 * time.Second))
+	push(base.Add(5 * time.Second))
+	push(base.Add(2 * time.Hour))
+	push(base.Add(3 * time.Hour))
+
+	tm.Tick(base)
+	tm.Tick(base.Add(time.Second))
+	// 掉了几个tick
+	tm.Tick(base.Add(6 * time.Second))
+	if len(fired) != 3 || fired[0] != -60 || fired[1] != 2 || fired[2] != 5 {
+		t.Fatalf("fired %v", fired)
+	}
+	// 往回跳，已经触发过的不会再触发，往回跳之后push的到点照常触发
+	tm.Tick(base.Add(3 * time.Second))
+	push(base.Add(4 * time.Second))
+	tm.Tick(base.Add(3 * time.Second))
+	if len(fired) != 3 {
+		t.Fatalf("fired too early after backward jump %v", fired)
+	}
+	tm.Tick(base.Add(7 * time.Second))
+	if len(fired) != 4 || fired[3] != 4 {
+		t.Fatalf("fired after backward jump %v", fired)
+	}
+	fired = fired[:3]
+	// 往前跳超过maxJump，每次只补maxJump
+	tm.SetMaxJump(time.Hour)
+	tm.Tick(base.Add(4 * time.Hour))
+	if len(fired) != 3 {
+		t.Fatalf("fired after limited jump %v", fired)
+	}
+	tm.Tick(base.Add(4 * time.Hour))
+	if len(fired) != 4 || fired[3] != 7200 {
+		t.Fatalf("fired after second catch-up %v", fired)
+	}
+	tm.Tick(base.Add(4 * time.Hour))
+	tm.Tick(base.Add(4 * time.Hour))
+	if len(fired) != 5 || fired[4] != 10800 {
+		t.Fatalf("fired after catch-up %v", fired)
+	}
+}
+
+func TestChain(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	s := NewSimulator(start)
+	var steps []string
+	step := func(name string) Trigger {
+		return Trigger{Name: name, Fun: func(now int64, _ interface{}) {
+			steps = append(steps, fmt.Sprintf("%s@%d", name, now-start.Unix()))
+		}}
+	}
+	c := s.After(start.Add(10*time.Second), step("close_signup")).
+		Then(step("start_match"), 5*time.Minute).
+		Then(step("settle"), 30*time.Minute)
+	if c.Pending() != 3 {
+		t.Fatalf("pending %d", c.Pending())
+	}
+	s.Advance(10 * time.Second)
+	if len(steps) != 1 || s.Pending() != 1 {
+		t.Fatalf("after first step %v, pending %d", steps, s.Pending())
+	}
+	s.Advance(40 * time.Minute)
+	if strings.Join(steps, ",") != "close_signup@10,start_match@310,settle@2110" || !c.Done() {
+		t.Fatalf("steps %v", steps)
+	}
+
+	// 在某一步里中止后续步骤
+	steps = nil
+	var c2 *Chain
+	c2 = s.After(s.Now().Add(time.Second), Trigger{Fun: func(int64, interface{}) { c2.Cancel() }}).
+		Then(step("never"), time.Second)
+	s.Advance(time.Minute)
+	if len(steps) != 0 || c2.Pending() != 0 || s.Pending() != 0 {
+		t.Fatalf("cancelled chain ran %v", steps)
+	}
+}
+
+// memLocker 进程内模拟的分布式锁，几个Simulator共用一个
+type memLocker struct {
+	held map[string]int
+	fail bool
+}
+
+func (l *memLocker) TryLock(name string, at int64) (bool, error) {
+	if l.fail {
+		return false, fmt.Errorf("db down")
+	}
+	key := fmt.Sprintf("%s@%d", name, at)
+	l.held[key]++
+	return l.held[key] == 1, nil
+}
+
+func TestSingleton(t *testing.T) {
+	start := time.Date(2024, 1, 1, 23, 0, 0, 0, time.Local)
+	locker := &memLocker{held: map[string]int{}}
+	runs := map[int]int{}
+	var sims []*Simulator
+	for i := 0; i < 3; i++ {
+		s := NewSimulator(start)
+		s.SetLocker(locker)
+		node := i
+		if err := s.PushDaily(time.Local, "05:00:00", Trigger{Name: "daily_settle", Singleton: true, Fun: func(int64, interface{}) { runs[node]++ }}); err != nil {
+			t.Fatal(err)
+		}
+		sims = append(sims, s)
+	}
+	for day := 0; day < 3; day++ {
+		for _, s := range sims {
+			s.Advance(24 * time.Hour)
+		}
+	}
+	if total := runs[0] + runs[1] + runs[2]; total != 3 || runs[0] != 3 {
+		t.Fatalf("expect exactly one run per day, got %v", runs)
+	}
+	// 没抢到的进程也要继续注册下一天
+	for i, s := range sims {
+		if s.Pending() != 1 {
+			t.Fatalf("sim %d pending %d", i, s.Pending())
+		}
+	}
+	// 抢锁出错时跳过
+	locker.fail = true
+	sims[0].Advance(24 * time.Hour)
+	if runs[0] != 3 {
+		t.Fatalf("ran without lock: %v", runs)
+	}
+	// 没设Locker当单进程
+	s := NewSimulator(start)
+	n := 0
+	s.Push(start.Add(time.Second), Trigger{Name: "solo", Singleton: true, Fun: func(int64, interface{}) { n++ }})
+	s.Advance(time.Minute)
+	if n != 1 {
+		t.Fatalf("singleton without locker ran %d times", n)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expect panic on unnamed singleton")
+		}
+	}()
+	s.Push(start.Add(time.Hour), Trigger{Singleton: true, Fun: func(int64, interface{}) {}})
+}
+
+func TestHistory(t *testing.T) {
+	start := time.Date(2024, 1, 1, 3, 59, 0, 0, time.Local)
+	s := NewSimulator(start)
+	s.Push(start.Add(time.Minute), Trigger{Name: "daily_reset", Fun: func(int64, interface{}) {}})
+	s.Push(start.Add(2*time.Minute), Trigger{Name: "settle", Param: 7, Fun: func(int64, interface{}) {
+		s.SetFireError(fmt.Errorf("no season"))
+	}})
+	s.Push(start.Add(3*time.Minute), Trigger{Name: "boom", Fun: func(int64, interface{}) { panic("bad") }})
+	s.Advance(2 * time.Minute)
+	func() {
+		defer func() { recover() }()
+		s.Advance(time.Minute)
+	}()
+	h := s.History("", 0)
+	if len(h) != 3 || h[0].Name != "boom" || h[0].Error != "panic: bad" || h[1].Error != "no season" || h[1].Param != "7" {
+		t.Fatalf("history %+v", h)
+	}
+	if r := s.History("daily_reset", 0); len(r) != 1 || !r[0].Scheduled.Equal(start.Add(time.Minute)) || r[0].Error != "" {
+		t.Fatalf("daily_reset %+v", r)
+	}
+	// 环形缓冲只留最近historySize条
+	for i := 0; i < historySize+5; i++ {
+		s.Push(s.Now().Add(time.Second), Trigger{Name: "spam", Param: i, Fun: func(int64, interface{}) {}})
+		s.Advance(time.Second)
+	}
+	if all := s.History("", 0); len(all) != historySize || all[0].Param != fmt.Sprint(historySize+4) {
+		t.Fatalf("ring size %d, newest %+v", len(all), all[0])
+	}
+	if len(s.History("daily_reset", 0)) != 0 || len(s.History("spam", 10)) != 10 {
+		t.Fatal("filter/limit wrong")
+	}
+}
+
+func TestPendingLimit(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	s := NewSimulator(start)
+	if err := s.SetLimit(&LimitConf{MaxPending: 5, MaxPerGroup: 2}); err != nil {
+		t.Fatal(err)
+	}
+	noop := func(int64, interface{}) {}
+	for i := 1; i <= 3; i++ {
+		err := s.Push(start.Add(time.Duration(i)*time.Second), Trigger{Fun: noop, Name: "leak"})
+		if (i <= 2) != (err == nil) {
+			t.Fatalf("push %d err = %v", i, err)
+		}
+	}
+	s.SetGroupLimit("leak", 3)
+	if err := s.Push(start.Add(3*time.Second), Trigger{Fun: noop, Name: "leak"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Push(start.Add(time.Second), Trigger{Fun: noop, Name: "other"})
+	s.Push(start.Add(time.Second), Trigger{Fun: noop})
+	if err := s.Push(start.Add(time.Second), Trigger{Fun: noop, Name: "other"}); !errors.Is(err, ErrPendingLimit) {
+		t.Fatalf("total limit err = %v", err)
+	}
+	if s.PendingCount("") != 5 || s.PendingCount("leak") != 3 || s.PendingCount("unnamed") != 1 {
+		t.Fatalf("pending = %d %d", s.PendingCount(""), s.PendingCount("leak"))
+	}
+
+	// 挤掉同组最早的
+	s.SetLimit(&LimitConf{MaxPending: 5, MaxPerGroup: 2, Policy: "evict_oldest"})
+	var fired []string
+	rec := func(now int64, p interface{}) { fired = append(fired, p.(string)) }
+	s.CancelWhere(func(Tags) bool { return true })
+	s.Push(start.Add(3*time.Second), Trigger{Fun: rec, Name: "a", Param: "a3"})
+	s.Push(start.Add(1*time.Second), Trigger{Fun: rec, Name: "a", Param: "a1"})
+	s.Push(start.Add(2*time.Second), Trigger{Fun: rec, Name: "a", Param: "a2"})
+	if s.PendingCount("a") != 2 {
+		t.Fatalf("pending a = %d", s.PendingCount("a"))
+	}
+	s.Advance(5 * time.Second)
+	if strings.Join(fired, ",") != "a2,a3" || s.PendingCount("") != 0 {
+		t.Fatalf("fired %v, pending %d", fired, s.PendingCount(""))
+	}
+
+	s.SetLimit(&LimitConf{MaxPending: 1, Policy: "log_only"})
+	s.Push(start.Add(time.Minute), Trigger{Fun: noop})
+	if err := s.Push(start.Add(time.Minute), Trigger{Fun: noop}); err != nil || s.PendingCount("") != 2 {
+		t.Fatalf("log_only err = %v", err)
+	}
+	if err := s.SetLimit(&LimitConf{Policy: "drop"}); err == nil {
+		t.Fatal("bad policy accepted")
+	}
+}
+
+func TestEveryExemptFromLimit(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	s := NewSimulator(start)
+	s.SetLimit(&LimitConf{MaxPending: 3, MaxPerGroup: 2})
+	flushed, daily, ticks := 0, 0, 0
+	stop := s.Every(time.Second, "flush", func() { flushed++ })
+	if err := s.PushDaily(time.Local, "00:00:02", Trigger{Fun: func(int64, interface{}) { daily++ }, Name: "flush"}); err != nil {
+		t.Fatal(err)
+	}
+	s.NewCountdown(3*time.Second, func(time.Duration) { ticks++ }, nil)
+	// 组和总数都满了，新来的业务触发器被拒，已经在跑的周期任务照样续上
+	noop := func(int64, interface{}) {}
+	if err := s.Push(start.Add(time.Hour), Trigger{Fun: noop, Name: "flush"}); !errors.Is(err, ErrPendingLimit) {
+		t.Fatalf("push into full group err = %v", err)
+	}
+	s.Advance(5 * time.Second)
+	if flushed != 5 || daily != 1 || ticks != 2 {
+		t.Fatalf("flushed %d daily %d countdown ticks %d", flushed, daily, ticks)
+	}
+	if s.PendingCount("flush") != 2 {
+		t.Fatalf("pending flush = %d", s.PendingCount("flush"))
+	}
+
+	// evict_oldest也不会挤掉周期任务
+	s.SetLimit(&LimitConf{MaxPerGroup: 2, Policy: "evict_oldest"})
+	if err := s.Push(start.Add(time.Hour), Trigger{Fun: noop, Name: "flush"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Advance(3 * time.Second)
+	if flushed != 8 {
+		t.Fatalf("flushed %d after evict_oldest", flushed)
+	}
+	stop()
+	s.Advance(3 * time.Second)
+	if flushed != 8 {
+		t.Fatalf("flushed %d after stop", flushed)
+	}
+}
+
+func TestKick(t *testing.T) {
+	tm := &Timer{kick: make(chan struct{}, 1)}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	fired := 0
+	noop := func(int64, interface{}) { fired++ }
+	tm.Tick(base)
+	tm.PushAt(base.Add(time.Second), Trigger{Fun: noop})
+	select {
+	case <-tm.Kicked():
+		t.Fatal("future trigger should not kick")
+	default:
+	}
+	// 推到已经走过的秒上，自动Kick，多次合并成一次
+	tm.PushAt(base, Trigger{Fun: noop})
+	tm.PushAt(base.Add(-time.Minute), Trigger{Fun: noop})
+	tm.Kick()
+	select {
+	case <-tm.Kicked():
+		tm.Tick(base.Add(500 * time.Millisecond))
+	default:
+		t.Fatal("not kicked")
+	}
+	if fired != 2 {
+		t.Fatalf("fired = %d", fired)
+	}
+	select {
+	case <-tm.Kicked():
+		t.Fatal("kicks not merged")
+	default:
+	}
+	(&Timer{}).Kick() // 没有channel时不阻塞
+}
@@ -0,0 +1,66 @@
+package timer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"test/metrics"
+)
+
+// 集群单例任务：多个逻辑进程都注册了同一个每日结算之类的触发器时，Trigger.Singleton设为true，
+// 到点后先用Locker按(触发器名, 计划触发时间)抢锁，只有抢到的进程执行回调，其他进程跳过（PushDaily照样注册下一天的）。
+// 锁的实现由外面SetLocker注入（db.JobLock是mysql版），没设Locker时当单进程处理，直接执行。
+// 注意：
+// 1. 必须填Name，各进程的同一个任务Name和触发时间要一致；不要和随机Jitter一起用（JitterKey固定的可以），不然各进程的触发时间不一样，锁不住
+// 2. 抢锁是同步的，在主循环里执行，Locker实现要快（一条insert）
+// 3. 抢锁出错时跳过不执行（宁可漏跑一次也不重复结算），看日志和指标timer.singleton.error
+
+var errSingletonHeld = errors.New("skipped, singleton lock held by another node")
+
+// Locker 同一个(name, at)只有第一个调用的进程返回true
+type Locker interface {
+	TryLock(name string, at int64) (bool, error)
+}
+
+// SetLocker 传nil表示单进程，Singleton触发器直接执行
+func (t *Timer) SetLocker(l Locker) {
+	t.locker = l
+}
+
+func SetLocker(l Locker) {
+	tm.SetLocker(l)
+}
+
+// guard 把Singleton触发器的回调包一层抢锁，包过的不会再包
+func (t *Timer) guard(trigger Trigger) Trigger {
+	if !trigger.Singleton || trigger.guarded {
+		return trigger
+	}
+	if trigger.Name == "" {
+		panic(fmt.Sprintf("timer: singleton trigger must have a Name, param = %v", trigger.Param))
+	}
+	f := trigger.Fun
+	name := trigger.Name
+	trigger.guarded = true
+	trigger.Fun = func(now int64, param interface{}) {
+		if t.locker == nil {
+			f(now, param)
+			return
+		}
+		ok, err := t.locker.TryLock(name, now)
+		if err != nil {
+			log.Printf("timer: singleton %s at %d skipped, lock failed: %s", name, now, err.Error())
+			metrics.GetCounter("timer.singleton.error").Inc()
+			t.SetFireError(fmt.Errorf("singleton lock failed, skipped: %w", err))
+			return
+		}
+		if !ok {
+			metrics.GetCounter("timer.singleton.skipped").Inc()
+			t.SetFireError(errSingletonHeld)
+			return
+		}
+		metrics.GetCounter("timer.singleton.won").Inc()
+		f(now, param)
+	}
+	return trigger
+}
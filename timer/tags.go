@@ -0,0 +1,73 @@
+package timer
+
+import "strings"
+
+// 标签：活动这类功能注册的触发器打上自己的标签（比如"activity:springfestival"），
+// 活动提前结束时CancelWhere一把清掉，不用自己记一堆触发器
+
+type Tags []string
+
+func (tags Tags) Has(tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPrefix 比如HasPrefix("activity:")匹配所有活动的触发器
+func (tags Tags) HasPrefix(prefix string) bool {
+	for _, t := range tags {
+		if strings.HasPrefix(t, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CancelWhere 取消所有标签满足f的触发器，返回取消的个数。没打标签的触发器f收到的是空Tags
+func (t *Timer) CancelWhere(f func(tags Tags) bool) int {
+	n := 0
+	for ts, list := range t.triggers {
+		kept := list[:0]
+		for _, trigger := range list {
+			if f(trigger.Tags) {
+				n++
+				t.uncount(trigger)
+				continue
+			}
+			kept = append(kept, trigger)
+		}
+		if len(kept) == 0 {
+			delete(t.triggers, ts)
+		} else {
+			t.triggers[ts] = kept
+		}
+	}
+	return n
+}
+
+func CancelWhere(f func(tags Tags) bool) int {
+	return tm.CancelWhere(f)
+}
+
+// CancelWhere 分片触发器的版本，逐个分片加锁扫一遍
+func (st *ShardedTimer) CancelWhere(f func(tags Tags) bool) int {
+	n := 0
+	for _, s := range st.shards {
+		s.m.Lock()
+		var hit []*keyedItem
+		for _, item := range s.heap {
+			if f(item.trigger.Tags) {
+				hit = append(hit, item)
+			}
+		}
+		for _, item := range hit {
+			s.remove(item)
+		}
+		n += len(hit)
+		s.m.Unlock()
+	}
+	return n
+}
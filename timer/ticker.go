@@ -0,0 +1,55 @@
+package timer
+
+import "time"
+
+// AlignedTicker 对齐到整秒（整d）的ticker。
+// time.NewTicker从调用那一刻开始算，启动在x.7秒的话之后每次tick都在x.7，秒级触发器最多晚将近1秒；
+// 这里第一下在下一个整秒，之后每次都按墙上时间重新算到下一个整秒的等待时间，不会越走越偏。
+// 和time.Ticker一样，接收方太慢时会丢tick，不会攒一堆
+type AlignedTicker struct {
+	C    <-chan time.Time // 发出来的是对齐后的整秒时间，不是实际醒来的时间
+	c    chan time.Time
+	stop chan struct{}
+}
+
+func NewAlignedTicker(d time.Duration) *AlignedTicker {
+	if d <= 0 {
+		panic("NewAlignedTicker: non-positive interval")
+	}
+	c := make(chan time.Time, 1)
+	t := &AlignedTicker{
+		C:    c,
+		c:    c,
+		stop: make(chan struct{}),
+	}
+	go t.run(d)
+	return t
+}
+
+func (t *AlignedTicker) run(d time.Duration) {
+	tm := time.NewTimer(time.Hour)
+	defer tm.Stop()
+	for {
+		now := time.Now()
+		next := now.Truncate(d).Add(d)
+		tm.Reset(next.Sub(now))
+		select {
+		case <-t.stop:
+			return
+		case <-tm.C:
+		}
+		select {
+		case t.c <- next:
+		default:
+		}
+	}
+}
+
+// Stop 之后不会再有tick，C不会被关闭（和time.Ticker一致）
+func (t *AlignedTicker) Stop() {
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+}
@@ -2,6 +2,9 @@ package timer
 
 import (
 	"fmt"
+	"sort"
+	"test/gtime"
+	"test/metrics"
 	"time"
 )
 
@@ -9,64 +12,201 @@ type Trigger struct {
 	Fun   func(int64, interface{})
 	Param interface{}
 	Now   int64
+	Name  string         // 触发器类型名，用于统计（同类触发器起同一个名字，比如daily_reset），不填归到unnamed
+	Loc   *time.Location // 按哪个时区注册的，nil表示服务器时区（gtime.Location），见zone.go
+
+	Jitter    time.Duration // 大于0时实际触发时间在[注册时间, 注册时间+Jitter)里打散，见jitter.go
+	JitterKey int64         // 同一个key每次打散到同一个偏移（比如填玩家id），0表示随机
+
+	Tags Tags // 自定义标签，CancelWhere按标签批量取消，见tags.go
+
+	Singleton bool // 多进程部署时整个集群只有一个进程执行（先抢分布式锁），见singleton.go
+
+	persistent bool // PushPersistent注册的，Save时会被存下来
+	guarded    bool // 回调已经包过抢锁
+	exempt     bool // 不受待触发上限限制、不会被挤掉：Every注册的，和已经注册过的周期触发器续上的下一次，见limit.go
 }
 
 type Timer struct {
 	triggers map[int64][]Trigger //TODO ←这里实际上用的是有序列表，有时间再手撸
+	stats    map[string]*TriggerStat
+	fireHook func(Trigger) // 每个触发器执行前回调，命令日志用
+	clock    func() time.Time
+	locker   Locker        // Singleton触发器抢锁用，nil表示单进程
+	hist     history       // 最近的触发记录，见history.go
+	firing   *FiredEntry   // 正在执行的触发器的记录，SetFireError用
+	limit    pendingLimit  // 待触发数统计和上限，见limit.go
+	kick     chan struct{} // 见kick.go，nil表示不支持
+
+	clockState clockState // Tick用，见clock.go
 }
 
-func (t *Timer) PushTimerTrigger(at string, trigger Trigger) { // TODO at应为时间戳 跟上面的todo一起做
-	if t.triggers == nil {
-		t.triggers = make(map[int64][]Trigger)
+// TriggerStat 按触发器名字统计的触发次数和回调耗时
+type TriggerStat struct {
+	Count int64
+	Total time.Duration
+	Max   time.Duration
+}
+
+func (s TriggerStat) Avg() time.Duration {
+	if s.Count == 0 {
+		return 0
 	}
-	tt, err := time.ParseInLocation("2006-01-02 15:04:05", at, time.Local)
+	return s.Total / time.Duration(s.Count)
+}
+
+// PushTimerTrigger at是服务器时区的gtime.Layout格式，格式不对直接panic。超过待触发上限被拒绝时返回ErrPendingLimit
+func (t *Timer) PushTimerTrigger(at string, trigger Trigger) error {
+	tt, err := gtime.Parse(at)
 	if err != nil {
 		panic(err)
 	}
-	trigger.Now = tt.Unix()
-	t.triggers[tt.Unix()] = append(t.triggers[tt.Unix()], trigger)
+	return t.pushAt(tt.Unix(), trigger)
+}
+
+// PushAt 直接按时间注册，代码里算出来的时间用这个，不用先Format成字符串再解析回来。超过待触发上限被拒绝时返回ErrPendingLimit
+func (t *Timer) PushAt(at time.Time, trigger Trigger) error {
+	return t.pushAt(at.Unix(), trigger)
+}
+
+// pushAt 按秒级时间戳注册
+func (t *Timer) pushAt(ts int64, trigger Trigger) error {
+	if err := t.admit(trigger); err != nil {
+		return err
+	}
+	trigger = t.guard(trigger)
+	if t.triggers == nil {
+		t.triggers = make(map[int64][]Trigger)
+	}
+	ts += jitterOffset(trigger)
+	trigger.Now = ts
+	overdue := t.clockState.lastWall != 0 && ts <= t.clockState.lastWall
+	if overdue {
+		t.clockState.overdue = true
+	}
+	t.triggers[ts] = append(t.triggers[ts], trigger)
+	t.count(trigger)
+	if overdue {
+		t.Kick()
+	}
+	return nil
+}
+
+// now 当前时间，Simulator会换成虚拟时钟
+func (t *Timer) now() time.Time {
+	if t.clock == nil {
+		return time.Now()
+	}
+	return t.clock()
 }
 
 func (t *Timer) Trigger(now string) {
-	tt, err := time.ParseInLocation("2006-01-02 15:04:05", now, time.Local)
+	tt, err := gtime.Parse(now)
 	if err != nil {
 		panic(err)
 	}
-	ts, ok := t.triggers[tt.Unix()]
+	t.triggerAt(tt.Unix())
+}
+
+// triggerAt 触发秒级时间戳ts上的所有触发器，返回触发过的列表
+// 先把这一格从map摘下来再执行，回调里如果又往同一秒push了触发器，会留到下次触发而不是被一起删掉
+func (t *Timer) triggerAt(ts int64) []Trigger {
+	list, ok := t.triggers[ts]
+	if !ok {
+		return nil
+	}
+	delete(t.triggers, ts)
+	for _, trigger := range list {
+		t.uncount(trigger)
+	}
+	for _, trigger := range list {
+		if t.fireHook != nil {
+			t.fireHook(trigger)
+		}
+		t.fire(trigger)
+	}
+	return list
+}
+
+// SetFireHook 传nil取消
+func (t *Timer) SetFireHook(f func(Trigger)) {
+	t.fireHook = f
+}
+
+// TriggerUntil 按时间顺序触发所有时间戳<=ts的触发器（重放日志时用，正常tick还是走Trigger）
+func (t *Timer) TriggerUntil(ts int64) {
+	var due []int64
+	for k := range t.triggers {
+		if k <= ts {
+			due = append(due, k)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i] < due[j] })
+	for _, k := range due {
+		t.triggerAt(k)
+	}
+}
+
+func (t *Timer) record(name string, cost time.Duration) {
+	if name == "" {
+		name = "unnamed"
+	}
+	if t.stats == nil {
+		t.stats = make(map[string]*TriggerStat)
+	}
+	st, ok := t.stats[name]
 	if !ok {
-		return
+		st = &TriggerStat{}
+		t.stats[name] = st
 	}
-	for _, trigger := range ts {
-		trigger.Fun(trigger.Now, trigger.Param)
+	st.Count++
+	st.Total += cost
+	if cost > st.Max {
+		st.Max = cost
 	}
-	delete(t.triggers, tt.Unix())
+	metrics.GetHistogram("timer.callback." + name).Observe(cost)
+	metrics.GetTickBudget().Observe("timer."+name, cost)
+}
+
+// Stats 各类触发器的统计（拷贝），排查哪类触发器拖慢了tick用
+func (t *Timer) Stats() map[string]TriggerStat {
+	ret := make(map[string]TriggerStat, len(t.stats))
+	for k, v := range t.stats {
+		ret[k] = *v
+	}
+	return ret
 }
 
 var tm = &Timer{
 	triggers: map[int64][]Trigger{},
+	kick:     make(chan struct{}, 1),
 }
 
 func GetInst() *Timer {
 	return tm
 }
 
-func PushTrigger(at string, trigger Trigger) {
-	tm.PushTimerTrigger(at, trigger)
+func PushTrigger(at string, trigger Trigger) error {
+	return tm.PushTimerTrigger(at, trigger)
+}
+
+func PushTriggerAt(at time.Time, trigger Trigger) error {
+	return tm.PushAt(at, trigger)
 }
 
 func TimerTestCode() {
-	PushTrigger(time.Now().Add(20*time.Second).Format("2006-01-02 15:04:05"), Trigger{
+	PushTriggerAt(time.Now().Add(20*time.Second), Trigger{
 		Fun: func(now int64, a interface{}) {
-			tt := time.Unix(now, 0)
-			fmt.Printf("now: %s, param: %v", tt.Format("2006-01-02 15:04:05"), a)
+			fmt.Printf("now: %s, param: %v", gtime.FormatStandard(time.Unix(now, 0)), a)
 		},
 		Param: "程序已启动20秒",
+		Name:  "test_20s",
 	})
-	PushTrigger(time.Now().Add(30*time.Second).Format("2006-01-02 15:04:05"), Trigger{
+	PushTriggerAt(time.Now().Add(30*time.Second), Trigger{
 		Fun: func(now int64, a interface{}) {
-			tt := time.Unix(now, 0)
-			fmt.Printf("now: %s, param: %v", tt.Format("2006-01-02 15:04:05"), a)
+			fmt.Printf("now: %s, param: %v", gtime.FormatStandard(time.Unix(now, 0)), a)
 		},
 		Param: "程序已启动30秒",
+		Name:  "test_30s",
 	})
 }
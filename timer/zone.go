@@ -0,0 +1,77 @@
+package timer
+
+import (
+	"fmt"
+	"test/gtime"
+	"time"
+)
+
+// 多时区：一个进程里带多个地区的玩家时，各地区的每日重置要按当地时间来。
+// 地区时区启动时RegisterRegion注册一次，之后用Region(名字)取，跟PushTimerTriggerIn/PushDaily配合使用
+
+var regions = make(map[string]*time.Location)
+
+// RegisterRegion tz是IANA时区名，比如"America/New_York"
+func RegisterRegion(region string, tz string) error {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return err
+	}
+	regions[region] = loc
+	return nil
+}
+
+// Region 没注册的地区返回服务器时区
+func Region(region string) *time.Location {
+	if loc, ok := regions[region]; ok {
+		return loc
+	}
+	return gtime.Location()
+}
+
+// PushTimerTriggerIn 同PushTimerTrigger，但at按loc的当地时间解析
+func (t *Timer) PushTimerTriggerIn(loc *time.Location, at string, trigger Trigger) error {
+	tt, err := gtime.ParseIn(loc, at)
+	if err != nil {
+		panic(err)
+	}
+	trigger.Loc = loc
+	return t.pushAt(tt.Unix(), trigger)
+}
+
+// PushDaily 每天loc当地时间的clock（"05:00:00"）触发一次，触发后自动注册下一天的。
+// 每次都按当地日历重新算，夏令时切换那天不会偏一小时
+func (t *Timer) PushDaily(loc *time.Location, clock string, trigger Trigger) error {
+	c, err := time.Parse("15:04:05", clock)
+	if err != nil {
+		return fmt.Errorf("PushDaily error: bad clock %q: %s", clock, err.Error())
+	}
+	trigger.Loc = loc
+	trigger = t.guard(trigger) // 抢锁只包住业务回调，没抢到也要注册下一天的
+	fun := trigger.Fun
+	var fire func(int64, interface{})
+	fire = func(now int64, param interface{}) {
+		fun(now, param)
+		next := trigger
+		next.Fun = fire
+		next.exempt = true // 第一次注册时过了上限检查，之后每天续上的不再受限制
+		t.pushAt(nextDaily(time.Unix(now, 0), loc, c), next)
+	}
+	next := trigger
+	next.Fun = fire
+	return t.pushAt(nextDaily(t.now(), loc, c), next)
+}
+
+// nextDaily from之后（不含）第一个loc当地时间clock的时间戳
+func nextDaily(from time.Time, loc *time.Location, clock time.Time) int64 {
+	local := from.In(loc)
+	at := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, loc)
+	if !at.After(from) {
+		at = time.Date(local.Year(), local.Month(), local.Day()+1, clock.Hour(), clock.Minute(), clock.Second(), 0, loc)
+	}
+	return at.Unix()
+}
+
+func PushDaily(loc *time.Location, clock string, trigger Trigger) error {
+	return tm.PushDaily(loc, clock, trigger)
+}
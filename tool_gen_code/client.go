@@ -0,0 +1,224 @@
+package tool_gen_code
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// 客户端代码：同一份表格再生成C#和TypeScript的结构体+加载代码，字段名/json名和服务器一致，
+// 客户端直接读服务器用的同一份json配置数据，不用另外维护一套导表流程。
+// 输出到result_client/cs/ 和 result_client/ts/，模板是cs_template.tpl、ts_template.tpl
+
+const clientOutputPath = "./tool_gen_code/result_client/"
+
+type ClientField struct {
+	*Variable
+	CsType    string
+	TsType    string
+	CsDefault string // C#属性初始化表达式，空表示不写
+	TsDefault string // TS里newXxxWithDefaults用的值，总是有值（没填默认值就是类型的零值）
+	TsName    string // 首字母小写的驼峰，TS函数名用
+}
+
+type clientFills struct {
+	FileName   string
+	StructName string
+	TsName     string
+	Fields     []*ClientField
+	Keys       []*ClientField
+	KeyName    string
+	Refs       []*ClientField
+	RefFiles   map[string]clientRefImport // 被引用的结构体 -> TS import用的信息
+}
+
+type clientRefImport struct {
+	File  string
+	Field string
+}
+
+// csType go类型 -> C#类型，处理器列不知道具体格式，当成JsonElement交给客户端自己解析
+func csType(goType string, custom bool) string {
+	if custom {
+		return "JsonElement"
+	}
+	if strings.HasPrefix(goType, "[]") {
+		return "List<" + csType(goType[2:], false) + ">"
+	}
+	if strings.HasPrefix(goType, "map[") {
+		k, v := splitMapType(goType)
+		return "Dictionary<" + csType(k, false) + ", " + csType(v, false) + ">"
+	}
+	switch goType {
+	case "int", "int32":
+		return "int"
+	case "int8":
+		return "sbyte"
+	case "int16":
+		return "short"
+	case "int64":
+		return "long"
+	case "uint", "uint32":
+		return "uint"
+	case "uint8":
+		return "byte"
+	case "uint16":
+		return "ushort"
+	case "uint64":
+		return "ulong"
+	case "float32":
+		return "float"
+	case "float64":
+		return "double"
+	}
+	return goType // string、bool同名
+}
+
+// tsType int64在js里超过2^53会丢精度，配置表里一般不会有这么大的数，有的话改成string列
+func tsType(goType string, custom bool) string {
+	if custom {
+		return "unknown"
+	}
+	if strings.HasPrefix(goType, "[]") {
+		return tsType(goType[2:], false) + "[]"
+	}
+	if strings.HasPrefix(goType, "map[") {
+		k, v := splitMapType(goType)
+		return "Record<" + tsType(k, false) + ", " + tsType(v, false) + ">"
+	}
+	switch goType {
+	case "string":
+		return "string"
+	case "bool":
+		return "boolean"
+	}
+	return "number"
+}
+
+// splitMapType "map[string][]int" -> "string", "[]int"
+func splitMapType(goType string) (string, string) {
+	depth := 0
+	for i := len("map"); i < len(goType); i++ {
+		switch goType[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return goType[len("map["):i], goType[i+1:]
+			}
+		}
+	}
+	return "string", "string"
+}
+
+// clientDefaults 从表格E列原文转成两边的字面量，数组的元素字面量和go的一样（数字、带引号的字符串、true/false）
+func clientDefaults(v *Variable) (cs string, ts string) {
+	zeroTs := map[string]string{"string": `""`, "boolean": "false", "number": "0"}[tsType(v.VType, v.custom)]
+	if v.Default == "" || v.custom {
+		switch {
+		case strings.HasPrefix(v.VType, "[]"):
+			return "new " + csType(v.VType, false) + "()", "[]"
+		case strings.HasPrefix(v.VType, "map["):
+			return "new " + csType(v.VType, false) + "()", "{}"
+		case zeroTs == "":
+			return "", "undefined as unknown"
+		case v.VType == "string":
+			return `""`, zeroTs
+		}
+		return "", zeroTs
+	}
+	if strings.HasPrefix(v.VType, "[]") {
+		elems := v.Default[strings.Index(v.Default, "{")+1 : len(v.Default)-1]
+		return "new " + csType(v.VType, false) + " { " + elems + " }", "[" + elems + "]"
+	}
+	if v.VType == "float32" {
+		return v.Default + "f", v.Default
+	}
+	return v.Default, v.Default
+}
+
+func toClientFields(kv []*Variable) []*ClientField {
+	ret := make([]*ClientField, 0, len(kv))
+	for _, v := range kv {
+		cs, ts := clientDefaults(v)
+		ret = append(ret, &ClientField{
+			Variable:  v,
+			CsType:    csType(v.VType, v.custom),
+			TsType:    tsType(v.VType, v.custom),
+			CsDefault: cs,
+			TsDefault: ts,
+			TsName:    argName(v.Name),
+		})
+	}
+	return ret
+}
+
+// clientFileOf 结构体名 -> 表名，TS跨表引用import用
+func clientFileOf(data map[string][]*Variable) map[string]string {
+	fileOf := make(map[string]string, len(data))
+	for structName := range data {
+		fileOf[UnderscoreToUpperCamelCase(structName)] = structName
+	}
+	return fileOf
+}
+
+// genClient 生成一个结构体的C#和TS代码，输出到outputPath下的cs/、ts/
+func genClient(csTpl *template.Template, tsTpl *template.Template, outputPath string, fileName string, kv []*Variable, fileOf map[string]string) error {
+	fills := &clientFills{
+		FileName:   fileName,
+		StructName: UnderscoreToUpperCamelCase(fileName),
+		TsName:     argName(UnderscoreToUpperCamelCase(fileName)),
+		Fields:     toClientFields(kv),
+		RefFiles:   make(map[string]clientRefImport),
+	}
+	for _, f := range fills.Fields {
+		if f.IsKey {
+			fills.Keys = append(fills.Keys, f)
+			fills.KeyName += f.Name
+		}
+		if f.Ref != nil {
+			fills.Refs = append(fills.Refs, f)
+			fills.RefFiles[f.Ref.Struct] = clientRefImport{File: fileOf[f.Ref.Struct], Field: f.Ref.Field}
+		}
+	}
+	for dir, tpl := range map[string]*template.Template{"cs/": csTpl, "ts/": tsTpl} {
+		if err := os.MkdirAll(outputPath+dir, 0755); err != nil {
+			return err
+		}
+		var b strings.Builder
+		if err := tpl.Execute(&b, fills); err != nil {
+			return fmt.Errorf("gen client %s%s: %w", dir, fileName, err)
+		}
+		name := fills.StructName + ".cs"
+		if dir == "ts/" {
+			name = fileName + ".ts"
+		}
+		if err := os.WriteFile(outputPath+dir+name, []byte(b.String()), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadClientTemplates dir是模板所在目录（带/）
+func loadClientTemplates(dir string) (*template.Template, *template.Template, error) {
+	cs, err := os.ReadFile(dir + "cs_template.tpl")
+	if err != nil {
+		return nil, nil, err
+	}
+	ts, err := os.ReadFile(dir + "ts_template.tpl")
+	if err != nil {
+		return nil, nil, err
+	}
+	csTpl, err := template.New("cs").Parse(string(cs))
+	if err != nil {
+		return nil, nil, err
+	}
+	tsTpl, err := template.New("ts").Parse(string(ts))
+	if err != nil {
+		return nil, nil, err
+	}
+	return csTpl, tsTpl, nil
+}
@@ -0,0 +1,61 @@
+package tool_gen_code
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestClientGolden 按chart.xlsx和当前模板重新生成客户端代码，和提交的result_client/逐个文件对比。
+// 改了cs_template.tpl、ts_template.tpl或者client.go却没重新生成提交的话这里会失败
+func TestClientGolden(t *testing.T) {
+	data, _, err := readChart("chart.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = resolveRefs(data); err != nil {
+		t.Fatal(err)
+	}
+	csTpl, tsTpl, err := loadClientTemplates("./")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir() + "/"
+	fileOf := clientFileOf(data)
+	for structName, kv := range data {
+		if err = genClient(csTpl, tsTpl, out, structName, kv, fileOf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{"cs", "ts"} {
+		got := listFiles(t, filepath.Join(out, dir))
+		want := listFiles(t, filepath.Join("result_client", dir))
+		if len(got) != len(want) {
+			t.Fatalf("%s: generated %v, committed %v", dir, got, want)
+		}
+		for i, name := range got {
+			if name != want[i] {
+				t.Fatalf("%s: generated %v, committed %v", dir, got, want)
+			}
+			g, _ := os.ReadFile(filepath.Join(out, dir, name))
+			w, _ := os.ReadFile(filepath.Join("result_client", dir, name))
+			if string(g) != string(w) {
+				t.Errorf("result_client/%s/%s is out of date, rerun the generator", dir, name)
+			}
+		}
+	}
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret []string
+	for _, e := range entries {
+		ret = append(ret, e.Name())
+	}
+	sort.Strings(ret)
+	return ret
+}
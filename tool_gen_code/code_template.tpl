@@ -1,5 +1,11 @@
 package {{.PackageName}}
-
+{{if or .HasDefault .Keys}}
+import (
+{{if .HasDefault}}    "encoding/json"
+{{end}}{{if .Keys}}    "fmt"
+{{end}}{{if and .Keys .Refs}}    "sort"
+{{end}})
+{{end}}
 type {{.StructName}} struct {
 {{range $v := .KV}}{{print "\t"}}{{$v.Name}} {{$v.VType}}{{print "\t"}}`json:"{{$v.JsonName}}"`{{if $v.Comment}}{{print "\t"}}// {{$v.Comment}}{{end}}
 {{end}}}
@@ -8,6 +14,87 @@ func (s *{{.StructName}}) GetStructName() string {
     return "{{.StructName}}"
 }
 
+// New{{.StructName}}WithDefaults 按表格里填的默认值初始化，没填默认值的字段是零值
+func New{{.StructName}}WithDefaults() *{{.StructName}} {
+    return &{{.StructName}}{
+{{range $v := .KV}}{{if $v.Default}}        {{$v.Name}}: {{$v.Default}},
+{{end}}{{end}}    }
+}
+{{if .HasDefault}}
+// UnmarshalJSON 数据里缺失（或为null）的字段保留默认值，而不是变成零值
+func (s *{{.StructName}}) UnmarshalJSON(b []byte) error {
+    type alias {{.StructName}}
+    tmp := (*alias)(New{{.StructName}}WithDefaults())
+    if err := json.Unmarshal(b, tmp); err != nil {
+        return err
+    }
+    *s = {{.StructName}}(*tmp)
+    return nil
+}
+{{end}}
+{{if .Keys}}{{if eq (len .Keys) 1}}{{$k := index .Keys 0}}
+// {{.StructName}}By{{.KeyName}} 按{{$k.Name}}索引，Load{{.StructName}}时整体重建
+var {{.StructName}}By{{.KeyName}} = map[{{$k.VType}}]*{{.StructName}}{}
+
+func Get{{.StructName}}By{{.KeyName}}({{$k.ArgName}} {{$k.VType}}) *{{.StructName}} {
+    return {{.StructName}}By{{.KeyName}}[{{$k.ArgName}}]
+}
+
+func {{.StructName}}IndexKey(s *{{.StructName}}) {{$k.VType}} {
+    return s.{{$k.Name}}
+}
+{{else}}
+// {{.StructName}}{{.KeyName}}Key 联合索引键
+type {{.StructName}}{{.KeyName}}Key struct {
+{{range $k := .Keys}}    {{$k.Name}} {{$k.VType}}
+{{end}}}
+
+// {{.StructName}}By{{.KeyName}} 按联合键索引，Load{{.StructName}}时整体重建
+var {{.StructName}}By{{.KeyName}} = map[{{.StructName}}{{.KeyName}}Key]*{{.StructName}}{}
+
+func Get{{.StructName}}By{{.KeyName}}({{range $i, $k := .Keys}}{{if $i}}, {{end}}{{$k.ArgName}} {{$k.VType}}{{end}}) *{{.StructName}} {
+    return {{.StructName}}By{{.KeyName}}[{{.StructName}}{{.KeyName}}Key{ {{range $i, $k := .Keys}}{{if $i}}, {{end}}{{$k.Name}}: {{$k.ArgName}}{{end}} }]
+}
+
+func {{.StructName}}IndexKey(s *{{.StructName}}) {{.StructName}}{{.KeyName}}Key {
+    return {{.StructName}}{{.KeyName}}Key{ {{range $i, $k := .Keys}}{{if $i}}, {{end}}{{$k.Name}}: s.{{$k.Name}}{{end}} }
+}
+{{end}}
+// Load{{.StructName}} 用一份完整的配置数据重建索引（整体替换，不是增量），有重复键直接报错
+func Load{{.StructName}}(rows []*{{.StructName}}) error {
+    idx := make(map[{{if eq (len .Keys) 1}}{{(index .Keys 0).VType}}{{else}}{{.StructName}}{{.KeyName}}Key{{end}}]*{{.StructName}}, len(rows))
+    for _, row := range rows {
+        key := {{.StructName}}IndexKey(row)
+        if _, ok := idx[key]; ok {
+            return fmt.Errorf("{{.StructName}} duplicated key %v", key)
+        }
+        idx[key] = row
+    }
+    {{.StructName}}By{{.KeyName}} = idx
+    return nil
+}
+{{end}}
+{{range $v := .Refs}}
+// {{$v.Ref.Accessor}} {{$v.Name}}引用的{{$v.Ref.Struct}}，找不到（或者{{$v.Name}}是零值）返回nil
+func (s *{{$.StructName}}) {{$v.Ref.Accessor}}() *{{$v.Ref.Struct}} {
+    return Get{{$v.Ref.Struct}}By{{$v.Ref.Field}}(s.{{$v.Name}})
+}
+{{end}}{{if and .Keys .Refs}}
+// Check{{.StructName}}Refs 所有表Load完之后调一次，列出引用不到的数据（零值表示不引用，跳过）
+func Check{{.StructName}}Refs() error {
+    var bad []string
+    for key, row := range {{.StructName}}By{{.KeyName}} {
+{{range $v := .Refs}}        if row.{{$v.Name}} != {{$v.Ref.Zero}} && row.{{$v.Ref.Accessor}}() == nil {
+            bad = append(bad, fmt.Sprintf("{{$.StructName}} %v {{$v.Name}} %v not found in {{$v.Ref.Struct}}", key, row.{{$v.Name}}))
+        }
+{{end}}    }
+    if len(bad) > 0 {
+        sort.Strings(bad)
+        return fmt.Errorf("%d dangling refs: %v", len(bad), bad)
+    }
+    return nil
+}
+{{end}}
 {{range $v := .KV}}
 func (s *{{$.StructName}}) Set{{$v.Name}}(setVal {{$v.VType}}) {
     s.{{$v.Name}} = setVal
@@ -0,0 +1,59 @@
+// 由tool_gen_code生成，不要手改
+using System.Collections.Generic;
+using System.Text.Json;
+using System.Text.Json.Serialization;
+
+namespace GameConfig
+{
+    public class {{.StructName}}
+    {
+{{range $f := .Fields}}        [JsonPropertyName("{{$f.JsonName}}")]
+        public {{$f.CsType}} {{$f.Name}} { get; set; }{{if $f.CsDefault}} = {{$f.CsDefault}};{{end}}{{if $f.Comment}} // {{$f.Comment}}{{end}}
+
+{{end}}{{if .Keys}}{{if eq (len .Keys) 1}}{{$k := index .Keys 0}}        public static Dictionary<{{$k.CsType}}, {{.StructName}}> By{{.KeyName}} = new Dictionary<{{$k.CsType}}, {{.StructName}}>();
+
+        public static {{.StructName}} GetBy{{.KeyName}}({{$k.CsType}} {{$k.ArgName}})
+        {
+            return By{{.KeyName}}.TryGetValue({{$k.ArgName}}, out var row) ? row : null;
+        }
+
+        private static {{$k.CsType}} IndexKey({{.StructName}} row)
+        {
+            return row.{{$k.Name}};
+        }
+{{else}}        public static Dictionary<({{range $i, $k := .Keys}}{{if $i}}, {{end}}{{$k.CsType}}{{end}}), {{.StructName}}> By{{.KeyName}} = new Dictionary<({{range $i, $k := .Keys}}{{if $i}}, {{end}}{{$k.CsType}}{{end}}), {{.StructName}}>();
+
+        public static {{.StructName}} GetBy{{.KeyName}}({{range $i, $k := .Keys}}{{if $i}}, {{end}}{{$k.CsType}} {{$k.ArgName}}{{end}})
+        {
+            return By{{.KeyName}}.TryGetValue(({{range $i, $k := .Keys}}{{if $i}}, {{end}}{{$k.ArgName}}{{end}}), out var row) ? row : null;
+        }
+
+        private static ({{range $i, $k := .Keys}}{{if $i}}, {{end}}{{$k.CsType}}{{end}}) IndexKey({{.StructName}} row)
+        {
+            return ({{range $i, $k := .Keys}}{{if $i}}, {{end}}row.{{$k.Name}}{{end}});
+        }
+{{end}}
+        // Load 用服务器同一份json数据（对象数组）整体重建索引，有重复键直接抛异常
+        public static void Load(string json)
+        {
+            var rows = JsonSerializer.Deserialize<List<{{.StructName}}>>(json);
+            var idx = new Dictionary<{{if eq (len .Keys) 1}}{{(index .Keys 0).CsType}}{{else}}({{range $i, $k := .Keys}}{{if $i}}, {{end}}{{$k.CsType}}{{end}}){{end}}, {{.StructName}}>(rows.Count);
+            foreach (var row in rows)
+            {
+                var key = IndexKey(row);
+                if (idx.ContainsKey(key))
+                {
+                    throw new System.Exception($"{{.StructName}} duplicated key {key}");
+                }
+                idx[key] = row;
+            }
+            By{{.KeyName}} = idx;
+        }
+{{end}}{{range $f := .Refs}}
+        // {{$f.Ref.Accessor}} {{$f.Name}}引用的{{$f.Ref.Struct}}，找不到返回null
+        public {{$f.Ref.Struct}} {{$f.Ref.Accessor}}()
+        {
+            return {{$f.Ref.Struct}}.GetBy{{$f.Ref.Field}}({{$f.Name}});
+        }
+{{end}}    }
+}
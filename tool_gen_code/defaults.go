@@ -0,0 +1,54 @@
+package tool_gen_code
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultLiteral 把表格里填的默认值转成对应类型的go字面量。
+// 数组类型用英文逗号分隔，比如[]int填 1,2,3 ；字符串直接填内容不用加引号
+func defaultLiteral(vType string, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(vType, "[]") {
+		elemType := vType[2:]
+		var elems []string
+		for _, e := range strings.Split(raw, ",") {
+			lit, err := defaultLiteral(elemType, e)
+			if err != nil {
+				return "", err
+			}
+			elems = append(elems, lit)
+		}
+		return vType + "{" + strings.Join(elems, ", ") + "}", nil
+	}
+	switch vType {
+	case "string":
+		return strconv.Quote(raw), nil
+	case "bool":
+		if _, err := strconv.ParseBool(raw); err != nil {
+			return "", fmt.Errorf("default value %q is not a bool", raw)
+		}
+		return raw, nil
+	case "int", "int8", "int16", "int32", "int64":
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			return "", fmt.Errorf("default value %q is not an integer", raw)
+		}
+		return raw, nil
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		if _, err := strconv.ParseUint(raw, 10, 64); err != nil {
+			return "", fmt.Errorf("default value %q is not an unsigned integer", raw)
+		}
+		return raw, nil
+	case "float32", "float64":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return "", fmt.Errorf("default value %q is not a float", raw)
+		}
+		return raw, nil
+	default:
+		return "", fmt.Errorf("default value not supported for type %s", vType)
+	}
+}
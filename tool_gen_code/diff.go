@@ -0,0 +1,117 @@
+package tool_gen_code
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"sort"
+	"strings"
+)
+
+type FieldChange struct {
+	Name    string
+	OldType string
+	NewType string
+}
+
+// StructDiff 一个结构体新旧生成结果的差异
+type StructDiff struct {
+	StructName  string
+	IsNew       bool // 之前没生成过
+	Added       []FieldChange
+	Removed     []FieldChange
+	TypeChanged []FieldChange
+}
+
+// Breaking 删字段或者改类型都会让引用这个字段的代码编译不过，需要带-allow-breaking才允许生成
+func (d *StructDiff) Breaking() bool {
+	return len(d.Removed) > 0 || len(d.TypeChanged) > 0
+}
+
+func (d *StructDiff) Empty() bool {
+	return !d.IsNew && len(d.Added) == 0 && len(d.Removed) == 0 && len(d.TypeChanged) == 0
+}
+
+func (d *StructDiff) String() string {
+	var sb strings.Builder
+	if d.IsNew {
+		sb.WriteString(fmt.Sprintf("[%s] new struct\n", d.StructName))
+	}
+	for _, f := range d.Added {
+		sb.WriteString(fmt.Sprintf("[%s] + %s %s\n", d.StructName, f.Name, f.NewType))
+	}
+	for _, f := range d.Removed {
+		sb.WriteString(fmt.Sprintf("[%s] - %s %s\n", d.StructName, f.Name, f.OldType))
+	}
+	for _, f := range d.TypeChanged {
+		sb.WriteString(fmt.Sprintf("[%s] ~ %s %s -> %s\n", d.StructName, f.Name, f.OldType, f.NewType))
+	}
+	return sb.String()
+}
+
+// loadOldFields 解析之前生成的go文件，拿到结构体的字段名和类型。文件不存在返回nil, nil
+func loadOldFields(path string, structName string) (map[string]string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	found := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		ts, ok := n.(*ast.TypeSpec)
+		if !ok || ts.Name.Name != structName {
+			return true
+		}
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok {
+			return false
+		}
+		found = true
+		for _, field := range st.Fields.List {
+			for _, name := range field.Names {
+				fields[name.Name] = types.ExprString(field.Type)
+			}
+		}
+		return false
+	})
+	if !found {
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// diffStruct 对比旧文件和这次要生成的字段
+func diffStruct(path string, structName string, kv []*Variable) (*StructDiff, error) {
+	old, err := loadOldFields(path, structName)
+	if err != nil {
+		return nil, err
+	}
+	d := &StructDiff{StructName: structName}
+	if old == nil {
+		d.IsNew = true
+		return d, nil
+	}
+	newFields := make(map[string]string, len(kv))
+	for _, v := range kv {
+		newFields[v.Name] = v.VType
+		oldType, ok := old[v.Name]
+		if !ok {
+			d.Added = append(d.Added, FieldChange{Name: v.Name, NewType: v.VType})
+		} else if oldType != v.VType {
+			d.TypeChanged = append(d.TypeChanged, FieldChange{Name: v.Name, OldType: oldType, NewType: v.VType})
+		}
+	}
+	for name, oldType := range old {
+		if _, ok := newFields[name]; !ok {
+			d.Removed = append(d.Removed, FieldChange{Name: name, OldType: oldType})
+		}
+	}
+	sort.Slice(d.Removed, func(i, j int) bool { return d.Removed[i].Name < d.Removed[j].Name })
+	return d, nil
+}
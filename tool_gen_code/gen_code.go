@@ -3,10 +3,12 @@ package tool_gen_code
 import (
 	"fmt"
 	"github.com/xuri/excelize/v2"
+	"go/token"
 	"log"
 	"os"
 	"strings"
 	"text/template"
+	"time"
 	"unicode"
 )
 
@@ -15,6 +17,13 @@ type Variable struct {
 	VType    string
 	JsonName string
 	Comment  string
+	Default  string   // 默认值的go字面量，表格E列没填就是空
+	IsKey    bool     // 表格F列非空表示这一列是索引键，多列都填就是联合键
+	ArgName  string   // 生成Get函数时这一列作为参数的名字
+	Sample   string   // 生成的单测里用的样例值（go字面量），见golden.go
+	Ref      *RefInfo // 表格G列填了ref=表.键时不为nil，见refs.go
+
+	custom bool // C列是@处理器
 }
 
 func UnderscoreToUpperCamelCase(s string) string {
@@ -39,48 +48,81 @@ func CamelCaseToUnderscore(s string) string {
 	return string(output)
 }
 
-func Gen() error {
+// GenOptions 生成选项，传nil全部用默认值
+type GenOptions struct {
+	AllowBreaking bool // 允许删字段/改字段类型（对应启动参数-allow-breaking），不开的话有这种改动直接报错不生成
+	Stamp         bool // 按chart.xlsx的hash和生成时间给result打版本戳（对应启动参数-gen-stamp），见version.go
+}
+
+// argName 首字母小写作为函数参数名，撞了go关键字就加个下划线
+func argName(name string) string {
+	if name == "" {
+		return name
+	}
+	r := []rune(name)
+	r[0] = unicode.ToLower(r[0])
+	ret := string(r)
+	if token.IsKeyword(ret) {
+		ret += "_"
+	}
+	return ret
+}
+
+func Gen(opt *GenOptions) error {
+	if opt == nil {
+		opt = &GenOptions{}
+	}
 	tplModel, err := os.ReadFile("./tool_gen_code/code_template.tpl")
 	if err != nil {
 		return err
 	}
-	parseChart, err := excelize.OpenFile("./tool_gen_code/chart.xlsx")
+	testTplModel, err := os.ReadFile("./tool_gen_code/test_template.tpl")
 	if err != nil {
 		return err
 	}
+	chartPath := "./tool_gen_code/chart.xlsx"
 	outputPath := "./tool_gen_code/result/"
-	chartSheet := "Sheet1"
+	data, usedDecls, err := readChart(chartPath)
+	if err != nil {
+		return err
+	}
+	for structName, kv := range data {
+		log.Printf("gen struct %s: %d fields", structName, len(kv))
+	}
+	if err = resolveRefs(data); err != nil {
+		return err
+	}
 
-	data := make(map[string][]*Variable)
-	for i := 2; ; i++ {
-		keyName, err := parseChart.GetCellValue(chartSheet, fmt.Sprintf("B%d", i))
-		if err != nil {
-			return err
-		}
-		if keyName == "" {
-			break
-		}
-		structName, err := parseChart.GetCellValue(chartSheet, fmt.Sprintf("A%d", i))
+	// 覆盖前先和上次生成的结果对比，把字段变动打出来
+	breaking := false
+	for structName, kv := range data {
+		d, err := diffStruct(outputPath+structName+".gen.go", UnderscoreToUpperCamelCase(structName), kv)
 		if err != nil {
 			return err
 		}
-		valueType, err := parseChart.GetCellValue(chartSheet, fmt.Sprintf("C%d", i))
-		if err != nil {
-			return err
+		if !d.Empty() {
+			log.Printf("gen diff:\n%s", d.String())
 		}
-		comment, err := parseChart.GetCellValue(chartSheet, fmt.Sprintf("D%d", i))
-		if err != nil {
-			return err
+		if d.Breaking() {
+			breaking = true
 		}
+	}
+	if breaking && !opt.AllowBreaking {
+		return fmt.Errorf("gen refused: fields removed or retyped, check the diff above and rerun with -allow-breaking if intended")
+	}
 
-		data[structName] = append(data[structName], &Variable{
-			Name:     UnderscoreToUpperCamelCase(keyName),
-			VType:    valueType,
-			JsonName: keyName, // Name变量名可根据代码规范调整，JsonName这里别做任何转化，这是他们那边要的效果
-			Comment:  comment,
-		})
+	if err = writeProcessorDecls(outputPath, usedDecls); err != nil {
+		return err
 	}
-	log.Println(data)
+	if err = writeConfVersion(outputPath, chartPath, opt.Stamp, time.Now()); err != nil {
+		return err
+	}
+	csTpl, tsTpl, err := loadClientTemplates("./tool_gen_code/")
+	if err != nil {
+		return err
+	}
+	fileOf := clientFileOf(data)
+
 	for structName, kv := range data {
 		_, err = os.Stat(outputPath)
 		if err != nil {
@@ -100,12 +142,30 @@ func Gen() error {
 		}
 		var Fills struct {
 			PackageName string
+			FileName    string
 			StructName  string
 			KV          []*Variable
+			HasDefault  bool
+			Keys        []*Variable
+			KeyName     string
+			Refs        []*Variable
 		}
 		Fills.PackageName = "result"
+		Fills.FileName = structName
 		Fills.StructName = UnderscoreToUpperCamelCase(structName)
 		Fills.KV = kv
+		for _, v := range kv {
+			if v.Default != "" {
+				Fills.HasDefault = true
+			}
+			if v.IsKey {
+				Fills.Keys = append(Fills.Keys, v)
+				Fills.KeyName += v.Name
+			}
+			if v.Ref != nil {
+				Fills.Refs = append(Fills.Refs, v)
+			}
+		}
 		tmpl, _ := template.New("test").Parse(string(tplModel))
 		err = tmpl.Execute(writeFile, Fills)
 		if err != nil {
@@ -115,7 +175,96 @@ func Gen() error {
 		if err != nil {
 			return err
 		}
+		if err = writeGolden(outputPath, structName, fillSamples(kv)); err != nil {
+			return err
+		}
+		testTmpl, err := template.New("test").Parse(string(testTplModel))
+		if err != nil {
+			return err
+		}
+		var testCode strings.Builder
+		if err = testTmpl.Execute(&testCode, Fills); err != nil {
+			return err
+		}
+		if err = os.WriteFile(outputPath+structName+".gen_test.go", []byte(testCode.String()), 0644); err != nil {
+			return err
+		}
+		if err = genClient(csTpl, tsTpl, clientOutputPath, structName, kv, fileOf); err != nil {
+			return err
+		}
 		log.Printf("output success to result.gen.go")
 	}
 	return nil
 }
+
+// readChart 读表格，返回 结构体名 -> 字段 和用到的自定义列类型定义（GoType -> Decl）
+func readChart(chartPath string) (map[string][]*Variable, map[string]string, error) {
+	parseChart, err := excelize.OpenFile(chartPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer parseChart.Close()
+	chartSheet := "Sheet1"
+
+	data := make(map[string][]*Variable)
+	usedDecls := make(map[string]string) // 用到的自定义列类型定义，GoType -> Decl
+	// 逐行流式读，几十万行的表也不会把整张sheet载进内存
+	err = forEachChartRow(parseChart, chartSheet, func(i int, row []string) error {
+		if i == 1 {
+			return nil // 表头
+		}
+		keyName := cellAt(row, colField)
+		if keyName == "" {
+			return errChartEnd
+		}
+		structName := cellAt(row, colStruct)
+		valueType := cellAt(row, colType)
+		comment := cellAt(row, colComment)
+		defaultValue := cellAt(row, colDefault)
+		proc, custom, err := lookupProcessor(valueType)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %s", structName, keyName, err.Error())
+		}
+		var defaultLit string
+		if custom {
+			valueType = proc.GoType
+			if proc.Decl != "" {
+				usedDecls[proc.GoType] = proc.Decl
+			}
+			defaultLit, err = processorDefault(proc, defaultValue)
+		} else {
+			defaultLit, err = defaultLiteral(valueType, defaultValue)
+		}
+		if err != nil {
+			return fmt.Errorf("%s.%s: %s", structName, keyName, err.Error())
+		}
+		isKey := strings.TrimSpace(cellAt(row, colKey)) != ""
+		ref, err := parseRef(cellAt(row, colRef))
+		if err != nil {
+			return fmt.Errorf("%s.%s: %s", structName, keyName, err.Error())
+		}
+		if ref != nil && (custom || strings.HasPrefix(valueType, "[]") || strings.HasPrefix(valueType, "map[")) {
+			return fmt.Errorf("%s.%s: type %s cannot be used as ref", structName, keyName, valueType)
+		}
+		if isKey && (custom || strings.HasPrefix(valueType, "[]") || strings.HasPrefix(valueType, "map[")) {
+			return fmt.Errorf("%s.%s: type %s cannot be used as index key", structName, keyName, valueType)
+		}
+
+		data[structName] = append(data[structName], &Variable{
+			Name:     UnderscoreToUpperCamelCase(keyName),
+			VType:    valueType,
+			JsonName: keyName, // Name变量名可根据代码规范调整，JsonName这里别做任何转化，这是他们那边要的效果
+			Comment:  comment,
+			Default:  defaultLit,
+			IsKey:    isKey,
+			ArgName:  argName(UnderscoreToUpperCamelCase(keyName)),
+			Ref:      ref,
+			custom:   custom,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, usedDecls, nil
+}
@@ -0,0 +1,73 @@
+package tool_gen_code
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 每个结构体额外生成一份_test.go和golden数据：
+// 样例值由生成器按字段类型造（都是非零值），go字面量写进测试，json写进result/testdata/结构体.golden.json，
+// 改模板导致json tag、UnmarshalJSON之类出问题时go test ./tool_gen_code/result/ 会直接报出来
+
+const goldenDir = "testdata/"
+
+// sampleValue 按类型造一个非零样例，返回go字面量和对应的json值，造不出来（map、[]byte之类）返回ok=false
+func sampleValue(vType string, seed int, name string) (lit string, js any, ok bool) {
+	if strings.HasPrefix(vType, "[]") {
+		elemType := vType[2:]
+		if elemType == "byte" || elemType == "uint8" { // json里是base64，不值得特殊处理
+			return "", nil, false
+		}
+		elemLit, elemJs, ok := sampleValue(elemType, seed, name)
+		if !ok {
+			return "", nil, false
+		}
+		return vType + "{" + elemLit + "}", []any{elemJs}, true
+	}
+	switch vType {
+	case "string":
+		s := name + "_sample"
+		return strconv.Quote(s), s, true
+	case "bool":
+		return "true", true, true
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return strconv.Itoa(seed), seed, true
+	case "float32", "float64":
+		f := float64(seed) + 0.5
+		return strconv.FormatFloat(f, 'g', -1, 64), f, true
+	}
+	return "", nil, false
+}
+
+// fillSamples 给每个字段填Sample，返回golden用的json对象。
+// 自定义列（处理器）的json格式生成器不知道，有默认值就用默认值当样例，只参与往返测试不进golden
+func fillSamples(kv []*Variable) map[string]any {
+	golden := make(map[string]any)
+	for i, v := range kv {
+		if v.custom {
+			v.Sample = v.Default
+			continue
+		}
+		lit, js, ok := sampleValue(v.VType, i+1, v.JsonName)
+		if !ok {
+			v.Sample = v.Default
+			continue
+		}
+		v.Sample = lit
+		golden[v.JsonName] = js
+	}
+	return golden
+}
+
+func writeGolden(outputPath string, structName string, golden map[string]any) error {
+	if err := os.MkdirAll(outputPath+goldenDir, 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(golden, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath+goldenDir+structName+".golden.json", append(b, '\n'), 0644)
+}
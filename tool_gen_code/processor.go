@@ -0,0 +1,177 @@
+package tool_gen_code
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 自定义列格式：项目里有"1:2;3:4"这种策划自己约定的格式时，不用改生成器，注册一个处理函数就行。
+// 表格C列写 @名字 表示这一列走对应的处理器，生成的字段类型是处理器的GoType，E列默认值也交给它解析
+
+type ColumnProcessor struct {
+	GoType string                        // 生成代码里的字段类型，比如[]ItemPair
+	Decl   string                        // 类型定义，会写进result/processors.gen.go，类型已经在result包里手写了的话留空
+	Parse  func(raw string) (any, error) // 解析单元格，返回值的类型名要和GoType一致
+}
+
+var processors = make(map[string]*ColumnProcessor)
+
+// RegisterProcessor 在Gen之前注册
+func RegisterProcessor(name string, p *ColumnProcessor) {
+	processors[name] = p
+}
+
+func lookupProcessor(vType string) (*ColumnProcessor, bool, error) {
+	if !strings.HasPrefix(vType, "@") {
+		return nil, false, nil
+	}
+	p, ok := processors[vType[1:]]
+	if !ok {
+		return nil, true, fmt.Errorf("column processor %s not registered", vType[1:])
+	}
+	return p, true, nil
+}
+
+// ProcessCell 按C列的类型解析一个单元格，自定义类型走处理器，其他的原样返回字符串（导数据的工具用）
+func ProcessCell(vType string, raw string) (any, error) {
+	p, custom, err := lookupProcessor(vType)
+	if err != nil {
+		return nil, err
+	}
+	if !custom {
+		return raw, nil
+	}
+	return p.Parse(raw)
+}
+
+// processorDefault 用处理器解析默认值再转成go字面量
+func processorDefault(p *ColumnProcessor, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	v, err := p.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	return goLiteral(reflect.ValueOf(v))
+}
+
+// goLiteral 把处理器返回的值写成go代码，具名类型只取类型名（默认它定义在result包里）
+func goLiteral(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return wrapNamed(v.Type(), strconv.FormatInt(v.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return wrapNamed(v.Type(), strconv.FormatUint(v.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		return wrapNamed(v.Type(), strconv.FormatFloat(v.Float(), 'g', -1, 64)), nil
+	case reflect.String:
+		return wrapNamed(v.Type(), strconv.Quote(v.String())), nil
+	case reflect.Slice:
+		var elems []string
+		for i := 0; i < v.Len(); i++ {
+			e, err := goLiteral(v.Index(i))
+			if err != nil {
+				return "", err
+			}
+			elems = append(elems, e)
+		}
+		return typeString(v.Type()) + "{" + strings.Join(elems, ", ") + "}", nil
+	case reflect.Map:
+		var elems []string
+		for _, k := range v.MapKeys() {
+			ks, err := goLiteral(k)
+			if err != nil {
+				return "", err
+			}
+			vs, err := goLiteral(v.MapIndex(k))
+			if err != nil {
+				return "", err
+			}
+			elems = append(elems, ks+": "+vs)
+		}
+		sort.Strings(elems) // map遍历顺序不固定，排一下保证每次生成的代码一样
+		return typeString(v.Type()) + "{" + strings.Join(elems, ", ") + "}", nil
+	case reflect.Struct:
+		var fields []string
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				return "", fmt.Errorf("struct %s has unexported field %s", v.Type().Name(), f.Name)
+			}
+			fs, err := goLiteral(v.Field(i))
+			if err != nil {
+				return "", err
+			}
+			fields = append(fields, f.Name+": "+fs)
+		}
+		return typeString(v.Type()) + "{" + strings.Join(fields, ", ") + "}", nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return "nil", nil
+		}
+		e, err := goLiteral(v.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "&" + e, nil
+	}
+	return "", fmt.Errorf("value of kind %s can not be written as go literal", v.Kind())
+}
+
+func typeString(t reflect.Type) string {
+	if t.Name() != "" {
+		return t.Name()
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		return "[]" + typeString(t.Elem())
+	case reflect.Map:
+		return "map[" + typeString(t.Key()) + "]" + typeString(t.Elem())
+	case reflect.Ptr:
+		return "*" + typeString(t.Elem())
+	}
+	return t.String()
+}
+
+// wrapNamed 具名的基础类型（type ItemId int32这种）要加类型转换
+func wrapNamed(t reflect.Type, lit string) string {
+	if t.PkgPath() == "" {
+		return lit
+	}
+	return t.Name() + "(" + lit + ")"
+}
+
+const processorDeclFile = "processors.gen.go"
+
+// writeProcessorDecls 没用到自定义类型时把旧文件删掉
+func writeProcessorDecls(outputPath string, decls map[string]string) error {
+	path := outputPath + processorDeclFile
+	if len(decls) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	var names []string
+	for name := range decls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("package result\n\n// 自定义列类型，由RegisterProcessor注册的Decl生成\n")
+	for _, name := range names {
+		b.WriteString("\n" + strings.TrimSpace(decls[name]) + "\n")
+	}
+	if err := os.MkdirAll(outputPath, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
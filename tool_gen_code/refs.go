@@ -0,0 +1,95 @@
+package tool_gen_code
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 跨表引用：表格G列写 ref=item.id 表示这一列存的是item表的id，
+// 生成 func (s *Quest) GetItem() *Item，业务里不用再自己拿id去查一遍map；
+// 被引用的表必须以这一列作为唯一的索引键（F列），两边类型要一致。
+// 同一个结构体里有两列引用同一张表时，访问函数名带上列名：GetRewardItemItem
+
+type RefInfo struct {
+	Struct   string // 被引用的结构体名，比如Item
+	Field    string // 被引用的键字段名，比如Id
+	Accessor string // 生成的访问函数名
+	Zero     string // 这一列的零值字面量，零值表示不引用
+}
+
+// parseRef G列的内容，空字符串返回nil
+func parseRef(raw string) (*RefInfo, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(raw, "ref=") {
+		return nil, fmt.Errorf("illegal ref %q, must be like ref=item.id", raw)
+	}
+	parts := strings.Split(raw[len("ref="):], ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("illegal ref %q, must be like ref=item.id", raw)
+	}
+	return &RefInfo{
+		Struct: UnderscoreToUpperCamelCase(parts[0]),
+		Field:  UnderscoreToUpperCamelCase(parts[1]),
+	}, nil
+}
+
+func zeroLiteral(vType string) string {
+	switch vType {
+	case "string":
+		return `""`
+	case "bool":
+		return "false"
+	}
+	return "0"
+}
+
+// resolveRefs 所有表都读完之后检查引用目标，填好访问函数名
+func resolveRefs(data map[string][]*Variable) error {
+	byStruct := make(map[string][]*Variable, len(data))
+	for structName, kv := range data {
+		byStruct[UnderscoreToUpperCamelCase(structName)] = kv
+	}
+	for structName, kv := range data {
+		targets := make(map[string]int)
+		for _, v := range kv {
+			if v.Ref != nil {
+				targets[v.Ref.Struct]++
+			}
+		}
+		for _, v := range kv {
+			if v.Ref == nil {
+				continue
+			}
+			target, ok := byStruct[v.Ref.Struct]
+			if !ok {
+				return fmt.Errorf("%s.%s: ref target struct %s not found", structName, v.JsonName, v.Ref.Struct)
+			}
+			var keys []*Variable
+			for _, t := range target {
+				if t.IsKey {
+					keys = append(keys, t)
+				}
+			}
+			if len(keys) != 1 || keys[0].Name != v.Ref.Field {
+				return fmt.Errorf("%s.%s: ref target %s.%s must be the only index key of %s", structName, v.JsonName, v.Ref.Struct, v.Ref.Field, v.Ref.Struct)
+			}
+			if keys[0].VType != v.VType {
+				return fmt.Errorf("%s.%s: type %s does not match ref target %s.%s type %s", structName, v.JsonName, v.VType, v.Ref.Struct, v.Ref.Field, keys[0].VType)
+			}
+			v.Ref.Accessor = "Get" + v.Ref.Struct
+			if targets[v.Ref.Struct] > 1 {
+				v.Ref.Accessor = "Get" + v.Name + v.Ref.Struct
+			}
+			v.Ref.Zero = zeroLiteral(v.VType)
+			for _, other := range kv {
+				if "Get"+other.Name == v.Ref.Accessor {
+					return fmt.Errorf("%s.%s: ref accessor %s conflicts with getter of field %s", structName, v.JsonName, v.Ref.Accessor, other.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
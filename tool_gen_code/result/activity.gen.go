@@ -0,0 +1,87 @@
+package result
+
+import (
+	"fmt"
+)
+
+type Activity struct {
+	Id        int    `json:"id"`         // 活动id
+	Type      string `json:"type"`       // 活动类型，calendar按类型找开关处理函数
+	Name      string `json:"name"`       // 活动名
+	OpenTime  string `json:"open_time"`  // 开启时间（服务器时区，2006-01-02 15:04:05）
+	CloseTime string `json:"close_time"` // 关闭时间（格式同上，不含）
+}
+
+func (s *Activity) GetStructName() string {
+	return "Activity"
+}
+
+// NewActivityWithDefaults 按表格里填的默认值初始化，没填默认值的字段是零值
+func NewActivityWithDefaults() *Activity {
+	return &Activity{}
+}
+
+// ActivityById 按Id索引，LoadActivity时整体重建
+var ActivityById = map[int]*Activity{}
+
+func GetActivityById(id int) *Activity {
+	return ActivityById[id]
+}
+
+func ActivityIndexKey(s *Activity) int {
+	return s.Id
+}
+
+// LoadActivity 用一份完整的配置数据重建索引（整体替换，不是增量），有重复键直接报错
+func LoadActivity(rows []*Activity) error {
+	idx := make(map[int]*Activity, len(rows))
+	for _, row := range rows {
+		key := ActivityIndexKey(row)
+		if _, ok := idx[key]; ok {
+			return fmt.Errorf("Activity duplicated key %v", key)
+		}
+		idx[key] = row
+	}
+	ActivityById = idx
+	return nil
+}
+
+func (s *Activity) SetId(setVal int) {
+	s.Id = setVal
+}
+
+func (s *Activity) GetId() int {
+	return s.Id
+}
+
+func (s *Activity) SetType(setVal string) {
+	s.Type = setVal
+}
+
+func (s *Activity) GetType() string {
+	return s.Type
+}
+
+func (s *Activity) SetName(setVal string) {
+	s.Name = setVal
+}
+
+func (s *Activity) GetName() string {
+	return s.Name
+}
+
+func (s *Activity) SetOpenTime(setVal string) {
+	s.OpenTime = setVal
+}
+
+func (s *Activity) GetOpenTime() string {
+	return s.OpenTime
+}
+
+func (s *Activity) SetCloseTime(setVal string) {
+	s.CloseTime = setVal
+}
+
+func (s *Activity) GetCloseTime() string {
+	return s.CloseTime
+}
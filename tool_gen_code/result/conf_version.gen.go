@@ -0,0 +1,19 @@
+package result
+
+// 配置版本戳，Gen开Stamp选项（启动参数-gen-stamp）时按chart.xlsx重新生成，不要手改
+
+// ConfVersionInfo Hash是chart.xlsx内容的sha256前16位，BuildTime是打戳时间；都为空表示没打过戳
+type ConfVersionInfo struct {
+	Hash      string `json:"hash"`
+	BuildTime string `json:"build_time"`
+}
+
+const (
+	confHash      = "9b1d3a319bfedce5"
+	confBuildTime = "2026-10-15T13:39:54Z"
+)
+
+// ConfVersion 当前二进制编进去的配置版本
+func ConfVersion() ConfVersionInfo {
+	return ConfVersionInfo{Hash: confHash, BuildTime: confBuildTime}
+}
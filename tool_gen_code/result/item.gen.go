@@ -0,0 +1,83 @@
+package result
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type Item struct {
+	Id       int    `json:"id"`        // 道具id
+	Name     string `json:"name"`      // 道具名
+	MaxStack int32  `json:"max_stack"` // 单格最大堆叠数
+}
+
+func (s *Item) GetStructName() string {
+	return "Item"
+}
+
+// NewItemWithDefaults 按表格里填的默认值初始化，没填默认值的字段是零值
+func NewItemWithDefaults() *Item {
+	return &Item{
+		MaxStack: 1,
+	}
+}
+
+// UnmarshalJSON 数据里缺失（或为null）的字段保留默认值，而不是变成零值
+func (s *Item) UnmarshalJSON(b []byte) error {
+	type alias Item
+	tmp := (*alias)(NewItemWithDefaults())
+	if err := json.Unmarshal(b, tmp); err != nil {
+		return err
+	}
+	*s = Item(*tmp)
+	return nil
+}
+
+// ItemById 按Id索引，LoadItem时整体重建
+var ItemById = map[int]*Item{}
+
+func GetItemById(id int) *Item {
+	return ItemById[id]
+}
+
+func ItemIndexKey(s *Item) int {
+	return s.Id
+}
+
+// LoadItem 用一份完整的配置数据重建索引（整体替换，不是增量），有重复键直接报错
+func LoadItem(rows []*Item) error {
+	idx := make(map[int]*Item, len(rows))
+	for _, row := range rows {
+		key := ItemIndexKey(row)
+		if _, ok := idx[key]; ok {
+			return fmt.Errorf("Item duplicated key %v", key)
+		}
+		idx[key] = row
+	}
+	ItemById = idx
+	return nil
+}
+
+func (s *Item) SetId(setVal int) {
+	s.Id = setVal
+}
+
+func (s *Item) GetId() int {
+	return s.Id
+}
+
+func (s *Item) SetName(setVal string) {
+	s.Name = setVal
+}
+
+func (s *Item) GetName() string {
+	return s.Name
+}
+
+func (s *Item) SetMaxStack(setVal int32) {
+	s.MaxStack = setVal
+}
+
+func (s *Item) GetMaxStack() int32 {
+	return s.MaxStack
+}
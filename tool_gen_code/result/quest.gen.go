@@ -0,0 +1,131 @@
+package result
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+type Quest struct {
+	Id          int    `json:"id"`           // 任务id
+	Event       string `json:"event"`        // 计数的事件类型（kill/level_up/rank_achieved）
+	Target      int64  `json:"target"`       // 事件目标（比如怪物id），0表示不限
+	Count       int64  `json:"count"`        // 完成需要的数量（等级/排名类事件是要达到的值）
+	RewardItem  int    `json:"reward_item"`  // 奖励道具id
+	RewardCount int32  `json:"reward_count"` // 奖励道具数量
+}
+
+func (s *Quest) GetStructName() string {
+	return "Quest"
+}
+
+// NewQuestWithDefaults 按表格里填的默认值初始化，没填默认值的字段是零值
+func NewQuestWithDefaults() *Quest {
+	return &Quest{
+		Count: 1,
+	}
+}
+
+// UnmarshalJSON 数据里缺失（或为null）的字段保留默认值，而不是变成零值
+func (s *Quest) UnmarshalJSON(b []byte) error {
+	type alias Quest
+	tmp := (*alias)(NewQuestWithDefaults())
+	if err := json.Unmarshal(b, tmp); err != nil {
+		return err
+	}
+	*s = Quest(*tmp)
+	return nil
+}
+
+// QuestById 按Id索引，LoadQuest时整体重建
+var QuestById = map[int]*Quest{}
+
+func GetQuestById(id int) *Quest {
+	return QuestById[id]
+}
+
+func QuestIndexKey(s *Quest) int {
+	return s.Id
+}
+
+// LoadQuest 用一份完整的配置数据重建索引（整体替换，不是增量），有重复键直接报错
+func LoadQuest(rows []*Quest) error {
+	idx := make(map[int]*Quest, len(rows))
+	for _, row := range rows {
+		key := QuestIndexKey(row)
+		if _, ok := idx[key]; ok {
+			return fmt.Errorf("Quest duplicated key %v", key)
+		}
+		idx[key] = row
+	}
+	QuestById = idx
+	return nil
+}
+
+// GetItem RewardItem引用的Item，找不到（或者RewardItem是零值）返回nil
+func (s *Quest) GetItem() *Item {
+	return GetItemById(s.RewardItem)
+}
+
+// CheckQuestRefs 所有表Load完之后调一次，列出引用不到的数据（零值表示不引用，跳过）
+func CheckQuestRefs() error {
+	var bad []string
+	for key, row := range QuestById {
+		if row.RewardItem != 0 && row.GetItem() == nil {
+			bad = append(bad, fmt.Sprintf("Quest %v RewardItem %v not found in Item", key, row.RewardItem))
+		}
+	}
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		return fmt.Errorf("%d dangling refs: %v", len(bad), bad)
+	}
+	return nil
+}
+
+func (s *Quest) SetId(setVal int) {
+	s.Id = setVal
+}
+
+func (s *Quest) GetId() int {
+	return s.Id
+}
+
+func (s *Quest) SetEvent(setVal string) {
+	s.Event = setVal
+}
+
+func (s *Quest) GetEvent() string {
+	return s.Event
+}
+
+func (s *Quest) SetTarget(setVal int64) {
+	s.Target = setVal
+}
+
+func (s *Quest) GetTarget() int64 {
+	return s.Target
+}
+
+func (s *Quest) SetCount(setVal int64) {
+	s.Count = setVal
+}
+
+func (s *Quest) GetCount() int64 {
+	return s.Count
+}
+
+func (s *Quest) SetRewardItem(setVal int) {
+	s.RewardItem = setVal
+}
+
+func (s *Quest) GetRewardItem() int {
+	return s.RewardItem
+}
+
+func (s *Quest) SetRewardCount(setVal int32) {
+	s.RewardCount = setVal
+}
+
+func (s *Quest) GetRewardCount() int32 {
+	return s.RewardCount
+}
@@ -1,5 +1,9 @@
 package result
 
+import (
+	"fmt"
+)
+
 type Struct1 struct {
 	Id       int    `json:"id"`       // 它的id
 	Id2      int    `json:"id2"`      // 它的第2个id
@@ -11,6 +15,42 @@ func (s *Struct1) GetStructName() string {
 	return "Struct1"
 }
 
+// NewStruct1WithDefaults 按表格里填的默认值初始化，没填默认值的字段是零值
+func NewStruct1WithDefaults() *Struct1 {
+	return &Struct1{}
+}
+
+// Struct1IdId2Key 联合索引键
+type Struct1IdId2Key struct {
+	Id  int
+	Id2 int
+}
+
+// Struct1ByIdId2 按联合键索引，LoadStruct1时整体重建
+var Struct1ByIdId2 = map[Struct1IdId2Key]*Struct1{}
+
+func GetStruct1ByIdId2(id int, id2 int) *Struct1 {
+	return Struct1ByIdId2[Struct1IdId2Key{Id: id, Id2: id2}]
+}
+
+func Struct1IndexKey(s *Struct1) Struct1IdId2Key {
+	return Struct1IdId2Key{Id: s.Id, Id2: s.Id2}
+}
+
+// LoadStruct1 用一份完整的配置数据重建索引（整体替换，不是增量），有重复键直接报错
+func LoadStruct1(rows []*Struct1) error {
+	idx := make(map[Struct1IdId2Key]*Struct1, len(rows))
+	for _, row := range rows {
+		key := Struct1IndexKey(row)
+		if _, ok := idx[key]; ok {
+			return fmt.Errorf("Struct1 duplicated key %v", key)
+		}
+		idx[key] = row
+	}
+	Struct1ByIdId2 = idx
+	return nil
+}
+
 func (s *Struct1) SetId(setVal int) {
 	s.Id = setVal
 }
@@ -0,0 +1,71 @@
+// 由tool_gen_code生成，不要手改
+
+package result
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func sampleStruct1() *Struct1 {
+	return &Struct1{
+		Id:       1,
+		Id2:      2,
+		Name:     "name_sample",
+		IntArray: []int{4},
+	}
+}
+
+func TestStruct1JSONRoundTrip(t *testing.T) {
+	want := sampleStruct1()
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &Struct1{}
+	if err = json.Unmarshal(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("round trip mismatch:\nwant %+v\ngot  %+v", want, got)
+	}
+}
+
+func TestStruct1Golden(t *testing.T) {
+	golden, err := os.ReadFile("testdata/struct1.golden.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]any
+	if err = json.Unmarshal(golden, &want); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(sampleStruct1())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err = json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(got[k], v) {
+			t.Errorf("field %s: golden %v, got %v", k, v, got[k])
+		}
+	}
+	// 反过来用golden数据反序列化，golden里有的字段要和样例一致
+	fromGolden := &Struct1{}
+	if err = json.Unmarshal(golden, fromGolden); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = json.Marshal(fromGolden)
+	got = nil
+	json.Unmarshal(b, &got)
+	for k, v := range want {
+		if !reflect.DeepEqual(got[k], v) {
+			t.Errorf("field %s after unmarshal golden: want %v, got %v", k, v, got[k])
+		}
+	}
+}
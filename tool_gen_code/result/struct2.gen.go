@@ -1,5 +1,10 @@
 package result
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 type Struct2 struct {
 	Id   int    `json:"id"`   // id。
 	Name string `json:"name"` // 名字。
@@ -9,6 +14,49 @@ func (s *Struct2) GetStructName() string {
 	return "Struct2"
 }
 
+// NewStruct2WithDefaults 按表格里填的默认值初始化，没填默认值的字段是零值
+func NewStruct2WithDefaults() *Struct2 {
+	return &Struct2{
+		Name: "未命名",
+	}
+}
+
+// UnmarshalJSON 数据里缺失（或为null）的字段保留默认值，而不是变成零值
+func (s *Struct2) UnmarshalJSON(b []byte) error {
+	type alias Struct2
+	tmp := (*alias)(NewStruct2WithDefaults())
+	if err := json.Unmarshal(b, tmp); err != nil {
+		return err
+	}
+	*s = Struct2(*tmp)
+	return nil
+}
+
+// Struct2ById 按Id索引，LoadStruct2时整体重建
+var Struct2ById = map[int]*Struct2{}
+
+func GetStruct2ById(id int) *Struct2 {
+	return Struct2ById[id]
+}
+
+func Struct2IndexKey(s *Struct2) int {
+	return s.Id
+}
+
+// LoadStruct2 用一份完整的配置数据重建索引（整体替换，不是增量），有重复键直接报错
+func LoadStruct2(rows []*Struct2) error {
+	idx := make(map[int]*Struct2, len(rows))
+	for _, row := range rows {
+		key := Struct2IndexKey(row)
+		if _, ok := idx[key]; ok {
+			return fmt.Errorf("Struct2 duplicated key %v", key)
+		}
+		idx[key] = row
+	}
+	Struct2ById = idx
+	return nil
+}
+
 func (s *Struct2) SetId(setVal int) {
 	s.Id = setVal
 }
@@ -0,0 +1,54 @@
+// 由tool_gen_code生成，不要手改
+using System.Collections.Generic;
+using System.Text.Json;
+using System.Text.Json.Serialization;
+
+namespace GameConfig
+{
+    public class Activity
+    {
+        [JsonPropertyName("id")]
+        public int Id { get; set; } // 活动id
+
+        [JsonPropertyName("type")]
+        public string Type { get; set; } = ""; // 活动类型，calendar按类型找开关处理函数
+
+        [JsonPropertyName("name")]
+        public string Name { get; set; } = ""; // 活动名
+
+        [JsonPropertyName("open_time")]
+        public string OpenTime { get; set; } = ""; // 开启时间（服务器时区，2006-01-02 15:04:05）
+
+        [JsonPropertyName("close_time")]
+        public string CloseTime { get; set; } = ""; // 关闭时间（格式同上，不含）
+
+        public static Dictionary<int, Activity> ById = new Dictionary<int, Activity>();
+
+        public static Activity GetById(int id)
+        {
+            return ById.TryGetValue(id, out var row) ? row : null;
+        }
+
+        private static int IndexKey(Activity row)
+        {
+            return row.Id;
+        }
+
+        // Load 用服务器同一份json数据（对象数组）整体重建索引，有重复键直接抛异常
+        public static void Load(string json)
+        {
+            var rows = JsonSerializer.Deserialize<List<Activity>>(json);
+            var idx = new Dictionary<int, Activity>(rows.Count);
+            foreach (var row in rows)
+            {
+                var key = IndexKey(row);
+                if (idx.ContainsKey(key))
+                {
+                    throw new System.Exception($"Activity duplicated key {key}");
+                }
+                idx[key] = row;
+            }
+            ById = idx;
+        }
+    }
+}
@@ -0,0 +1,48 @@
+// 由tool_gen_code生成，不要手改
+using System.Collections.Generic;
+using System.Text.Json;
+using System.Text.Json.Serialization;
+
+namespace GameConfig
+{
+    public class Item
+    {
+        [JsonPropertyName("id")]
+        public int Id { get; set; } // 道具id
+
+        [JsonPropertyName("name")]
+        public string Name { get; set; } = ""; // 道具名
+
+        [JsonPropertyName("max_stack")]
+        public int MaxStack { get; set; } = 1; // 单格最大堆叠数
+
+        public static Dictionary<int, Item> ById = new Dictionary<int, Item>();
+
+        public static Item GetById(int id)
+        {
+            return ById.TryGetValue(id, out var row) ? row : null;
+        }
+
+        private static int IndexKey(Item row)
+        {
+            return row.Id;
+        }
+
+        // Load 用服务器同一份json数据（对象数组）整体重建索引，有重复键直接抛异常
+        public static void Load(string json)
+        {
+            var rows = JsonSerializer.Deserialize<List<Item>>(json);
+            var idx = new Dictionary<int, Item>(rows.Count);
+            foreach (var row in rows)
+            {
+                var key = IndexKey(row);
+                if (idx.ContainsKey(key))
+                {
+                    throw new System.Exception($"Item duplicated key {key}");
+                }
+                idx[key] = row;
+            }
+            ById = idx;
+        }
+    }
+}
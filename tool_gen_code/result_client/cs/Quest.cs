@@ -0,0 +1,63 @@
+// 由tool_gen_code生成，不要手改
+using System.Collections.Generic;
+using System.Text.Json;
+using System.Text.Json.Serialization;
+
+namespace GameConfig
+{
+    public class Quest
+    {
+        [JsonPropertyName("id")]
+        public int Id { get; set; } // 任务id
+
+        [JsonPropertyName("event")]
+        public string Event { get; set; } = ""; // 计数的事件类型（kill/level_up/rank_achieved）
+
+        [JsonPropertyName("target")]
+        public long Target { get; set; } // 事件目标（比如怪物id），0表示不限
+
+        [JsonPropertyName("count")]
+        public long Count { get; set; } = 1; // 完成需要的数量（等级/排名类事件是要达到的值）
+
+        [JsonPropertyName("reward_item")]
+        public int RewardItem { get; set; } // 奖励道具id
+
+        [JsonPropertyName("reward_count")]
+        public int RewardCount { get; set; } // 奖励道具数量
+
+        public static Dictionary<int, Quest> ById = new Dictionary<int, Quest>();
+
+        public static Quest GetById(int id)
+        {
+            return ById.TryGetValue(id, out var row) ? row : null;
+        }
+
+        private static int IndexKey(Quest row)
+        {
+            return row.Id;
+        }
+
+        // Load 用服务器同一份json数据（对象数组）整体重建索引，有重复键直接抛异常
+        public static void Load(string json)
+        {
+            var rows = JsonSerializer.Deserialize<List<Quest>>(json);
+            var idx = new Dictionary<int, Quest>(rows.Count);
+            foreach (var row in rows)
+            {
+                var key = IndexKey(row);
+                if (idx.ContainsKey(key))
+                {
+                    throw new System.Exception($"Quest duplicated key {key}");
+                }
+                idx[key] = row;
+            }
+            ById = idx;
+        }
+
+        // GetItem RewardItem引用的Item，找不到返回null
+        public Item GetItem()
+        {
+            return Item.GetById(RewardItem);
+        }
+    }
+}
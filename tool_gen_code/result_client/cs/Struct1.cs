@@ -0,0 +1,51 @@
+// 由tool_gen_code生成，不要手改
+using System.Collections.Generic;
+using System.Text.Json;
+using System.Text.Json.Serialization;
+
+namespace GameConfig
+{
+    public class Struct1
+    {
+        [JsonPropertyName("id")]
+        public int Id { get; set; } // 它的id
+
+        [JsonPropertyName("id2")]
+        public int Id2 { get; set; } // 它的第2个id
+
+        [JsonPropertyName("name")]
+        public string Name { get; set; } = ""; // 它的名字
+
+        [JsonPropertyName("intArray")]
+        public List<int> IntArray { get; set; } = new List<int>(); // 它的数据组
+
+        public static Dictionary<(int, int), Struct1> ByIdId2 = new Dictionary<(int, int), Struct1>();
+
+        public static Struct1 GetByIdId2(int id, int id2)
+        {
+            return ByIdId2.TryGetValue((id, id2), out var row) ? row : null;
+        }
+
+        private static (int, int) IndexKey(Struct1 row)
+        {
+            return (row.Id, row.Id2);
+        }
+
+        // Load 用服务器同一份json数据（对象数组）整体重建索引，有重复键直接抛异常
+        public static void Load(string json)
+        {
+            var rows = JsonSerializer.Deserialize<List<Struct1>>(json);
+            var idx = new Dictionary<(int, int), Struct1>(rows.Count);
+            foreach (var row in rows)
+            {
+                var key = IndexKey(row);
+                if (idx.ContainsKey(key))
+                {
+                    throw new System.Exception($"Struct1 duplicated key {key}");
+                }
+                idx[key] = row;
+            }
+            ByIdId2 = idx;
+        }
+    }
+}
@@ -0,0 +1,45 @@
+// 由tool_gen_code生成，不要手改
+using System.Collections.Generic;
+using System.Text.Json;
+using System.Text.Json.Serialization;
+
+namespace GameConfig
+{
+    public class Struct2
+    {
+        [JsonPropertyName("id")]
+        public int Id { get; set; } // id。
+
+        [JsonPropertyName("name")]
+        public string Name { get; set; } = "未命名"; // 名字。
+
+        public static Dictionary<int, Struct2> ById = new Dictionary<int, Struct2>();
+
+        public static Struct2 GetById(int id)
+        {
+            return ById.TryGetValue(id, out var row) ? row : null;
+        }
+
+        private static int IndexKey(Struct2 row)
+        {
+            return row.Id;
+        }
+
+        // Load 用服务器同一份json数据（对象数组）整体重建索引，有重复键直接抛异常
+        public static void Load(string json)
+        {
+            var rows = JsonSerializer.Deserialize<List<Struct2>>(json);
+            var idx = new Dictionary<int, Struct2>(rows.Count);
+            foreach (var row in rows)
+            {
+                var key = IndexKey(row);
+                if (idx.ContainsKey(key))
+                {
+                    throw new System.Exception($"Struct2 duplicated key {key}");
+                }
+                idx[key] = row;
+            }
+            ById = idx;
+        }
+    }
+}
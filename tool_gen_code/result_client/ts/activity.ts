@@ -0,0 +1,45 @@
+// 由tool_gen_code生成，不要手改
+
+export interface Activity {
+    id: number; // 活动id
+    type: string; // 活动类型，calendar按类型找开关处理函数
+    name: string; // 活动名
+    open_time: string; // 开启时间（服务器时区，2006-01-02 15:04:05）
+    close_time: string; // 关闭时间（格式同上，不含）
+}
+
+// newActivityWithDefaults 按表格里填的默认值初始化
+export function newActivityWithDefaults(): Activity {
+    return {
+        id: 0,
+        type: "",
+        name: "",
+        open_time: "",
+        close_time: "",
+    };
+}
+
+export let activityById = new Map<number, Activity>();
+
+function activityIndexKey(row: Activity): number {
+    return row.id;
+}
+
+export function getActivityById(id: number): Activity | undefined {
+    return activityById.get(id);
+}
+
+// loadActivity 用服务器同一份json数据整体重建索引，数据里没填的字段用默认值，有重复键直接抛异常
+export function loadActivity(rows: Partial<Activity>[]): void {
+    const idx = new Map<number, Activity>();
+    for (const raw of rows) {
+        const row = { ...newActivityWithDefaults(), ...raw };
+        const key = activityIndexKey(row);
+        if (idx.has(key)) {
+            throw new Error(`Activity duplicated key ${key}`);
+        }
+        idx.set(key, row);
+    }
+    activityById = idx;
+}
+
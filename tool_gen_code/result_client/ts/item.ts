@@ -0,0 +1,41 @@
+// 由tool_gen_code生成，不要手改
+
+export interface Item {
+    id: number; // 道具id
+    name: string; // 道具名
+    max_stack: number; // 单格最大堆叠数
+}
+
+// newItemWithDefaults 按表格里填的默认值初始化
+export function newItemWithDefaults(): Item {
+    return {
+        id: 0,
+        name: "",
+        max_stack: 1,
+    };
+}
+
+export let itemById = new Map<number, Item>();
+
+function itemIndexKey(row: Item): number {
+    return row.id;
+}
+
+export function getItemById(id: number): Item | undefined {
+    return itemById.get(id);
+}
+
+// loadItem 用服务器同一份json数据整体重建索引，数据里没填的字段用默认值，有重复键直接抛异常
+export function loadItem(rows: Partial<Item>[]): void {
+    const idx = new Map<number, Item>();
+    for (const raw of rows) {
+        const row = { ...newItemWithDefaults(), ...raw };
+        const key = itemIndexKey(row);
+        if (idx.has(key)) {
+            throw new Error(`Item duplicated key ${key}`);
+        }
+        idx.set(key, row);
+    }
+    itemById = idx;
+}
+
@@ -0,0 +1,53 @@
+// 由tool_gen_code生成，不要手改
+import { getItemById, Item } from "./item";
+
+export interface Quest {
+    id: number; // 任务id
+    event: string; // 计数的事件类型（kill/level_up/rank_achieved）
+    target: number; // 事件目标（比如怪物id），0表示不限
+    count: number; // 完成需要的数量（等级/排名类事件是要达到的值）
+    reward_item: number; // 奖励道具id
+    reward_count: number; // 奖励道具数量
+}
+
+// newQuestWithDefaults 按表格里填的默认值初始化
+export function newQuestWithDefaults(): Quest {
+    return {
+        id: 0,
+        event: "",
+        target: 0,
+        count: 1,
+        reward_item: 0,
+        reward_count: 0,
+    };
+}
+
+export let questById = new Map<number, Quest>();
+
+function questIndexKey(row: Quest): number {
+    return row.id;
+}
+
+export function getQuestById(id: number): Quest | undefined {
+    return questById.get(id);
+}
+
+// loadQuest 用服务器同一份json数据整体重建索引，数据里没填的字段用默认值，有重复键直接抛异常
+export function loadQuest(rows: Partial<Quest>[]): void {
+    const idx = new Map<number, Quest>();
+    for (const raw of rows) {
+        const row = { ...newQuestWithDefaults(), ...raw };
+        const key = questIndexKey(row);
+        if (idx.has(key)) {
+            throw new Error(`Quest duplicated key ${key}`);
+        }
+        idx.set(key, row);
+    }
+    questById = idx;
+}
+
+// questGetItem reward_item引用的Item
+export function questGetItem(row: Quest): Item | undefined {
+    return getItemById(row.reward_item);
+}
+
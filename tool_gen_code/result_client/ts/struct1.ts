@@ -0,0 +1,43 @@
+// 由tool_gen_code生成，不要手改
+
+export interface Struct1 {
+    id: number; // 它的id
+    id2: number; // 它的第2个id
+    name: string; // 它的名字
+    intArray: number[]; // 它的数据组
+}
+
+// newStruct1WithDefaults 按表格里填的默认值初始化
+export function newStruct1WithDefaults(): Struct1 {
+    return {
+        id: 0,
+        id2: 0,
+        name: "",
+        intArray: [],
+    };
+}
+
+export let struct1ByIdId2 = new Map<string, Struct1>();
+
+function struct1IndexKey(row: Struct1): string {
+    return [row.id, row.id2].join("|");
+}
+
+export function getStruct1ByIdId2(id: number, id2: number): Struct1 | undefined {
+    return struct1ByIdId2.get([id, id2].join("|"));
+}
+
+// loadStruct1 用服务器同一份json数据整体重建索引，数据里没填的字段用默认值，有重复键直接抛异常
+export function loadStruct1(rows: Partial<Struct1>[]): void {
+    const idx = new Map<string, Struct1>();
+    for (const raw of rows) {
+        const row = { ...newStruct1WithDefaults(), ...raw };
+        const key = struct1IndexKey(row);
+        if (idx.has(key)) {
+            throw new Error(`Struct1 duplicated key ${key}`);
+        }
+        idx.set(key, row);
+    }
+    struct1ByIdId2 = idx;
+}
+
@@ -0,0 +1,39 @@
+// 由tool_gen_code生成，不要手改
+
+export interface Struct2 {
+    id: number; // id。
+    name: string; // 名字。
+}
+
+// newStruct2WithDefaults 按表格里填的默认值初始化
+export function newStruct2WithDefaults(): Struct2 {
+    return {
+        id: 0,
+        name: "未命名",
+    };
+}
+
+export let struct2ById = new Map<number, Struct2>();
+
+function struct2IndexKey(row: Struct2): number {
+    return row.id;
+}
+
+export function getStruct2ById(id: number): Struct2 | undefined {
+    return struct2ById.get(id);
+}
+
+// loadStruct2 用服务器同一份json数据整体重建索引，数据里没填的字段用默认值，有重复键直接抛异常
+export function loadStruct2(rows: Partial<Struct2>[]): void {
+    const idx = new Map<number, Struct2>();
+    for (const raw of rows) {
+        const row = { ...newStruct2WithDefaults(), ...raw };
+        const key = struct2IndexKey(row);
+        if (idx.has(key)) {
+            throw new Error(`Struct2 duplicated key ${key}`);
+        }
+        idx.set(key, row);
+    }
+    struct2ById = idx;
+}
+
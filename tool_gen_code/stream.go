@@ -0,0 +1,118 @@
+package tool_gen_code
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 表格列，和readme里的约定一致
+const (
+	colStruct  = iota // A 结构体
+	colField          // B 字段
+	colType           // C 类型
+	colComment        // D 注释
+	colDefault        // E 默认值
+	colKey            // F 索引键
+	colRef            // G 跨表引用
+)
+
+// chartProgressRows 每读这么多行打一次进度
+const chartProgressRows = 50000
+
+// errChartEnd 回调返回它表示正常读完（B列为空的行），不当成错误
+var errChartEnd = errors.New("chart end")
+
+// forEachChartRow 用excelize的流式行读取逐行回调，行号从1开始。
+// GetCellValue每次都按坐标查一遍，几十万行时又慢又要把整张sheet留在内存里，这里一行读完就丢
+func forEachChartRow(f *excelize.File, sheet string, fn func(rowNum int, row []string) error) error {
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	merged, err := chartMerges(f, sheet)
+	if err != nil {
+		return err
+	}
+	begin := time.Now()
+	n := 0
+	for rows.Next() {
+		n++
+		row, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		row = merged.fill(n, row)
+		if err = fn(n, row); err != nil {
+			if errors.Is(err, errChartEnd) {
+				break
+			}
+			return err
+		}
+		if n%chartProgressRows == 0 {
+			log.Printf("gen parse %s: %d rows, %s", sheet, n, time.Since(begin).Truncate(time.Millisecond))
+		}
+	}
+	if err = rows.Error(); err != nil {
+		return err
+	}
+	if n >= chartProgressRows {
+		log.Printf("gen parse %s done: %d rows, %s", sheet, n, time.Since(begin).Truncate(time.Millisecond))
+	}
+	return nil
+}
+
+type chartMerge struct {
+	top, bottom, left, right int // 行号从1开始，列从0开始
+	value                    string
+}
+
+type chartMergeList []chartMerge
+
+// chartMerges 策划习惯把A列结构体名合并单元格，流式读只有左上角有值，合并区域单独取一次（只是元数据，不大）
+func chartMerges(f *excelize.File, sheet string) (chartMergeList, error) {
+	mcs, err := f.GetMergeCells(sheet)
+	if err != nil {
+		return nil, err
+	}
+	var ret chartMergeList
+	for _, mc := range mcs {
+		left, top, err := excelize.CellNameToCoordinates(mc.GetStartAxis())
+		if err != nil {
+			return nil, err
+		}
+		right, bottom, err := excelize.CellNameToCoordinates(mc.GetEndAxis())
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, chartMerge{top: top, bottom: bottom, left: left - 1, right: right - 1, value: mc.GetCellValue()})
+	}
+	return ret, nil
+}
+
+// fill 把落在合并区域里的单元格补成左上角的值，和GetCellValue的行为一致
+func (l chartMergeList) fill(rowNum int, row []string) []string {
+	for _, m := range l {
+		if rowNum < m.top || rowNum > m.bottom {
+			continue
+		}
+		for len(row) <= m.right {
+			row = append(row, "")
+		}
+		for c := m.left; c <= m.right; c++ {
+			row[c] = m.value
+		}
+	}
+	return row
+}
+
+// cellAt Columns会省掉行尾的空单元格，越界当空串
+func cellAt(row []string, col int) string {
+	if col < len(row) {
+		return row[col]
+	}
+	return ""
+}
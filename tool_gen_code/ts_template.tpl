@@ -0,0 +1,43 @@
+// 由tool_gen_code生成，不要手改
+{{range $s, $r := .RefFiles}}import { get{{$s}}By{{$r.Field}}, {{$s}} } from "./{{$r.File}}";
+{{end}}
+export interface {{.StructName}} {
+{{range $f := .Fields}}    {{$f.JsonName}}: {{$f.TsType}};{{if $f.Comment}} // {{$f.Comment}}{{end}}
+{{end}}}
+
+// new{{.StructName}}WithDefaults 按表格里填的默认值初始化
+export function new{{.StructName}}WithDefaults(): {{.StructName}} {
+    return {
+{{range $f := .Fields}}        {{$f.JsonName}}: {{$f.TsDefault}},
+{{end}}    };
+}
+{{if .Keys}}
+export let {{.TsName}}By{{.KeyName}} = new Map<{{if eq (len .Keys) 1}}{{(index .Keys 0).TsType}}{{else}}string{{end}}, {{.StructName}}>();
+
+function {{.TsName}}IndexKey(row: {{.StructName}}): {{if eq (len .Keys) 1}}{{(index .Keys 0).TsType}}{{else}}string{{end}} {
+    return {{if eq (len .Keys) 1}}row.{{(index .Keys 0).JsonName}}{{else}}[{{range $i, $k := .Keys}}{{if $i}}, {{end}}row.{{$k.JsonName}}{{end}}].join("|"){{end}};
+}
+
+export function get{{.StructName}}By{{.KeyName}}({{range $i, $k := .Keys}}{{if $i}}, {{end}}{{$k.ArgName}}: {{$k.TsType}}{{end}}): {{.StructName}} | undefined {
+    return {{.TsName}}By{{.KeyName}}.get({{if eq (len .Keys) 1}}{{(index .Keys 0).ArgName}}{{else}}[{{range $i, $k := .Keys}}{{if $i}}, {{end}}{{$k.ArgName}}{{end}}].join("|"){{end}});
+}
+
+// load{{.StructName}} 用服务器同一份json数据整体重建索引，数据里没填的字段用默认值，有重复键直接抛异常
+export function load{{.StructName}}(rows: Partial<{{.StructName}}>[]): void {
+    const idx = new Map<{{if eq (len .Keys) 1}}{{(index .Keys 0).TsType}}{{else}}string{{end}}, {{.StructName}}>();
+    for (const raw of rows) {
+        const row = { ...new{{.StructName}}WithDefaults(), ...raw };
+        const key = {{.TsName}}IndexKey(row);
+        if (idx.has(key)) {
+            throw new Error(`{{.StructName}} duplicated key ${key}`);
+        }
+        idx.set(key, row);
+    }
+    {{.TsName}}By{{.KeyName}} = idx;
+}
+{{end}}{{range $f := .Refs}}
+// {{$.TsName}}{{$f.Ref.Accessor}} {{$f.JsonName}}引用的{{$f.Ref.Struct}}
+export function {{$.TsName}}{{$f.Ref.Accessor}}(row: {{$.StructName}}): {{$f.Ref.Struct}} | undefined {
+    return get{{$f.Ref.Struct}}By{{$f.Ref.Field}}(row.{{$f.JsonName}});
+}
+{{end}}
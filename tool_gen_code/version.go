@@ -0,0 +1,79 @@
+package tool_gen_code
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/format"
+	"os"
+	"regexp"
+	"time"
+)
+
+// 配置版本戳：chart.xlsx的sha256加上生成时间写进result/conf_version.gen.go，服务器通过result.ConfVersion()上报自己编进去的是哪一版表
+
+const confVersionFile = "conf_version.gen.go"
+
+var confHashReg = regexp.MustCompile(`confHash\s*=\s*"([0-9a-f]*)"`)
+
+// chartHash 表格文件内容的sha256，取前16位够区分了
+func chartHash(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+// writeConfVersion stamp为false时只保证文件存在（ConfVersion返回空版本），不动已有的戳；
+// 为true时表格没变就保留原来的时间，避免每次启动都把文件改一遍
+func writeConfVersion(outputPath string, chartPath string, stamp bool, now time.Time) error {
+	path := outputPath + confVersionFile
+	old, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	exist := err == nil
+	if !stamp && exist {
+		return nil
+	}
+	hash, buildTime := "", ""
+	if stamp {
+		if hash, err = chartHash(chartPath); err != nil {
+			return err
+		}
+		if sub := confHashReg.FindSubmatch(old); sub != nil && string(sub[1]) == hash {
+			return nil
+		}
+		buildTime = now.Format(time.RFC3339)
+	}
+	src := fmt.Sprintf(`package result
+
+// 配置版本戳，Gen开Stamp选项（启动参数-gen-stamp）时按chart.xlsx重新生成，不要手改
+
+// ConfVersionInfo Hash是chart.xlsx内容的sha256前16位，BuildTime是打戳时间；都为空表示没打过戳
+type ConfVersionInfo struct {
+	Hash      string `+"`json:\"hash\"`"+`
+	BuildTime string `+"`json:\"build_time\"`"+`
+}
+
+const (
+	confHash      = %q
+	confBuildTime = %q
+)
+
+// ConfVersion 当前二进制编进去的配置版本
+func ConfVersion() ConfVersionInfo {
+	return ConfVersionInfo{Hash: confHash, BuildTime: confBuildTime}
+}
+`, hash, buildTime)
+	b, err := format.Source([]byte(src))
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(outputPath, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
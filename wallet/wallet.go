@@ -0,0 +1,257 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"test/db"
+	"test/gtime"
+	"time"
+)
+
+// 建表语句：
+// CREATE TABLE player_wallet (
+//   player_id BIGINT NOT NULL PRIMARY KEY,
+//   data BLOB NOT NULL,
+//   update_time BIGINT NOT NULL
+// );
+// CREATE TABLE wallet_log (
+//   tx_id BIGINT NOT NULL,
+//   player_id BIGINT NOT NULL,
+//   currency INT NOT NULL,
+//   delta BIGINT NOT NULL,
+//   balance BIGINT NOT NULL,
+//   reason VARCHAR(64) NOT NULL,
+//   create_time BIGINT NOT NULL,
+//   KEY idx_player (player_id, create_time),
+//   KEY idx_tx (tx_id)
+// );
+//
+// 余额整包存一行，标脏定时落库；每笔变动另外往wallet_log插一行，只插不改，对账和补偿按tx_id查
+
+type Currency int32
+
+var (
+	ErrNotEnough   = errors.New("balance not enough")
+	ErrNoWallet    = errors.New("wallet not loaded")
+	ErrBadAmount   = errors.New("amount must be positive")
+	ErrEarnCapped  = errors.New("earn cap reached")
+	ErrDupCurrency = errors.New("currency appears more than once")
+)
+
+// Amount 一种货币的数量
+type Amount struct {
+	Currency Currency
+	Value    int64
+}
+
+type Wallet struct {
+	PlayerId int64              `json:"-"`
+	Balances map[Currency]int64 `json:"balances"`
+	Earned   map[Currency]int64 `json:"earned"`   // 当天已获得的量，算获取上限用
+	EarnDay  string             `json:"earn_day"` // Earned是哪天的，跨天清零
+}
+
+type Manager struct {
+	pool    db.Pool
+	wallets map[int64]*Wallet
+	caps    map[Currency]int64 // 每日获取上限，没配的不限
+	dirty   *db.DirtySet[int64]
+	txSeq   atomic.Int64
+	now     func() time.Time
+}
+
+func NewManager(pool db.Pool) *Manager {
+	m := &Manager{
+		pool:    pool,
+		wallets: make(map[int64]*Wallet),
+		caps:    make(map[Currency]int64),
+		now:     time.Now,
+	}
+	m.dirty = db.NewDirtySet[int64](pool, "wallet", m.saveQuery)
+	return m
+}
+
+// SetEarnCap 每日获取上限，<=0表示不限。只限制Earn，充值之类的走EarnUncapped
+func (m *Manager) SetEarnCap(c Currency, daily int64) {
+	if daily <= 0 {
+		delete(m.caps, c)
+		return
+	}
+	m.caps[c] = daily
+}
+
+func (m *Manager) StartFlush(interval time.Duration) {
+	m.dirty.StartFlush(interval)
+}
+
+func (m *Manager) saveQuery(playerId int64) *db.SqlQuery {
+	w, ok := m.wallets[playerId]
+	if !ok {
+		return nil
+	}
+	b, err := json.Marshal(w)
+	if err != nil {
+		log.Printf("wallet marshal failed, player %d: %s", playerId, err.Error())
+		return nil
+	}
+	return &db.SqlQuery{
+		Stmt: "replace into player_wallet (player_id, data, update_time) values (?, ?, ?);",
+		Args: []any{playerId, b, m.now().Unix()},
+	}
+}
+
+// Load cb在db的Loop goroutine里执行，拿到的wallet要回到主循环再Put
+func (m *Manager) Load(playerId int64, cb func(*Wallet, error)) error {
+	return m.pool.AddQuery(&db.SqlQuery{
+		Stmt: "select * from player_wallet where player_id = ?;",
+		Args: []any{playerId},
+		CbFunc: func(data []*db.DBData, err error) {
+			w := &Wallet{PlayerId: playerId}
+			if errors.Is(err, db.ErrNoRows) {
+				cb(w, nil)
+				return
+			}
+			if err != nil {
+				cb(nil, err)
+				return
+			}
+			if err = json.Unmarshal(data[0].Data["data"], w); err != nil {
+				cb(nil, err)
+				return
+			}
+			cb(w, nil)
+		},
+	})
+}
+
+func (m *Manager) Put(w *Wallet) {
+	if w.Balances == nil {
+		w.Balances = make(map[Currency]int64)
+	}
+	if w.Earned == nil {
+		w.Earned = make(map[Currency]int64)
+	}
+	m.wallets[w.PlayerId] = w
+}
+
+// Unload 玩家下线，先落库再卸载
+func (m *Manager) Unload(playerId int64) {
+	if q := m.saveQuery(playerId); q != nil {
+		q.Priority = db.PriorityHigh
+		q.CbFunc = func(_ []*db.DBData, err error) {
+			if err != nil {
+				log.Printf("wallet save on unload failed, player %d: %s", playerId, err.Error())
+			}
+		}
+		if err := m.pool.AddQuery(q); err != nil {
+			log.Printf("wallet save on unload failed, player %d: %s", playerId, err.Error())
+		}
+	}
+	delete(m.wallets, playerId)
+}
+
+func (m *Manager) Balance(playerId int64, c Currency) int64 {
+	w, ok := m.wallets[playerId]
+	if !ok {
+		return 0
+	}
+	return w.Balances[c]
+}
+
+// nextTxId 毫秒时间戳左移+进程内序号
+func (m *Manager) nextTxId() int64 {
+	return m.now().UnixMilli()<<12 | (m.txSeq.Add(1) & 0xfff)
+}
+
+// Spend 多种货币一起扣，有一种不够就全部不扣。返回交易号，退款时按它查日志
+func (m *Manager) Spend(playerId int64, costs []Amount, reason string) (txId int64, err error) {
+	w, ok := m.wallets[playerId]
+	if !ok {
+		return 0, ErrNoWallet
+	}
+	seen := make(map[Currency]bool, len(costs))
+	for _, c := range costs {
+		if c.Value <= 0 {
+			return 0, ErrBadAmount
+		}
+		if seen[c.Currency] {
+			return 0, fmt.Errorf("%w: %d", ErrDupCurrency, c.Currency)
+		}
+		seen[c.Currency] = true
+		if w.Balances[c.Currency] < c.Value {
+			return 0, fmt.Errorf("%w: currency %d has %d, need %d", ErrNotEnough, c.Currency, w.Balances[c.Currency], c.Value)
+		}
+	}
+	txId = m.nextTxId()
+	for _, c := range costs {
+		w.Balances[c.Currency] -= c.Value
+		m.writeLog(txId, playerId, c.Currency, -c.Value, w.Balances[c.Currency], reason)
+	}
+	m.dirty.Mark(playerId)
+	return txId, nil
+}
+
+// Earn 受每日上限限制，超出部分不加，返回实际加了多少。已经到上限返回ErrEarnCapped
+func (m *Manager) Earn(playerId int64, a Amount, reason string) (added int64, err error) {
+	w, ok := m.wallets[playerId]
+	if !ok {
+		return 0, ErrNoWallet
+	}
+	if a.Value <= 0 {
+		return 0, ErrBadAmount
+	}
+	added = a.Value
+	if limit, capped := m.caps[a.Currency]; capped {
+		if day := gtime.FormatDate(m.now()); w.EarnDay != day {
+			w.EarnDay = day
+			w.Earned = make(map[Currency]int64)
+		}
+		left := limit - w.Earned[a.Currency]
+		if left <= 0 {
+			return 0, ErrEarnCapped
+		}
+		if added > left {
+			added = left
+		}
+		w.Earned[a.Currency] += added
+	}
+	m.add(w, a.Currency, added, reason)
+	return added, nil
+}
+
+// EarnUncapped 不受获取上限限制（充值、补偿等）
+func (m *Manager) EarnUncapped(playerId int64, a Amount, reason string) error {
+	w, ok := m.wallets[playerId]
+	if !ok {
+		return ErrNoWallet
+	}
+	if a.Value <= 0 {
+		return ErrBadAmount
+	}
+	m.add(w, a.Currency, a.Value, reason)
+	return nil
+}
+
+func (m *Manager) add(w *Wallet, c Currency, v int64, reason string) {
+	w.Balances[c] += v
+	m.writeLog(m.nextTxId(), w.PlayerId, c, v, w.Balances[c], reason)
+	m.dirty.Mark(w.PlayerId)
+}
+
+func (m *Manager) writeLog(txId int64, playerId int64, c Currency, delta int64, balance int64, reason string) {
+	err := m.pool.AddQuery(&db.SqlQuery{
+		Stmt: "insert into wallet_log (tx_id, player_id, currency, delta, balance, reason, create_time) values (?, ?, ?, ?, ?, ?, ?);",
+		Args: []any{txId, playerId, int32(c), delta, balance, reason, m.now().Unix()},
+		CbFunc: func(_ []*db.DBData, err error) {
+			if err != nil {
+				log.Printf("wallet log write failed, tx %d player %d currency %d delta %d: %s", txId, playerId, c, delta, err.Error())
+			}
+		},
+	})
+	if err != nil {
+		log.Printf("wallet log write failed, tx %d player %d currency %d delta %d: %s", txId, playerId, c, delta, err.Error())
+	}
+}
@@ -0,0 +1,114 @@
+package wallet
+
+import (
+	"errors"
+	"test/db"
+	"test/gtime"
+	"testing"
+	"time"
+)
+
+const (
+	gold Currency = 1
+	gem  Currency = 2
+)
+
+func newTestManager(t *testing.T) (*Manager, *db.FakePool) {
+	pool := db.NewFakePool()
+	m := NewManager(pool)
+	var loaded *Wallet
+	if err := m.Load(1, func(w *Wallet, err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded = w
+	}); err != nil {
+		t.Fatal(err)
+	}
+	m.Put(loaded)
+	return m, pool
+}
+
+func TestSpendAllOrNothing(t *testing.T) {
+	m, pool := newTestManager(t)
+	m.EarnUncapped(1, Amount{gold, 100}, "init")
+	m.EarnUncapped(1, Amount{gem, 5}, "init")
+	logs := len(pool.Table("wallet_log"))
+	if logs != 2 {
+		t.Fatalf("log rows = %d", logs)
+	}
+
+	// 宝石不够，金币也不扣，不写日志
+	if _, err := m.Spend(1, []Amount{{gold, 50}, {gem, 10}}, "shop"); !errors.Is(err, ErrNotEnough) {
+		t.Fatalf("spend err = %v", err)
+	}
+	if _, err := m.Spend(1, []Amount{{gold, 10}, {gold, 10}}, "shop"); !errors.Is(err, ErrDupCurrency) {
+		t.Fatalf("dup currency err = %v", err)
+	}
+	if _, err := m.Spend(1, []Amount{{gold, 0}}, "shop"); !errors.Is(err, ErrBadAmount) {
+		t.Fatalf("zero amount err = %v", err)
+	}
+	if m.Balance(1, gold) != 100 || m.Balance(1, gem) != 5 || len(pool.Table("wallet_log")) != logs {
+		t.Fatalf("failed spend changed wallet: gold %d gem %d logs %d", m.Balance(1, gold), m.Balance(1, gem), len(pool.Table("wallet_log")))
+	}
+
+	txId, err := m.Spend(1, []Amount{{gold, 50}, {gem, 5}}, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Balance(1, gold) != 50 || m.Balance(1, gem) != 0 {
+		t.Fatalf("after spend gold %d gem %d", m.Balance(1, gold), m.Balance(1, gem))
+	}
+	// 每种货币一行，同一个tx_id
+	rows := pool.Table("wallet_log")[logs:]
+	if len(rows) != 2 {
+		t.Fatalf("spend log rows = %d", len(rows))
+	}
+	for i, want := range []struct{ currency, delta, balance string }{{"1", "-50", "50"}, {"2", "-5", "0"}} {
+		r := rows[i]
+		if r.Int64("tx_id") != txId || r.String("currency") != want.currency || r.String("delta") != want.delta ||
+			r.String("balance") != want.balance || r.String("reason") != "shop" {
+			t.Fatalf("log row %d = %v", i, r.Data)
+		}
+	}
+	if _, err = m.Spend(2, []Amount{{gold, 1}}, "shop"); !errors.Is(err, ErrNoWallet) {
+		t.Fatalf("unloaded wallet err = %v", err)
+	}
+}
+
+func TestEarnCap(t *testing.T) {
+	m, pool := newTestManager(t)
+	now := time.Date(2024, 1, 1, 23, 0, 0, 0, gtime.Location())
+	m.now = func() time.Time { return now }
+	m.SetEarnCap(gold, 100)
+
+	if added, err := m.Earn(1, Amount{gold, 60}, "quest"); added != 60 || err != nil {
+		t.Fatalf("earn = %d, %v", added, err)
+	}
+	// 跨过上限只加剩下的部分
+	if added, err := m.Earn(1, Amount{gold, 60}, "quest"); added != 40 || err != nil {
+		t.Fatalf("earn over cap = %d, %v", added, err)
+	}
+	if added, err := m.Earn(1, Amount{gold, 1}, "quest"); added != 0 || !errors.Is(err, ErrEarnCapped) {
+		t.Fatalf("earn at cap = %d, %v", added, err)
+	}
+	// 没配上限的货币、EarnUncapped不受影响
+	if added, err := m.Earn(1, Amount{gem, 500}, "quest"); added != 500 || err != nil {
+		t.Fatalf("uncapped currency = %d, %v", added, err)
+	}
+	if err := m.EarnUncapped(1, Amount{gold, 1000}, "recharge"); err != nil {
+		t.Fatal(err)
+	}
+	if m.Balance(1, gold) != 1100 || len(pool.Table("wallet_log")) != 4 {
+		t.Fatalf("gold %d, logs %d", m.Balance(1, gold), len(pool.Table("wallet_log")))
+	}
+
+	// 第二天重新算
+	now = now.Add(2 * time.Hour)
+	if added, err := m.Earn(1, Amount{gold, 30}, "quest"); added != 30 || err != nil {
+		t.Fatalf("earn next day = %d, %v", added, err)
+	}
+	if w := m.wallets[1]; w.EarnDay != gtime.FormatDate(now) || w.Earned[gold] != 30 {
+		t.Fatalf("earn day %s earned %d", w.EarnDay, w.Earned[gold])
+	}
+}
@@ -0,0 +1,76 @@
+package wg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 取消原因：光一个"context canceled"看不出是谁、为什么取消的，停服日志里一堆这个没法查。
+// go1.18没有context.WithCancelCause，这里自己挂一个原因在ctx的Value上
+
+// CancelReason errors.Is(err, context.Canceled)仍然成立
+type CancelReason struct {
+	By  string // 谁取消的，比如"shutdown"、"dag task load_config"
+	Why string
+	At  time.Time
+}
+
+func (r *CancelReason) Error() string {
+	return fmt.Sprintf("canceled by %s at %s: %s", r.By, r.At.Format("2006-01-02 15:04:05.000"), r.Why)
+}
+
+func (r *CancelReason) Unwrap() error {
+	return context.Canceled
+}
+
+type reasonKey struct{}
+
+type reasonHolder struct {
+	mu     sync.Mutex
+	reason *CancelReason
+	parent *reasonHolder
+}
+
+func (h *reasonHolder) get() *CancelReason {
+	for ; h != nil; h = h.parent {
+		h.mu.Lock()
+		r := h.reason
+		h.mu.Unlock()
+		if r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// WithCancelReason 和context.WithCancel一样，只是cancel时要说明是谁、为什么。多次cancel只记第一次的原因
+func WithCancelReason(parent context.Context) (context.Context, func(by string, why string)) {
+	h := &reasonHolder{}
+	h.parent, _ = parent.Value(reasonKey{}).(*reasonHolder)
+	ctx, cancel := context.WithCancel(context.WithValue(parent, reasonKey{}, h))
+	return ctx, func(by string, why string) {
+		h.mu.Lock()
+		if h.reason == nil {
+			h.reason = &CancelReason{By: by, Why: why, At: time.Now()}
+		}
+		h.mu.Unlock()
+		cancel()
+	}
+}
+
+// Cause ctx没结束返回nil；是被WithCancelReason取消的返回*CancelReason，否则（超时、普通cancel）返回ctx.Err()
+func Cause(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	if ctx.Err() == context.Canceled {
+		if h, ok := ctx.Value(reasonKey{}).(*reasonHolder); ok {
+			if r := h.get(); r != nil {
+				return r
+			}
+		}
+	}
+	return ctx.Err()
+}
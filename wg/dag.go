@@ -0,0 +1,172 @@
+package wg
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// DagTask 有依赖关系的任务，Deps里填依赖的任务名，依赖全部成功后才会开始
+type DagTask struct {
+	Name string
+	Deps []string
+	Fn   func(ctx context.Context) error
+}
+
+type DagResult struct {
+	Durations    map[string]time.Duration // 每个跑过的任务的耗时
+	Skipped      []string                 // 因为依赖失败或者ctx取消没有跑的任务
+	CriticalPath []string                 // 耗时最长的依赖链（从前往后），优化启动/结算耗时先看这条
+	CriticalCost time.Duration
+	CancelCause  error // 有任务被跳过时，跳过的原因（哪个任务失败了，或者外部ctx的取消原因）
+}
+
+// checkDag 检查依赖是否存在、有没有环，返回一个拓扑序
+func checkDag(tasks []*DagTask) ([]*DagTask, error) {
+	byName := make(map[string]*DagTask, len(tasks))
+	for _, t := range tasks {
+		if _, ok := byName[t.Name]; ok {
+			return nil, fmt.Errorf("dag error: duplicated task %s", t.Name)
+		}
+		byName[t.Name] = t
+	}
+	inDegree := make(map[string]int, len(tasks))
+	next := make(map[string][]string)
+	for _, t := range tasks {
+		for _, d := range t.Deps {
+			if _, ok := byName[d]; !ok {
+				return nil, fmt.Errorf("dag error: task %s depends on unknown task %s", t.Name, d)
+			}
+			inDegree[t.Name]++
+			next[d] = append(next[d], t.Name)
+		}
+	}
+	var queue, order []*DagTask
+	for _, t := range tasks {
+		if inDegree[t.Name] == 0 {
+			queue = append(queue, t)
+		}
+	}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		order = append(order, t)
+		for _, n := range next[t.Name] {
+			inDegree[n]--
+			if inDegree[n] == 0 {
+				queue = append(queue, byName[n])
+			}
+		}
+	}
+	if len(order) != len(tasks) {
+		return nil, fmt.Errorf("dag error: dependency cycle detected")
+	}
+	return order, nil
+}
+
+// RunDag 按依赖关系尽可能并行地跑完所有任务（阻塞到全部结束）。
+// 任意任务失败后ctx会被取消（原因记为"dag task 任务名"），依赖它的任务不再执行，返回第一个错误；DagResult无论成败都会返回。
+// 任务里拿到ctx.Done()时用Cause(ctx)看是谁取消的
+func (m *Mgr) RunDag(ctx context.Context, tasks []*DagTask) (*DagResult, error) {
+	order, err := checkDag(tasks)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := WithCancelReason(ctx)
+	defer cancel("dag", "finished")
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		ok       = make(map[string]bool, len(tasks))
+		done     = make(map[string]chan struct{}, len(tasks))
+		res      = &DagResult{Durations: make(map[string]time.Duration, len(tasks))}
+		w        sync.WaitGroup
+	)
+	for _, t := range tasks {
+		done[t.Name] = make(chan struct{})
+	}
+	for _, t := range order {
+		w.Add(1)
+		go func(t *DagTask) {
+			defer w.Done()
+			defer close(done[t.Name])
+			for _, d := range t.Deps {
+				<-done[d]
+			}
+			mu.Lock()
+			runnable := ctx.Err() == nil
+			for _, d := range t.Deps {
+				runnable = runnable && ok[d]
+			}
+			if !runnable {
+				res.Skipped = append(res.Skipped, t.Name)
+				if res.CancelCause == nil {
+					res.CancelCause = Cause(ctx)
+				}
+				mu.Unlock()
+				return
+			}
+			mu.Unlock()
+
+			realFcId := m.fcId.Add(1)
+			start := time.Now()
+			done := trackTask(t.Name)
+			err := t.Fn(ctx)
+			done()
+			cost := time.Since(start)
+			if err == context.Canceled {
+				// 任务只是因为ctx取消才退出的，换成带原因的错误
+				if cause := Cause(ctx); cause != nil {
+					err = cause
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			res.Durations[t.Name] = cost
+			if err != nil {
+				log.Printf("fcId %d dag task %s failed: %s", realFcId, t.Name, err.Error())
+				if firstErr == nil {
+					firstErr = fmt.Errorf("dag task %s: %w", t.Name, err)
+					cancel("dag task "+t.Name, err.Error())
+				}
+				return
+			}
+			ok[t.Name] = true
+		}(t)
+	}
+	w.Wait()
+	res.CriticalPath, res.CriticalCost = criticalPath(order, res.Durations)
+	return res, firstErr
+}
+
+// criticalPath order是拓扑序，没跑的任务耗时按0算
+func criticalPath(order []*DagTask, durations map[string]time.Duration) ([]string, time.Duration) {
+	dist := make(map[string]time.Duration, len(order))
+	prev := make(map[string]string, len(order))
+	var last string
+	for _, t := range order {
+		var best time.Duration
+		for _, d := range t.Deps {
+			if _, has := prev[t.Name]; !has || dist[d] > best {
+				best = dist[d]
+				prev[t.Name] = d
+			}
+		}
+		dist[t.Name] = best + durations[t.Name]
+		if last == "" || dist[t.Name] > dist[last] {
+			last = t.Name
+		}
+	}
+	if last == "" {
+		return nil, 0
+	}
+	path := []string{last}
+	for n, has := prev[last]; has; n, has = prev[n] {
+		path = append([]string{n}, path...)
+	}
+	return path, dist[last]
+}
@@ -0,0 +1,93 @@
+package wg
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func noopTask(name string, deps ...string) *DagTask {
+	return &DagTask{Name: name, Deps: deps, Fn: func(context.Context) error { return nil }}
+}
+
+func TestDagCheck(t *testing.T) {
+	m := &Mgr{}
+	cases := []struct {
+		tasks []*DagTask
+		want  string
+	}{
+		{[]*DagTask{noopTask("a", "c"), noopTask("b", "a"), noopTask("c", "b")}, "cycle"},
+		{[]*DagTask{noopTask("a"), noopTask("b", "x")}, "unknown task x"},
+		{[]*DagTask{noopTask("a"), noopTask("a")}, "duplicated task a"},
+	}
+	for _, c := range cases {
+		res, err := m.RunDag(context.Background(), c.tasks)
+		if err == nil || !strings.Contains(err.Error(), c.want) || res != nil {
+			t.Fatalf("want %q, got %v", c.want, err)
+		}
+	}
+}
+
+func TestDagFailure(t *testing.T) {
+	boom := errors.New("boom")
+	var ran []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error { ran = append(ran, name); return nil }
+	}
+	// 一条链，前一个跑完后一个才开始，ran不用加锁
+	tasks := []*DagTask{
+		{Name: "load", Fn: record("load")},
+		{Name: "parse", Deps: []string{"load"}, Fn: func(context.Context) error { ran = append(ran, "parse"); return boom }},
+		{Name: "index", Deps: []string{"parse"}, Fn: record("index")},
+		{Name: "warm", Deps: []string{"index"}, Fn: record("warm")},
+	}
+	res, err := (&Mgr{}).RunDag(context.Background(), tasks)
+	if !errors.Is(err, boom) || !strings.Contains(err.Error(), "dag task parse") {
+		t.Fatalf("err = %v", err)
+	}
+	if !reflect.DeepEqual(ran, []string{"load", "parse"}) {
+		t.Fatalf("ran %v", ran)
+	}
+	sort.Strings(res.Skipped)
+	if !reflect.DeepEqual(res.Skipped, []string{"index", "warm"}) {
+		t.Fatalf("skipped %v", res.Skipped)
+	}
+	var reason *CancelReason
+	if !errors.As(res.CancelCause, &reason) || reason.By != "dag task parse" || reason.Why != "boom" {
+		t.Fatalf("cancel cause %v", res.CancelCause)
+	}
+	if _, ok := res.Durations["index"]; ok || len(res.Durations) != 2 {
+		t.Fatalf("durations %v", res.Durations)
+	}
+}
+
+func TestDagCriticalPath(t *testing.T) {
+	tasks := []*DagTask{noopTask("a"), noopTask("b", "a"), noopTask("c", "a"), noopTask("d", "b", "c")}
+	order, err := checkDag(tasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := time.Millisecond
+	path, cost := criticalPath(order, map[string]time.Duration{"a": 10 * ms, "b": 5 * ms, "c": 20 * ms, "d": ms})
+	if !reflect.DeepEqual(path, []string{"a", "c", "d"}) || cost != 31*ms {
+		t.Fatalf("critical path %v cost %v", path, cost)
+	}
+	path, cost = criticalPath(order, map[string]time.Duration{"a": 10 * ms, "b": 30 * ms, "c": 20 * ms, "d": ms})
+	if !reflect.DeepEqual(path, []string{"a", "b", "d"}) || cost != 41*ms {
+		t.Fatalf("critical path %v cost %v", path, cost)
+	}
+
+	// RunDag跑菱形图，慢的那条边是关键路径
+	tasks[2].Fn = func(ctx context.Context) error { return SleepCtx(ctx, 30*ms) }
+	res, err := (&Mgr{}).RunDag(context.Background(), tasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.CriticalPath, []string{"a", "c", "d"}) || res.CriticalCost < 30*ms || len(res.Skipped) != 0 {
+		t.Fatalf("result %+v", res)
+	}
+}
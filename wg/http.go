@@ -0,0 +1,224 @@
+package wg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"test/metrics"
+	"time"
+)
+
+// 异步http请求：主循环里不能直接http.Get（对方卡几秒整个服就卡几秒），用HTTPDo丢到单独的goroutine里发，
+// 每次尝试有自己的超时，网络错误/5xx/429按指数退避重试，最后把结果交给回调。
+// 回调默认在主循环里执行（main启动时SetLoopPoster注入投递函数），回调里可以直接改玩家数据，不用加锁；没注入时在请求goroutine里执行。
+// 停服（ShutdownCtx取消）时正在等的请求和退避会立刻结束，回调拿到的是取消原因
+
+var ErrHTTPStatus = errors.New("http bad status")
+
+const (
+	defaultHTTPTimeout = 5 * time.Second
+	defaultHTTPBackoff = 200 * time.Millisecond
+	maxHTTPBackoff     = 5 * time.Second
+	maxHTTPBody        = 16 << 20 // 响应体最多读16MB
+)
+
+var httpClient = &http.Client{}
+
+var loopPoster func(f func()) bool
+
+// SetLoopPoster 设置把回调投递到主循环的函数，投递失败（主循环已经退出）返回false，这时回调不会执行
+func SetLoopPoster(post func(f func()) bool) {
+	loopPoster = post
+}
+
+type HTTPRequest struct {
+	Name     string // 指标和日志用，耗时记在wg.task.http.<Name>，不填记在wg.task.http
+	Method   string // 不填是GET
+	URL      string
+	Header   map[string]string
+	Body     []byte
+	Timeout  time.Duration // 每次尝试的超时，不填5秒
+	Retries  int           // 失败后最多再试几次，POST不是幂等的话别填
+	Deadline time.Duration // 整个请求（包括重试和退避）的总时限，不填不限
+	Backoff  time.Duration // 第一次重试前等多久，之后翻倍（最多5秒），不填200ms
+}
+
+type HTTPResponse struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	Attempts int           // 一共发了几次
+	Cost     time.Duration // 包括重试和退避的总耗时
+}
+
+// retryable 网络错误、5xx、429可以重试，其他4xx重试也没用
+func retryable(status int, err error) bool {
+	if status == 0 {
+		return err != nil
+	}
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// HTTPDo 异步发请求，cb在主循环里执行。状态码不是2xx时err是ErrHTTPStatus，resp照样带着Body（对方的错误信息）
+func HTTPDo(req *HTTPRequest, cb func(*HTTPResponse, error)) {
+	goHTTP(req, func(resp *HTTPResponse, err error) func() {
+		if cb == nil {
+			return nil
+		}
+		return func() { cb(resp, err) }
+	})
+}
+
+// goHTTP prepare在请求goroutine里处理结果（解析之类的），返回的函数投递到主循环执行
+func goHTTP(req *HTTPRequest, prepare func(*HTTPResponse, error) func()) {
+	name := "http"
+	if req.Name != "" {
+		name = "http." + req.Name
+	}
+	go func() {
+		defer trackTask(name)()
+		resp, err := doWithRetry(ShutdownCtx(), req)
+		if err != nil {
+			metrics.GetCounter("wg.http.error").Inc()
+			log.Printf("http %s %s failed after %d attempts: %s", req.method(), req.URL, resp.Attempts, err.Error())
+		}
+		f := prepare(resp, err)
+		if f == nil {
+			return
+		}
+		if loopPoster == nil {
+			f()
+			return
+		}
+		if !loopPoster(f) {
+			log.Printf("http %s %s: main loop gone, callback dropped", req.method(), req.URL)
+		}
+	}()
+}
+
+func (req *HTTPRequest) method() string {
+	if req.Method == "" {
+		return http.MethodGet
+	}
+	return req.Method
+}
+
+func doWithRetry(ctx context.Context, req *HTTPRequest) (*HTTPResponse, error) {
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	backoff := req.Backoff
+	if backoff <= 0 {
+		backoff = defaultHTTPBackoff
+	}
+	if req.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Deadline)
+		defer cancel()
+	}
+	start := time.Now()
+	resp := &HTTPResponse{}
+	var err error
+	for {
+		resp.Attempts++
+		err = doOnce(ctx, req, timeout, resp)
+		if err == nil || resp.Attempts > req.Retries || !retryable(resp.Status, err) || ctx.Err() != nil {
+			break
+		}
+		metrics.GetCounter("wg.http.retry").Inc()
+		if e := SleepCtx(ctx, backoff); e != nil {
+			err = e
+			break
+		}
+		if backoff *= 2; backoff > maxHTTPBackoff {
+			backoff = maxHTTPBackoff
+		}
+	}
+	resp.Cost = time.Since(start)
+	return resp, err
+}
+
+func doOnce(ctx context.Context, req *HTTPRequest, timeout time.Duration, resp *HTTPResponse) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var body io.Reader
+	if req.Body != nil {
+		body = bytes.NewReader(req.Body)
+	}
+	hr, err := http.NewRequestWithContext(ctx, req.method(), req.URL, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range req.Header {
+		hr.Header.Set(k, v)
+	}
+	resp.Status, resp.Header, resp.Body = 0, nil, nil
+	r, err := httpClient.Do(hr)
+	if err != nil {
+		if c := Cause(ctx); c != nil && !errors.Is(c, context.DeadlineExceeded) {
+			return c
+		}
+		return err
+	}
+	defer r.Body.Close()
+	resp.Status = r.StatusCode
+	resp.Header = r.Header
+	if resp.Body, err = io.ReadAll(io.LimitReader(r.Body, maxHTTPBody)); err != nil {
+		return err
+	}
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return fmt.Errorf("%w %d: %s", ErrHTTPStatus, r.StatusCode, truncate(resp.Body, 200))
+	}
+	return nil
+}
+
+func truncate(b []byte, n int) string {
+	if len(b) > n {
+		return string(b[:n]) + "..."
+	}
+	return string(b)
+}
+
+// HTTPGet 简单GET，默认超时，不重试
+func HTTPGet(url string, cb func(*HTTPResponse, error)) {
+	HTTPDo(&HTTPRequest{URL: url}, cb)
+}
+
+// HTTPPostJSON body序列化成json发POST
+func HTTPPostJSON(req *HTTPRequest, body any, cb func(*HTTPResponse, error)) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		if cb != nil {
+			cb(&HTTPResponse{}, err)
+		}
+		return
+	}
+	r := *req
+	r.Method = http.MethodPost
+	r.Body = b
+	r.Header = map[string]string{"Content-Type": "application/json"}
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	HTTPDo(&r, cb)
+}
+
+// HTTPJSON 发请求并把响应体按json解析成T再交给回调，解析在请求goroutine里做，不占主循环。请求失败或者解析失败时v为nil
+func HTTPJSON[T any](req *HTTPRequest, cb func(v *T, resp *HTTPResponse, err error)) {
+	goHTTP(req, func(resp *HTTPResponse, err error) func() {
+		var v *T
+		if err == nil {
+			v = new(T)
+			if e := json.Unmarshal(resp.Body, v); e != nil {
+				v, err = nil, fmt.Errorf("decode %s response: %w", req.URL, e)
+			}
+		}
+		return func() { cb(v, resp, err) }
+	})
+}
@@ -0,0 +1,185 @@
+package wg
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// 按实体加锁和带权重的信号量。
+// 同一个玩家的数据可能被db回调、timer触发器、消息处理从不同goroutine同时改，KeyedMutex按玩家id串行，不同玩家互不影响，
+// 没人持有也没人等的key会立刻从map里删掉，不会随玩家数涨内存。
+// Semaphore限制总量（比如同时最多占用64MB的导出缓冲、同时最多8个重查询），每次可以拿不同的份数，先来先得，大的请求不会被小的一直插队饿死
+
+// KeyedMutex 零值可用，不能复制
+type KeyedMutex[K comparable] struct {
+	mu    sync.Mutex
+	locks map[K]*keyedEntry
+}
+
+type keyedEntry struct {
+	m    sync.Mutex
+	refs int // 持有的加上在等的
+}
+
+func (km *KeyedMutex[K]) Lock(k K) {
+	km.mu.Lock()
+	if km.locks == nil {
+		km.locks = make(map[K]*keyedEntry)
+	}
+	e, ok := km.locks[k]
+	if !ok {
+		e = &keyedEntry{}
+		km.locks[k] = e
+	}
+	e.refs++
+	km.mu.Unlock()
+	e.m.Lock()
+}
+
+// TryLock k没人持有时加锁返回true，否则立刻返回false
+func (km *KeyedMutex[K]) TryLock(k K) bool {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	if _, ok := km.locks[k]; ok {
+		return false
+	}
+	if km.locks == nil {
+		km.locks = make(map[K]*keyedEntry)
+	}
+	e := &keyedEntry{refs: 1}
+	e.m.Lock()
+	km.locks[k] = e
+	return true
+}
+
+// Unlock 没Lock过的key会panic，和sync.Mutex一样
+func (km *KeyedMutex[K]) Unlock(k K) {
+	km.mu.Lock()
+	e, ok := km.locks[k]
+	if !ok {
+		km.mu.Unlock()
+		panic(fmt.Sprintf("wg: unlock of unlocked key %v", k))
+	}
+	e.refs--
+	if e.refs == 0 {
+		delete(km.locks, k)
+	}
+	km.mu.Unlock()
+	e.m.Unlock()
+}
+
+// Do 持有k的锁执行f
+func (km *KeyedMutex[K]) Do(k K, f func()) {
+	km.Lock(k)
+	defer km.Unlock(k)
+	f()
+}
+
+// Len 当前有人持有或者在等的key数
+func (km *KeyedMutex[K]) Len() int {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	return len(km.locks)
+}
+
+// Semaphore 带权重的信号量，用NewSemaphore建
+type Semaphore struct {
+	size    int64
+	cur     int64
+	mu      sync.Mutex
+	waiters list.List // *semWaiter，先来先得
+}
+
+type semWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+func NewSemaphore(size int64) *Semaphore {
+	return &Semaphore{size: size}
+}
+
+// Acquire 拿n份，不够时排队等到够了或者ctx结束（返回Cause(ctx)，什么都没拿到）。n超过总量直接报错
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	if n > s.size {
+		return fmt.Errorf("wg: semaphore acquire %d exceeds size %d", n, s.size)
+	}
+	s.mu.Lock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		return nil
+	}
+	w := &semWaiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-w.ready:
+			// 取消的同时刚好拿到了，就当没取消
+			return nil
+		default:
+		}
+		front := s.waiters.Front() == elem
+		s.waiters.Remove(elem)
+		if front {
+			// 排在最前面的走了，后面小的请求可能已经够了
+			s.notify()
+		}
+		return Cause(ctx)
+	}
+}
+
+// TryAcquire 够n份就拿走返回true，不够（或者有人在排队）立刻返回false
+func (s *Semaphore) TryAcquire(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		return true
+	}
+	return false
+}
+
+// Release 还回n份，还的比拿的多会panic
+func (s *Semaphore) Release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cur -= n
+	if s.cur < 0 {
+		panic("wg: semaphore released more than held")
+	}
+	s.notify()
+}
+
+// notify 按顺序唤醒够份数的等待者，队首不够时后面的也不唤醒
+func (s *Semaphore) notify() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+		w := front.Value.(*semWaiter)
+		if s.size-s.cur < w.n {
+			return
+		}
+		s.cur += w.n
+		s.waiters.Remove(front)
+		close(w.ready)
+	}
+}
+
+// InUse 当前被拿走的份数和在排队的请求数
+func (s *Semaphore) InUse() (held int64, waiting int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cur, s.waiters.Len()
+}
@@ -0,0 +1,145 @@
+package wg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor 等cond成立，最多等1秒
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKeyedMutex(t *testing.T) {
+	var km KeyedMutex[int]
+	counts := make([]int, 4)
+	var w sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		w.Add(1)
+		go func(k int) {
+			defer w.Done()
+			km.Do(k, func() { counts[k]++ })
+		}(i % 4)
+	}
+	w.Wait()
+	for k, n := range counts {
+		if n != 50 {
+			t.Fatalf("key %d count %d", k, n)
+		}
+	}
+	if km.Len() != 0 {
+		t.Fatalf("len after all unlocked = %d", km.Len())
+	}
+
+	km.Lock(1)
+	if km.TryLock(1) {
+		t.Fatal("TryLock succeeded on held key")
+	}
+	if !km.TryLock(2) {
+		t.Fatal("TryLock failed on free key")
+	}
+	km.Unlock(2)
+	// 有人在等时持有者解锁，key留给等待者，等待者解锁后才删
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		km.Lock(1)
+		close(locked)
+		<-release
+		km.Unlock(1)
+	}()
+	waitFor(t, "waiter queued", func() bool {
+		km.mu.Lock()
+		defer km.mu.Unlock()
+		return km.locks[1].refs == 2
+	})
+	km.Unlock(1)
+	<-locked
+	if km.Len() != 1 || km.TryLock(1) {
+		t.Fatalf("key dropped while waiter holds it, len %d", km.Len())
+	}
+	close(release)
+	waitFor(t, "key removed", func() bool { return km.Len() == 0 })
+}
+
+func TestSemaphoreFIFO(t *testing.T) {
+	s := NewSemaphore(10)
+	ctx := context.Background()
+	if err := s.Acquire(ctx, 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Acquire(ctx, 11); err == nil {
+		t.Fatal("acquire over size accepted")
+	}
+	acquire := func(n int64) chan error {
+		ch := make(chan error, 1)
+		go func() { ch <- s.Acquire(ctx, n) }()
+		return ch
+	}
+	big := acquire(10)
+	waitFor(t, "big waiting", func() bool { _, n := s.InUse(); return n == 1 })
+	// 剩4份够小请求，但大请求在排队，小的不能插队
+	if s.TryAcquire(1) {
+		t.Fatal("TryAcquire jumped the queue")
+	}
+	small := acquire(2)
+	waitFor(t, "small waiting", func() bool { _, n := s.InUse(); return n == 2 })
+
+	s.Release(6)
+	if err := <-big; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-small:
+		t.Fatal("small acquired while big holds everything")
+	case <-time.After(10 * time.Millisecond):
+	}
+	s.Release(10)
+	if err := <-small; err != nil {
+		t.Fatal(err)
+	}
+	if held, waiting := s.InUse(); held != 2 || waiting != 0 {
+		t.Fatalf("in use %d, waiting %d", held, waiting)
+	}
+}
+
+func TestSemaphoreCancel(t *testing.T) {
+	s := NewSemaphore(10)
+	s.Acquire(context.Background(), 8)
+	ctx, cancel := WithCancelReason(context.Background())
+	big := make(chan error, 1)
+	go func() { big <- s.Acquire(ctx, 5) }()
+	waitFor(t, "big waiting", func() bool { _, n := s.InUse(); return n == 1 })
+	small := make(chan error, 1)
+	go func() { small <- s.Acquire(context.Background(), 2) }()
+	waitFor(t, "small waiting", func() bool { _, n := s.InUse(); return n == 2 })
+
+	// 队首取消后，后面够份数的要被唤醒
+	cancel("test", "give up")
+	err := <-big
+	var reason *CancelReason
+	if !errors.As(err, &reason) || reason.By != "test" || !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled acquire err = %v", err)
+	}
+	select {
+	case err = <-small:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter behind canceled front not woken")
+	}
+	if held, waiting := s.InUse(); held != 10 || waiting != 0 {
+		t.Fatalf("in use %d, waiting %d", held, waiting)
+	}
+}
@@ -0,0 +1,73 @@
+package wg
+
+import (
+	"sync"
+	"test/metrics"
+)
+
+// Map 把items分给最多limit个goroutine并发跑f，结果按items的原顺序返回。
+// 任意一个f返回错误后，还没开始的item不会再跑（已经在跑的跑完为止），返回第一个错误，此时结果切片不完整不要用
+// limit<=0时不限制（每个item一个goroutine）
+func Map[T any, R any](items []T, f func(T) (R, error), limit int) ([]R, error) {
+	return MapNamed("map", items, f, limit)
+}
+
+// MapNamed 和Map一样，name用于指标：wg.queue.<name>是还没派发的item数，wg.task.<name>是每个item的耗时
+func MapNamed[T any, R any](name string, items []T, f func(T) (R, error), limit int) ([]R, error) {
+	if limit <= 0 || limit > len(items) {
+		limit = len(items)
+	}
+	results := make([]R, len(items))
+	var (
+		w        sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		stop     = make(chan struct{})
+		jobs     = make(chan int)
+		queue    = metrics.GetGauge("wg.queue." + name)
+	)
+	queue.Add(int64(len(items)))
+	dispatched := 0
+	for i := 0; i < limit; i++ {
+		w.Add(1)
+		go func() {
+			defer w.Done()
+			for idx := range jobs {
+				select {
+				case <-stop:
+					// 出错和派发同时发生时可能多派出去一个，不跑
+					continue
+				default:
+				}
+				done := trackTask(name)
+				r, err := f(items[idx])
+				done()
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						close(stop)
+					})
+					continue
+				}
+				results[idx] = r
+			}
+		}()
+	}
+dispatch:
+	for i := range items {
+		select {
+		case <-stop:
+			break dispatch
+		case jobs <- i:
+			dispatched++
+			queue.Add(-1)
+		}
+	}
+	close(jobs)
+	queue.Add(-int64(len(items) - dispatched)) // 出错后没派发的
+	w.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
@@ -0,0 +1,83 @@
+package wg
+
+import (
+	"errors"
+	"sync/atomic"
+	"test/metrics"
+	"testing"
+	"time"
+)
+
+func TestMapOrder(t *testing.T) {
+	items := []int{5, 1, 4, 2, 3, 0, 6, 7}
+	var running, peak atomic.Int32
+	got, err := MapNamed("test_map_order", items, func(v int) (int, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		// 后面的item先跑完，结果还是按原顺序放
+		time.Sleep(time.Duration(8-v) * time.Millisecond)
+		return v * 10, nil
+	}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range items {
+		if got[i] != v*10 {
+			t.Fatalf("results %v", got)
+		}
+	}
+	if peak.Load() > 3 {
+		t.Fatalf("ran %d at once, limit 3", peak.Load())
+	}
+	if q := metrics.GetGauge("wg.queue.test_map_order").Value(); q != 0 {
+		t.Fatalf("queue gauge %d", q)
+	}
+}
+
+func TestMapStopOnError(t *testing.T) {
+	boom := errors.New("boom")
+	var called []int
+	got, err := MapNamed("test_map_err", []int{0, 1, 2, 3, 4, 5}, func(v int) (int, error) {
+		called = append(called, v) // limit 1，只有一个goroutine在跑
+		if v == 2 {
+			return 0, boom
+		}
+		return v, nil
+	}, 1)
+	if !errors.Is(err, boom) || got != nil {
+		t.Fatalf("map = %v, %v", got, err)
+	}
+	if len(called) != 3 {
+		t.Fatalf("items dispatched after the error: %v", called)
+	}
+	if q := metrics.GetGauge("wg.queue.test_map_err").Value(); q != 0 {
+		t.Fatalf("queue gauge %d", q)
+	}
+}
+
+func TestMapUnlimitedAndEmpty(t *testing.T) {
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	go func() {
+		// limit<=0时5个item同时在跑
+		waitFor(t, "all items running", func() bool { return peak.Load() == 5 })
+		close(release)
+	}()
+	got, err := Map([]int{1, 2, 3, 4, 5}, func(v int) (int, error) {
+		n := running.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		<-release
+		return -v, nil
+	}, 0)
+	if err != nil || len(got) != 5 || got[0] != -1 || got[4] != -5 {
+		t.Fatalf("unlimited = %v, %v", got, err)
+	}
+
+	got, err = Map(nil, func(v int) (int, error) { t.Fatal("called on empty input"); return 0, nil }, 4)
+	if err != nil || len(got) != 0 {
+		t.Fatalf("empty = %v, %v", got, err)
+	}
+}
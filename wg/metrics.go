@@ -0,0 +1,23 @@
+package wg
+
+import (
+	"test/metrics"
+	"time"
+)
+
+// 并发指标，看板上调并发上限用：
+// wg.running             当前在跑的任务数（Mgr.Add、RunDag、Map都算）
+// wg.queue.<名字>         Map有并发上限时，还没派发出去的item数
+// wg.task.<名字>          每个任务的耗时，名字是AddNamed/DagTask.Name/MapNamed传的名字
+
+var runningGauge = metrics.GetGauge("wg.running")
+
+// trackTask 任务开始时调用，返回的函数在任务结束时调用
+func trackTask(name string) func() {
+	runningGauge.Add(1)
+	start := time.Now()
+	return func() {
+		runningGauge.Add(-1)
+		metrics.GetHistogram("wg.task." + name).Observe(time.Since(start))
+	}
+}
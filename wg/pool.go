@@ -0,0 +1,182 @@
+package wg
+
+import (
+	"errors"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"test/metrics"
+)
+
+// 固定大小的CPU密集型任务池：结算算分、压缩这种纯计算的活丢这里，不要和等网络/等db的任务挤在Mgr里。
+// 每个worker一条自己的队列，Submit轮流分配；自己的队列空了就去别的worker那里偷一半过来，
+// 某个worker被一个大任务卡住时，排在它后面的任务会被空闲的worker拿走
+// 指标：wg.task.<名字>（每个任务的耗时）、wg.pool.<名字>.stolen（被偷的任务数）
+
+var ErrPoolClosed = errors.New("worker pool closed")
+
+type poolWorker struct {
+	m     sync.Mutex
+	queue []func()
+	done  atomic.Int64
+}
+
+// pop 自己从队头取
+func (w *poolWorker) pop() func() {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if len(w.queue) == 0 {
+		return nil
+	}
+	f := w.queue[0]
+	w.queue[0] = nil
+	w.queue = w.queue[1:]
+	return f
+}
+
+// stealHalf 从队尾拿走一半（至少1个）
+func (w *poolWorker) stealHalf() []func() {
+	w.m.Lock()
+	defer w.m.Unlock()
+	n := len(w.queue)
+	if n == 0 {
+		return nil
+	}
+	k := (n + 1) / 2
+	stolen := append([]func(){}, w.queue[n-k:]...)
+	for i := n - k; i < n; i++ {
+		w.queue[i] = nil
+	}
+	w.queue = w.queue[:n-k]
+	return stolen
+}
+
+type Pool struct {
+	name    string
+	workers []*poolWorker
+	next    atomic.Uint32
+	pending atomic.Int64 // 所有队列里还没开始执行的任务数
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	closed bool
+	wait   sync.WaitGroup
+	stolen *metrics.Counter
+}
+
+// NewPool n<=0时按CPU核数，name用在指标里
+func NewPool(name string, n int) *Pool {
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	p := &Pool{name: name, stolen: metrics.GetCounter("wg.pool." + name + ".stolen")}
+	p.cond = sync.NewCond(&p.mu)
+	for i := 0; i < n; i++ {
+		p.workers = append(p.workers, &poolWorker{})
+	}
+	p.wait.Add(n)
+	for i := range p.workers {
+		go p.run(i)
+	}
+	return p
+}
+
+// Submit 不阻塞，Close之后返回ErrPoolClosed。f里panic会被recover并打日志，不影响worker
+func (p *Pool) Submit(f func()) error {
+	// 全程持有p.mu，不会和Close交错（Close之后worker按pending判断退出，不能漏掉正在提交的任务）
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	w := p.workers[int(p.next.Add(1))%len(p.workers)]
+	w.m.Lock()
+	w.queue = append(w.queue, f)
+	w.m.Unlock()
+	p.pending.Add(1)
+	p.cond.Signal()
+	return nil
+}
+
+// Close 不再接新任务，等已经提交的全部执行完再返回
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.wait.Wait()
+}
+
+func (p *Pool) run(i int) {
+	defer p.wait.Done()
+	self := p.workers[i]
+	for {
+		f := self.pop()
+		if f == nil {
+			f = p.steal(i)
+		}
+		if f != nil {
+			p.pending.Add(-1)
+			p.exec(self, f)
+			continue
+		}
+		p.mu.Lock()
+		for p.pending.Load() == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		exit := p.closed && p.pending.Load() == 0
+		p.mu.Unlock()
+		if exit {
+			return
+		}
+	}
+}
+
+// steal 从别的worker偷一半，第一个自己执行，剩下的放进自己的队列
+func (p *Pool) steal(i int) func() {
+	n := len(p.workers)
+	for k := 1; k < n; k++ {
+		stolen := p.workers[(i+k)%n].stealHalf()
+		if len(stolen) == 0 {
+			continue
+		}
+		p.stolen.Add(int64(len(stolen)))
+		if len(stolen) > 1 {
+			self := p.workers[i]
+			self.m.Lock()
+			self.queue = append(self.queue, stolen[1:]...)
+			self.m.Unlock()
+		}
+		return stolen[0]
+	}
+	return nil
+}
+
+func (p *Pool) exec(w *poolWorker, f func()) {
+	defer w.done.Add(1)
+	defer trackTask(p.name)()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("wg pool %s task panic: %v\n%s", p.name, r, debug.Stack())
+		}
+	}()
+	f()
+}
+
+type PoolWorkerStat struct {
+	Queued int
+	Done   int64
+}
+
+// Stats 每个worker的排队数和执行完的任务数
+func (p *Pool) Stats() []PoolWorkerStat {
+	ret := make([]PoolWorkerStat, len(p.workers))
+	for i, w := range p.workers {
+		w.m.Lock()
+		ret[i] = PoolWorkerStat{Queued: len(w.queue), Done: w.done.Load()}
+		w.m.Unlock()
+	}
+	return ret
+}
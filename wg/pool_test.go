@@ -0,0 +1,80 @@
+package wg
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolCloseDrains(t *testing.T) {
+	p := NewPool("test_drain", 3)
+	var n atomic.Int64
+	for i := 0; i < 100; i++ {
+		if err := p.Submit(func() {
+			time.Sleep(100 * time.Microsecond)
+			n.Add(1)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Close()
+	if n.Load() != 100 {
+		t.Fatalf("ran %d tasks before Close returned", n.Load())
+	}
+	if err := p.Submit(func() {}); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("submit after close err = %v", err)
+	}
+	var done int64
+	for _, st := range p.Stats() {
+		done += st.Done
+	}
+	if done != 100 {
+		t.Fatalf("stats done %d", done)
+	}
+}
+
+func TestPoolSteal(t *testing.T) {
+	p := NewPool("test_steal", 2)
+	defer p.Close()
+	stolen := p.stolen.Value() // 指标按名字全局共用，-count多跑时要减掉之前的
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	p.Submit(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	// 一半排在卡住的worker后面，只能被另一个偷走执行
+	var n atomic.Int64
+	for i := 0; i < 20; i++ {
+		p.Submit(func() { n.Add(1) })
+	}
+	waitFor(t, "tasks behind blocked worker", func() bool { return n.Load() == 20 })
+	if p.stolen.Value() == stolen {
+		t.Fatal("nothing stolen")
+	}
+	var queued int
+	for _, st := range p.Stats() {
+		queued += st.Queued
+	}
+	if queued != 0 {
+		t.Fatalf("queued %d", queued)
+	}
+}
+
+func TestPoolPanic(t *testing.T) {
+	p := NewPool("test_panic", 1)
+	ran := make(chan struct{})
+	p.Submit(func() { panic("boom") })
+	p.Submit(func() { close(ran) })
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("worker died after panic")
+	}
+	p.Close()
+	if st := p.Stats(); st[0].Done != 2 {
+		t.Fatalf("done %d", st[0].Done)
+	}
+}
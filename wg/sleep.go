@@ -0,0 +1,46 @@
+package wg
+
+import (
+	"context"
+	"time"
+)
+
+// 能被停服打断的sleep/等待：time.Sleep(5 * time.Second)这种写法在停服时会把退出拖住5秒，
+// 后台goroutine里的长等待都改用下面的函数，ctx没有现成的就用ShutdownCtx()
+
+var shutdownCtx, shutdownCancel = WithCancelReason(context.Background())
+
+// ShutdownCtx 进程级的ctx，main收到退出信号时Shutdown取消它。Mgr.Add出去的任务也挂在它下面
+func ShutdownCtx() context.Context {
+	return shutdownCtx
+}
+
+// Shutdown main里收到退出信号时调，多次调用只记第一次的原因
+func Shutdown(by string, why string) {
+	shutdownCancel(by, why)
+}
+
+// SleepCtx 睡d或者直到ctx结束，正常睡满返回nil，被打断返回Cause(ctx)
+func SleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return Cause(ctx)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return Cause(ctx)
+	}
+}
+
+// WaitChanCtx 等ch出一个值或者ctx结束。ok为false表示ch被关了；ctx先结束时返回Cause(ctx)
+func WaitChanCtx[T any](ctx context.Context, ch <-chan T) (v T, ok bool, err error) {
+	select {
+	case v, ok = <-ch:
+		return v, ok, nil
+	case <-ctx.Done():
+		return v, false, Cause(ctx)
+	}
+}
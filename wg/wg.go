@@ -11,18 +11,41 @@ import (
 type Mgr struct {
 	fcId atomic.Uint32
 	w    sync.WaitGroup
+
+	once   sync.Once
+	ctx    context.Context // Add出去的任务都挂在这个ctx下面，Cancel或者停服（Shutdown）时一起取消
+	cancel func(by string, why string)
+}
+
+func (m *Mgr) init() {
+	m.once.Do(func() {
+		m.ctx, m.cancel = WithCancelReason(ShutdownCtx())
+	})
+}
+
+// Cancel 取消所有还没结束的任务，by/why会出现在每个任务的失败日志里
+func (m *Mgr) Cancel(by string, why string) {
+	m.init()
+	m.cancel(by, why)
 }
 
 func (m *Mgr) Add(f func() <-chan struct{}, timeLimit time.Duration) {
+	m.AddNamed("mgr", f, timeLimit)
+}
+
+// AddNamed 和Add一样，name用于耗时指标wg.task.<name>
+func (m *Mgr) AddNamed(name string, f func() <-chan struct{}, timeLimit time.Duration) {
+	m.init()
 	m.w.Add(1)
 	go func() {
 		defer m.w.Done()
-		ctx, cf := context.WithTimeout(context.Background(), timeLimit)
+		defer trackTask(name)()
+		ctx, cf := context.WithTimeout(m.ctx, timeLimit)
 		defer cf()
 		realFcId := m.fcId.Add(1)
 		select {
 		case <-ctx.Done():
-			log.Printf("fcId %d not ok, reason: %s\n", realFcId, ctx.Err().Error())
+			log.Printf("fcId %d not ok, reason: %s\n", realFcId, Cause(ctx).Error())
 		case <-f(): // 这个写法有点问题 f阻塞5秒之后还能报ok
 			log.Printf("fcId %d ok\n", realFcId)
 		}
@@ -47,7 +70,10 @@ func TestFunc() {
 	//	panic(err)
 	//}
 	//log.Println(string(b[:n]))
-	time.Sleep(5 * time.Second)
+	if err := SleepCtx(ShutdownCtx(), 5*time.Second); err != nil {
+		log.Printf("TestFunc interrupted: %s", err.Error())
+		return
+	}
 	log.Println("TestFunc finished in sleep 5 seconds")
 }
 